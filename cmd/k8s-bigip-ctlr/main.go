@@ -28,6 +28,7 @@ import (
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/health"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/pollers"
 	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tokenmanager"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/vxlan"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -41,6 +42,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -102,6 +104,9 @@ const (
 	versionPathk8s         = "/version"
 )
 
+// credentialsPollInterval is the interval at which the credentials directory is checked for rotated credentials
+const credentialsPollInterval = 30 * time.Second
+
 var (
 	// To be set by build
 	version   string
@@ -120,6 +125,26 @@ var (
 	customResourceMode *bool
 	defaultRouteDomain *int
 
+	// Leader Election
+	enableLeaderElection   *bool
+	leaderElectionLease    *string
+	leaderElectionNS       *string
+	leaderElectionDuration *int
+	leaderElectionRenew    *int
+	leaderElectionRetry    *int
+
+	// Dry Run
+	dryRun          *bool
+	dryRunManifests *[]string
+
+	// Validating Admission Webhook
+	webhookPort      *int
+	webhookTLSSecret *string
+
+	// Gateway API
+	enableGatewayAPI      *bool
+	gatewayControllerName *string
+
 	pythonBaseDir    *string
 	logLevel         *string
 	ccclLogLevel     *string
@@ -147,18 +172,26 @@ var (
 	defaultIngIP           *string
 	vsSnatPoolName         *string
 	useSecrets             *bool
+	useEndpointSlices      *bool
+	policyFinalizer        *bool
+	baselinePolicy         *string
 	schemaLocal            *string
 	manageIngressClassOnly *bool
 	ingressClass           *string
 
 	bigIPURL                  *string
+	bigIPURLs                 *[]string
+	failoverCheckInterval     *int
+	configSyncAware           *bool
 	bigIPUsername             *string
 	bigIPPassword             *string
 	bigIPPartitions           *[]string
 	credsDir                  *string
+	bigIPLoginProvider        *string
 	as3Validation             *bool
 	sslInsecure               *bool
 	ipam                      *bool
+	ipamConfigMap             *string
 	enableTLS                 *string
 	tls13CipherGroupReference *string
 	ciphers                   *string
@@ -171,6 +204,9 @@ var (
 	shareNodes             *bool
 	overriderAS3CfgmapName *string
 	filterTenants          *bool
+	tenantPerNamespace     *bool
+	driftCheckInterval     *int
+	driftRepost            *bool
 
 	vxlanMode        string
 	openshiftSDNName *string
@@ -197,6 +233,7 @@ var (
 	eventChan          chan interface{}
 	configWriter       writer.Writer
 	k8sVersion         string
+	tokenMgr           *tokenmanager.TokenManager
 )
 
 func _init() {
@@ -235,7 +272,7 @@ func _init() {
 	printVersion = globalFlags.Bool("version", false,
 		"Optional, print version and exit.")
 	httpAddress = globalFlags.String("http-listen-address", "0.0.0.0:8080",
-		"Optional, address to serve http based informations (/metrics and /health).")
+		"Optional, address to serve http based informations (/metrics, /health, /livez and /readyz).")
 	disableTeems = globalFlags.Bool("disable-teems", false,
 		"Optional, flag to disable sending telemetry data to TEEM")
 	// Custom Resource
@@ -245,6 +282,37 @@ func _init() {
 		"Optional, When set to true, controller processes only F5 Custom Resources.")
 	defaultRouteDomain = globalFlags.Int("default-route-domain", 0,
 		"Optional, CIS uses this value as default Route Domain in BIG-IP ")
+	enableLeaderElection = globalFlags.Bool("enable-leader-election", false,
+		"Optional, when set to true, only the replica holding the leader Lease posts configuration to BIG-IP. "+
+			"Supported only in custom-resource-mode.")
+	leaderElectionLease = globalFlags.String("leader-election-lease-name", crmanager.DefaultLeaseName,
+		"Optional, name of the Lease used for leader election.")
+	leaderElectionNS = globalFlags.String("leader-election-namespace", "kube-system",
+		"Optional, namespace of the Lease used for leader election.")
+	leaderElectionDuration = globalFlags.Int("leader-election-lease-duration", 15,
+		"Optional, duration (in seconds) that standby replicas wait before taking over an expired Lease.")
+	leaderElectionRenew = globalFlags.Int("leader-election-renew-deadline", 10,
+		"Optional, duration (in seconds) that the leader retries renewing the Lease before giving up leadership.")
+	leaderElectionRetry = globalFlags.Int("leader-election-retry-period", 2,
+		"Optional, interval (in seconds) at which replicas try to acquire or renew the Lease.")
+	dryRun = globalFlags.Bool("dry-run", false,
+		"Optional, when set to true, prints the AS3 declarations of LTM and GTM that CIS would post for the "+
+			"custom resources and exits, without connecting to BIG-IP. Resources are read from dry-run-manifests, "+
+			"or else from the cluster.")
+	dryRunManifests = globalFlags.StringArray("dry-run-manifests", []string{},
+		"Optional, files or directories of VirtualServer, TransportServer, TLSProfile, Policy, ExternalDNS, "+
+			"Service, Endpoints, Secret and Node manifests to render with dry-run. Use - to read from stdin.")
+	webhookPort = globalFlags.Int("webhook-port", 0,
+		"Optional, port to serve the validating admission webhook of VirtualServer, TransportServer and "+
+			"IngressLink on. Supported only in custom-resource-mode, 0 disables the webhook.")
+	webhookTLSSecret = globalFlags.String("webhook-tls-secret", "",
+		"Optional, namespace/name of the kubernetes.io/tls Secret with the certificate served by the "+
+			"validating admission webhook. Required with webhook-port.")
+	enableGatewayAPI = globalFlags.Bool("enable-gateway-api", false,
+		"Optional, when set to true, processes the Gateways, HTTPRoutes, TLSRoutes and TCPRoutes of the "+
+			"networking.x-k8s.io/v1alpha1 Gateway API. Supported only in custom-resource-mode.")
+	gatewayControllerName = globalFlags.String("gateway-controller-name", crmanager.DefaultGatewayControllerName,
+		"Optional, controller of the GatewayClasses whose Gateways are processed by CIS.")
 
 	globalFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  Global:\n%s\n", globalFlags.FlagUsagesWrapped(width))
@@ -253,6 +321,14 @@ func _init() {
 	// BigIP flags
 	bigIPURL = bigIPFlags.String("bigip-url", "",
 		"Required, URL for the Big-IP")
+	bigIPURLs = bigIPFlags.StringSlice("bigip-urls", []string{},
+		"Optional, comma separated URLs of the BIG-IPs of an HA group in custom-resource-mode. "+
+			"Declarations are posted to the active BIG-IP, bigip-url defaults to the first URL.")
+	failoverCheckInterval = bigIPFlags.Int("bigip-failover-check-interval", 10,
+		"Optional, interval (in seconds) at which the failover status of the BIG-IPs in bigip-urls is checked.")
+	configSyncAware = bigIPFlags.Bool("bigip-config-sync-aware", false,
+		"Optional, when set to true, declarations are re-posted to the new active BIG-IP of bigip-urls "+
+			"only when its device group is not in sync.")
 	bigIPUsername = bigIPFlags.String("bigip-username", "",
 		"Required, user name for the Big-IP user account.")
 	bigIPPassword = bigIPFlags.String("bigip-password", "",
@@ -262,12 +338,17 @@ func _init() {
 	credsDir = bigIPFlags.String("credentials-directory", "",
 		"Optional, directory that contains the BIG-IP username, password, and/or "+
 			"url files. To be used instead of username, password, and/or url arguments.")
+	bigIPLoginProvider = bigIPFlags.String("bigip-login-provider", tokenmanager.DefaultLoginProvider,
+		"Optional, login provider of the BIG-IP user account used to request iControl REST authentication tokens.")
 	as3Validation = bigIPFlags.Bool("as3-validation", true,
 		"Optional, when set to false, disables as3 template validation on the controller.")
 	sslInsecure = bigIPFlags.Bool("insecure", false,
 		"Optional, when set to true, enable insecure SSL communication to BIGIP.")
 	ipam = bigIPFlags.Bool("ipam", false,
 		"Optional, when set to true, enable ipam feature for CRD.")
+	ipamConfigMap = bigIPFlags.String("ipam-configmap", "",
+		"Optional, <namespace>/<name> of the ConfigMap with the address ranges of each IPAM label. "+
+			"When set, CIS allocates the virtual addresses instead of f5-ipam-controller.")
 	as3PostDelay = bigIPFlags.Int("as3-post-delay", 0,
 		"Optional, time (in seconds) that CIS waits to post the available AS3 declaration.")
 	logAS3Response = bigIPFlags.Bool("log-as3-response", false,
@@ -289,6 +370,14 @@ func _init() {
 	overriderAS3CfgmapName = bigIPFlags.String("override-as3-declaration", "", overrideAS3UsageStr)
 	filterTenants = kubeFlags.Bool("filter-tenants", false,
 		"Optional, specify whether or not to use tenant filtering API for AS3 declaration")
+	tenantPerNamespace = bigIPFlags.Bool("tenant-per-namespace", false,
+		"Optional, when set to true, custom resources are declared in an AS3 tenant per namespace. "+
+			"cis.f5.com/tenant label on a resource overrides its tenant.")
+	driftCheckInterval = bigIPFlags.Int("drift-check-interval", 0,
+		"Optional, interval (in seconds) at which CIS compares the AS3 tenants on BIG-IP with the declaration it posted. "+
+			"Disabled when set to 0.")
+	driftRepost = bigIPFlags.Bool("drift-repost", false,
+		"Optional, when set to true, CIS re-posts the declaration of a tenant when configuration drift is detected.")
 	bigIPFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  BigIP:\n%s\n", bigIPFlags.FlagUsagesWrapped(width))
 	}
@@ -333,6 +422,15 @@ func _init() {
 			"pool with this name.")
 	useSecrets = kubeFlags.Bool("use-secrets", true,
 		"Optional, enable/disable use of Secrets for Ingress or ConfigMap SSL Profiles.")
+	useEndpointSlices = kubeFlags.Bool("use-endpoint-slices", false,
+		"Optional, build pool members from discovery.k8s.io/v1 EndpointSlices instead of Endpoints. "+
+			"Terminating endpoints are disabled on BIG-IP to drain their connections.")
+	policyFinalizer = kubeFlags.Bool("policy-finalizer", false,
+		"Optional, when set to true, a Policy used by VirtualServers or TransportServers is protected "+
+			"from deletion with the cis.f5.com/policy-in-use finalizer until it is no longer used.")
+	baselinePolicy = kubeFlags.String("baseline-policy", "",
+		"Optional, namespace/name of a Policy applied to all the VirtualServers and TransportServers, "+
+			"before the default Policy of their namespace and the Policy they refer to.")
 	schemaLocal = kubeFlags.String("schema-db-base-dir", "file:///app/vendor/src/f5/schemas/",
 		"Optional, where the schema db's locally reside")
 	// TODO once ingress extentionv1/beta1 api is deprecated we can remove this deployment parameter
@@ -469,6 +567,18 @@ func verifyArgs() error {
 		}
 	}
 
+	if len(*bigIPURL) == 0 && len(*bigIPURLs) > 0 {
+		*bigIPURL = (*bigIPURLs)[0]
+	}
+
+	if len(*bigIPURLs) > 1 && !*customResourceMode {
+		return fmt.Errorf("bigip-urls is supported only in custom-resource-mode")
+	}
+
+	if *failoverCheckInterval <= 0 {
+		return fmt.Errorf("bigip-failover-check-interval must be greater than 0")
+	}
+
 	if (len(*bigIPURL) == 0 || len(*bigIPUsername) == 0 ||
 		len(*bigIPPassword) == 0) && len(*credsDir) == 0 {
 		return fmt.Errorf("Missing BIG-IP credentials info")
@@ -478,6 +588,49 @@ func verifyArgs() error {
 		return fmt.Errorf("Can not specify both namespace and namespace-label")
 	}
 
+	if *driftCheckInterval < 0 {
+		return fmt.Errorf("drift-check-interval can not be negative")
+	}
+
+	if *tenantPerNamespace && !*shareNodes {
+		log.Warning("Pool members shared by multiple tenants need share-nodes to be enabled")
+	}
+
+	if *enableLeaderElection {
+		if !*customResourceMode {
+			return fmt.Errorf("Leader election is supported only in custom-resource-mode")
+		}
+		if len(*leaderElectionNS) == 0 || len(*leaderElectionLease) == 0 {
+			return fmt.Errorf("Missing leader election Lease name or namespace")
+		}
+		if *leaderElectionRetry <= 0 || *leaderElectionRenew <= *leaderElectionRetry ||
+			*leaderElectionDuration <= *leaderElectionRenew {
+			return fmt.Errorf("Invalid leader election timings, expected " +
+				"lease-duration > renew-deadline > retry-period > 0")
+		}
+	}
+
+	if *webhookPort != 0 {
+		if !*customResourceMode {
+			return fmt.Errorf("Validating admission webhook is supported only in custom-resource-mode")
+		}
+		if *webhookPort < 0 || *webhookPort > 65535 {
+			return fmt.Errorf("Invalid webhook-port %v", *webhookPort)
+		}
+		if len(*webhookTLSSecret) == 0 {
+			return fmt.Errorf("Missing webhook-tls-secret for the validating admission webhook")
+		}
+	}
+
+	if *enableGatewayAPI {
+		if !*customResourceMode {
+			return fmt.Errorf("Gateway API is supported only in custom-resource-mode")
+		}
+		if len(*gatewayControllerName) == 0 {
+			return fmt.Errorf("Missing gateway-controller-name for Gateway API")
+		}
+	}
+
 	if len(*namespaces) == 0 && len(*namespaceLabel) == 0 {
 		watchAllNamespaces = true
 	} else {
@@ -536,9 +689,9 @@ func verifyArgs() error {
 }
 
 func getCredentials() error {
+	var err error
 	if len(*credsDir) > 0 {
 		var usr, pass, bigipURL string
-		var err error
 		if strings.HasSuffix(*credsDir, "/") {
 			usr = *credsDir + "username"
 			pass = *credsDir + "password"
@@ -577,18 +730,61 @@ func getCredentials() error {
 		}
 	}
 	// Verify URL is valid
-	if !strings.HasPrefix(*bigIPURL, "https://") {
-		*bigIPURL = "https://" + *bigIPURL
+	if *bigIPURL, err = verifyBigIPURL(*bigIPURL); err != nil {
+		return err
+	}
+	if len(*bigIPURLs) == 0 {
+		return nil
+	}
+	found := false
+	for i := range *bigIPURLs {
+		if (*bigIPURLs)[i], err = verifyBigIPURL((*bigIPURLs)[i]); err != nil {
+			return err
+		}
+		found = found || (*bigIPURLs)[i] == *bigIPURL
+	}
+	if !found {
+		// BIG-IP of bigip-url is part of the HA group
+		*bigIPURLs = append([]string{*bigIPURL}, *bigIPURLs...)
+	}
+	return nil
+}
+
+// verifyBigIPURL returns the BIG-IP URL with https scheme, after verifying that it has no path
+func verifyBigIPURL(bigipURL string) (string, error) {
+	if !strings.HasPrefix(bigipURL, "https://") {
+		bigipURL = "https://" + bigipURL
 	}
-	u, err := url.Parse(*bigIPURL)
+	u, err := url.Parse(bigipURL)
 	if nil != err {
-		return fmt.Errorf("Error parsing url: %s", err)
+		return "", fmt.Errorf("Error parsing url: %s", err)
 	}
 	if len(u.Path) > 0 && u.Path != "/" {
-		return fmt.Errorf("BIGIP-URL path must be empty or '/'; check URL formatting and/or remove %s from path",
+		return "", fmt.Errorf("BIGIP-URL path must be empty or '/'; check URL formatting and/or remove %s from path",
 			u.Path)
 	}
-	return nil
+	return bigipURL, nil
+}
+
+// watchCredentials re-reads the BIG-IP username and password from the credentials directory
+// so that rotated credentials are used without restarting the controller
+func watchCredentials(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	username, password := *bigIPUsername, *bigIPPassword
+	for range ticker.C {
+		for field, filename := range map[*string]string{
+			&username: "username",
+			&password: "password",
+		} {
+			fileBytes, err := ioutil.ReadFile(filepath.Join(*credsDir, filename))
+			if err != nil {
+				continue
+			}
+			*field = strings.TrimSpace(string(fileBytes))
+		}
+		tokenMgr.UpdateCredentials(username, password)
+	}
 }
 
 func getGTMCredentials() {
@@ -760,13 +956,22 @@ func initCustomResourceManager(
 ) *crmanager.CRManager {
 
 	postMgrParams := crmanager.PostParams{
-		BIGIPUsername: *bigIPUsername,
-		BIGIPPassword: *bigIPPassword,
-		BIGIPURL:      *bigIPURL,
-		TrustedCerts:  "",
-		SSLInsecure:   true,
-		AS3PostDelay:  *as3PostDelay,
-		LogResponse:   *logAS3Response,
+		BIGIPUsername:      *bigIPUsername,
+		BIGIPPassword:      *bigIPPassword,
+		BIGIPURL:           *bigIPURL,
+		TrustedCerts:       "",
+		SSLInsecure:        true,
+		AS3PostDelay:       *as3PostDelay,
+		LogResponse:        *logAS3Response,
+		LeaderElection:     *enableLeaderElection,
+		DriftCheckInterval: *driftCheckInterval,
+		DriftRepost:        *driftRepost,
+		LoginProvider:      *bigIPLoginProvider,
+		TokenManager:       tokenMgr,
+		BIGIPURLs:          *bigIPURLs,
+
+		FailoverCheckInterval: *failoverCheckInterval,
+		ConfigSyncAware:       *configSyncAware,
 	}
 
 	GtmParams := crmanager.GTMParams{
@@ -803,14 +1008,82 @@ func initCustomResourceManager(
 			NodePollInterval:   *nodePollInterval,
 			NodeLabelSelector:  *nodeLabelSelector,
 			IPAM:               *ipam,
+			IPAMConfigMap:      *ipamConfigMap,
+			EndpointSlices:     *useEndpointSlices,
 			ShareNodes:         *shareNodes,
 			DefaultRouteDomain: *defaultRouteDomain,
+			TenantPerNamespace: *tenantPerNamespace,
+			PolicyFinalizer:    *policyFinalizer,
+			BaselinePolicy:     *baselinePolicy,
+			LeaderElection: crmanager.LeaderElectionParams{
+				Enabled:        *enableLeaderElection,
+				LeaseName:      *leaderElectionLease,
+				LeaseNamespace: *leaderElectionNS,
+				LeaseDuration:  time.Duration(*leaderElectionDuration) * time.Second,
+				RenewDeadline:  time.Duration(*leaderElectionRenew) * time.Second,
+				RetryPeriod:    time.Duration(*leaderElectionRetry) * time.Second,
+			},
+			Webhook: crmanager.WebhookParams{
+				Port:      *webhookPort,
+				TLSSecret: *webhookTLSSecret,
+			},
+			GatewayAPI: crmanager.GatewayAPIParams{
+				Enabled:        *enableGatewayAPI,
+				ControllerName: *gatewayControllerName,
+			},
 		},
 	)
 
 	return crMgr
 }
 
+// runDryRun prints the configuration CIS would post to BIG-IP and returns the exit code
+func runDryRun() int {
+	// INFO logs are written to stdout, which is reserved for the configuration
+	level := strings.ToUpper(*logLevel)
+	if level == "DEBUG" || level == "INFO" {
+		level = "WARNING"
+	}
+	if err := initLogger(level); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if len(*bigIPPartitions) == 0 {
+		fmt.Fprintf(os.Stderr, "missing a BIG-IP partition\n")
+		return 1
+	}
+
+	var config *rest.Config
+	if len(*dryRunManifests) == 0 {
+		var err error
+		if config, err = getKubeConfig(); err != nil {
+			return 1
+		}
+	}
+
+	err := crmanager.RenderDeclaration(
+		crmanager.DryRunParams{
+			Manifests:          *dryRunManifests,
+			Config:             config,
+			Namespaces:         *namespaces,
+			Partition:          (*bigIPPartitions)[0],
+			ControllerMode:     *poolMemberType,
+			UseNodeInternal:    *useNodeInternal,
+			TenantPerNamespace: *tenantPerNamespace,
+			ShareNodes:         *shareNodes,
+			DefaultRouteDomain: *defaultRouteDomain,
+			// Cluster version is left out, so that the output is comparable across clusters
+			UserAgent: fmt.Sprintf("CIS/v%v", version),
+		},
+		os.Stdout,
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
 // TODO Remove the function and appMgr.K8sVersion property once v1beta1.Ingress is deprecated in k8s 1.22
 // it is used to create informer for v1 ingress
 func getk8sVersion() string {
@@ -844,6 +1117,10 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *dryRun {
+		os.Exit(runDryRun())
+	}
+
 	err = verifyArgs()
 	if nil != err {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -856,6 +1133,10 @@ func main() {
 		flags.Usage()
 		os.Exit(1)
 	}
+	tokenMgr = tokenmanager.NewTokenManager(*bigIPURL, *bigIPUsername, *bigIPPassword, *bigIPLoginProvider)
+	if len(*credsDir) > 0 {
+		go watchCredentials(credentialsPollInterval)
+	}
 
 	log.Infof("[INIT] Starting: Container Ingress Services - Version: %s, BuildInfo: %s", version, buildInfo)
 
@@ -1073,8 +1354,19 @@ func main() {
 	// Add health check e.g. is Python process still there?
 	hc := &health.HealthChecker{
 		SubPID: subPid,
+		LivenessChecks: []health.Check{
+			{Name: "python-driver", Func: func() error { return health.CheckProcess(subPid) }},
+		},
+		ReadinessChecks: []health.Check{
+			{Name: "kubernetes-api", Func: func() error {
+				_, err := kubeClient.Discovery().ServerVersion()
+				return err
+			}},
+		},
 	}
 	http.Handle("/health", hc.HealthCheckHandler())
+	http.Handle("/livez", hc.LivenessHandler())
+	http.Handle("/readyz", hc.ReadinessHandler())
 	bigIPPrometheus.RegisterMetrics()
 	go func() {
 		log.Fatal(http.ListenAndServe(*httpAddress, nil).Error())
@@ -1135,6 +1427,7 @@ func getAppManagerParams() appmanager.Params {
 		SchemaLocal:            *schemaLocal,
 		ProcessAgentLabels:     getProcessAgentLabelFunc(),
 		DefaultRouteDomain:     *defaultRouteDomain,
+		EndpointSlices:         *useEndpointSlices,
 	}
 }
 
@@ -1172,6 +1465,10 @@ func getAS3Params() *as3.Params {
 		ConfigWriter:              getConfigWriter(),
 		EventChan:                 eventChan,
 		DefaultRouteDomain:        *defaultRouteDomain,
+		DriftCheckInterval:        *driftCheckInterval,
+		DriftRepost:               *driftRepost,
+		LoginProvider:             *bigIPLoginProvider,
+		TokenManager:              tokenMgr,
 	}
 }
 
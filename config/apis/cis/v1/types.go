@@ -22,8 +22,50 @@ type VirtualServer struct {
 type VirtualServerStatus struct {
 	VSAddress string `json:"vsAddress,omitempty"`
 	StatusOk  string `json:"status,omitempty"`
+	// ObservedGeneration is the generation of the resource last processed by CIS
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the latest observed state of the resource
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// Condition types reported on VirtualServer, TransportServer and Policy status.
+const (
+	// ConditionAccepted indicates whether the resource is valid and accepted by CIS
+	ConditionAccepted = "Accepted"
+	// ConditionResolvedRefs indicates whether all the resources referred are found
+	ConditionResolvedRefs = "ResolvedRefs"
+	// ConditionIPAllocated indicates whether a virtual address is available for the resource
+	ConditionIPAllocated = "IPAllocated"
+	// ConditionProgrammed indicates whether BIG-IP accepted the configuration of the resource
+	ConditionProgrammed = "Programmed"
+)
+
+// Condition reasons reported on VirtualServer, TransportServer and Policy status.
+const (
+	ReasonAccepted           = "Accepted"
+	ReasonInvalid            = "Invalid"
+	ReasonResolvedRefs       = "ResolvedRefs"
+	ReasonServiceNotFound    = "ServiceNotFound"
+	ReasonTLSProfileNotFound = "TLSProfileNotFound"
+	ReasonInvalidTLSProfile  = "InvalidTLSProfile"
+	ReasonInvalidPolicy      = "InvalidPolicy"
+	ReasonStaticAddress      = "StaticAddress"
+	ReasonIPAMAllocated      = "IPAMAllocated"
+	ReasonIPAMPending        = "IPAMPending"
+	ReasonIPAMUnavailable    = "IPAMUnavailable"
+	ReasonIPAMExhausted      = "IPAMExhausted"
+	ReasonInvalidIPAMLabel   = "InvalidIPAMLabel"
+	ReasonNoAddress          = "NoAddress"
+	ReasonProgrammed         = "Programmed"
+	ReasonRejected           = "Rejected"
+	// ReasonPersistenceConflict is reported on a VirtualServer whose persistenceProfile differs from the one
+	// of the VirtualServers sharing its address.
+	ReasonPersistenceConflict = "PersistenceConflict"
+	// ReasonTenantConflict is reported on a VirtualServer whose tenant differs from the one of the
+	// VirtualServers sharing its address.
+	ReasonTenantConflict = "TenantConflict"
+)
+
 // VirtualServerSpec is the spec of the VirtualServer resource.
 type VirtualServerSpec struct {
 	Host                   string           `json:"host,omitempty"`
@@ -43,6 +85,8 @@ type VirtualServerSpec struct {
 	IRules                 []string         `json:"iRules,omitempty"`
 	ServiceIPAddress       []ServiceAddress `json:"serviceAddress,omitempty"`
 	PolicyName             string           `json:"policyName,omitempty"`
+	// PersistenceProfile is the session persistence of the virtual server, overriding the one of the Policy.
+	PersistenceProfile *PersistenceProfile `json:"persistenceProfile,omitempty"`
 }
 
 // ServiceAddress Service IP address definition (BIG-IP virtual-address).
@@ -62,6 +106,54 @@ type Pool struct {
 	NodeMemberLabel string  `json:"nodeMemberLabel,omitempty"`
 	Monitor         Monitor `json:"monitor"`
 	Rewrite         string  `json:"rewrite,omitempty"`
+	// Weight is the ratio of requests on the path sent to the service,
+	// relative to the other pools of the path and alternate backends.
+	Weight            *int32             `json:"weight,omitempty"`
+	AlternateBackends []AlternateBackend `json:"alternateBackends,omitempty"`
+	// DrainTimeout is the number of seconds the removed pool members are kept disabled,
+	// so that BIG-IP drains their connections.
+	DrainTimeout int32 `json:"drainTimeout,omitempty"`
+	// Balance is the load balancing method of the pool, round-robin by default.
+	Balance string `json:"balance,omitempty"`
+	// SlowRampTime is the number of seconds over which a new pool member ramps up to its full share of traffic.
+	SlowRampTime *int32 `json:"slowRampTime,omitempty"`
+	// MinimumMonitors is the number of monitors that must succeed for a pool member to be up.
+	MinimumMonitors int32 `json:"minimumMonitors,omitempty"`
+	// ReselectTries is the number of times another pool member is selected when a connection fails.
+	ReselectTries int32 `json:"reselectTries,omitempty"`
+	// ConnectionLimit, RateLimit and Ratio apply to each member of the pool.
+	ConnectionLimit int32 `json:"connectionLimit,omitempty"`
+	RateLimit       int32 `json:"rateLimit,omitempty"`
+	Ratio           int32 `json:"ratio,omitempty"`
+	// Monitors are the health monitors of the pool in addition to monitor,
+	// minimumMonitors of which must succeed for a pool member to be up.
+	Monitors []Monitor `json:"monitors,omitempty"`
+	// HostRewrite is the Host header of the requests forwarded to the pool.
+	HostRewrite string `json:"hostRewrite,omitempty"`
+	// RequestHeaders and ResponseHeaders manipulate the HTTP headers of the requests
+	// forwarded to the pool and of their responses.
+	RequestHeaders  *HeaderActions `json:"requestHeaders,omitempty"`
+	ResponseHeaders *HeaderActions `json:"responseHeaders,omitempty"`
+}
+
+// HeaderActions defines the HTTP headers inserted, replaced and removed.
+type HeaderActions struct {
+	Insert  []HTTPHeader `json:"insert,omitempty"`
+	Replace []HTTPHeader `json:"replace,omitempty"`
+	Remove  []string     `json:"remove,omitempty"`
+}
+
+// HTTPHeader defines the name and value of an HTTP header.
+type HTTPHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// AlternateBackend defines a service that shares the traffic of a pool by weight.
+type AlternateBackend struct {
+	Service     string `json:"service"`
+	ServicePort int32  `json:"servicePort,omitempty"`
+	Weight      *int32 `json:"weight,omitempty"`
 }
 
 // Monitor defines a monitor object in BIG-IP.
@@ -71,6 +163,23 @@ type Monitor struct {
 	Recv     string `json:"recv"`
 	Interval int    `json:"interval"`
 	Timeout  int    `json:"timeout"`
+	// TargetPort is the port monitored on the pool members, the port of the pool members by default.
+	TargetPort int32 `json:"targetPort,omitempty"`
+	// Reference is the path of an existing BIG-IP monitor, such as /Common/gateway_icmp,
+	// used by the pool instead of a monitor created from the other fields.
+	Reference string `json:"reference,omitempty"`
+	// ClientCertificate is the name of the kubernetes.io/tls Secret with the certificate and key
+	// presented by the https monitor to the pool members.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	// QueryName and QueryType are the query of the dns monitor.
+	QueryName string `json:"queryName,omitempty"`
+	QueryType string `json:"queryType,omitempty"`
+	// Base and Filter are the search of the ldap monitor.
+	Base   string `json:"base,omitempty"`
+	Filter string `json:"filter,omitempty"`
+	// Pathname and Arguments are the script of the external monitor on BIG-IP.
+	Pathname  string `json:"pathname,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -163,7 +272,7 @@ type TransportServer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec TransportServerSpec `json:"spec"`
+	Spec   TransportServerSpec   `json:"spec"`
 	Status TransportServerStatus `json:"status,omitempty"`
 }
 
@@ -171,6 +280,10 @@ type TransportServer struct {
 type TransportServerStatus struct {
 	VSAddress string `json:"vsAddress,omitempty"`
 	StatusOk  string `json:"status,omitempty"`
+	// ObservedGeneration is the generation of the resource last processed by CIS
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions describe the latest observed state of the resource
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // TransportServerSpec is the spec of the VirtualServer resource.
@@ -187,6 +300,8 @@ type TransportServerSpec struct {
 	IPAMLabel            string           `json:"ipamLabel"`
 	IRules               []string         `json:"iRules,omitempty"`
 	PolicyName           string           `json:"policyName,omitempty"`
+	// PersistenceProfile is the session persistence of the virtual server, overriding the one of the Policy.
+	PersistenceProfile *PersistenceProfile `json:"persistenceProfile,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -223,6 +338,28 @@ type DNSPool struct {
 	DNSRecordType     string  `json:"dnsRecordType"`
 	LoadBalanceMethod string  `json:"loadBalanceMethod"`
 	Monitor           Monitor `json:"monitor"`
+	// Load balancing method used when the preferred method fails
+	FallbackMethod string `json:"fallbackMethod,omitempty"`
+	// Ratio of the pool for ratio load balancing of the WideIP
+	Ratio int32 `json:"ratio,omitempty"`
+	// Order of the pool in the WideIP, lower first, used by global-availability load balancing
+	Order int32 `json:"order,omitempty"`
+	// Members added along with the virtual servers of this cluster, i.e. the virtual servers of other clusters
+	Members []DNSPoolMember `json:"members,omitempty"`
+}
+
+// DNSPoolMember refers to a virtual server on a GSLB server, or to a static address in a data center
+type DNSPoolMember struct {
+	// GSLB server of the virtual server, defaults to dataServerName of the pool
+	DataServerName string `json:"dataServerName,omitempty"`
+	// Path of the virtual server on the GSLB server, i.e. /tenant/Shared/vs
+	VirtualServerName string `json:"virtualServerName,omitempty"`
+	// Static address and port of the member, configured as a generic host in the data center
+	Address    string `json:"address,omitempty"`
+	Port       int32  `json:"port,omitempty"`
+	DataCenter string `json:"dataCenter,omitempty"`
+	// Ratio of the member for ratio load balancing of the pool
+	Ratio int32 `json:"ratio,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -265,19 +402,61 @@ type ProfileSpec struct {
 	HTTP2          string   `json:"http2,omitempty"`
 	RewriteProfile string   `json:"rewriteProfile,omitempty"`
 	LogProfiles    []string `json:"logProfiles,omitempty"`
+	// PersistenceProfile is the session persistence of the virtual servers using the Policy.
+	PersistenceProfile *PersistenceProfile `json:"persistenceProfile,omitempty"`
+}
+
+// PersistenceProfile defines the session persistence of a virtual server, either
+// an existing BIG-IP persistence profile or a persistence method.
+type PersistenceProfile struct {
+	// Reference is the path of an existing BIG-IP persistence profile, such as /Common/cookie.
+	Reference string `json:"reference,omitempty"`
+	// Method is cookie, source-address, destination-address or universal.
+	Method string `json:"method,omitempty"`
+	// CookieMethod is insert, hash or rewrite, insert by default.
+	CookieMethod string `json:"cookieMethod,omitempty"`
+	CookieName   string `json:"cookieName,omitempty"`
+	// AddressMask is the mask of the source or destination address, such as 255.255.255.0.
+	AddressMask string `json:"addressMask,omitempty"`
+	// Timeout is the number of seconds a persistence record is kept.
+	Timeout int32 `json:"timeout,omitempty"`
+	// Rule is the path of the BIG-IP iRule of the universal persistence.
+	Rule string `json:"rule,omitempty"`
+	// FallbackPersistence is the persistence method used when the persistence method fails,
+	// such as source-address.
+	FallbackPersistence string `json:"fallbackPersistence,omitempty"`
 }
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:subresource:status
 
 // Policy describes a Policy custom resource.
 type Policy struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec PolicySpec `json:"spec"`
+	Spec   PolicySpec   `json:"spec"`
+	Status PolicyStatus `json:"status,omitempty"`
+}
+
+// PolicyStatus is the status of the Policy resource.
+type PolicyStatus struct {
+	// VirtualServers are the names of the VirtualServers using the Policy
+	VirtualServers []string `json:"virtualServers,omitempty"`
+	// TransportServers are the names of the TransportServers using the Policy
+	TransportServers []string `json:"transportServers,omitempty"`
+	// VirtualServerCount is the number of VirtualServers using the Policy
+	VirtualServerCount int `json:"virtualServerCount,omitempty"`
+	// TransportServerCount is the number of TransportServers using the Policy
+	TransportServerCount int `json:"transportServerCount,omitempty"`
+	// Conditions describe the latest observed state of the Policy on BIG-IP
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// PolicyFinalizer protects a Policy used by VirtualServers or TransportServers from deletion.
+const PolicyFinalizer = "cis.f5.com/policy-in-use"
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // PolicyList is list of Policy resources
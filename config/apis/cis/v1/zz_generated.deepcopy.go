@@ -25,10 +25,36 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AlternateBackend) DeepCopyInto(out *AlternateBackend) {
+	*out = *in
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AlternateBackend.
+func (in *AlternateBackend) DeepCopy() *AlternateBackend {
+	if in == nil {
+		return nil
+	}
+	out := new(AlternateBackend)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DNSPool) DeepCopyInto(out *DNSPool) {
 	*out = *in
 	out.Monitor = in.Monitor
+	if in.Members != nil {
+		in, out := &in.Members, &out.Members
+		*out = make([]DNSPoolMember, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -42,6 +68,22 @@ func (in *DNSPool) DeepCopy() *DNSPool {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSPoolMember) DeepCopyInto(out *DNSPoolMember) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSPoolMember.
+func (in *DNSPoolMember) DeepCopy() *DNSPoolMember {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSPoolMember)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalDNS) DeepCopyInto(out *ExternalDNS) {
 	*out = *in
@@ -108,7 +150,9 @@ func (in *ExternalDNSSpec) DeepCopyInto(out *ExternalDNSSpec) {
 	if in.Pools != nil {
 		in, out := &in.Pools, &out.Pools
 		*out = make([]DNSPool, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -123,6 +167,53 @@ func (in *ExternalDNSSpec) DeepCopy() *ExternalDNSSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HTTPHeader) DeepCopyInto(out *HTTPHeader) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HTTPHeader.
+func (in *HTTPHeader) DeepCopy() *HTTPHeader {
+	if in == nil {
+		return nil
+	}
+	out := new(HTTPHeader)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HeaderActions) DeepCopyInto(out *HeaderActions) {
+	*out = *in
+	if in.Insert != nil {
+		in, out := &in.Insert, &out.Insert
+		*out = make([]HTTPHeader, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replace != nil {
+		in, out := &in.Replace, &out.Replace
+		*out = make([]HTTPHeader, len(*in))
+		copy(*out, *in)
+	}
+	if in.Remove != nil {
+		in, out := &in.Remove, &out.Remove
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HeaderActions.
+func (in *HeaderActions) DeepCopy() *HeaderActions {
+	if in == nil {
+		return nil
+	}
+	out := new(HeaderActions)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressLink) DeepCopyInto(out *IngressLink) {
 	*out = *in
@@ -290,12 +381,29 @@ func (in *Monitor) DeepCopy() *Monitor {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PersistenceProfile) DeepCopyInto(out *PersistenceProfile) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PersistenceProfile.
+func (in *PersistenceProfile) DeepCopy() *PersistenceProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(PersistenceProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Policy) DeepCopyInto(out *Policy) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -371,10 +479,75 @@ func (in *PolicySpec) DeepCopy() *PolicySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PolicyStatus) DeepCopyInto(out *PolicyStatus) {
+	*out = *in
+	if in.VirtualServers != nil {
+		in, out := &in.VirtualServers, &out.VirtualServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TransportServers != nil {
+		in, out := &in.TransportServers, &out.TransportServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PolicyStatus.
+func (in *PolicyStatus) DeepCopy() *PolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pool) DeepCopyInto(out *Pool) {
 	*out = *in
 	out.Monitor = in.Monitor
+	if in.Weight != nil {
+		in, out := &in.Weight, &out.Weight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AlternateBackends != nil {
+		in, out := &in.AlternateBackends, &out.AlternateBackends
+		*out = make([]AlternateBackend, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SlowRampTime != nil {
+		in, out := &in.SlowRampTime, &out.SlowRampTime
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Monitors != nil {
+		in, out := &in.Monitors, &out.Monitors
+		*out = make([]Monitor, len(*in))
+		copy(*out, *in)
+	}
+	if in.RequestHeaders != nil {
+		in, out := &in.RequestHeaders, &out.RequestHeaders
+		*out = new(HeaderActions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResponseHeaders != nil {
+		in, out := &in.ResponseHeaders, &out.ResponseHeaders
+		*out = new(HeaderActions)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -396,6 +569,11 @@ func (in *ProfileSpec) DeepCopyInto(out *ProfileSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PersistenceProfile != nil {
+		in, out := &in.PersistenceProfile, &out.PersistenceProfile
+		*out = new(PersistenceProfile)
+		**out = **in
+	}
 	return
 }
 
@@ -529,7 +707,7 @@ func (in *TransportServer) DeepCopyInto(out *TransportServer) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -587,7 +765,7 @@ func (in *TransportServerList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TransportServerSpec) DeepCopyInto(out *TransportServerSpec) {
 	*out = *in
-	out.Pool = in.Pool
+	in.Pool.DeepCopyInto(&out.Pool)
 	if in.AllowVLANs != nil {
 		in, out := &in.AllowVLANs, &out.AllowVLANs
 		*out = make([]string, len(*in))
@@ -603,6 +781,11 @@ func (in *TransportServerSpec) DeepCopyInto(out *TransportServerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PersistenceProfile != nil {
+		in, out := &in.PersistenceProfile, &out.PersistenceProfile
+		*out = new(PersistenceProfile)
+		**out = **in
+	}
 	return
 }
 
@@ -619,6 +802,13 @@ func (in *TransportServerSpec) DeepCopy() *TransportServerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TransportServerStatus) DeepCopyInto(out *TransportServerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -638,7 +828,7 @@ func (in *VirtualServer) DeepCopyInto(out *VirtualServer) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -699,7 +889,9 @@ func (in *VirtualServerSpec) DeepCopyInto(out *VirtualServerSpec) {
 	if in.Pools != nil {
 		in, out := &in.Pools, &out.Pools
 		*out = make([]Pool, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	if in.AllowVLANs != nil {
 		in, out := &in.AllowVLANs, &out.AllowVLANs
@@ -716,6 +908,11 @@ func (in *VirtualServerSpec) DeepCopyInto(out *VirtualServerSpec) {
 		*out = make([]ServiceAddress, len(*in))
 		copy(*out, *in)
 	}
+	if in.PersistenceProfile != nil {
+		in, out := &in.PersistenceProfile, &out.PersistenceProfile
+		*out = new(PersistenceProfile)
+		**out = **in
+	}
 	return
 }
 
@@ -732,6 +929,13 @@ func (in *VirtualServerSpec) DeepCopy() *VirtualServerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualServerStatus) DeepCopyInto(out *VirtualServerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -25,4 +25,5 @@ require (
 	k8s.io/apimachinery v0.21.2
 	k8s.io/client-go v0.21.2
 	k8s.io/klog/v2 v2.9.0
+	sigs.k8s.io/gateway-api v0.3.0
 )
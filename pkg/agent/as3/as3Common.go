@@ -265,6 +265,10 @@ func createPoolDecl(cfg *ResourceConfig, sharedApp as3Application, shareNodes bo
 			if shareNodes {
 				member.ShareNodes = shareNodes
 			}
+			// Terminating endpoints are disabled to drain their connections
+			if val.Session == MemberSessionDisabled {
+				member.AdminState = "disable"
+			}
 			pool.Members = append(pool.Members, member)
 		}
 		for _, val := range v.MonitorNames {
@@ -0,0 +1,129 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package as3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	. "github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
+
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// checkDrift compares the tenants on BIG-IP with the last declaration posted
+// Drifted tenants are reported over the response channel and optionally re-posted
+func (am *AS3Manager) checkDrift() {
+	unifiedDecl := am.as3ActiveConfig.unifiedDeclaration
+	// Declaration failed to post is retried irrespective of drift
+	if unifiedDecl == "" || am.unprocessableEntityStatus {
+		return
+	}
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(unifiedDecl), &as3Config); err != nil {
+		log.Errorf("[AS3] JSON unmarshal failed: %v", err)
+		return
+	}
+	adc, _ := as3Config["declaration"].(map[string]interface{})
+
+	var driftedTenants []string
+	newlyDrifted := make(map[string][]string)
+	for _, tenant := range getTenants(unifiedDecl, false) {
+		inSync, err := am.PostManager.isTenantInSync(tenant, adc[tenant])
+		if err != nil {
+			log.Debugf("[AS3] Unable to check configuration drift of tenant %v: %v", tenant, err)
+			continue
+		}
+		if inSync {
+			if am.driftedTenants[tenant] {
+				log.Infof("[AS3] Tenant %v on BIG-IP is in sync with the posted declaration", tenant)
+				delete(am.driftedTenants, tenant)
+			}
+			bigIPPrometheus.ConfigurationDrift.WithLabelValues(tenant).Set(0)
+			continue
+		}
+		bigIPPrometheus.ConfigurationDrift.WithLabelValues(tenant).Set(1)
+		driftedTenants = append(driftedTenants, tenant)
+		if !am.driftedTenants[tenant] {
+			log.Warningf("[AS3] Configuration drift detected on BIG-IP for tenant %v", tenant)
+			bigIPPrometheus.ConfigurationDriftCount.WithLabelValues(tenant).Inc()
+			am.driftedTenants[tenant] = true
+			newlyDrifted[tenant] = am.getTenantConfigMaps(tenant)
+		}
+	}
+
+	if len(newlyDrifted) > 0 {
+		agRsp := am.ResourceResponse
+		agRsp.IsResponseSuccessful = true
+		agRsp.DriftedTenants = newlyDrifted
+		am.postAgentResponse(MessageResponse{ResourceResponse: agRsp})
+	}
+
+	if am.driftRepost && len(driftedTenants) > 0 {
+		log.Infof("[AS3] Re-posting the declaration of tenants %v to fix the configuration drift", driftedTenants)
+		if posted, event := am.PostManager.postConfig(string(unifiedDecl), driftedTenants, false); !posted {
+			log.Errorf("[AS3] Failed to re-post the declaration of drifted tenants: %v", event)
+		}
+	}
+}
+
+// getTenantConfigMaps returns the AS3 ConfigMaps (namespace/name) declaring the tenant
+func (am *AS3Manager) getTenantConfigMaps(tenant string) []string {
+	var cfgMaps []string
+	for _, cm := range am.as3ActiveConfig.configmaps {
+		if _, ok := cm.config[tenant]; ok {
+			cfgMaps = append(cfgMaps, cm.Namespace+"/"+cm.Name)
+		}
+	}
+	return cfgMaps
+}
+
+// isTenantInSync semantically compares the tenant declaration with the one available on BIG-IP
+func (postMgr *PostManager) isTenantInSync(tenant string, tenantDecl interface{}) (bool, error) {
+	req, err := http.NewRequest("GET", postMgr.getAS3APIURL([]string{tenant}), nil)
+	if err != nil {
+		return false, err
+	}
+	httpResp, err := postMgr.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		// Tenant is not available on BIG-IP
+		return false, nil
+	default:
+		return false, fmt.Errorf("response from BIG-IP with status code %v", httpResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return false, err
+	}
+	var response map[string]interface{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(tenantDecl, response[tenant]), nil
+}
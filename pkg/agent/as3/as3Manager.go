@@ -23,6 +23,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tokenmanager"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 
 	. "github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
@@ -113,6 +114,11 @@ type AS3Manager struct {
 	unprocessableEntityStatus bool
 	shareNodes                bool
 	defaultRouteDomain        int
+	// Interval (in seconds) to check the tenants on BIG-IP for configuration drift
+	driftCheckInterval int
+	driftRepost        bool
+	// Tenants reported as drifted, until they are in sync again
+	driftedTenants map[string]bool
 }
 
 // Struct to allow NewManager to receive all or only specific parameters.
@@ -146,6 +152,10 @@ type Params struct {
 	As3SchemaVersion          string
 	unprocessableEntityStatus bool
 	DefaultRouteDomain        int
+	DriftCheckInterval        int
+	DriftRepost               bool
+	LoginProvider             string
+	TokenManager              *tokenmanager.TokenManager
 }
 
 // Create and return a new app manager that meets the Manager interface
@@ -166,6 +176,9 @@ func NewAS3Manager(params *Params) *AS3Manager {
 		OverriderCfgMapName:       params.OverriderCfgMapName,
 		shareNodes:                params.ShareNodes,
 		defaultRouteDomain:        params.DefaultRouteDomain,
+		driftCheckInterval:        params.DriftCheckInterval,
+		driftRepost:               params.DriftRepost,
+		driftedTenants:            make(map[string]bool),
 		l2l3Agent: L2L3Agent{eventChan: params.EventChan,
 			configWriter: params.ConfigWriter},
 		PostManager: NewPostManager(PostParams{
@@ -175,7 +188,9 @@ func NewAS3Manager(params *Params) *AS3Manager {
 			TrustedCerts:  params.TrustedCerts,
 			SSLInsecure:   params.SSLInsecure,
 			AS3PostDelay:  params.AS3PostDelay,
-			LogResponse:   params.LogResponse}),
+			LogResponse:   params.LogResponse,
+			LoginProvider: params.LoginProvider,
+			TokenManager:  params.TokenManager}),
 	}
 
 	if as3Manager.tls13CipherGroupReference == "" {
@@ -345,11 +360,30 @@ func (am *AS3Manager) fetchAS3Schema() {
 
 // configDeployer blocks on ReqChan
 // whenever gets unblocked posts active configuration to BIG-IP
+// In between the posts, checks the tenants on BIG-IP for configuration drift
 func (am *AS3Manager) ConfigDeployer() {
 	// For the very first post after starting controller, need not wait to post
 	firstPost := true
 	am.unprocessableEntityStatus = false
-	for msgReq := range am.ReqChan {
+	var driftCheck <-chan time.Time
+	if am.driftCheckInterval > 0 {
+		ticker := time.NewTicker(time.Duration(am.driftCheckInterval) * time.Second)
+		defer ticker.Stop()
+		driftCheck = ticker.C
+	}
+	for {
+		var msgReq MessageRequest
+		select {
+		case req, ok := <-am.ReqChan:
+			if !ok {
+				return
+			}
+			msgReq = req
+		case <-driftCheck:
+			am.checkDrift()
+			continue
+		}
+
 		if !firstPost && am.PostManager.AS3PostDelay != 0 {
 			// Time (in seconds) that CIS waits to post the AS3 declaration to BIG-IP.
 			log.Debugf("[AS3] Delaying post to BIG-IP for %v seconds", am.PostManager.AS3PostDelay)
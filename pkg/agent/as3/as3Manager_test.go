@@ -16,9 +16,13 @@
 package as3
 
 import (
+	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"net/http"
 
 	. "github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
+	mockhc "github.com/f5devcentral/mockhttpclient"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -42,6 +46,20 @@ func (m *mockAS3Manager) shutdown() error {
 	return nil
 }
 
+func (m *mockAS3Manager) setGETResponse(statusCode int, body string) {
+	responseMap := mockhc.ResponseConfigMap{
+		http.MethodGet: &mockhc.ResponseConfig{
+			Responses: []*http.Response{{
+				StatusCode: statusCode,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+			}},
+		},
+	}
+	client, _ := mockhc.NewMockHTTPClient(responseMap)
+	m.PostManager.httpClient = client
+}
+
 var _ = Describe("AS3Manager Tests", func() {
 	var mockMgr *mockAS3Manager
 	BeforeEach(func() {
@@ -316,4 +334,68 @@ var _ = Describe("AS3Manager Tests", func() {
 			Expect(sharedApp["virtualServer_tls_server"].(*as3TLSServer).CipherGroup.BigIP).To(Equal("/Common/f5-default"), "Failed to set Default Cipher group for TLS Server Profile")
 		})
 	})
+
+	Describe("Configuration Drift", func() {
+		tenantDecl := map[string]interface{}{
+			"class":  "Tenant",
+			"Shared": map[string]interface{}{"class": "Application"},
+		}
+		BeforeEach(func() {
+			mockMgr.PostManager.BIGIPURL = "bigip.com"
+		})
+
+		It("Tenant in sync with BIG-IP", func() {
+			mockMgr.setGETResponse(http.StatusOK,
+				`{"class":"ADC","test":{"Shared":{"class":"Application"},"class":"Tenant"}}`)
+			inSync, err := mockMgr.PostManager.isTenantInSync("test", tenantDecl)
+			Expect(err).To(BeNil())
+			Expect(inSync).To(BeTrue(), "Tenant should be in sync")
+		})
+
+		It("Tenant modified on BIG-IP", func() {
+			mockMgr.setGETResponse(http.StatusOK, `{"class":"ADC","test":{"class":"Tenant"}}`)
+			inSync, err := mockMgr.PostManager.isTenantInSync("test", tenantDecl)
+			Expect(err).To(BeNil())
+			Expect(inSync).To(BeFalse(), "Tenant should have drifted")
+		})
+
+		It("Tenant deleted on BIG-IP", func() {
+			mockMgr.setGETResponse(http.StatusNoContent, "")
+			inSync, err := mockMgr.PostManager.isTenantInSync("test", tenantDecl)
+			Expect(err).To(BeNil())
+			Expect(inSync).To(BeFalse(), "Tenant should have drifted")
+		})
+
+		It("BIG-IP unavailable", func() {
+			mockMgr.setGETResponse(http.StatusServiceUnavailable, `{"code":503}`)
+			_, err := mockMgr.PostManager.isTenantInSync("test", tenantDecl)
+			Expect(err).NotTo(BeNil(), "Drift should not be decided without a valid response")
+		})
+
+		It("Report drifted tenants with their ConfigMaps", func() {
+			mockMgr.RspChan = make(chan interface{}, 1)
+			mockMgr.as3ActiveConfig.unifiedDeclaration = as3Declaration(
+				`{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant","Shared":{"class":"Application"}}}}`)
+			mockMgr.as3ActiveConfig.configmaps = []*AS3ConfigMap{{
+				Name:      "as3",
+				Namespace: "default",
+				config:    as3ADC{"test": tenantDecl},
+			}}
+			mockMgr.setGETResponse(http.StatusOK, `{"class":"ADC","test":{"class":"Tenant"}}`)
+			mockMgr.checkDrift()
+			Expect(mockMgr.driftedTenants["test"]).To(BeTrue(), "Tenant should be marked as drifted")
+			rsp := (<-mockMgr.RspChan).(MessageResponse)
+			Expect(rsp.DriftedTenants).To(Equal(map[string][]string{"test": {"default/as3"}}))
+
+			// Drift is reported only once
+			mockMgr.setGETResponse(http.StatusOK, `{"class":"ADC","test":{"class":"Tenant"}}`)
+			mockMgr.checkDrift()
+			Expect(mockMgr.RspChan).To(BeEmpty(), "Drift should be reported only once")
+
+			mockMgr.setGETResponse(http.StatusOK,
+				`{"class":"ADC","test":{"class":"Tenant","Shared":{"class":"Application"}}}`)
+			mockMgr.checkDrift()
+			Expect(mockMgr.driftedTenants).To(BeEmpty(), "Tenant should be in sync")
+		})
+	})
 })
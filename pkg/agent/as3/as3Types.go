@@ -122,6 +122,7 @@ type (
 		ServerAddresses  []string `json:"serverAddresses,omitempty"`
 		ServicePort      int32    `json:"servicePort,omitempty"`
 		ShareNodes       bool     `json:"shareNodes,omitempty"`
+		AdminState       string   `json:"adminState,omitempty"`
 	}
 
 	// as3ResourcePointer maps to following in AS3 Resources
@@ -23,10 +23,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tokenmanager"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	routeclient "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 )
@@ -36,6 +38,8 @@ const (
 	timeoutSmall  = 3 * time.Second
 	timeoutMedium = 30 * time.Second
 	timeoutLarge  = 60 * time.Second
+	// timeoutDial bounds the connection to BIG-IP, which otherwise waits for the TCP timeout of the OS
+	timeoutDial = 10 * time.Second
 )
 
 const (
@@ -63,6 +67,10 @@ type PostParams struct {
 	//Log the AS3 response body in Controller logs
 	LogResponse   bool
 	RouteClientV1 routeclient.RouteV1Interface
+	// Login provider used to request authentication tokens from BIG-IP
+	LoginProvider string
+	// TokenManager authenticates the requests to BIG-IP, created from the credentials when nil
+	TokenManager *tokenmanager.TokenManager
 }
 
 type config struct {
@@ -96,14 +104,20 @@ func (postMgr *PostManager) setupBIGIPRESTClient() {
 	}
 
 	tr := &http.Transport{
+		DialContext: (&net.Dialer{Timeout: timeoutDial}).DialContext,
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: postMgr.SSLInsecure,
 			RootCAs:            rootCAs,
 		},
 	}
 
+	if postMgr.TokenManager == nil {
+		postMgr.TokenManager = tokenmanager.NewTokenManager(postMgr.BIGIPURL, postMgr.BIGIPUsername,
+			postMgr.BIGIPPassword, postMgr.LoginProvider)
+	}
+
 	postMgr.httpClient = &http.Client{
-		Transport: tr,
+		Transport: postMgr.TokenManager.Transport(tr),
 		Timeout:   timeoutLarge,
 	}
 }
@@ -186,8 +200,6 @@ func (postMgr *PostManager) postConfigRequests(data string, url string) (bool, s
 		return false, responseStatusCommon
 	}
 	log.Debugf("[AS3] posting request to %v", cfg.as3APIURL)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
 	httpResp, responseMap := postMgr.httpReq(req)
 	if httpResp == nil || responseMap == nil {
 		return false, responseStatusCommon
@@ -214,8 +226,6 @@ func (postMgr *PostManager) GetBigipAS3Version() (string, string, string, error)
 	}
 
 	log.Debugf("[AS3] posting GET BIGIP AS3 Version request on %v", url)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
 	httpResp, responseMap := postMgr.httpReq(req)
 	if httpResp == nil || responseMap == nil {
 		return "", "", "", fmt.Errorf("Internal Error")
@@ -251,8 +261,6 @@ func (postMgr *PostManager) GetBigipRegKey() (string, error) {
 	}
 
 	log.Debugf("Posting GET BIGIP Reg Key request on %v", url)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
 	httpResp, responseMap := postMgr.httpReq(req)
 	if httpResp == nil || responseMap == nil {
 		return "", fmt.Errorf("Internal Error")
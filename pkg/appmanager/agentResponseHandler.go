@@ -18,11 +18,14 @@ package appmanager
 
 import (
 	"context"
+	"fmt"
+
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	routeapi "github.com/openshift/api/route/v1"
 	v1 "k8s.io/api/core/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -139,5 +142,35 @@ func (appMgr *Manager) agentResponseWorker() {
 				appMgr.updateRouteAdmitStatus()
 			}
 		}
+		if len(rspMsg.DriftedTenants) > 0 {
+			appMgr.recordDriftEvents(rspMsg.DriftedTenants)
+		}
+	}
+}
+
+// recordDriftEvents records an Event on the AS3 ConfigMaps of each tenant drifted on BIG-IP
+func (appMgr *Manager) recordDriftEvents(driftedTenants map[string][]string) {
+	for tenant, cfgMaps := range driftedTenants {
+		message := fmt.Sprintf("Configuration of tenant %v on BIG-IP differs from the declaration posted by F5 CIS",
+			tenant)
+		if len(cfgMaps) == 0 {
+			log.Warningf("[CORE] %v", message)
+			continue
+		}
+		for _, cfgMapKey := range cfgMaps {
+			namespace, name, err := cache.SplitMetaNamespaceKey(cfgMapKey)
+			if err != nil {
+				continue
+			}
+			cfgMap, err := appMgr.kubeClient.CoreV1().ConfigMaps(namespace).Get(
+				context.TODO(), name, metaV1.GetOptions{})
+			if err != nil {
+				log.Errorf("[CORE] Unable to get ConfigMap %v to record configuration drift: %v", cfgMapKey, err)
+				continue
+			}
+			evNotifier := appMgr.eventNotifier.CreateNotifierForNamespace(
+				namespace, appMgr.kubeClient.CoreV1())
+			evNotifier.RecordEvent(cfgMap, v1.EventTypeWarning, "ConfigurationDrift", message)
+		}
 	}
 }
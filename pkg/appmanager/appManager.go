@@ -41,6 +41,7 @@ import (
 	routeclient "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 	"golang.org/x/mod/semver"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -126,6 +127,8 @@ type Manager struct {
 	manageIngress          bool
 	manageIngressClassOnly bool
 	ingressClass           string
+	// Build pool members from EndpointSlices instead of Endpoints
+	useEndpointSlices bool
 	// Ingress SSL security Context
 	rsrcSSLCtxt     map[string]*v1.Secret
 	WatchedNS       WatchedNamespaces
@@ -181,6 +184,7 @@ type Params struct {
 	ProcessAgentLabels func(map[string]string, string, string) bool
 	UserAgent          string
 	DefaultRouteDomain int
+	EndpointSlices     bool
 }
 
 // Configuration options for Routes in OpenShift
@@ -204,6 +208,7 @@ const (
 	Namespaces     = "namespaces"
 	Services       = "services"
 	Endpoints      = "endpoints"
+	EndpointSlices = "endpointslices"
 	Configmaps     = "configmaps"
 	Ingresses      = "ingresses"
 	Routes         = "routes"
@@ -211,6 +216,9 @@ const (
 	IngressClasses = "ingressclasses"
 
 	hubModeInterval = 30 * time.Second //Hubmode ConfigMap resync interval
+
+	// endpointSliceServiceIndex indexes the EndpointSlices by the key of their service
+	endpointSliceServiceIndex = "service"
 )
 
 var RoutesProcessed []*routeapi.Route
@@ -253,6 +261,7 @@ func NewManager(params *Params) *Manager {
 		manageIngress:          params.ManageIngress,
 		manageIngressClassOnly: params.ManageIngressClassOnly,
 		ingressClass:           params.IngressClass,
+		useEndpointSlices:      params.EndpointSlices,
 		rsrcSSLCtxt:            make(map[string]*v1.Secret),
 		trustedCertsCfgmap:     params.TrustedCertsCfgmap,
 		intF5Res:               make(map[string]InternalF5Resources),
@@ -571,6 +580,8 @@ type appInformer struct {
 	secretInformer   cache.SharedIndexInformer
 	ingClassInformer cache.SharedIndexInformer
 	stopCh           chan struct{}
+	// EndpointSlices are watched instead of Endpoints when useEndpointSlices is set
+	endptSliceInformer cache.SharedIndexInformer
 }
 
 func (appMgr *Manager) newAppInformer(
@@ -596,28 +607,46 @@ func (appMgr *Manager) newAppInformer(
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 		),
-		endptInformer: cache.NewSharedIndexInformer(
+		secretInformer: cache.NewSharedIndexInformer(
 			cache.NewFilteredListWatchFromClient(
 				appMgr.restClientv1,
-				Endpoints,
+				Secrets,
 				namespace,
 				everything,
 			),
-			&v1.Endpoints{},
+			&v1.Secret{},
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 		),
-		secretInformer: cache.NewSharedIndexInformer(
+	}
+
+	if appMgr.useEndpointSlices {
+		appInf.endptSliceInformer = cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(
+				appMgr.kubeClient.DiscoveryV1().RESTClient(),
+				EndpointSlices,
+				namespace,
+				everything,
+			),
+			&discoveryv1.EndpointSlice{},
+			resyncPeriod,
+			cache.Indexers{
+				cache.NamespaceIndex:      cache.MetaNamespaceIndexFunc,
+				endpointSliceServiceIndex: endpointSliceServiceIndexFunc,
+			},
+		)
+	} else {
+		appInf.endptInformer = cache.NewSharedIndexInformer(
 			cache.NewFilteredListWatchFromClient(
 				appMgr.restClientv1,
-				Secrets,
+				Endpoints,
 				namespace,
 				everything,
 			),
-			&v1.Secret{},
+			&v1.Endpoints{},
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
-		),
+		)
 	}
 
 	if true == appMgr.manageIngress {
@@ -743,14 +772,25 @@ func (appMgr *Manager) newAppInformer(
 		resyncPeriod,
 	)
 
-	appInf.endptInformer.AddEventHandlerWithResyncPeriod(
-		&cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { appMgr.enqueueEndpoints(obj, OprTypeCreate) },
-			UpdateFunc: func(old, cur interface{}) { appMgr.enqueueEndpoints(cur, OprTypeUpdate) },
-			DeleteFunc: func(obj interface{}) { appMgr.enqueueEndpoints(obj, OprTypeDelete) },
-		},
-		resyncPeriod,
-	)
+	if nil != appInf.endptSliceInformer {
+		appInf.endptSliceInformer.AddEventHandlerWithResyncPeriod(
+			&cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { appMgr.enqueueEndpointSlice(obj, OprTypeCreate) },
+				UpdateFunc: func(old, cur interface{}) { appMgr.enqueueEndpointSlice(cur, OprTypeUpdate) },
+				DeleteFunc: func(obj interface{}) { appMgr.enqueueEndpointSlice(obj, OprTypeDelete) },
+			},
+			resyncPeriod,
+		)
+	} else {
+		appInf.endptInformer.AddEventHandlerWithResyncPeriod(
+			&cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { appMgr.enqueueEndpoints(obj, OprTypeCreate) },
+				UpdateFunc: func(old, cur interface{}) { appMgr.enqueueEndpoints(cur, OprTypeUpdate) },
+				DeleteFunc: func(obj interface{}) { appMgr.enqueueEndpoints(obj, OprTypeDelete) },
+			},
+			resyncPeriod,
+		)
+	}
 	appInf.secretInformer.AddEventHandlerWithResyncPeriod(
 		&cache.ResourceEventHandlerFuncs{
 			// Making all operation types as update because each change in secret will update the ingress/configmap
@@ -828,6 +868,15 @@ func (appMgr *Manager) enqueueEndpoints(obj interface{}, operation string) {
 	}
 }
 
+func (appMgr *Manager) enqueueEndpointSlice(obj interface{}, operation string) {
+	if ok, keys := appMgr.checkValidEndpointSlice(obj); ok {
+		for _, key := range keys {
+			key.Operation = operation
+			appMgr.vsQueue.Add(*key)
+		}
+	}
+}
+
 func (appMgr *Manager) enqueueSecrets(obj interface{}, operation string) {
 	if ok, keys := appMgr.checkValidSecrets(obj); ok {
 		for _, key := range keys {
@@ -883,6 +932,9 @@ func (appInf *appInformer) start() {
 	if nil != appInf.endptInformer {
 		go appInf.endptInformer.Run(appInf.stopCh)
 	}
+	if nil != appInf.endptSliceInformer {
+		go appInf.endptSliceInformer.Run(appInf.stopCh)
+	}
 	if nil != appInf.secretInformer {
 		go appInf.secretInformer.Run(appInf.stopCh)
 	}
@@ -903,6 +955,33 @@ func (appInf *appInformer) start() {
 	}
 }
 
+// getEndpointSlices returns the EndpointSlices of the service from the informer cache
+func (appInf *appInformer) getEndpointSlices(svcKey string) []*discoveryv1.EndpointSlice {
+	var slices []*discoveryv1.EndpointSlice
+	objs, err := appInf.endptSliceInformer.GetIndexer().ByIndex(endpointSliceServiceIndex, svcKey)
+	if err != nil {
+		log.Errorf("[CORE] Unable to get EndpointSlices of service %v: %v", svcKey, err)
+		return slices
+	}
+	for _, obj := range objs {
+		slices = append(slices, obj.(*discoveryv1.EndpointSlice))
+	}
+	return slices
+}
+
+// endpointSliceServiceIndexFunc indexes the EndpointSlices by the key of their service
+func endpointSliceServiceIndexFunc(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return []string{}, nil
+	}
+	svcName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{slice.Namespace + "/" + svcName}, nil
+}
+
 func (appInf *appInformer) waitForCacheSync() {
 	cacheSyncs := []cache.InformerSynced{}
 
@@ -912,6 +991,9 @@ func (appInf *appInformer) waitForCacheSync() {
 	if nil != appInf.endptInformer {
 		cacheSyncs = append(cacheSyncs, appInf.endptInformer.HasSynced)
 	}
+	if nil != appInf.endptSliceInformer {
+		cacheSyncs = append(cacheSyncs, appInf.endptSliceInformer.HasSynced)
+	}
 	if nil != appInf.secretInformer {
 		cacheSyncs = append(cacheSyncs, appInf.secretInformer.HasSynced)
 	}
@@ -2644,6 +2726,15 @@ func (appMgr *Manager) updatePoolMembersForCluster(
 	index int,
 ) (bool, string, string) {
 	svcKey := sKey.Namespace + "/" + sKey.ServiceName
+	if nil != appInf.endptSliceInformer {
+		nodes := appMgr.getNodesFromCache()
+		// Checking for headless service
+		include := func(endpoint discoveryv1.Endpoint) bool {
+			return (endpoint.NodeName != nil && containsNode(nodes, *endpoint.NodeName)) ||
+				svc.Spec.ClusterIP == "None"
+		}
+		return appMgr.updatePoolMembersFromEndpointSlices(svc, sKey, rsCfg, appInf, index, include)
+	}
 	item, found, _ := appInf.endptInformer.GetStore().GetByKey(svcKey)
 	if !found {
 		msg := "Endpoints for service " + svcKey + " not found!"
@@ -2666,6 +2757,42 @@ func (appMgr *Manager) updatePoolMembersForCluster(
 	return true, "", ""
 }
 
+// updatePoolMembersFromEndpointSlices updates the pool with the members of the EndpointSlices of the service
+func (appMgr *Manager) updatePoolMembersFromEndpointSlices(
+	svc *v1.Service,
+	sKey ServiceKey,
+	rsCfg *ResourceConfig,
+	appInf *appInformer,
+	index int,
+	include func(endpoint discoveryv1.Endpoint) bool,
+) (bool, string, string) {
+	svcKey := sKey.Namespace + "/" + sKey.ServiceName
+	slices := appInf.getEndpointSlices(svcKey)
+	if len(slices) == 0 {
+		msg := "EndpointSlices for service " + svcKey + " not found!"
+		log.Debug(msg)
+		return false, "EndpointsNotFound", msg
+	}
+	memberMap := GetEndpointSliceMembers(svc, slices, include)
+	for _, portSpec := range svc.Spec.Ports {
+		if portSpec.Port == sKey.ServicePort {
+			var members []Member
+			for port, mems := range memberMap {
+				if port.Name == portSpec.Name {
+					members = append(members, mems...)
+				}
+			}
+			log.Debugf("[CORE] Found endpoints for backend %+v: %v", sKey, members)
+			rsCfg.MetaData.Active = true
+			rsCfg.Pools[index].Members = members
+		}
+	}
+	if rsCfg.Pools[index].Members == nil {
+		log.Debugf("[CORE]Endpoints could not be fetched for service %v with port %v", sKey.ServiceName, sKey.ServicePort)
+	}
+	return true, "", ""
+}
+
 func (appMgr *Manager) deactivateVirtualServer(
 	sKey ServiceKey,
 	rsName string,
@@ -3236,7 +3363,9 @@ func (appMgr *Manager) getEndpoints(selector, namespace string) []Member {
 	}
 
 	for _, service := range services.Items {
-		if appMgr.isNodePort == false { // Controller is in ClusterIP Mode
+		if appMgr.isNodePort == false && appMgr.useEndpointSlices {
+			members = append(members, appMgr.getEndpointSliceMembers(&service)...)
+		} else if appMgr.isNodePort == false { // Controller is in ClusterIP Mode
 			endpointsList, err := appMgr.kubeClient.CoreV1().Endpoints(service.Namespace).List(context.TODO(),
 				metav1.ListOptions{
 					FieldSelector: "metadata.name=" + service.Name,
@@ -3276,6 +3405,44 @@ func (appMgr *Manager) getEndpoints(selector, namespace string) []Member {
 	return members
 }
 
+// getEndpointSliceMembers returns the members of the ready endpoints of the service from its EndpointSlices.
+// A pool of the AS3 ConfigMap has the same session for all its members, so terminating endpoints are excluded
+// like the not ready addresses of the Endpoints.
+func (appMgr *Manager) getEndpointSliceMembers(service *v1.Service) []Member {
+	sliceList, err := appMgr.kubeClient.DiscoveryV1().EndpointSlices(service.Namespace).List(context.TODO(),
+		metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + service.Name,
+		},
+	)
+	if err != nil {
+		log.Debugf("[CORE] Error getting EndpointSlices for service %v", service.Name)
+		return nil
+	}
+	var slices []*discoveryv1.EndpointSlice
+	for i := range sliceList.Items {
+		slices = append(slices, &sliceList.Items[i])
+	}
+	ready := func(endpoint discoveryv1.Endpoint) bool {
+		return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+	}
+	memberMap := GetEndpointSliceMembers(service, slices, ready)
+	var ports []EndpointPort
+	for port := range memberMap {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Port != ports[j].Port {
+			return ports[i].Port < ports[j].Port
+		}
+		return ports[i].Name < ports[j].Name
+	})
+	var members []Member
+	for _, port := range ports {
+		members = append(members, memberMap[port]...)
+	}
+	return members
+}
+
 func (appMgr *Manager) exposeKubernetesService(
 	svc *v1.Service,
 	sKey ServiceKey,
@@ -3284,6 +3451,9 @@ func (appMgr *Manager) exposeKubernetesService(
 	index int,
 ) (bool, string, string) {
 	svcKey := sKey.Namespace + "/" + sKey.ServiceName
+	if nil != appInf.endptSliceInformer {
+		return appMgr.updatePoolMembersFromEndpointSlices(svc, sKey, rsCfg, appInf, index, nil)
+	}
 	item, found, _ := appInf.endptInformer.GetStore().GetByKey(svcKey)
 	if !found {
 		msg := "Endpoints for service " + svcKey + " not found!"
@@ -37,6 +37,7 @@ import (
 	routeapi "github.com/openshift/api/route/v1"
 	fakeRouteClient "github.com/openshift/client-go/route/clientset/versioned/fake"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -2104,6 +2105,47 @@ var _ = Describe("AppManager Tests", func() {
 				testNoBindAddr(false)
 			})
 
+			It("gets AS3 pool members from EndpointSlices", func() {
+				mockMgr.appMgr.isNodePort = false
+				mockMgr.appMgr.useEndpointSlices = true
+				selector := "cis.f5.com/as3-tenant=t1,cis.f5.com/as3-app=app,cis.f5.com/as3-pool=pool"
+				svc := test.NewService("foo", "1", namespace, v1.ServiceTypeClusterIP,
+					[]v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}})
+				svc.Labels = map[string]string{
+					"cis.f5.com/as3-tenant": "t1",
+					"cis.f5.com/as3-app":    "app",
+					"cis.f5.com/as3-pool":   "pool",
+				}
+				_, err := mockMgr.appMgr.kubeClient.CoreV1().Services(namespace).Create(
+					context.TODO(), svc, metav1.CreateOptions{})
+				Expect(err).To(BeNil())
+
+				notReady := false
+				port := int32(8080)
+				slice := &discoveryv1.EndpointSlice{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo-abc",
+						Namespace: namespace,
+						Labels:    map[string]string{discoveryv1.LabelServiceName: "foo"},
+					},
+					AddressType: discoveryv1.AddressTypeIPv4,
+					Endpoints: []discoveryv1.Endpoint{
+						{Addresses: []string{"10.1.1.2"}},
+						{Addresses: []string{"10.1.1.1"}},
+						{Addresses: []string{"10.1.1.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+					},
+					Ports: []discoveryv1.EndpointPort{{Port: &port}},
+				}
+				_, err = mockMgr.appMgr.kubeClient.DiscoveryV1().EndpointSlices(namespace).Create(
+					context.TODO(), slice, metav1.CreateOptions{})
+				Expect(err).To(BeNil())
+
+				Expect(mockMgr.appMgr.getEndpoints(selector, namespace)).To(Equal([]Member{
+					{Address: "10.1.1.1", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+					{Address: "10.1.1.2", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+				}), "Members of the ready endpoints should be returned")
+			})
+
 			It("doesn't manage ConfigMap in wrong partition", func() {
 				//Config map with wrong partition
 				DEFAULT_PARTITION = "k8s" //partition the controller has been asked to watch
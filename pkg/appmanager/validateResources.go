@@ -25,6 +25,7 @@ import (
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	routeapi "github.com/openshift/api/route/v1"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/api/extensions/v1beta1"
 	netv1 "k8s.io/api/networking/v1"
 )
@@ -153,6 +154,34 @@ func (appMgr *Manager) checkValidEndpoints(
 	return true, keyList
 }
 
+func (appMgr *Manager) checkValidEndpointSlice(
+	obj interface{},
+) (bool, []*serviceQueueKey) {
+	slice := obj.(*discoveryv1.EndpointSlice)
+	namespace := slice.ObjectMeta.Namespace
+	svcName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	if !ok {
+		// Not managed for a service
+		return false, nil
+	}
+	// Check if the service to see if we care about it.
+	_, ok = appMgr.getNamespaceInformer(namespace)
+	if !ok {
+		// Not watching this namespace
+		return false, nil
+	}
+	// Pool members of the service are updated same as for its Endpoints
+	key := &serviceQueueKey{
+		ServiceName:  svcName,
+		Namespace:    namespace,
+		ResourceKind: Endpoints,
+		ResourceName: svcName,
+	}
+	var keyList []*serviceQueueKey
+	keyList = append(keyList, key)
+	return true, keyList
+}
+
 func (appMgr *Manager) getSecretServiceQueueKeyForConfigMap(secret *v1.Secret) []*serviceQueueKey {
 	var keyList []*serviceQueueKey
 	// We will be adding ResourceKind as Configmaps so that particular Configmaps can be re-synced
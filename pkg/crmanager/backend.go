@@ -49,9 +49,14 @@ const (
 
 var DEFAULT_PARTITION string
 
+// tenantLabelPrefix prefixes the label of the tenants declared by CIS, followed by the partition of CIS
+const tenantLabelPrefix = "CIS:"
+
 func NewAgent(params AgentParams) *Agent {
 	DEFAULT_PARTITION = params.Partition
-	postMgr := NewPostManager(params.PostParams)
+	postParams := params.PostParams
+	postParams.TenantLabel = tenantLabelPrefix + params.Partition
+	postMgr := NewPostManager(postParams)
 	configWriter, err := writer.NewConfigWriter()
 	if nil != err {
 		log.Fatalf("Failed creating ConfigWriter tool: %v", err)
@@ -65,6 +70,7 @@ func NewAgent(params AgentParams) *Agent {
 		userAgent:    params.UserAgent,
 		HttpAddress:  params.HttpAddress,
 	}
+	agent.GTMPostManager = NewPostManager(getGTMPostParams(params))
 	// If running in VXLAN mode, extract the partition name from the tunnel
 	// to be used in configuring a net instance of CCCL for that partition
 	var vxlanPartition string
@@ -85,58 +91,68 @@ func NewAgent(params AgentParams) *Agent {
 		VerifyInterval: params.VerifyInterval,
 		VXLANPartition: vxlanPartition,
 		DisableLTM:     true,
-		GTM:            true,
+		GTM:            false,
 	}
 	bs := bigIPSection{
 		BigIPUsername:   params.PostParams.BIGIPUsername,
 		BigIPPassword:   params.PostParams.BIGIPPassword,
-		BigIPURL:        params.PostParams.BIGIPURL,
+		BigIPURL:        postMgr.getBIGIPURL(),
 		BigIPPartitions: []string{params.Partition},
 	}
 
-	var gtm gtmBigIPSection
-	if len(params.GTMParams.GTMBigIpUrl) == 0 || len(params.GTMParams.GTMBigIpUsername) == 0 || len(params.GTMParams.GTMBigIpPassword) == 0 {
-		// gs.GTM = false
-		gtm = gtmBigIPSection{
-			GtmBigIPUsername: params.PostParams.BIGIPUsername,
-			GtmBigIPPassword: params.PostParams.BIGIPPassword,
-			GtmBigIPURL:      params.PostParams.BIGIPURL,
-		}
-		log.Warning("Creating GTM with default bigip credentials as GTM BIGIP Url or GTM BIGIP Username or GTM BIGIP Password is missing on CIS args.")
-	} else {
-		gtm = gtmBigIPSection{
-			GtmBigIPUsername: params.GTMParams.GTMBigIpUsername,
-			GtmBigIPPassword: params.GTMParams.GTMBigIpPassword,
-			GtmBigIPURL:      params.GTMParams.GTMBigIpUrl,
-		}
-	}
 	//For IPV6 net config is not required. f5-sdk doesnt support ipv6
 	if !(params.EnableIPV6) {
 		agent.startPythonDriver(
 			gs,
 			bs,
-			gtm,
+			gtmBigIPSection{},
 			params.PythonBaseDir,
 		)
+		// Python driver configures the BIG-IP it is started with, so that it is restarted on failover
+		postMgr.setActiveURLHandler(agent.restartPythonDriver)
+		agent.restartPythonDriver()
 	}
 	return agent
 }
 
+// getGTMPostParams returns the parameters to post the GSLB declaration to the GTM BIG-IP
+// GSLB declaration is posted to the LTM BIG-IP when the GTM BIG-IP is not configured
+func getGTMPostParams(params AgentParams) PostParams {
+	gtmParams := params.PostParams
+	// Drift of the GSLB tenant is corrected on the next update of ExternalDNS resources
+	gtmParams.DriftCheckInterval = 0
+	gtmParams.TenantLabel = tenantLabelPrefix + params.Partition + gtmPartitionSuffix
+	if len(params.GTMParams.GTMBigIpUrl) == 0 || len(params.GTMParams.GTMBigIpUsername) == 0 || len(params.GTMParams.GTMBigIpPassword) == 0 {
+		log.Warning("Creating GTM with default bigip credentials as GTM BIGIP Url or GTM BIGIP Username or GTM BIGIP Password is missing on CIS args.")
+		return gtmParams
+	}
+	gtmParams.BIGIPURL = params.GTMParams.GTMBigIpUrl
+	gtmParams.BIGIPUsername = params.GTMParams.GTMBigIpUsername
+	gtmParams.BIGIPPassword = params.GTMParams.GTMBigIpPassword
+	gtmParams.BIGIPURLs = nil
+	// Token of the LTM BIG-IP is not valid on the GTM BIG-IP
+	gtmParams.TokenManager = nil
+	return gtmParams
+}
+
 func (agent *Agent) Stop() {
 	agent.ConfigWriter.Stop()
 	if !(agent.EnableIPV6) {
+		agent.pythonDriver.mutex.Lock()
 		agent.stopPythonDriver()
+		agent.pythonDriver.mutex.Unlock()
 	}
 }
 
-func (agent *Agent) PostConfig(rsConfig ResourceConfigWrapper) {
-	if !(agent.EnableIPV6) {
-		agent.PostGTMConfig(rsConfig)
-	}
+// PostConfig posts the configuration to BIG-IP, returns false when it is not posted as it has not changed
+func (agent *Agent) PostConfig(rsConfig ResourceConfigWrapper) bool {
+	agent.declMutex.Lock()
+	defer agent.declMutex.Unlock()
+	agent.postGTMConfig(rsConfig)
 	decl := createAS3Declaration(rsConfig, agent.userAgent)
 	if DeepEqualJSON(agent.activeDecl, decl) {
 		log.Debug("[AS3] No Change in the Configuration")
-		return
+		return false
 	}
 	cfg := agentConfig{
 		data:      string(decl),
@@ -165,37 +181,74 @@ func (agent *Agent) PostConfig(rsConfig ResourceConfigWrapper) {
 		case <-time.After(3 * time.Second):
 		}
 	}
+	return true
 }
 
-func (agent Agent) SetResponseChannel(respChan chan int) {
+// OnStartedLeading posts the configuration held by the Agent while it was a standby
+func (agent *Agent) OnStartedLeading() {
+	agent.declMutex.Lock()
+	defer agent.declMutex.Unlock()
+	log.Infof("[AS3] Acquired leadership, posting configuration to BIG-IP")
+	agent.SetLeader(true)
+	if agent.GTMPostManager != nil {
+		agent.GTMPostManager.SetLeader(true)
+	}
+}
+
+// OnStoppedLeading moves the Agent back to standby
+func (agent *Agent) OnStoppedLeading() {
+	agent.declMutex.Lock()
+	defer agent.declMutex.Unlock()
+	log.Infof("[AS3] Lost leadership, moving to standby")
+	agent.SetLeader(false)
+	if agent.GTMPostManager != nil {
+		agent.GTMPostManager.SetLeader(false)
+	}
+}
+
+func (agent *Agent) SetResponseChannel(respChan chan agentResponse) {
 	agent.PostManager.respChan = respChan
 }
 
-func (agent Agent) PostGTMConfig(config ResourceConfigWrapper) {
+func (agent *Agent) SetDriftChannel(driftChan chan string) {
+	agent.PostManager.driftChan = driftChan
+}
 
-	dnsConfig := make(map[string]interface{})
-	wideIPs := WideIPs{}
-	for _, v := range config.dnsConfig {
-		wideIPs.WideIPs = append(wideIPs.WideIPs, v)
+// SetGTMResponseChannel sets the channel receiving the result of posting the GSLB declaration
+func (agent *Agent) SetGTMResponseChannel(respChan chan agentResponse) {
+	if agent.GTMPostManager != nil {
+		agent.GTMPostManager.respChan = respChan
 	}
+}
 
-	// TODO: Need to change to DEFAULT_PARTITION from Common, once Agent starts to support DEFAULT_PARTITION
-	dnsConfig["Common"] = wideIPs
-
-	doneCh, errCh, err := agent.ConfigWriter.SendSection("gtm", dnsConfig)
+// PostGTMConfig posts the GSLB objects of the ExternalDNS resources to the GTM BIG-IP
+// Like the LTM declaration, it is posted only by the leader
+func (agent *Agent) PostGTMConfig(config ResourceConfigWrapper) {
+	agent.declMutex.Lock()
+	defer agent.declMutex.Unlock()
+	agent.postGTMConfig(config)
+}
 
-	if nil != err {
-		log.Warningf("Failed to write gtm config section: %v", err)
-	} else {
-		select {
-		case <-doneCh:
-			log.Debugf("Wrote gtm config section: %v", config.dnsConfig)
-		case e := <-errCh:
-			log.Warningf("Failed to write gtm config section: %v", e)
-		case <-time.After(time.Second):
-			log.Warningf("Did not receive write response in 1s")
-		}
+func (agent *Agent) postGTMConfig(config ResourceConfigWrapper) {
+	if agent.GTMPostManager == nil {
+		return
+	}
+	// GSLB tenant is not declared until an ExternalDNS is processed, to avoid
+	// posting to BIG-IPs without GTM provisioned
+	if len(config.dnsConfig) == 0 && agent.activeGTMDecl == "" {
+		return
+	}
+	decl := createGTMDeclaration(config, agent.userAgent, agent.activeGTMDecl)
+	if DeepEqualJSON(agent.activeGTMDecl, decl) {
+		log.Debug("[GTM] No Change in the Configuration")
+		return
 	}
+	agent.GTMPostManager.Write(agentConfig{
+		data:      string(decl),
+		as3APIURL: agent.GTMPostManager.getAS3APIURL(nil),
+		id:        config.reqId,
+	})
+	agent.activeGTMDecl = decl
 }
 
 //Create AS3 declaration
@@ -221,6 +274,22 @@ func createAS3Declaration(config ResourceConfigWrapper, userAgentInfo string) as
 }
 
 func createAS3ADC(config ResourceConfigWrapper) as3ADC {
+	as3JSONDecl := as3ADC{}
+	tenantRsCfgs := config.rsCfgs.groupByTenant()
+	// Default partition is always declared, so that it gets cleaned up once all its resources are removed
+	if _, ok := tenantRsCfgs[DEFAULT_PARTITION]; !ok {
+		tenantRsCfgs[DEFAULT_PARTITION] = ResourceConfigs{}
+	}
+	for tenantName, rsCfgs := range tenantRsCfgs {
+		tenantConfig := config
+		tenantConfig.rsCfgs = rsCfgs
+		tenantConfig.customProfiles = config.customProfiles.getProfilesForResources(rsCfgs)
+		as3JSONDecl[tenantName] = createAS3Tenant(tenantConfig)
+	}
+	return as3JSONDecl
+}
+
+func createAS3Tenant(config ResourceConfigWrapper) as3Tenant {
 	// Create Shared as3Application object
 	sharedApp := as3Application{}
 	sharedApp["class"] = "Application"
@@ -239,15 +308,11 @@ func createAS3ADC(config ResourceConfigWrapper) as3ADC {
 	processDataGroupForAS3(config, sharedApp)
 
 	// Create AS3 Tenant
-	tenant := as3Tenant{
+	return as3Tenant{
 		"class":              "Tenant",
 		"defaultRouteDomain": config.defaultRouteDomain,
 		as3SharedApplication: sharedApp,
 	}
-	as3JSONDecl := as3ADC{
-		DEFAULT_PARTITION: tenant,
-	}
-	return as3JSONDecl
 }
 
 func processIRulesForAS3(config ResourceConfigWrapper, sharedApp as3Application) {
@@ -393,29 +458,42 @@ func createPoliciesDecl(cfg *ResourceConfig, sharedApp as3Application) {
 func createPoolDecl(cfg *ResourceConfig, sharedApp as3Application, shareNodes bool) {
 	for _, v := range cfg.Pools {
 		pool := &as3Pool{}
-		// TODO
-		// pool.LoadBalancingMode = v.Balance
+		pool.LoadBalancingMode = v.Balance
+		pool.SlowRampTime = v.SlowRampTime
+		pool.MinimumMonitors = v.MinimumMonitors
+		pool.ReselectTries = v.ReselectTries
 		pool.Class = "Pool"
 		for _, val := range v.Members {
 			var member as3PoolMember
 			member.AddressDiscovery = "static"
 			member.ServicePort = val.Port
 			member.ServerAddresses = append(member.ServerAddresses, val.Address)
+			member.ConnectionLimit = v.ConnectionLimit
+			member.RateLimit = v.RateLimit
+			member.Ratio = v.Ratio
 			if shareNodes {
 				member.ShareNodes = shareNodes
 			}
+			// Terminating endpoints are disabled to drain their connections
+			if val.Session == rsc.MemberSessionDisabled {
+				member.AdminState = "disable"
+			}
 			pool.Members = append(pool.Members, member)
 		}
 		for _, val := range v.MonitorNames {
 			var monitor as3ResourcePointer
 			use := strings.Split(val, "/")
 			monitor.Use = fmt.Sprintf("/%s/%s/%s",
-				DEFAULT_PARTITION,
+				cfg.Virtual.tenant(),
 				as3SharedApplication,
 				use[len(use)-1],
 			)
 			pool.Monitors = append(pool.Monitors, monitor)
 		}
+		// Existing BIG-IP monitors are referred to by path
+		for _, val := range v.MonitorRefs {
+			pool.Monitors = append(pool.Monitors, as3ResourcePointer{BigIP: val})
+		}
 		sharedApp[v.Name] = pool
 	}
 }
@@ -442,7 +520,8 @@ func processIrulesForCRD(cfg *ResourceConfig, svc *as3Service) {
 		}
 		if strings.HasSuffix(iRuleNoPort, HttpRedirectIRuleName) ||
 			strings.HasSuffix(iRuleNoPort, HttpRedirectNoHostIRuleName) ||
-			strings.HasSuffix(iRuleName, TLSIRuleName) {
+			strings.HasSuffix(iRuleName, TLSIRuleName) ||
+			strings.HasSuffix(iRuleName, AbDeploymentPathIRuleName) {
 
 			IRules = append(IRules, iRuleName)
 		} else {
@@ -463,7 +542,7 @@ func createServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 	case numPolicies == 1:
 		policyName := cfg.Virtual.Policies[0].Name
 		svc.PolicyEndpoint = fmt.Sprintf("/%s/%s/%s",
-			DEFAULT_PARTITION,
+			cfg.Virtual.tenant(),
 			as3SharedApplication,
 			policyName)
 	case numPolicies > 1:
@@ -473,7 +552,7 @@ func createServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 				peps,
 				as3ResourcePointer{
 					Use: fmt.Sprintf("/%s/%s/%s",
-						DEFAULT_PARTITION,
+						cfg.Virtual.tenant(),
 						as3SharedApplication,
 						pep.Name,
 					),
@@ -486,7 +565,7 @@ func createServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 		ps := strings.Split(cfg.Virtual.PoolName, "/")
 		if cfg.Virtual.PoolName != "" {
 			svc.Pool = fmt.Sprintf("/%s/%s/%s",
-				DEFAULT_PARTITION,
+				cfg.Virtual.tenant(),
 				as3SharedApplication,
 				ps[len(ps)-1])
 		}
@@ -499,9 +578,12 @@ func createServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 		svc.TranslateServerPort = true
 		svc.Class = "Service_HTTP"
 	} else {
-		svc.PersistenceMethods = cfg.Virtual.PersistenceMethods
+		for _, method := range cfg.Virtual.PersistenceMethods {
+			svc.PersistenceMethods = append(svc.PersistenceMethods, method)
+		}
 		svc.Class = "Service_TCP"
 	}
+	createPersistenceDecl(cfg, svc, sharedApp)
 
 	// Attaching Profiles from Policy CRD
 	for _, profile := range cfg.Virtual.Profiles {
@@ -531,6 +613,10 @@ func createServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 					BigIP: fmt.Sprintf("%v", profile.Name),
 				}
 			}
+		case "rewrite":
+			svc.ProfileRewrite = &as3ResourcePointer{
+				BigIP: fmt.Sprintf("%v", profile.Name),
+			}
 		}
 	}
 
@@ -686,10 +772,13 @@ func createRuleAction(rl *Rule, rulesData *as3Rule) {
 		if v.Request {
 			action.Event = "request"
 		}
+		if v.Response {
+			action.Event = "response"
+		}
 		if v.Redirect {
 			action.Type = "httpRedirect"
 		}
-		if v.HTTPHost {
+		if v.HTTPHost || v.HTTPHeader {
 			action.Type = "httpHeader"
 		}
 		if v.HTTPURI {
@@ -711,6 +800,25 @@ func createRuleAction(rl *Rule, rulesData *as3Rule) {
 				Value: v.Value,
 			}
 		}
+		// handle header insert, replace and remove.
+		if v.HTTPHeader {
+			switch {
+			case v.Insert:
+				action.Insert = &as3ActionReplaceMap{
+					Name:  v.TmName,
+					Value: v.Value,
+				}
+			case v.Replace:
+				action.Replace = &as3ActionReplaceMap{
+					Name:  v.TmName,
+					Value: v.Value,
+				}
+			case v.Remove:
+				action.Remove = &as3ActionReplaceMap{
+					Name: v.TmName,
+				}
+			}
+		}
 		p := strings.Split(v.Pool, "/")
 		if v.Pool != "" {
 			action.Select = &as3ActionForwardSelect{
@@ -779,7 +887,7 @@ func processTLSProfilesForAS3(virtual *Virtual, svc *as3Service, profileName str
 			// Profile is stored in a k8s secret
 			if profile.Partition == "" {
 				// Incoming traffic (clientssl) from a web client will be handled by ServerTLS in AS3
-				svc.ServerTLS = fmt.Sprintf("/%v/%v/%v%v", DEFAULT_PARTITION,
+				svc.ServerTLS = fmt.Sprintf("/%v/%v/%v%v", virtual.tenant(),
 					as3SharedApplication, profileName, as3ServerSuffix)
 
 			} else {
@@ -794,7 +902,7 @@ func processTLSProfilesForAS3(virtual *Virtual, svc *as3Service, profileName str
 			// Profile is stored in a k8s secret
 			if profile.Partition == "" {
 				// Outgoing traffic (serverssl) to BackEnd Servers from BigIP will be handled by ClientTLS in AS3
-				svc.ClientTLS = fmt.Sprintf("/%v/%v/%v%v", DEFAULT_PARTITION,
+				svc.ClientTLS = fmt.Sprintf("/%v/%v/%v%v", virtual.tenant(),
 					as3SharedApplication, profileName, as3ClientSuffix)
 			} else {
 				// Profile is a BIG-IP reference
@@ -934,35 +1042,63 @@ func createMonitorDecl(cfg *ResourceConfig, sharedApp as3Application) {
 		monitor.Interval = v.Interval
 		monitor.MonitorType = v.Type
 		monitor.Timeout = v.Timeout
+		if v.Type == "icmp" || v.Type == "gateway-icmp" {
+			// ICMP monitors probe the address only, AS3 rejects the port and send/receive strings
+			sharedApp[v.Name] = monitor
+			continue
+		}
 		val := 0
-		monitor.TargetPort = &v.TargetPort
+		targetPort := v.TargetPort
+		monitor.TargetPort = &targetPort
 		targetAddressStr := ""
 		monitor.TargetAddress = &targetAddressStr
+		send := v.Send
+		recv := v.Recv
 		//Monitor type
 		switch v.Type {
 		case "http":
 			adaptiveFalse := false
 			monitor.Adaptive = &adaptiveFalse
 			monitor.Dscp = &val
-			monitor.Receive = "none"
+			recv = "none"
 			if v.Recv != "" {
-				monitor.Receive = v.Recv
+				recv = v.Recv
 			}
+			monitor.Receive = &recv
 			monitor.TimeUnitilUp = &val
-			monitor.Send = v.Send
+			monitor.Send = &send
 		case "https":
-			//Todo: For https monitor type
 			adaptiveFalse := false
 			monitor.Adaptive = &adaptiveFalse
-			if v.Recv != "" {
-				monitor.Receive = v.Recv
+			monitor.Receive = &recv
+			monitor.Send = &send
+			// Client certificate is declared next to the monitor
+			if v.ClientCert != "" && v.ClientKey != "" {
+				certName := v.Name + "_client_cert"
+				sharedApp[certName] = &as3Certificate{
+					Class:       "Certificate",
+					Certificate: v.ClientCert,
+					PrivateKey:  v.ClientKey,
+				}
+				monitor.ClientCertificate = certName
 			}
-			monitor.Send = v.Send
 		case "tcp", "udp":
 			adaptiveFalse := false
 			monitor.Adaptive = &adaptiveFalse
-			monitor.Receive = v.Recv
-			monitor.Send = v.Send
+			monitor.Receive = &recv
+			monitor.Send = &send
+		case "dns":
+			monitor.QueryName = v.QueryName
+			monitor.QueryType = v.QueryType
+			if v.Recv != "" {
+				monitor.Receive = &recv
+			}
+		case "ldap":
+			monitor.Base = v.Base
+			monitor.Filter = v.Filter
+		case "external":
+			monitor.Pathname = v.Pathname
+			monitor.Arguments = v.Arguments
 		}
 		sharedApp[v.Name] = monitor
 	}
@@ -1038,10 +1174,54 @@ func createTransportServiceDecl(cfg *ResourceConfig, sharedApp as3Application) {
 		}
 	}
 	svc.Pool = cfg.Virtual.PoolName
+	createPersistenceDecl(cfg, svc, sharedApp)
 	processCommonDecl(cfg, svc)
 	sharedApp[cfg.Virtual.Name] = svc
 }
 
+// Create AS3 persistence of the virtual server, referring to the BIG-IP persistence profile
+// or to a Persist declared for the persistence method
+func createPersistenceDecl(cfg *ResourceConfig, svc *as3Service, sharedApp as3Application) {
+	persistence := cfg.Virtual.Persistence
+	if persistence == nil {
+		return
+	}
+	switch {
+	case persistence.Reference != "":
+		svc.PersistenceMethods = []as3MultiTypeParam{
+			&as3ResourcePointer{BigIP: persistence.Reference},
+		}
+	case persistence.Method != "":
+		persist := &as3Persist{
+			Class:             "Persist",
+			PersistenceMethod: persistence.Method,
+		}
+		switch persistence.Method {
+		case "cookie":
+			persist.CookieMethod = persistence.CookieMethod
+			if persist.CookieMethod == "" {
+				persist.CookieMethod = "insert"
+			}
+			persist.CookieName = persistence.CookieName
+			persist.TTL = persistence.Timeout
+		case "source-address", "destination-address":
+			persist.AddressMask = persistence.AddressMask
+			persist.Duration = persistence.Timeout
+		case "universal":
+			persist.Duration = persistence.Timeout
+			if persistence.Rule != "" {
+				persist.IRule = &as3ResourcePointer{BigIP: persistence.Rule}
+			}
+		}
+		persistName := fmt.Sprintf("%s_persist", cfg.Virtual.Name)
+		sharedApp[persistName] = persist
+		svc.PersistenceMethods = []as3MultiTypeParam{
+			&as3ResourcePointer{Use: persistName},
+		}
+	}
+	svc.FallbackPersistence = persistence.FallbackPersistence
+}
+
 //Process common declaration for VS and TS
 func processCommonDecl(cfg *ResourceConfig, svc *as3Service) {
 
@@ -1068,6 +1248,26 @@ func processCommonDecl(cfg *ResourceConfig, svc *as3Service) {
 		}
 	}
 
+	//Attach DoS profile
+	if cfg.Virtual.ProfileDOS != "" {
+		svc.ProfileDOS = &as3ResourcePointer{
+			BigIP: fmt.Sprintf("%v", cfg.Virtual.ProfileDOS),
+		}
+	}
+
+	//Attach LTM policy along with the policies generated by CIS
+	if cfg.Virtual.LTMPolicy != "" {
+		ltmPolicy := as3ResourcePointer{BigIP: cfg.Virtual.LTMPolicy}
+		switch pep := svc.PolicyEndpoint.(type) {
+		case string:
+			svc.PolicyEndpoint = []as3ResourcePointer{{Use: pep}, ltmPolicy}
+		case []as3ResourcePointer:
+			svc.PolicyEndpoint = append(pep, ltmPolicy)
+		default:
+			svc.PolicyEndpoint = []as3ResourcePointer{ltmPolicy}
+		}
+	}
+
 	//Attach logging profile
 	if cfg.Virtual.LogProfiles != nil {
 		for _, lp := range cfg.Virtual.LogProfiles {
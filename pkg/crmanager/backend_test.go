@@ -1,7 +1,8 @@
 package crmanager
 
 import (
-	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	"encoding/json"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -9,6 +10,7 @@ import (
 var _ = Describe("Backend Tests", func() {
 
 	It("DNS Config", func() {
+		DEFAULT_PARTITION = "test"
 		dnsConfig := DNSConfig{
 			"test.com": WideIP{
 				DomainName: "test.com",
@@ -19,7 +21,11 @@ var _ = Describe("Backend Tests", func() {
 						Name:       "pool1",
 						RecordType: "A",
 						LBMethod:   "round-robin",
-						Members:    []string{"vs1", "vs2"},
+						Members: []GSLBPoolMember{
+							{Server: "/Common/server1", VirtualServer: "/test/Shared/vs1"},
+							{Server: "server2", VirtualServer: "/test/Shared/vs2", Ratio: 2},
+							{Address: "10.1.1.1", Port: 443, DataCenter: "DC1"},
+						},
 						Monitor: &Monitor{
 							Name:     "pool1_monitor",
 							Interval: 10,
@@ -40,24 +46,86 @@ var _ = Describe("Backend Tests", func() {
 			defaultRouteDomain: 1,
 		}
 
-		writer := &test.MockWriter{
-			FailStyle: test.Success,
-			Sections:  make(map[string]interface{}),
-		}
-		agent := newMockAgent(writer)
-		agent.PostGTMConfig(config)
+		var as3Config map[string]interface{}
+		Expect(json.Unmarshal([]byte(createGTMDeclaration(config, "", "")), &as3Config)).To(BeNil())
+		adc := as3Config["declaration"].(map[string]interface{})
+		Expect(adc).To(HaveKey("test_gtm"), "GSLB objects should be declared in the GTM tenant")
+		app := adc["test_gtm"].(map[string]interface{})["Shared"].(map[string]interface{})
+
+		domain := app["test_com"].(map[string]interface{})
+		Expect(domain["class"]).To(Equal("GSLB_Domain"))
+		Expect(domain["domainName"]).To(Equal("test.com"))
+		Expect(domain["pools"]).To(Equal([]interface{}{map[string]interface{}{"use": "pool1"}}))
+
+		pool := app["pool1"].(map[string]interface{})
+		Expect(pool["class"]).To(Equal("GSLB_Pool"))
+		Expect(pool["members"]).To(Equal([]interface{}{
+			map[string]interface{}{
+				"enabled":       true,
+				"server":        map[string]interface{}{"bigip": "/Common/server1"},
+				"virtualServer": "/test/Shared/vs1",
+			},
+			map[string]interface{}{
+				"enabled":       true,
+				"server":        map[string]interface{}{"bigip": "/Common/server2"},
+				"virtualServer": "/test/Shared/vs2",
+				"ratio":         float64(2),
+			},
+			map[string]interface{}{
+				"enabled":       true,
+				"server":        map[string]interface{}{"use": "/Common/Shared/gslb_server_10_1_1_1"},
+				"virtualServer": "vs_10_1_1_1_443",
+			},
+		}))
+		Expect(app).NotTo(HaveKey("gslb_server_10_1_1_1"), "GSLB server is allowed only in /Common/Shared")
+		Expect(adc).To(HaveKey("Common"), "GSLB servers of static addresses should be declared in Common tenant")
+		commonApp := adc["Common"].(map[string]interface{})["Shared"].(map[string]interface{})
+		server := commonApp["gslb_server_10_1_1_1"].(map[string]interface{})
+		Expect(server["class"]).To(Equal("GSLB_Server"))
+		Expect(server["serverType"]).To(Equal("generic-host"))
+		Expect(server["dataCenter"]).To(Equal(map[string]interface{}{"bigip": "/Common/DC1"}))
+		Expect(server["virtualServers"]).To(Equal([]interface{}{
+			map[string]interface{}{"name": "vs_10_1_1_1_443", "address": "10.1.1.1", "port": float64(443)},
+		}), "Static member should be a virtual server of the generic host")
+		Expect(pool["monitors"]).To(Equal([]interface{}{map[string]interface{}{"use": "pool1_monitor"}}))
+		Expect(app["pool1_monitor"].(map[string]interface{})["class"]).To(Equal("GSLB_Monitor"))
 
-		writer.FailStyle = test.ImmediateFail
-		agent = newMockAgent(writer)
+		// Once no static address is left, GSLB servers are removed from /Common/Shared
+		static := createGTMDeclaration(config, "", "")
+		dnsConfig["test.com"].Pools[0].Members = dnsConfig["test.com"].Pools[0].Members[:2]
+		as3Config = nil
+		Expect(json.Unmarshal([]byte(createGTMDeclaration(config, "", static)), &as3Config)).To(BeNil())
+		adc = as3Config["declaration"].(map[string]interface{})
+		Expect(adc["Common"]).To(Equal(map[string]interface{}{
+			"class":  "Tenant",
+			"Shared": map[string]interface{}{"class": "Application", "template": "shared"},
+		}))
+		removed := createGTMDeclaration(config, "", "")
+		as3Config = nil
+		Expect(json.Unmarshal([]byte(createGTMDeclaration(config, "", removed)), &as3Config)).To(BeNil())
+		Expect(as3Config["declaration"]).NotTo(HaveKey("Common"), "Common tenant should not be declared without GSLB servers")
+
+		agent := newMockAgent(nil)
 		agent.PostGTMConfig(config)
+		agent.GTMPostManager = &PostManager{
+			postChan:   make(chan agentConfig, 1),
+			PostParams: PostParams{BIGIPURL: "https://gtm.example.com"},
+		}
+		agent.PostGTMConfig(ResourceConfigWrapper{})
+		Expect(agent.GTMPostManager.postChan).To(BeEmpty(),
+			"GTM tenant should not be declared without ExternalDNS")
 
-		writer.FailStyle = test.Timeout
-		agent = newMockAgent(writer)
 		agent.PostGTMConfig(config)
+		Expect(agent.GTMPostManager.postChan).To(HaveLen(1))
+		cfg := <-agent.GTMPostManager.postChan
+		Expect(cfg.as3APIURL).To(Equal("https://gtm.example.com/mgmt/shared/appsvcs/declare/"))
 
-		writer.FailStyle = test.AsyncFail
-		agent = newMockAgent(writer)
 		agent.PostGTMConfig(config)
+		Expect(agent.GTMPostManager.postChan).To(BeEmpty(), "Unchanged declaration should not be posted")
+
+		agent.PostGTMConfig(ResourceConfigWrapper{})
+		Expect(agent.GTMPostManager.postChan).To(HaveLen(1),
+			"GTM tenant should be cleaned up once all ExternalDNS are removed")
 	})
 
 	Describe("Prepare AS3 Declaration", func() {
@@ -306,6 +374,223 @@ var _ = Describe("Backend Tests", func() {
 			Expect(string(decl)).ToNot(Equal(""), "Failed to Create AS3 Declaration")
 
 		})
+		It("Disabled pool members", func() {
+			mem2.Session = "user-disabled"
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Name = "crd_vs_172.13.14.15"
+			rsCfg.Pools = Pools{
+				Pool{
+					Name:    "pool1",
+					Members: []PoolMember{mem1, mem2},
+				},
+			}
+			sharedApp := as3Application{}
+			createPoolDecl(rsCfg, sharedApp, false)
+			pool := sharedApp["pool1"].(*as3Pool)
+			Expect(pool.Members).To(HaveLen(2))
+			Expect(pool.Members[0].AdminState).To(BeEmpty())
+			Expect(pool.Members[1].AdminState).To(Equal("disable"),
+				"Terminating member should be disabled")
+		})
+		It("Pool load balancing options", func() {
+			slowRampTime := int32(30)
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Name = "crd_vs_172.13.14.15"
+			rsCfg.Pools = Pools{
+				Pool{
+					Name:            "pool1",
+					Members:         []PoolMember{mem1, mem2},
+					Balance:         "least-connections-member",
+					SlowRampTime:    &slowRampTime,
+					MinimumMonitors: 1,
+					ReselectTries:   2,
+					ConnectionLimit: 100,
+					RateLimit:       50,
+					Ratio:           3,
+				},
+			}
+			sharedApp := as3Application{}
+			createPoolDecl(rsCfg, sharedApp, false)
+			pool := sharedApp["pool1"].(*as3Pool)
+			Expect(pool.LoadBalancingMode).To(Equal("least-connections-member"))
+			Expect(*pool.SlowRampTime).To(BeEquivalentTo(30))
+			Expect(pool.MinimumMonitors).To(BeEquivalentTo(1))
+			Expect(pool.ReselectTries).To(BeEquivalentTo(2))
+			for _, member := range pool.Members {
+				Expect(member.ConnectionLimit).To(BeEquivalentTo(100))
+				Expect(member.RateLimit).To(BeEquivalentTo(50))
+				Expect(member.Ratio).To(BeEquivalentTo(3))
+			}
+
+			rsCfg.Pools[0] = Pool{Name: "pool1", Members: []PoolMember{mem1}}
+			createPoolDecl(rsCfg, sharedApp, false)
+			data, _ := json.Marshal(sharedApp["pool1"])
+			Expect(string(data)).ToNot(ContainSubstring("slowRampTime"),
+				"Unset options should be left to the AS3 defaults")
+			Expect(string(data)).ToNot(ContainSubstring("loadBalancingMode"))
+		})
+		It("Monitor declarations", func() {
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Name = "crd_vs_172.13.14.15"
+			rsCfg.Virtual.Partition = "test"
+			rsCfg.Pools = Pools{
+				Pool{
+					Name:         "pool1",
+					MonitorNames: []string{"/test/https_monitor"},
+					MonitorRefs:  []string{"/Common/gateway_icmp"},
+				},
+			}
+			rsCfg.Monitors = Monitors{
+				{Name: "https_monitor", Type: "https", Send: "GET /", ClientCert: "cert", ClientKey: "key"},
+				{Name: "dns_monitor", Type: "dns", QueryName: "test.com", QueryType: "a"},
+				{Name: "external_monitor", Type: "external", Pathname: "/Common/check", Arguments: "-v"},
+			}
+			sharedApp := as3Application{}
+			createMonitorDecl(rsCfg, sharedApp)
+			createPoolDecl(rsCfg, sharedApp, false)
+
+			https := sharedApp["https_monitor"].(*as3Monitor)
+			Expect(https.ClientCertificate).To(Equal("https_monitor_client_cert"))
+			Expect(sharedApp).To(HaveKey("https_monitor_client_cert"))
+			Expect(*https.Send).To(Equal("GET /"))
+
+			dns := sharedApp["dns_monitor"].(*as3Monitor)
+			Expect(dns.QueryName).To(Equal("test.com"))
+			Expect(dns.Receive).To(BeNil(), "Unset receive of dns monitor should be left to the AS3 default")
+			external := sharedApp["external_monitor"].(*as3Monitor)
+			Expect(external.Pathname).To(Equal("/Common/check"))
+			Expect(external.Send).To(BeNil())
+
+			pool := sharedApp["pool1"].(*as3Pool)
+			Expect(pool.Monitors).To(Equal([]as3ResourcePointer{
+				{Use: "/test/Shared/https_monitor"},
+				{BigIP: "/Common/gateway_icmp"},
+			}))
+		})
+		It("Persistence declarations", func() {
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Name = "crd_vs_172.13.14.15"
+			rsCfg.Virtual.Partition = "test"
+			rsCfg.Virtual.PersistenceMethods = []string{"tls-session-id"}
+			sharedApp := as3Application{}
+			createServiceDecl(rsCfg, sharedApp)
+			svc := sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.PersistenceMethods).To(Equal([]as3MultiTypeParam{"tls-session-id"}))
+
+			rsCfg.Virtual.PersistenceMethods = nil
+			rsCfg.Virtual.Persistence = &Persistence{
+				Method:              "cookie",
+				CookieName:          "session",
+				Timeout:             3600,
+				FallbackPersistence: "source-address",
+			}
+			createServiceDecl(rsCfg, sharedApp)
+			svc = sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.PersistenceMethods).To(Equal([]as3MultiTypeParam{
+				&as3ResourcePointer{Use: "crd_vs_172.13.14.15_persist"},
+			}))
+			Expect(svc.FallbackPersistence).To(Equal("source-address"))
+			Expect(sharedApp["crd_vs_172.13.14.15_persist"]).To(Equal(&as3Persist{
+				Class:             "Persist",
+				PersistenceMethod: "cookie",
+				CookieMethod:      "insert",
+				CookieName:        "session",
+				TTL:               3600,
+			}))
+
+			rsCfg.Virtual.Persistence = &Persistence{Method: "source-address", AddressMask: "255.255.255.0", Timeout: 300}
+			createTransportServiceDecl(rsCfg, sharedApp)
+			persist := sharedApp["crd_vs_172.13.14.15_persist"].(*as3Persist)
+			Expect(persist.AddressMask).To(Equal("255.255.255.0"))
+			Expect(persist.Duration).To(BeEquivalentTo(300))
+
+			rsCfg.Virtual.Persistence = &Persistence{Reference: "/Common/cookie"}
+			createServiceDecl(rsCfg, sharedApp)
+			svc = sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.PersistenceMethods).To(Equal([]as3MultiTypeParam{
+				&as3ResourcePointer{BigIP: "/Common/cookie"},
+			}))
+		})
+		It("Policy profiles and LTM policies", func() {
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Name = "crd_vs_172.13.14.15"
+			rsCfg.Virtual.Partition = "test"
+			rsCfg.Virtual.ProfileDOS = "/Common/dos"
+			rsCfg.Virtual.LTMPolicy = "/Common/ltm_policy"
+			rsCfg.Virtual.Profiles = ProfileRefs{{Name: "/Common/rewrite", Context: "rewrite"}}
+			sharedApp := as3Application{}
+			createServiceDecl(rsCfg, sharedApp)
+			svc := sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.ProfileDOS).To(Equal(&as3ResourcePointer{BigIP: "/Common/dos"}))
+			Expect(svc.ProfileRewrite).To(Equal(&as3ResourcePointer{BigIP: "/Common/rewrite"}))
+			Expect(svc.PolicyEndpoint).To(Equal([]as3ResourcePointer{{BigIP: "/Common/ltm_policy"}}))
+
+			rsCfg.Virtual.Policies = []nameRef{{Name: "crd_vs_policy", Partition: "test"}}
+			createServiceDecl(rsCfg, sharedApp)
+			svc = sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.PolicyEndpoint).To(Equal([]as3ResourcePointer{
+				{Use: "/test/Shared/crd_vs_policy"},
+				{BigIP: "/Common/ltm_policy"},
+			}), "LTM policy should be merged with the policy generated by CIS")
+
+			rsCfg.Virtual.Policies = append(rsCfg.Virtual.Policies, nameRef{Name: "crd_vs_policy_2", Partition: "test"})
+			createServiceDecl(rsCfg, sharedApp)
+			svc = sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.PolicyEndpoint).To(HaveLen(3))
+
+			createTransportServiceDecl(rsCfg, sharedApp)
+			svc = sharedApp["crd_vs_172.13.14.15"].(*as3Service)
+			Expect(svc.ProfileDOS).To(Equal(&as3ResourcePointer{BigIP: "/Common/dos"}))
+			Expect(svc.ProfileRewrite).To(BeNil())
+			Expect(svc.PolicyEndpoint).To(Equal([]as3ResourcePointer{{BigIP: "/Common/ltm_policy"}}))
+		})
+		It("Header rule actions", func() {
+			rl := &Rule{
+				Actions: []*action{
+					{Name: "0", HTTPHost: true, Replace: true, Request: true, Value: "internal.test.com"},
+					{Name: "1", HTTPHeader: true, Insert: true, Request: true, TmName: "X-Forwarded-Proto", Value: "https"},
+					{Name: "2", HTTPHeader: true, Replace: true, Response: true, TmName: "Server", Value: "test"},
+					{Name: "3", HTTPHeader: true, Remove: true, Response: true, TmName: "X-Powered-By"},
+				},
+			}
+			rulesData := &as3Rule{}
+			createRuleAction(rl, rulesData)
+			Expect(rulesData.Actions).To(Equal([]*as3Action{
+				{Type: "httpHeader", Event: "request", Replace: &as3ActionReplaceMap{Name: "host", Value: "internal.test.com"}},
+				{Type: "httpHeader", Event: "request", Insert: &as3ActionReplaceMap{Name: "X-Forwarded-Proto", Value: "https"}},
+				{Type: "httpHeader", Event: "response", Replace: &as3ActionReplaceMap{Name: "Server", Value: "test"}},
+				{Type: "httpHeader", Event: "response", Remove: &as3ActionReplaceMap{Name: "X-Powered-By"}},
+			}))
+		})
+		It("Tenant Declarations", func() {
+			DEFAULT_PARTITION = "test"
+			rsCfg := &ResourceConfig{}
+			rsCfg.MetaData.ResourceType = TransportServer
+			rsCfg.Virtual.Name = "crd_ts_172_13_14_6_1600"
+			rsCfg.Virtual.Partition = "team1"
+			rsCfg.Virtual.Mode = "standard"
+			rsCfg.Virtual.Destination = "/team1/172.13.14.6:1600"
+			rsCfg.Virtual.PoolName = "pool1"
+			rsCfg.Pools = Pools{
+				Pool{
+					Name:    "pool1",
+					Members: []PoolMember{mem1},
+				},
+			}
+
+			config := ResourceConfigWrapper{
+				rsCfgs:         ResourceConfigs{rsCfg},
+				customProfiles: NewCustomProfiles(),
+			}
+
+			adc := createAS3ADC(config)
+			Expect(adc).To(HaveKey("team1"), "Tenant of the resource not declared")
+			Expect(adc).To(HaveKey("test"), "Default tenant not declared")
+			team1 := adc["team1"].(as3Tenant)[as3SharedApplication].(as3Application)
+			Expect(team1).To(HaveKey("pool1"), "Pool not declared in the tenant of the resource")
+			Expect(adc["test"].(as3Tenant)[as3SharedApplication].(as3Application)).NotTo(HaveKey("pool1"),
+				"Pool declared in the default tenant")
+		})
 	})
 
 	Describe("Misc", func() {
@@ -17,8 +17,11 @@
 package crmanager
 
 import (
+	"container/list"
+	"context"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
@@ -60,8 +63,18 @@ const (
 	Service = "Service"
 	// Endpoints is a k8s native Endpoint Resource.
 	Endpoints = "Endpoints"
+	// EndpointSlice is a k8s native EndpointSlice Resource.
+	EndpointSlice = "EndpointSlice"
 	// Namespace is k8s namespace
 	Namespace = "Namespace"
+	// K8sSecret is a k8s native Secret Resource.
+	K8sSecret = "Secret"
+	// GatewayClass, Gateway and Routes are Gateway API Resource Kinds
+	GatewayClass = "GatewayClass"
+	Gateway      = "Gateway"
+	HTTPRoute    = "HTTPRoute"
+	TLSRoute     = "TLSRoute"
+	TCPRoute     = "TCPRoute"
 
 	NodePortMode = "nodeport"
 
@@ -85,8 +98,17 @@ const (
 
 	LBServiceIPAMLabelAnnotation = "cis.f5.com/ipamLabel"
 	HealthMonitorAnnotation      = "cis.f5.com/health"
+	DrainTimeoutAnnotation       = "cis.f5.com/drain-timeout"
+
+	// TenantLabel places the resource in the given AS3 tenant
+	TenantLabel = "cis.f5.com/tenant"
+	// DefaultPolicyLabel applies the Policy to all the VirtualServers and TransportServers of its namespace
+	DefaultPolicyLabel = "cis.f5.com/default-policy"
 )
 
+// tenantNameRegex matches the names of BIG-IP partitions allowed as AS3 tenants
+var tenantNameRegex = regexp.MustCompile(`^[A-Za-z][0-9A-Za-z_.-]{0,63}$`)
+
 // NewCRManager creates a new CRManager Instance.
 func NewCRManager(params Params) *CRManager {
 
@@ -95,16 +117,23 @@ func NewCRManager(params Params) *CRManager {
 		crInformers: make(map[string]*CRInformer),
 		rscQueue: workqueue.NewNamedRateLimitingQueue(
 			workqueue.DefaultControllerRateLimiter(), "custom-resource-controller"),
+		policyUsageQueue:   workqueue.NewNamedDelayingQueue("policy-usage"),
+		policyUsageDelay:   policyUsageUpdateDelay,
 		resources:          NewResources(),
 		Agent:              params.Agent,
 		ControllerMode:     params.ControllerMode,
 		UseNodeInternal:    params.UseNodeInternal,
 		initState:          true,
 		SSLContext:         make(map[string]*v1.Secret),
-		dgPath:             strings.Join([]string{DEFAULT_PARTITION, "Shared"}, "/"),
+		tenantPerNamespace: params.TenantPerNamespace,
 		shareNodes:         params.ShareNodes,
 		eventNotifier:      apm.NewEventNotifier(nil),
 		defaultRouteDomain: params.DefaultRouteDomain,
+		requestQueue:       &requestQueueData{List: list.New()},
+		webhookParams:      params.Webhook,
+		useEndpointSlices:  params.EndpointSlices,
+		policyRefs:         make(map[string]string),
+		policyFinalizer:    params.PolicyFinalizer,
 	}
 
 	log.Debug("Custom Resource Manager Created")
@@ -115,6 +144,18 @@ func NewCRManager(params Params) *CRManager {
 		log.Errorf("Failed to Setup Clients: %v", err)
 	}
 
+	if params.GatewayAPI.Enabled {
+		if err := crMgr.setupGatewayClient(params.Config, params.GatewayAPI.ControllerName); err != nil {
+			log.Errorf("Failed to Setup Gateway API: %v", err)
+		}
+	}
+
+	if params.BaselinePolicy != "" {
+		if err := crMgr.setupBaselinePolicy(params.BaselinePolicy); err != nil {
+			log.Errorf("Failed to Setup Baseline Policy: %v", err)
+		}
+	}
+
 	namespaceSelector, err := createLabelSelector(params.NamespaceLabel)
 
 	if params.NamespaceLabel == "" || err != nil {
@@ -149,7 +190,14 @@ func NewCRManager(params Params) *CRManager {
 	if err != nil {
 		log.Errorf("Failed to Setup Node Polling: %v", err)
 	}
-	if params.IPAM {
+	if params.IPAM && params.IPAMConfigMap != "" {
+		ipamProvider, err := crMgr.newBuiltinIPAM(params.IPAMConfigMap)
+		if err != nil {
+			log.Errorf("[IPAM] Failed to Setup IPAM: %v", err)
+		} else {
+			crMgr.ipamProvider = ipamProvider
+		}
+	} else if params.IPAM {
 		ipamParams := ipammachinery.Params{
 			Config:        params.Config,
 			EventHandlers: crMgr.getEventHandlerForIPAM(),
@@ -164,9 +212,28 @@ func NewCRManager(params Params) *CRManager {
 		_ = crMgr.createIPAMResource()
 	}
 
-	respChan := make(chan int)
+	if params.LeaderElection.Enabled {
+		elector, err := crMgr.newLeaderElector(params.LeaderElection)
+		if err != nil {
+			log.Fatalf("Failed to Setup Leader Election: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		crMgr.leaderCancel = cancel
+		crMgr.leaderStopped = make(chan struct{})
+		go crMgr.runLeaderElection(ctx, elector)
+	}
+
+	respChan := make(chan agentResponse)
 	crMgr.Agent.SetResponseChannel(respChan)
 	go crMgr.responseHandler(respChan)
+	gtmRespChan := make(chan agentResponse)
+	crMgr.Agent.SetGTMResponseChannel(gtmRespChan)
+	go crMgr.gtmResponseHandler(gtmRespChan)
+	driftChan := make(chan string)
+	crMgr.Agent.SetDriftChannel(driftChan)
+	go crMgr.driftHandler(driftChan)
+	//Enable "/health", "/livez", "/readyz" and "/metrics" endpoint with crmanager
+	go crMgr.startHTTPServer()
 	go crMgr.Start()
 	return crMgr
 }
@@ -267,6 +334,23 @@ func createLabelSelector(label string) (labels.Selector, error) {
 	return l, nil
 }
 
+// getTenant returns the AS3 tenant of a resource.
+// Tenant label takes precedence over the namespace, when none applies the default partition is used.
+func (crMgr *CRManager) getTenant(objMeta metaV1.ObjectMeta) string {
+	if tenant, ok := objMeta.Labels[TenantLabel]; ok && tenant != "" {
+		if tenant == "Common" || !tenantNameRegex.MatchString(tenant) {
+			log.Errorf("Tenant %v is not allowed for %v/%v, using default partition %v",
+				tenant, objMeta.Namespace, objMeta.Name, DEFAULT_PARTITION)
+			return DEFAULT_PARTITION
+		}
+		return tenant
+	}
+	if crMgr.tenantPerNamespace && objMeta.Namespace != "" {
+		return objMeta.Namespace
+	}
+	return DEFAULT_PARTITION
+}
+
 // setupClients sets Kubernetes Clients.
 func (crMgr *CRManager) setupClients(config *rest.Config) error {
 	kubeCRClient, err := versioned.NewForConfig(config)
@@ -310,7 +394,16 @@ func (crMgr *CRManager) Start() {
 	log.Infof("Starting Custom Resource Manager")
 	defer utilruntime.HandleCrash()
 	defer crMgr.rscQueue.ShutDown()
-	for _, inf := range crMgr.crInformers {
+	defer crMgr.policyUsageQueue.ShutDown()
+	// Gateways are processed only for the GatewayClasses known to CIS
+	if crMgr.gwcInformer != nil {
+		crMgr.gwcInformer.start()
+	}
+	// Baseline Policy is applied to the virtuals processed once the informers are synced
+	if crMgr.baselinePlcInformer != nil {
+		crMgr.baselinePlcInformer.start()
+	}
+	for _, inf := range crMgr.getCRInformers() {
 		inf.start()
 	}
 
@@ -322,10 +415,20 @@ func (crMgr *CRManager) Start() {
 		go crMgr.ipamCli.Start()
 	}
 
+	// Webhook validates against the informer caches, so it is served only once they are synced
+	if crMgr.webhookParams.Port != 0 {
+		if err := crMgr.startWebhookServer(crMgr.webhookParams); err != nil {
+			log.Errorf("[Webhook] Failed to Setup Validating Admission Webhook: %v", err)
+		}
+	}
+
 	crMgr.nodePoller.Run()
 
 	stopChan := make(chan struct{})
 	go wait.Until(crMgr.customResourceWorker, time.Second, stopChan)
+	go wait.Until(crMgr.checkDrainingMembers, drainCheckInterval, stopChan)
+	go wait.Until(crMgr.policyUsageWorker, time.Second, stopChan)
+	go crMgr.policyUsageLeaderWorker()
 
 	<-stopChan
 	crMgr.Stop()
@@ -333,13 +436,28 @@ func (crMgr *CRManager) Start() {
 
 // Stop the Custom Resource Manager.
 func (crMgr *CRManager) Stop() {
-	for _, inf := range crMgr.crInformers {
+	if crMgr.leaderCancel != nil {
+		crMgr.leaderCancel()
+		// Wait for the Lease to be released, so that a standby can take over immediately
+		select {
+		case <-crMgr.leaderStopped:
+		case <-time.After(timeoutSmall):
+		}
+	}
+	for _, inf := range crMgr.getCRInformers() {
 		inf.stop()
 	}
 	if crMgr.nsInformer != nil {
 		crMgr.nsInformer.stop()
 	}
+	if crMgr.gwcInformer != nil {
+		crMgr.gwcInformer.stop()
+	}
+	if crMgr.baselinePlcInformer != nil {
+		crMgr.baselinePlcInformer.stop()
+	}
 
+	crMgr.stopWebhookServer()
 	crMgr.nodePoller.Stop()
 	crMgr.Agent.Stop()
 	if crMgr.ipamCli != nil {
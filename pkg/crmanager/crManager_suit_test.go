@@ -47,6 +47,9 @@ func newMockPostManger() *mockPostManager {
 	}
 
 	mockPM.postChan = make(chan agentConfig, 1)
+	// Declarations written to the mock are posted as the default tenant
+	mockPM.tenantChans = map[string]chan agentConfig{"": mockPM.postChan}
+	mockPM.postedDecls = make(map[string]agentConfig)
 
 	return mockPM
 }
@@ -0,0 +1,235 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	rsc "github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// drainCheckInterval is the interval of checking whether the draining pool members can be removed
+const drainCheckInterval = 5 * time.Second
+
+type (
+	// poolMemberDrainer tracks the members removed from the pools, which are kept disabled
+	// until the drain timeout of the pool expires or BIG-IP reports no connections to them.
+	poolMemberDrainer struct {
+		sync.Mutex
+		// lastMembers are the members of the pool in the last update
+		lastMembers map[poolRef][]PoolMember
+		// draining are the removed members of the pool by address and port
+		draining map[poolRef]map[string]*drainingMember
+	}
+
+	poolRef struct {
+		partition string
+		name      string
+	}
+
+	drainingMember struct {
+		member    PoolMember
+		deadline  time.Time
+		namespace string
+		service   string
+	}
+)
+
+func memberKey(member PoolMember) string {
+	return fmt.Sprintf("%s:%d", member.Address, member.Port)
+}
+
+// getDrainTimeout returns the drain timeout of the pool, configured on the pool or on its service
+func (crMgr *CRManager) getDrainTimeout(pool Pool, namespace string) time.Duration {
+	if pool.DrainTimeout > 0 {
+		return time.Duration(pool.DrainTimeout) * time.Second
+	}
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
+	if !ok {
+		return 0
+	}
+	obj, found, _ := crInf.svcInformer.GetIndexer().GetByKey(namespace + "/" + pool.ServiceName)
+	if !found {
+		return 0
+	}
+	timeoutStr, ok := obj.(*v1.Service).Annotations[DrainTimeoutAnnotation]
+	if !ok {
+		return 0
+	}
+	timeout, err := strconv.Atoi(timeoutStr)
+	if err != nil || timeout < 0 {
+		log.Errorf("Invalid %v annotation '%v' on service %v/%v",
+			DrainTimeoutAnnotation, timeoutStr, namespace, pool.ServiceName)
+		return 0
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// drainPoolMembers adds the members removed from the pool since its last update as disabled members,
+// so that BIG-IP drains their connections instead of resetting them.
+func (crMgr *CRManager) drainPoolMembers(rsCfg *ResourceConfig, index int, namespace string) {
+	pool := &rsCfg.Pools[index]
+	ref := poolRef{partition: rsCfg.Virtual.tenant(), name: pool.Name}
+	timeout := crMgr.getDrainTimeout(*pool, namespace)
+
+	drainer := &crMgr.drainer
+	drainer.Lock()
+	defer drainer.Unlock()
+	if drainer.lastMembers == nil {
+		drainer.lastMembers = make(map[poolRef][]PoolMember)
+		drainer.draining = make(map[poolRef]map[string]*drainingMember)
+	}
+
+	current := make(map[string]bool)
+	for _, member := range pool.Members {
+		current[memberKey(member)] = true
+	}
+	lastMembers := drainer.lastMembers[ref]
+	drainer.lastMembers[ref] = append([]PoolMember{}, pool.Members...)
+	if timeout <= 0 {
+		delete(drainer.draining, ref)
+		return
+	}
+
+	draining, ok := drainer.draining[ref]
+	if !ok {
+		draining = make(map[string]*drainingMember)
+	}
+	// Members added back to the pool are not drained anymore
+	for key := range draining {
+		if current[key] {
+			delete(draining, key)
+		}
+	}
+	for _, member := range lastMembers {
+		key := memberKey(member)
+		if current[key] {
+			continue
+		}
+		if _, found := draining[key]; found {
+			continue
+		}
+		member.Session = rsc.MemberSessionDisabled
+		draining[key] = &drainingMember{
+			member:    member,
+			deadline:  time.Now().Add(timeout),
+			namespace: namespace,
+			service:   pool.ServiceName,
+		}
+		log.Debugf("Draining pool member %v of pool %v for %v", key, pool.Name, timeout)
+	}
+	if len(draining) == 0 {
+		delete(drainer.draining, ref)
+		return
+	}
+	drainer.draining[ref] = draining
+
+	var members []PoolMember
+	for _, dm := range draining {
+		members = append(members, dm.member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return memberKey(members[i]) < memberKey(members[j])
+	})
+	pool.Members = append(pool.Members, members...)
+}
+
+// forgetRemovedPools forgets the members of the pools no longer in the resources, so that a pool
+// created again with the same name does not drain the members of the removed one.
+func (drainer *poolMemberDrainer) forgetRemovedPools(rsMap ResourceConfigMap) {
+	pools := make(map[poolRef]bool)
+	for _, rsCfg := range rsMap {
+		for _, pool := range rsCfg.Pools {
+			pools[poolRef{partition: rsCfg.Virtual.tenant(), name: pool.Name}] = true
+		}
+	}
+	drainer.Lock()
+	defer drainer.Unlock()
+	for ref := range drainer.lastMembers {
+		if !pools[ref] {
+			delete(drainer.lastMembers, ref)
+			delete(drainer.draining, ref)
+		}
+	}
+}
+
+// checkDrainingMembers removes the draining members whose drain timeout has expired or
+// which have no connections on BIG-IP, and updates the resources of their services.
+func (crMgr *CRManager) checkDrainingMembers() {
+	drainer := &crMgr.drainer
+	drainer.Lock()
+	var refs []poolRef
+	for ref := range drainer.draining {
+		refs = append(refs, ref)
+	}
+	drainer.Unlock()
+
+	services := make(map[string]drainingMember)
+	for _, ref := range refs {
+		// Connections are fetched without holding the lock, as the request might be slow
+		conns := crMgr.getPoolMemberConnections(ref)
+		now := time.Now()
+
+		drainer.Lock()
+		for key, dm := range drainer.draining[ref] {
+			count, found := conns[key]
+			if now.Before(dm.deadline) && (!found || count > 0) {
+				continue
+			}
+			log.Debugf("Removing drained pool member %v of pool %v", key, ref.name)
+			delete(drainer.draining[ref], key)
+			services[dm.namespace+"/"+dm.service] = *dm
+		}
+		if len(drainer.draining[ref]) == 0 {
+			delete(drainer.draining, ref)
+		}
+		drainer.Unlock()
+	}
+
+	for _, dm := range services {
+		svc := crMgr.getService(dm.namespace, dm.service)
+		if svc == nil {
+			// Resources of the deleted service are updated by its name
+			svc = &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: dm.service, Namespace: dm.namespace},
+			}
+		}
+		crMgr.enqueueService(svc)
+	}
+}
+
+// getPoolMemberConnections returns the current connections of the pool members on BIG-IP.
+// Only the leader polls BIG-IP, the draining members of a standby are removed once their timeout expires
+func (crMgr *CRManager) getPoolMemberConnections(ref poolRef) map[string]int64 {
+	if crMgr.Agent == nil || crMgr.Agent.PostManager == nil || crMgr.Agent.httpClient == nil ||
+		!crMgr.Agent.IsLeader() {
+		return nil
+	}
+	conns, err := crMgr.Agent.GetPoolMemberConnections(ref.partition, as3SharedApplication, ref.name)
+	if err != nil {
+		log.Debugf("Unable to get connections of pool %v: %v", ref.name, err)
+		return nil
+	}
+	return conns
+}
@@ -0,0 +1,182 @@
+package crmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var _ = Describe("Pool Member Draining", func() {
+	var mockCRM *mockCRManager
+	var rsCfg *ResourceConfig
+	var svc *v1.Service
+	namespace := "default"
+	mem1 := PoolMember{Address: "10.1.1.1", Port: 8080, Session: "user-enabled"}
+	mem2 := PoolMember{Address: "10.1.1.2", Port: 8080, Session: "user-enabled"}
+
+	newResourceConfig := func(drainTimeout int32, members ...PoolMember) *ResourceConfig {
+		rsCfg := &ResourceConfig{}
+		rsCfg.Virtual.Partition = "test"
+		rsCfg.Pools = Pools{
+			{
+				Name:         "svc1_8080_default",
+				ServiceName:  "svc1",
+				ServicePort:  8080,
+				Members:      members,
+				DrainTimeout: drainTimeout,
+			},
+		}
+		return rsCfg
+	}
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		svc = test.NewService("svc1", "1", namespace, v1.ServiceTypeClusterIP,
+			[]v1.ServicePort{{Port: 8080, Name: "port0"}})
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset(svc)
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		_ = mockCRM.addNamespacedInformer(namespace)
+		mockCRM.rscQueue = workqueue.NewNamedRateLimitingQueue(
+			workqueue.DefaultControllerRateLimiter(), "custom-resource-controller")
+	})
+	AfterEach(func() {
+		mockCRM.rscQueue.ShutDown()
+	})
+
+	It("Keeps the removed members disabled", func() {
+		rsCfg = newResourceConfig(30, mem1, mem2)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1, mem2}))
+
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		disabled := mem2
+		disabled.Session = "user-disabled"
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1, disabled}),
+			"Removed member should be disabled")
+
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1, disabled}),
+			"Draining member should be kept on the next update")
+
+		rsCfg = newResourceConfig(30, mem1, mem2)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1, mem2}),
+			"Member added back should not be drained")
+		Expect(mockCRM.drainer.draining).To(BeEmpty())
+	})
+
+	It("Removes members without drain timeout", func() {
+		rsCfg = newResourceConfig(0, mem1, mem2)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		rsCfg = newResourceConfig(0, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1}))
+	})
+
+	It("Drain timeout from the Service annotation", func() {
+		rsCfg = newResourceConfig(0)
+		Expect(mockCRM.getDrainTimeout(rsCfg.Pools[0], namespace)).To(BeZero())
+
+		svc.Annotations = map[string]string{DrainTimeoutAnnotation: "45"}
+		_ = mockCRM.crInformers[namespace].svcInformer.GetIndexer().Add(svc)
+		Expect(mockCRM.getDrainTimeout(rsCfg.Pools[0], namespace)).To(Equal(45 * time.Second))
+
+		rsCfg.Pools[0].DrainTimeout = 10
+		Expect(mockCRM.getDrainTimeout(rsCfg.Pools[0], namespace)).To(Equal(10*time.Second),
+			"Pool drain timeout should take precedence")
+
+		svc.Annotations[DrainTimeoutAnnotation] = "invalid"
+		rsCfg.Pools[0].DrainTimeout = 0
+		Expect(mockCRM.getDrainTimeout(rsCfg.Pools[0], namespace)).To(BeZero())
+	})
+
+	It("Removes the expired draining members", func() {
+		_ = mockCRM.crInformers[namespace].svcInformer.GetIndexer().Add(svc)
+		rsCfg = newResourceConfig(30, mem1, mem2)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+
+		mockCRM.checkDrainingMembers()
+		Expect(mockCRM.drainer.draining).To(HaveLen(1), "Member should be drained until the timeout")
+		Expect(mockCRM.rscQueue.Len()).To(BeZero())
+
+		ref := poolRef{partition: "test", name: "svc1_8080_default"}
+		mockCRM.drainer.draining[ref]["10.1.1.2:8080"].deadline = time.Now().Add(-time.Second)
+		mockCRM.checkDrainingMembers()
+		Expect(mockCRM.drainer.draining).To(BeEmpty())
+		Expect(mockCRM.rscQueue.Len()).To(Equal(1), "Service should be processed again")
+		key, _ := mockCRM.rscQueue.Get()
+		Expect(key.(*rqKey).kind).To(Equal(Service))
+		Expect(key.(*rqKey).rscName).To(Equal("svc1"))
+
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{mem1}))
+	})
+
+	It("Removes the draining members without connections", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/mgmt/tm/ltm/pool/~test~Shared~svc1_8080_default/members/stats"))
+			stats := `{"entries": {%s, %s}}`
+			entry := `"https://localhost/mgmt/tm/ltm/pool/~test~Shared~svc1_8080_default/members/~test~%[1]s:8080/stats": ` +
+				`{"nestedStats": {"entries": {"addr": {"description": "%[1]s%%1"}, "port": {"value": 8080}, ` +
+				`"serverside.curConns": {"value": %[2]d}}}}`
+			_, _ = fmt.Fprintf(w, stats, fmt.Sprintf(entry, "10.1.1.2", 0), fmt.Sprintf(entry, "10.1.1.3", 4))
+		}))
+		defer server.Close()
+		mockCRM.Agent = &Agent{
+			PostManager: &PostManager{
+				PostParams: PostParams{BIGIPURL: server.URL},
+				httpClient: server.Client(),
+			},
+		}
+
+		mem3 := PoolMember{Address: "10.1.1.3", Port: 8080}
+		rsCfg = newResourceConfig(30, mem1, mem2, mem3)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+
+		mockCRM.checkDrainingMembers()
+		ref := poolRef{partition: "test", name: "svc1_8080_default"}
+		Expect(mockCRM.drainer.draining[ref]).To(HaveLen(2), "Standby should not poll BIG-IP")
+
+		mockCRM.Agent.SetLeader(true)
+		mockCRM.checkDrainingMembers()
+		Expect(mockCRM.drainer.draining[ref]).To(HaveLen(1))
+		Expect(mockCRM.drainer.draining[ref]).To(HaveKey("10.1.1.3:8080"),
+			"Member with connections should be drained")
+	})
+	It("Forgets the members of the removed pools", func() {
+		rsCfg = newResourceConfig(30, mem1, mem2)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		rsCfg = newResourceConfig(30, mem1)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		mockCRM.drainer.forgetRemovedPools(ResourceConfigMap{"vs": rsCfg})
+		Expect(mockCRM.drainer.draining).To(HaveLen(1), "Pool in the resources should be retained")
+
+		mockCRM.drainer.forgetRemovedPools(ResourceConfigMap{})
+		Expect(mockCRM.drainer.lastMembers).To(BeEmpty())
+		Expect(mockCRM.drainer.draining).To(BeEmpty())
+
+		// Pool created again does not drain the members of the removed one
+		rsCfg = newResourceConfig(30)
+		mockCRM.drainPoolMembers(rsCfg, 0, namespace)
+		Expect(rsCfg.Pools[0].Members).To(BeEmpty())
+	})
+})
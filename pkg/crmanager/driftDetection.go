@@ -0,0 +1,186 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// Reason of the Event recorded on resources of a drifted tenant
+	ConfigurationDriftReason = "ConfigurationDrift"
+)
+
+// driftWorker periodically compares the tenants available on BIG-IP with the declarations posted
+// Only the leader checks for drift, as a standby replica does not post declarations
+func (postMgr *PostManager) driftWorker() {
+	ticker := time.NewTicker(time.Duration(postMgr.DriftCheckInterval) * time.Second)
+	defer ticker.Stop()
+	// drifted tenants are reported only once until they are in sync again
+	drifted := make(map[string]bool)
+	for range ticker.C {
+		if !postMgr.IsLeader() {
+			continue
+		}
+		postMgr.tenantMutex.Lock()
+		var postedDecls []agentConfig
+		for _, cfg := range postMgr.postedDecls {
+			postedDecls = append(postedDecls, cfg)
+		}
+		postMgr.tenantMutex.Unlock()
+
+		for _, cfg := range postedDecls {
+			if isEmptyTenantDeclaration(cfg) {
+				continue
+			}
+			drifted[cfg.tenant] = postMgr.checkDrift(cfg, drifted[cfg.tenant])
+		}
+	}
+}
+
+// checkDrift compares the tenant on BIG-IP with the declaration posted and returns true on drift
+func (postMgr *PostManager) checkDrift(cfg agentConfig, reported bool) bool {
+	inSync, err := postMgr.compareDeclaration(&cfg)
+	if err != nil {
+		log.Debugf("[AS3] Unable to check configuration drift of tenant %v: %v", cfg.tenant, err)
+		return reported
+	}
+	if inSync {
+		if reported {
+			log.Infof("[AS3] Tenant %v on BIG-IP is in sync with the posted declaration", cfg.tenant)
+		}
+		bigIPPrometheus.ConfigurationDrift.WithLabelValues(cfg.tenant).Set(0)
+		return false
+	}
+	// tenantConfigWorker might have posted a newer declaration while comparing
+	if postedDecl, ok := postMgr.getPostedDecl(cfg.tenant); !ok || postedDecl.data != cfg.data {
+		return reported
+	}
+
+	bigIPPrometheus.ConfigurationDrift.WithLabelValues(cfg.tenant).Set(1)
+	if !reported {
+		log.Warningf("[AS3] Configuration drift detected on BIG-IP for tenant %v", cfg.tenant)
+		bigIPPrometheus.ConfigurationDriftCount.WithLabelValues(cfg.tenant).Inc()
+		postMgr.sendDrift(cfg.tenant)
+	}
+	if postMgr.DriftRepost {
+		log.Infof("[AS3] Re-posting the declaration of tenant %v to fix the configuration drift", cfg.tenant)
+		postMgr.repostTenant(cfg)
+	}
+	return true
+}
+
+// repostTenant forgets the posted declaration, so that tenantConfigWorker posts it again
+// A newer declaration already waiting for the tenant is posted instead
+func (postMgr *PostManager) repostTenant(cfg agentConfig) {
+	postMgr.tenantMutex.Lock()
+	delete(postMgr.postedDecls, cfg.tenant)
+	tenantChan := postMgr.tenantChans[cfg.tenant]
+	postMgr.tenantMutex.Unlock()
+	if tenantChan == nil {
+		return
+	}
+	select {
+	case tenantChan <- cfg:
+	default:
+	}
+}
+
+func (postMgr *PostManager) sendDrift(tenant string) {
+	if postMgr.driftChan == nil {
+		return
+	}
+	postMgr.driftChan <- tenant
+}
+
+// isEmptyTenantDeclaration returns true for the declarations that remove the tenant from BIG-IP
+func isEmptyTenantDeclaration(cfg agentConfig) bool {
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(cfg.data), &as3Config); err != nil {
+		return false
+	}
+	adc, ok := as3Config["declaration"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	tenant, ok := adc[cfg.tenant].(map[string]interface{})
+	if !ok {
+		return true
+	}
+	for _, obj := range tenant {
+		if _, ok := obj.(map[string]interface{}); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// driftHandler records an Event on the resources of each tenant found drifted on BIG-IP
+func (crMgr *CRManager) driftHandler(driftChan chan string) {
+	for tenant := range driftChan {
+		message := fmt.Sprintf("Configuration of tenant %v on BIG-IP differs from the declaration posted by F5 CIS",
+			tenant)
+		for _, obj := range crMgr.getTenantResources(tenant) {
+			crMgr.recordDriftEvent(obj, message)
+		}
+	}
+}
+
+// getTenantResources returns the VirtualServers and TransportServers declared in the tenant
+func (crMgr *CRManager) getTenantResources(tenant string) []runtime.Object {
+	var objs []runtime.Object
+	for _, crInf := range crMgr.getCRInformers() {
+		if crInf.vsInformer != nil {
+			for _, obj := range crInf.vsInformer.GetIndexer().List() {
+				vs := obj.(*cisapiv1.VirtualServer)
+				if crMgr.getTenant(vs.ObjectMeta) == tenant {
+					objs = append(objs, vs)
+				}
+			}
+		}
+		if crInf.tsInformer != nil {
+			for _, obj := range crInf.tsInformer.GetIndexer().List() {
+				ts := obj.(*cisapiv1.TransportServer)
+				if crMgr.getTenant(ts.ObjectMeta) == tenant {
+					objs = append(objs, ts)
+				}
+			}
+		}
+	}
+	return objs
+}
+
+func (crMgr *CRManager) recordDriftEvent(obj runtime.Object, message string) {
+	var namespace string
+	switch rsc := obj.(type) {
+	case *cisapiv1.VirtualServer:
+		namespace = rsc.Namespace
+	case *cisapiv1.TransportServer:
+		namespace = rsc.Namespace
+	}
+	evNotifier := crMgr.eventNotifier.CreateNotifierForNamespace(
+		namespace, crMgr.kubeClient.CoreV1())
+	evNotifier.RecordEvent(obj, v1.EventTypeWarning, ConfigurationDriftReason, message)
+}
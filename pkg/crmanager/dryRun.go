@@ -0,0 +1,469 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	"github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned"
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	cisscheme "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/scheme"
+	apm "github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/teem"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8sscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// DryRunParams holds the parameters to render the configuration without a BIG-IP
+type DryRunParams struct {
+	// Files or directories of YAML/JSON manifests, "-" reads from stdin
+	Manifests []string
+	// Cluster to take a snapshot of the resources from, when no manifests are provided
+	Config             *rest.Config
+	Namespaces         []string
+	Partition          string
+	ControllerMode     string
+	UseNodeInternal    bool
+	TenantPerNamespace bool
+	ShareNodes         bool
+	DefaultRouteDomain int
+	UserAgent          string
+}
+
+// dryRunOutput is the configuration CIS would post to BIG-IP
+type dryRunOutput struct {
+	AS3 json.RawMessage `json:"as3"`
+	GTM json.RawMessage `json:"gtm"`
+}
+
+// dryRunResources holds the resources rendered in dry run mode
+type dryRunResources struct {
+	virtuals    []*cisapiv1.VirtualServer
+	transports  []*cisapiv1.TransportServer
+	tlsProfiles []*cisapiv1.TLSProfile
+	policies    []*cisapiv1.Policy
+	edns        []*cisapiv1.ExternalDNS
+	services    []*v1.Service
+	endpoints   []*v1.Endpoints
+	secrets     []*v1.Secret
+	nodes       []v1.Node
+}
+
+// RenderDeclaration writes the AS3 declarations of LTM and GTM that CIS would post
+// for the given resources, without connecting to BIG-IP
+func RenderDeclaration(params DryRunParams, out io.Writer) error {
+	var rscs *dryRunResources
+	var err error
+	if len(params.Manifests) != 0 {
+		rscs, err = loadManifests(params.Manifests, params.Namespaces)
+	} else {
+		rscs, err = loadClusterSnapshot(params.Config, params.Namespaces)
+	}
+	if err != nil {
+		return err
+	}
+
+	DEFAULT_PARTITION = params.Partition
+	crMgr := newDryRunCRManager(params, rscs)
+	crMgr.processDryRunResources(rscs)
+
+	config := crMgr.getResourceConfigWrapper()
+	output := dryRunOutput{
+		AS3: json.RawMessage(createAS3Declaration(config, params.UserAgent)),
+		GTM: json.RawMessage(createGTMDeclaration(config, params.UserAgent, "")),
+	}
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to render the configuration: %v", err)
+	}
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// newDryRunCRManager creates a CRManager backed by the given resources instead of a cluster
+func newDryRunCRManager(params DryRunParams, rscs *dryRunResources) *CRManager {
+	crMgr := &CRManager{
+		namespaces:         map[string]bool{"": true},
+		crInformers:        make(map[string]*CRInformer),
+		resources:          NewResources(),
+		ControllerMode:     params.ControllerMode,
+		UseNodeInternal:    params.UseNodeInternal,
+		SSLContext:         make(map[string]*v1.Secret),
+		tenantPerNamespace: params.TenantPerNamespace,
+		shareNodes:         params.ShareNodes,
+		eventNotifier:      apm.NewEventNotifier(nil),
+		defaultRouteDomain: params.DefaultRouteDomain,
+		kubeClient:         k8sfake.NewSimpleClientset(),
+		kubeCRClient:       crdfake.NewSimpleClientset(),
+		TeemData: &teem.TeemsData{
+			ResourceType: teem.ResourceTypes{
+				VirtualServer:   make(map[string]int),
+				TransportServer: make(map[string]int),
+				ExternalDNS:     make(map[string]int),
+				IngressLink:     make(map[string]int),
+				IPAMVS:          make(map[string]int),
+				IPAMTS:          make(map[string]int),
+				IPAMSvcLB:       make(map[string]int),
+			},
+		},
+	}
+	crMgr.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+
+	// Informers are never started, their stores are populated with the resources
+	crInf := crMgr.newNamespacedInformer("")
+	crMgr.crInformers[""] = crInf
+	for _, vs := range rscs.virtuals {
+		_ = crInf.vsInformer.GetIndexer().Add(vs)
+	}
+	for _, ts := range rscs.transports {
+		_ = crInf.tsInformer.GetIndexer().Add(ts)
+	}
+	for _, tls := range rscs.tlsProfiles {
+		_ = crInf.tlsInformer.GetIndexer().Add(tls)
+	}
+	for _, plc := range rscs.policies {
+		_ = crInf.plcInformer.GetIndexer().Add(plc)
+	}
+	for _, edns := range rscs.edns {
+		_ = crInf.ednsInformer.GetIndexer().Add(edns)
+	}
+	for _, svc := range rscs.services {
+		_ = crInf.svcInformer.GetIndexer().Add(svc)
+	}
+	for _, ep := range rscs.endpoints {
+		_ = crInf.epsInformer.GetIndexer().Add(ep)
+	}
+	for _, secret := range rscs.secrets {
+		_ = crInf.secretInformer.GetIndexer().Add(secret)
+	}
+	return crMgr
+}
+
+// processDryRunResources processes the resources the same way as the workers do
+func (crMgr *CRManager) processDryRunResources(rscs *dryRunResources) {
+	if nodes, err := crMgr.getNodes(rscs.nodes); err == nil {
+		crMgr.oldNodes = nodes
+	}
+	for _, svc := range rscs.services {
+		if err := crMgr.processService(svc, nil, false); err != nil {
+			log.Debugf("[DryRun] %v", err)
+		}
+	}
+	for _, vs := range rscs.virtuals {
+		if err := crMgr.processVirtualServers(vs, false); err != nil {
+			log.Errorf("[DryRun] Unable to process VirtualServer %v/%v: %v", vs.Namespace, vs.Name, err)
+		}
+	}
+	for _, ts := range rscs.transports {
+		if err := crMgr.processTransportServers(ts, false); err != nil {
+			log.Errorf("[DryRun] Unable to process TransportServer %v/%v: %v", ts.Namespace, ts.Name, err)
+		}
+	}
+	for _, edns := range rscs.edns {
+		crMgr.processExternalDNS(edns, false)
+	}
+}
+
+// loadManifests decodes the resources from the manifest files
+func loadManifests(paths []string, namespaces []string) (*dryRunResources, error) {
+	scheme := runtime.NewScheme()
+	if err := k8sscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := cisscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+
+	var objs []runtime.Object
+	for _, path := range paths {
+		files, err := getManifestFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			var data []byte
+			if file == "-" {
+				data, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				data, err = ioutil.ReadFile(file)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read manifest %v: %v", file, err)
+			}
+			fileObjs, err := decodeManifest(decoder, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode manifest %v: %v", file, err)
+			}
+			objs = append(objs, fileObjs...)
+		}
+	}
+	return newDryRunResources(objs, namespaces)
+}
+
+// getManifestFiles returns the YAML and JSON files of a directory, or the path itself
+func getManifestFiles(path string) ([]string, error) {
+	if path == "-" {
+		return []string{path}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				files = append(files, file)
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// decodeManifest decodes all the documents of a manifest, including the items of Lists
+func decodeManifest(decoder runtime.Decoder, data []byte) ([]runtime.Object, error) {
+	var objs []runtime.Object
+	yamlDecoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw runtime.RawExtension
+		if err := yamlDecoder.Decode(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		obj, gvk, err := decoder.Decode(raw.Raw, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if list, ok := obj.(*v1.List); ok {
+			for _, item := range list.Items {
+				itemObjs, err := decodeManifest(decoder, item.Raw)
+				if err != nil {
+					return nil, err
+				}
+				objs = append(objs, itemObjs...)
+			}
+			continue
+		}
+		log.Debugf("[DryRun] Loaded %v", gvk.Kind)
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// loadClusterSnapshot takes a snapshot of the resources available in the cluster
+func loadClusterSnapshot(config *rest.Config, namespaces []string) (*dryRunResources, error) {
+	if config == nil {
+		return nil, fmt.Errorf("no manifests or cluster provided to render the configuration")
+	}
+	kubeCRClient, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Custum Resource kubeClient: %v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create kubeClient: %v", err)
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var objs []runtime.Object
+	ctx := context.TODO()
+	opts := metaV1.ListOptions{}
+	for _, ns := range namespaces {
+		vsList, err := kubeCRClient.CisV1().VirtualServers(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list VirtualServers: %v", err)
+		}
+		for i := range vsList.Items {
+			objs = append(objs, &vsList.Items[i])
+		}
+		tsList, err := kubeCRClient.CisV1().TransportServers(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list TransportServers: %v", err)
+		}
+		for i := range tsList.Items {
+			objs = append(objs, &tsList.Items[i])
+		}
+		tlsList, err := kubeCRClient.CisV1().TLSProfiles(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list TLSProfiles: %v", err)
+		}
+		for i := range tlsList.Items {
+			objs = append(objs, &tlsList.Items[i])
+		}
+		plcList, err := kubeCRClient.CisV1().Policies(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list Policies: %v", err)
+		}
+		for i := range plcList.Items {
+			objs = append(objs, &plcList.Items[i])
+		}
+		ednsList, err := kubeCRClient.CisV1().ExternalDNSes(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list ExternalDNSes: %v", err)
+		}
+		for i := range ednsList.Items {
+			objs = append(objs, &ednsList.Items[i])
+		}
+		svcList, err := kubeClient.CoreV1().Services(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list Services: %v", err)
+		}
+		for i := range svcList.Items {
+			objs = append(objs, &svcList.Items[i])
+		}
+		epsList, err := kubeClient.CoreV1().Endpoints(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list Endpoints: %v", err)
+		}
+		for i := range epsList.Items {
+			objs = append(objs, &epsList.Items[i])
+		}
+		secretList, err := kubeClient.CoreV1().Secrets(ns).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list Secrets: %v", err)
+		}
+		for i := range secretList.Items {
+			objs = append(objs, &secretList.Items[i])
+		}
+	}
+	nodeList, err := kubeClient.CoreV1().Nodes().List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list Nodes: %v", err)
+	}
+	for i := range nodeList.Items {
+		objs = append(objs, &nodeList.Items[i])
+	}
+	return newDryRunResources(objs, nil)
+}
+
+// newDryRunResources groups the resources by kind
+// Custom Resources are considered only with the label CIS watches for
+func newDryRunResources(objs []runtime.Object, namespaces []string) (*dryRunResources, error) {
+	resourceSelector, err := createLabelSelector(DefaultCustomResourceLabel)
+	if err != nil {
+		return nil, err
+	}
+	inScope := func(objMeta *metaV1.ObjectMeta, isCustomResource bool) bool {
+		if objMeta.Namespace == "" {
+			objMeta.Namespace = v1.NamespaceDefault
+		}
+		if isCustomResource && !resourceSelector.Matches(labels.Set(objMeta.Labels)) {
+			log.Debugf("[DryRun] Skipping %v/%v without label %v",
+				objMeta.Namespace, objMeta.Name, DefaultCustomResourceLabel)
+			return false
+		}
+		if len(namespaces) == 0 {
+			return true
+		}
+		for _, ns := range namespaces {
+			if ns == objMeta.Namespace {
+				return true
+			}
+		}
+		return false
+	}
+
+	rscs := &dryRunResources{}
+	for _, obj := range objs {
+		switch rsc := obj.(type) {
+		case *cisapiv1.VirtualServer:
+			if inScope(&rsc.ObjectMeta, true) {
+				rscs.virtuals = append(rscs.virtuals, rsc)
+			}
+		case *cisapiv1.TransportServer:
+			if inScope(&rsc.ObjectMeta, true) {
+				rscs.transports = append(rscs.transports, rsc)
+			}
+		case *cisapiv1.TLSProfile:
+			if inScope(&rsc.ObjectMeta, true) {
+				rscs.tlsProfiles = append(rscs.tlsProfiles, rsc)
+			}
+		case *cisapiv1.Policy:
+			if inScope(&rsc.ObjectMeta, true) {
+				rscs.policies = append(rscs.policies, rsc)
+			}
+		case *cisapiv1.ExternalDNS:
+			if inScope(&rsc.ObjectMeta, true) {
+				rscs.edns = append(rscs.edns, rsc)
+			}
+		case *v1.Service:
+			if inScope(&rsc.ObjectMeta, false) {
+				rscs.services = append(rscs.services, rsc)
+			}
+		case *v1.Endpoints:
+			if inScope(&rsc.ObjectMeta, false) {
+				rscs.endpoints = append(rscs.endpoints, rsc)
+			}
+		case *v1.Secret:
+			if inScope(&rsc.ObjectMeta, false) {
+				rscs.secrets = append(rscs.secrets, rsc)
+			}
+		case *v1.Node:
+			rscs.nodes = append(rscs.nodes, *rsc)
+		default:
+			log.Warningf("[DryRun] Skipping unsupported resource %v",
+				obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+	}
+
+	// Process the resources in a stable order, so that the output can be compared
+	sort.Slice(rscs.virtuals, func(i, j int) bool {
+		return rscs.virtuals[i].Namespace+"/"+rscs.virtuals[i].Name <
+			rscs.virtuals[j].Namespace+"/"+rscs.virtuals[j].Name
+	})
+	sort.Slice(rscs.transports, func(i, j int) bool {
+		return rscs.transports[i].Namespace+"/"+rscs.transports[i].Name <
+			rscs.transports[j].Namespace+"/"+rscs.transports[j].Name
+	})
+	return rscs, nil
+}
@@ -0,0 +1,138 @@
+package crmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const dryRunManifest = `
+apiVersion: cis.f5.com/v1
+kind: VirtualServer
+metadata:
+  name: vs1
+  namespace: default
+  labels:
+    f5cr: "true"
+spec:
+  host: test.com
+  virtualServerAddress: 10.1.1.1
+  pools:
+  - path: /
+    service: svc1
+    servicePort: 8080
+---
+apiVersion: cis.f5.com/v1
+kind: VirtualServer
+metadata:
+  name: unlabelled
+  namespace: default
+spec:
+  host: other.com
+  virtualServerAddress: 10.1.1.2
+  pools:
+  - path: /
+    service: svc1
+    servicePort: 8080
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: svc1
+    namespace: default
+  spec:
+    ports:
+    - port: 80
+      name: http
+- apiVersion: v1
+  kind: Endpoints
+  metadata:
+    name: svc1
+    namespace: default
+  subsets:
+  - addresses:
+    - ip: 10.244.0.5
+      nodeName: node1
+    ports:
+    - port: 8080
+      name: http
+- apiVersion: v1
+  kind: Node
+  metadata:
+    name: node1
+  status:
+    addresses:
+    - type: InternalIP
+      address: 192.168.1.10
+`
+
+var _ = Describe("Dry Run", func() {
+	var manifestDir string
+	var params DryRunParams
+	BeforeEach(func() {
+		var err error
+		manifestDir, err = ioutil.TempDir("", "dryrun")
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(filepath.Join(manifestDir, "app.yaml"), []byte(dryRunManifest), 0644)).To(BeNil())
+		Expect(ioutil.WriteFile(filepath.Join(manifestDir, "README.md"), []byte("# not a manifest"), 0644)).To(BeNil())
+		params = DryRunParams{
+			Manifests:       []string{manifestDir},
+			Partition:       "test",
+			ControllerMode:  "cluster",
+			UseNodeInternal: true,
+			UserAgent:       "CIS",
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(manifestDir)
+	})
+
+	It("Render declaration from manifests", func() {
+		var out bytes.Buffer
+		Expect(RenderDeclaration(params, &out)).To(BeNil())
+
+		var output map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &output)).To(BeNil(), "Output should be a JSON document")
+		Expect(output["gtm"]).NotTo(BeNil(), "gtm section should be rendered")
+
+		adc := output["as3"].(map[string]interface{})["declaration"].(map[string]interface{})
+		app := adc["test"].(map[string]interface{})["Shared"].(map[string]interface{})
+		Expect(app["crd_10_1_1_1_80"]).NotTo(BeNil(), "Labelled VirtualServer should be rendered")
+		Expect(app["crd_10_1_1_2_80"]).To(BeNil(), "VirtualServer without f5cr label should be skipped")
+
+		pool := app["svc1_8080_default"].(map[string]interface{})
+		Expect(pool["members"]).To(HaveLen(1), "Pool members should be rendered from Endpoints")
+	})
+
+	It("Render declaration of watched namespaces", func() {
+		params.Namespaces = []string{"other"}
+		var out bytes.Buffer
+		Expect(RenderDeclaration(params, &out)).To(BeNil())
+		Expect(out.String()).NotTo(ContainSubstring("crd_10_1_1_1_80"),
+			"Resources of other namespaces should be skipped")
+	})
+
+	It("Stable output", func() {
+		var out1, out2 bytes.Buffer
+		Expect(RenderDeclaration(params, &out1)).To(BeNil())
+		Expect(RenderDeclaration(params, &out2)).To(BeNil())
+		Expect(out1.String()).To(Equal(out2.String()), "Output should be comparable across runs")
+	})
+
+	It("Invalid manifest", func() {
+		params.Manifests = []string{filepath.Join(manifestDir, "missing.yaml")}
+		Expect(RenderDeclaration(params, ioutil.Discard)).NotTo(BeNil())
+
+		Expect(ioutil.WriteFile(filepath.Join(manifestDir, "invalid.yaml"), []byte("kind: [}"), 0644)).To(BeNil())
+		params.Manifests = []string{filepath.Join(manifestDir, "invalid.yaml")}
+		Expect(RenderDeclaration(params, ioutil.Discard)).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,196 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+const (
+	// defaultFailoverCheckInterval is used when the failover check interval is not configured
+	defaultFailoverCheckInterval = 10
+	failoverStatusURI            = "/mgmt/tm/cm/failover-status"
+	syncStatusURI                = "/mgmt/tm/cm/sync-status"
+	failoverStatusActive         = "ACTIVE"
+	syncStatusInSync             = "In Sync"
+	// cmStatusTimeout bounds each status probe, so that an unreachable BIG-IP does not delay the failover
+	cmStatusTimeout = timeoutSmall
+)
+
+// cmStatus is the response of the failover and sync status of BIG-IP
+type cmStatus struct {
+	Entries map[string]struct {
+		NestedStats struct {
+			Entries map[string]struct {
+				Description string `json:"description"`
+			} `json:"entries"`
+		} `json:"nestedStats"`
+	} `json:"entries"`
+}
+
+// getBIGIPURL returns the BIG-IP which the declarations are posted to
+func (postMgr *PostManager) getBIGIPURL() string {
+	postMgr.urlMutex.RLock()
+	defer postMgr.urlMutex.RUnlock()
+	if postMgr.activeURL == "" {
+		return postMgr.BIGIPURL
+	}
+	return postMgr.activeURL
+}
+
+func (postMgr *PostManager) setBIGIPURL(url string) {
+	postMgr.urlMutex.Lock()
+	postMgr.activeURL = url
+	handler := postMgr.activeURLHandler
+	postMgr.urlMutex.Unlock()
+	if handler != nil {
+		go handler()
+	}
+}
+
+// setActiveURLHandler sets the handler called whenever another BIG-IP of the HA group becomes active
+func (postMgr *PostManager) setActiveURLHandler(handler func()) {
+	postMgr.urlMutex.Lock()
+	defer postMgr.urlMutex.Unlock()
+	postMgr.activeURLHandler = handler
+}
+
+// failoverWorker periodically checks the failover status of the BIG-IPs of the HA group
+// A standby replica does not check, the active BIG-IP is found once it acquires leadership
+func (postMgr *PostManager) failoverWorker() {
+	interval := postMgr.FailoverCheckInterval
+	if interval <= 0 {
+		interval = defaultFailoverCheckInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if !postMgr.IsLeader() {
+			<-postMgr.leaderSignal()
+		}
+		postMgr.checkActiveBIGIP()
+		<-ticker.C
+	}
+}
+
+// checkActiveBIGIP finds the active BIG-IP of the HA group and moves the posting to it,
+// re-posting the declarations when the active BIG-IP has changed
+func (postMgr *PostManager) checkActiveBIGIP() {
+	var active string
+	for _, url := range postMgr.BIGIPURLs {
+		status, err := postMgr.getCMStatus(url, failoverStatusURI)
+		if err != nil {
+			log.Warningf("[AS3] Unable to get failover status of BIG-IP %v: %v", url, err)
+			continue
+		}
+		log.Debugf("[AS3] Failover status of BIG-IP %v: %v", url, status)
+		if status == failoverStatusActive && active == "" {
+			active = url
+		}
+	}
+	if active == "" {
+		log.Warningf("[AS3] No active BIG-IP found in %v, posting to %v", postMgr.BIGIPURLs, postMgr.getBIGIPURL())
+		return
+	}
+	for _, url := range postMgr.BIGIPURLs {
+		if url == active {
+			bigIPPrometheus.BigIPActiveDevice.WithLabelValues(url).Set(1)
+		} else {
+			bigIPPrometheus.BigIPActiveDevice.WithLabelValues(url).Set(0)
+		}
+	}
+
+	previous := postMgr.getBIGIPURL()
+	if active == previous {
+		return
+	}
+	postMgr.setBIGIPURL(active)
+	bigIPPrometheus.BigIPFailoverCount.Inc()
+	log.Infof("[AS3] Active BIG-IP changed from %v to %v", previous, active)
+
+	if postMgr.ConfigSyncAware && postMgr.isConfigInSync(active) {
+		log.Infof("[AS3] Device group of BIG-IP %v is in sync, skipping the re-post of declarations", active)
+		return
+	}
+	postMgr.repostTenants()
+}
+
+// isConfigInSync returns true when the device group of the BIG-IP is in sync
+func (postMgr *PostManager) isConfigInSync(url string) bool {
+	status, err := postMgr.getCMStatus(url, syncStatusURI)
+	if err != nil {
+		log.Warningf("[AS3] Unable to get sync status of BIG-IP %v: %v", url, err)
+		return false
+	}
+	inSync := status == syncStatusInSync
+	if inSync {
+		bigIPPrometheus.BigIPConfigSync.WithLabelValues(url).Set(1)
+	} else {
+		bigIPPrometheus.BigIPConfigSync.WithLabelValues(url).Set(0)
+		log.Warningf("[AS3] Sync status of BIG-IP %v: %v", url, status)
+	}
+	return inSync
+}
+
+// repostTenants posts the last declaration of each tenant to the active BIG-IP
+// unless a newer declaration of the tenant is waiting to be posted
+func (postMgr *PostManager) repostTenants() {
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	for tenant, cfg := range postMgr.postedDecls {
+		delete(postMgr.postedDecls, tenant)
+		select {
+		case postMgr.tenantChans[tenant] <- cfg:
+		default:
+		}
+	}
+}
+
+// getCMStatus returns the status reported by the failover or the sync status of BIG-IP
+func (postMgr *PostManager) getCMStatus(url, uri string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmStatusTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url+uri, nil)
+	if err != nil {
+		return "", err
+	}
+	httpResp, err := postMgr.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("response from BIG-IP with status code %v", httpResp.StatusCode)
+	}
+	var status cmStatus
+	if err = json.NewDecoder(httpResp.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("response body unmarshal failed: %v", err)
+	}
+	for _, entry := range status.Entries {
+		if s, ok := entry.NestedStats.Entries["status"]; ok {
+			return s.Description, nil
+		}
+	}
+	return "", fmt.Errorf("no status found in the response")
+}
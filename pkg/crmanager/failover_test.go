@@ -0,0 +1,128 @@
+package crmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BIG-IP Failover", func() {
+	var postMgr *PostManager
+	var bigip1, bigip2 *httptest.Server
+	var status map[string]string
+	var syncStatus string
+
+	newBIGIP := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := `{"entries": {"https://localhost%s/0": {"nestedStats": {"entries": ` +
+				`{"color": {"description": "green"}, "status": {"description": "%s"}}}}}}`
+			switch r.URL.Path {
+			case failoverStatusURI:
+				if status[name] == "" {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = fmt.Fprintf(w, entry, failoverStatusURI, status[name])
+			case syncStatusURI:
+				_, _ = fmt.Fprintf(w, entry, syncStatusURI, syncStatus)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	}
+
+	BeforeEach(func() {
+		status = map[string]string{"bigip1": "ACTIVE", "bigip2": "STANDBY"}
+		syncStatus = "In Sync"
+		bigip1 = newBIGIP("bigip1")
+		bigip2 = newBIGIP("bigip2")
+		postMgr = &PostManager{
+			tenantChans: map[string]chan agentConfig{"test": make(chan agentConfig, 1)},
+			postedDecls: map[string]agentConfig{"test": {tenant: "test", data: "decl"}},
+			httpClient:  http.DefaultClient,
+			PostParams: PostParams{
+				BIGIPURL:  bigip1.URL,
+				BIGIPURLs: []string{bigip1.URL, bigip2.URL},
+			},
+		}
+	})
+	AfterEach(func() {
+		bigip1.Close()
+		bigip2.Close()
+	})
+
+	It("Posts to the active BIG-IP", func() {
+		postMgr.checkActiveBIGIP()
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip1.URL))
+		Expect(postMgr.tenantChans["test"]).To(BeEmpty(), "Declarations should not be re-posted")
+
+		status = map[string]string{"bigip1": "STANDBY", "bigip2": "ACTIVE"}
+		postMgr.checkActiveBIGIP()
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip2.URL), "Posting should move to the new active BIG-IP")
+		Expect(postMgr.getAS3APIURL([]string{"test"})).To(Equal(bigip2.URL + "/mgmt/shared/appsvcs/declare/test"))
+		Expect(postMgr.tenantChans["test"]).To(HaveLen(1), "Declarations should be re-posted")
+		Expect(postMgr.postedDecls).To(BeEmpty())
+	})
+
+	It("Notifies the handler on failover", func() {
+		changed := make(chan string, 2)
+		postMgr.setActiveURLHandler(func() { changed <- postMgr.getBIGIPURL() })
+		postMgr.checkActiveBIGIP()
+		Consistently(changed, "100ms").ShouldNot(Receive(), "Handler should not be called without failover")
+
+		status = map[string]string{"bigip1": "STANDBY", "bigip2": "ACTIVE"}
+		postMgr.checkActiveBIGIP()
+		Eventually(changed).Should(Receive(Equal(bigip2.URL)))
+	})
+
+	It("Checks the failover status only as the leader", func() {
+		postMgr.leaderChan = make(chan struct{})
+		postMgr.FailoverCheckInterval = 1
+		status = map[string]string{"bigip1": "STANDBY", "bigip2": "ACTIVE"}
+		go postMgr.failoverWorker()
+		Consistently(postMgr.getBIGIPURL, "200ms").Should(Equal(bigip1.URL), "Standby replica should not check")
+
+		postMgr.SetLeader(true)
+		Eventually(postMgr.getBIGIPURL).Should(Equal(bigip2.URL))
+	})
+
+	It("Moves on from an unresponsive BIG-IP", func() {
+		release := make(chan struct{})
+		hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer hung.Close()
+		defer close(release)
+		postMgr.BIGIPURLs = []string{hung.URL, bigip2.URL}
+		status = map[string]string{"bigip1": "STANDBY", "bigip2": "ACTIVE"}
+		start := time.Now()
+		postMgr.checkActiveBIGIP()
+		Expect(time.Since(start)).To(BeNumerically("<", cmStatusTimeout+time.Second),
+			"Status probe should time out")
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip2.URL))
+	})
+
+	It("Keeps the BIG-IP when no BIG-IP is active", func() {
+		status = map[string]string{"bigip1": "", "bigip2": "STANDBY"}
+		postMgr.checkActiveBIGIP()
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip1.URL))
+	})
+
+	It("Skips the re-post when the device group is in sync", func() {
+		postMgr.ConfigSyncAware = true
+		status = map[string]string{"bigip1": "STANDBY", "bigip2": "ACTIVE"}
+		postMgr.checkActiveBIGIP()
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip2.URL))
+		Expect(postMgr.tenantChans["test"]).To(BeEmpty(), "Declarations should not be re-posted")
+
+		syncStatus = "Changes Pending"
+		status = map[string]string{"bigip1": "ACTIVE", "bigip2": "STANDBY"}
+		postMgr.checkActiveBIGIP()
+		Expect(postMgr.getBIGIPURL()).To(Equal(bigip1.URL))
+		Expect(postMgr.tenantChans["test"]).To(HaveLen(1), "Declarations should be re-posted")
+	})
+})
@@ -0,0 +1,1082 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+	gwclientset "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+	gwinfv1 "sigs.k8s.io/gateway-api/pkg/client/informers/externalversions/apis/v1alpha1"
+)
+
+const (
+	// DefaultGatewayControllerName is the controller of the GatewayClasses processed by CIS by default
+	DefaultGatewayControllerName = "f5.com/k8s-bigip-ctlr"
+
+	// Group of the Gateway API resources
+	gatewayAPIGroup = "networking.x-k8s.io"
+
+	// Reasons of the conditions not defined by Gateway API
+	gatewayReasonScheduled   = "Scheduled"
+	gatewayReasonReady       = "Ready"
+	gatewayClassReasonAdmit  = "Admitted"
+	routeReasonAdmitted      = "Admitted"
+	routeReasonUnsupported   = "Unsupported"
+	routeReasonRouteConflict = "RouteConflict"
+	routeReasonInvalidConfig = "InvalidConfig"
+)
+
+// setupGatewayClient creates the Gateway API client and the GatewayClass informer
+func (crMgr *CRManager) setupGatewayClient(config *rest.Config, controllerName string) error {
+	gatewayClient, err := gwclientset.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("Failed to create Gateway API client: %v", err)
+	}
+	crMgr.gatewayClient = gatewayClient
+	crMgr.gatewayControllerName = controllerName
+	crMgr.gwcInformer = crMgr.newGatewayClassInformer()
+	return nil
+}
+
+func (crMgr *CRManager) newGatewayClassInformer() *GWCInformer {
+	gwcInf := &GWCInformer{
+		stopCh: make(chan struct{}),
+		gwcInformer: gwinfv1.NewGatewayClassInformer(
+			crMgr.gatewayClient,
+			0*time.Second,
+			cache.Indexers{},
+		),
+	}
+	gwcInf.gwcInformer.AddEventHandler(
+		&cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { crMgr.enqueueGatewayResource(obj, GatewayClass, false) },
+			UpdateFunc: func(old, cur interface{}) { crMgr.enqueueUpdatedGatewayResource(old, cur, GatewayClass) },
+			DeleteFunc: func(obj interface{}) { crMgr.enqueueGatewayResource(obj, GatewayClass, true) },
+		},
+	)
+	return gwcInf
+}
+
+// formatGatewayVirtualName returns the name of the virtual created for a port of the Gateway listeners
+func formatGatewayVirtualName(namespace, name string, port gwapiv1.PortNumber) string {
+	return AS3NameFormatter(fmt.Sprintf("gw_%s_%s_%d", namespace, name, port))
+}
+
+// getGatewayClass returns the GatewayClass with the given name, nil if it does not exist
+func (crMgr *CRManager) getGatewayClass(name string) *gwapiv1.GatewayClass {
+	if crMgr.gwcInformer == nil {
+		return nil
+	}
+	obj, found, _ := crMgr.gwcInformer.gwcInformer.GetIndexer().GetByKey(name)
+	if !found {
+		return nil
+	}
+	return obj.(*gwapiv1.GatewayClass)
+}
+
+// isGatewayManaged returns true when the class of the Gateway is controlled by CIS
+func (crMgr *CRManager) isGatewayManaged(gw *gwapiv1.Gateway) bool {
+	gwc := crMgr.getGatewayClass(gw.Spec.GatewayClassName)
+	return gwc != nil && gwc.Spec.Controller == crMgr.gatewayControllerName
+}
+
+// listNamespacedObjects returns the objects of the informer in the namespace, all objects when namespace is empty
+func listNamespacedObjects(informer cache.SharedIndexInformer, namespace string) []interface{} {
+	if informer == nil {
+		return nil
+	}
+	if namespace == "" {
+		return informer.GetIndexer().List()
+	}
+	objs, err := informer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil {
+		log.Errorf("Unable to list resources of namespace '%v': %v", namespace, err)
+		return nil
+	}
+	return objs
+}
+
+// getAllGateways returns the Gateways in the namespace
+func (crMgr *CRManager) getAllGateways(namespace string) []*gwapiv1.Gateway {
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v", namespace)
+		return nil
+	}
+	var gateways []*gwapiv1.Gateway
+	for _, obj := range listNamespacedObjects(crInf.gwInformer, namespace) {
+		gateways = append(gateways, obj.(*gwapiv1.Gateway))
+	}
+	return gateways
+}
+
+// getGatewaysForClass returns the Gateways of the GatewayClass in all the watched namespaces
+func (crMgr *CRManager) getGatewaysForClass(className string) []*gwapiv1.Gateway {
+	var gateways []*gwapiv1.Gateway
+	for _, crInf := range crMgr.getCRInformers() {
+		for _, obj := range listNamespacedObjects(crInf.gwInformer, crInf.namespace) {
+			gw := obj.(*gwapiv1.Gateway)
+			if gw.Spec.GatewayClassName == className {
+				gateways = append(gateways, gw)
+			}
+		}
+	}
+	return gateways
+}
+
+// getGatewaysForService returns the Gateways with a virtual referring to the service as pool
+func (crMgr *CRManager) getGatewaysForService(svc *v1.Service) []*gwapiv1.Gateway {
+	keys := make(map[string]bool)
+	for _, rsCfg := range crMgr.resources.rsMap {
+		if rsCfg.MetaData.gateway == "" || rsCfg.MetaData.namespace != svc.Namespace {
+			continue
+		}
+		for _, pool := range rsCfg.Pools {
+			if pool.ServiceName == svc.Name {
+				keys[rsCfg.MetaData.gateway] = true
+				break
+			}
+		}
+	}
+	var gateways []*gwapiv1.Gateway
+	crInf, ok := crMgr.getNamespacedInformer(svc.Namespace)
+	if !ok || crInf.gwInformer == nil {
+		return nil
+	}
+	for key := range keys {
+		obj, found, _ := crInf.gwInformer.GetIndexer().GetByKey(key)
+		if found {
+			gateways = append(gateways, obj.(*gwapiv1.Gateway))
+		}
+	}
+	return gateways
+}
+
+// getGatewaysForSecret returns the managed Gateways with a listener referring to the Secret as certificate
+func (crMgr *CRManager) getGatewaysForSecret(secret *v1.Secret) []*gwapiv1.Gateway {
+	var gateways []*gwapiv1.Gateway
+	for _, gw := range crMgr.getAllGateways(secret.Namespace) {
+		if !crMgr.isGatewayManaged(gw) {
+			continue
+		}
+		for _, l := range gw.Spec.Listeners {
+			if l.TLS != nil && l.TLS.CertificateRef != nil && l.TLS.CertificateRef.Name == secret.Name {
+				gateways = append(gateways, gw)
+				break
+			}
+		}
+	}
+	return gateways
+}
+
+// processGatewayClass admits the GatewayClass controlled by CIS and processes its Gateways
+func (crMgr *CRManager) processGatewayClass(gwc *gwapiv1.GatewayClass, isDeleted bool) error {
+	if !isDeleted && gwc.Spec.Controller == crMgr.gatewayControllerName {
+		crMgr.updateGatewayClassStatus(gwc, newCondition(string(gwapiv1.GatewayClassConditionStatusAdmitted),
+			metav1.ConditionTrue, gatewayClassReasonAdmit, "GatewayClass is admitted by "+crMgr.gatewayControllerName))
+	}
+	var err error
+	for _, gw := range crMgr.getGatewaysForClass(gwc.Name) {
+		if gwErr := crMgr.processGateway(gw, false); gwErr != nil {
+			err = gwErr
+		}
+	}
+	return err
+}
+
+// gatewayListener holds the listener of a Gateway with the conditions observed while processing it
+type gatewayListener struct {
+	gwapiv1.Listener
+	// failed is the condition which detaches the listener, nil when the listener is valid
+	failed *metav1.Condition
+}
+
+// processGateway creates a virtual for each port of the Gateway listeners,
+// the Routes bound to the listeners are converted into pools and LTM policy rules of the virtual
+func (crMgr *CRManager) processGateway(gw *gwapiv1.Gateway, isDeleted bool) error {
+	startTime := time.Now()
+	defer func() {
+		log.Debugf("Finished syncing Gateway %v/%v (%v)", gw.Namespace, gw.Name, time.Since(startTime))
+	}()
+
+	gwKey := gw.Namespace + "/" + gw.Name
+	// Conditions of the routes bound to the Gateway, keyed by kind/namespace/name
+	routeConds := make(map[string]metav1.Condition)
+	if isDeleted || !crMgr.isGatewayManaged(gw) {
+		crMgr.deleteGatewayVirtuals(gwKey, nil)
+		crMgr.updateRoutesStatus(gw, routeConds)
+		return nil
+	}
+
+	ip := getGatewayAddress(gw)
+	if ip == "" {
+		crMgr.deleteGatewayVirtuals(gwKey, nil)
+		crMgr.updateRoutesStatus(gw, routeConds)
+		crMgr.updateGatewayStatus(gw, "", nil,
+			newCondition(string(gwapiv1.GatewayConditionScheduled), metav1.ConditionTrue, gatewayReasonScheduled,
+				"Gateway is scheduled"),
+			newCondition(string(gwapiv1.GatewayConditionReady), metav1.ConditionFalse,
+				string(gwapiv1.GatewayReasonAddressNotAssigned), "No IPAddress found in the addresses of Gateway"))
+		return nil
+	}
+
+	listeners := make([]*gatewayListener, len(gw.Spec.Listeners))
+	var ports []gwapiv1.PortNumber
+	portListeners := make(map[gwapiv1.PortNumber][]*gatewayListener)
+	for i, l := range gw.Spec.Listeners {
+		listeners[i] = &gatewayListener{Listener: l, failed: validateListener(l)}
+		if _, ok := portListeners[l.Port]; !ok {
+			ports = append(ports, l.Port)
+		}
+		portListeners[l.Port] = append(portListeners[l.Port], listeners[i])
+	}
+
+	vsMap := make(ResourceConfigMap)
+	for _, port := range ports {
+		lsnrs := portListeners[port]
+		setListenerConflicts(lsnrs)
+		// Virtual of VirtualServer or TransportServer on the same address takes precedence over the Gateway
+		if vrt := crMgr.getVirtualUsingAddress(gwKey, ip, int32(port)); vrt != nil {
+			message := fmt.Sprintf("Address %v:%v is used by %v %v/%v", ip, port,
+				vrt.MetaData.ResourceType, vrt.MetaData.namespace, vrt.MetaData.rscName)
+			if vrt.MetaData.gateway != "" {
+				message = fmt.Sprintf("Address %v:%v is used by Gateway %v", ip, port, vrt.MetaData.gateway)
+			}
+			for _, l := range lsnrs {
+				if l.failed == nil {
+					cond := newCondition(string(gwapiv1.ListenerConditionDetached), metav1.ConditionTrue,
+						string(gwapiv1.ListenerReasonPortUnavailable), message)
+					l.failed = &cond
+				}
+			}
+			continue
+		}
+		var rsCfg *ResourceConfig
+		switch lsnrs[0].Protocol {
+		case gwapiv1.HTTPProtocolType, gwapiv1.HTTPSProtocolType:
+			rsCfg = crMgr.prepareRSConfigFromHTTPListeners(gw, ip, port, lsnrs, routeConds)
+		case gwapiv1.TLSProtocolType, gwapiv1.TCPProtocolType:
+			rsCfg = crMgr.prepareRSConfigFromL4Listener(gw, ip, port, lsnrs[0], routeConds)
+		}
+		if rsCfg == nil {
+			continue
+		}
+		if crMgr.ControllerMode == NodePortMode {
+			crMgr.updatePoolMembersForNodePort(rsCfg, gw.Namespace)
+		} else {
+			crMgr.updatePoolMembersForCluster(rsCfg, gw.Namespace)
+		}
+		vsMap[rsCfg.Virtual.Name] = rsCfg
+	}
+
+	var hostnames []string
+	newVSCreated := false
+	for rsName, rsCfg := range vsMap {
+		if _, ok := crMgr.resources.rsMap[rsName]; !ok {
+			newVSCreated = true
+		}
+		hostnames = append(hostnames, rsCfg.MetaData.hosts...)
+		crMgr.resources.rsMap[rsName] = rsCfg
+	}
+	crMgr.deleteGatewayVirtuals(gwKey, vsMap)
+	if newVSCreated {
+		crMgr.ProcessAssociatedExternalDNS(hostnames)
+	}
+
+	crMgr.updateRoutesStatus(gw, routeConds)
+
+	var listenerStatuses []gwapiv1.ListenerStatus
+	ready := newCondition(string(gwapiv1.GatewayConditionReady), metav1.ConditionTrue, gatewayReasonReady,
+		"Gateway is ready")
+	for _, l := range listeners {
+		if l.failed != nil {
+			ready = newCondition(string(gwapiv1.GatewayConditionReady), metav1.ConditionFalse,
+				string(gwapiv1.GatewayReasonListenersNotValid), "One or more listeners are not valid")
+		}
+		listenerStatuses = append(listenerStatuses, getListenerStatus(l))
+	}
+	crMgr.updateGatewayStatus(gw, ip, listenerStatuses,
+		newCondition(string(gwapiv1.GatewayConditionScheduled), metav1.ConditionTrue, gatewayReasonScheduled,
+			"Gateway is scheduled"),
+		ready)
+	return nil
+}
+
+// deleteGatewayVirtuals deletes the virtuals of the Gateway which are not in keep
+func (crMgr *CRManager) deleteGatewayVirtuals(gwKey string, keep ResourceConfigMap) {
+	for rsName, rsCfg := range crMgr.resources.rsMap {
+		if rsCfg.MetaData.gateway != gwKey {
+			continue
+		}
+		if _, ok := keep[rsName]; !ok {
+			crMgr.deleteVirtualServer(rsName)
+		}
+	}
+}
+
+// getGatewayAddress returns the first IPAddress requested in the addresses of the Gateway
+func getGatewayAddress(gw *gwapiv1.Gateway) string {
+	for _, addr := range gw.Spec.Addresses {
+		if addr.Type == nil || *addr.Type == gwapiv1.IPAddressType {
+			return addr.Value
+		}
+	}
+	return ""
+}
+
+// getVirtualUsingAddress returns the virtual, which is not of the Gateway, using the address and port
+func (crMgr *CRManager) getVirtualUsingAddress(gwKey, ip string, port int32) *ResourceConfig {
+	for _, rsCfg := range crMgr.resources.rsMap {
+		if rsCfg.MetaData.gateway == gwKey || rsCfg.Virtual.VirtualAddress == nil {
+			continue
+		}
+		if rsCfg.Virtual.VirtualAddress.BindAddr == ip && rsCfg.Virtual.VirtualAddress.Port == port {
+			return rsCfg
+		}
+	}
+	return nil
+}
+
+// getGatewaysUsingAddress returns the managed Gateways with a listener on any of the ports of the address
+func (crMgr *CRManager) getGatewaysUsingAddress(ip string, ports []int32) []*gwapiv1.Gateway {
+	portSet := make(map[int32]bool)
+	for _, port := range ports {
+		portSet[port] = true
+	}
+	var gateways []*gwapiv1.Gateway
+	for _, crInf := range crMgr.getCRInformers() {
+		for _, obj := range listNamespacedObjects(crInf.gwInformer, crInf.namespace) {
+			gw := obj.(*gwapiv1.Gateway)
+			if getGatewayAddress(gw) != ip || !crMgr.isGatewayManaged(gw) {
+				continue
+			}
+			for _, l := range gw.Spec.Listeners {
+				if portSet[int32(l.Port)] {
+					gateways = append(gateways, gw)
+					break
+				}
+			}
+		}
+	}
+	return gateways
+}
+
+// enqueueGatewaysUsingAddress enqueues the Gateways with a listener on any of the ports of the address
+func (crMgr *CRManager) enqueueGatewaysUsingAddress(ip string, ports []int32) {
+	for _, gw := range crMgr.getGatewaysUsingAddress(ip, ports) {
+		crMgr.enqueueGatewayResource(gw, Gateway, false)
+	}
+}
+
+// getRouteKind returns the kind of Routes served by the listener protocol
+func getRouteKind(protocol gwapiv1.ProtocolType) string {
+	switch protocol {
+	case gwapiv1.HTTPProtocolType, gwapiv1.HTTPSProtocolType:
+		return HTTPRoute
+	case gwapiv1.TLSProtocolType:
+		return TLSRoute
+	case gwapiv1.TCPProtocolType:
+		return TCPRoute
+	}
+	return ""
+}
+
+// validateListener returns the condition which detaches the listener, nil when the listener is supported
+func validateListener(l gwapiv1.Listener) *metav1.Condition {
+	fail := func(condType gwapiv1.ListenerConditionType, status metav1.ConditionStatus,
+		reason gwapiv1.ListenerConditionReason, message string) *metav1.Condition {
+		cond := newCondition(string(condType), status, string(reason), message)
+		return &cond
+	}
+	switch l.Protocol {
+	case gwapiv1.HTTPProtocolType, gwapiv1.TCPProtocolType:
+	case gwapiv1.HTTPSProtocolType:
+		if l.TLS == nil || l.TLS.CertificateRef == nil {
+			return fail(gwapiv1.ListenerConditionResolvedRefs, metav1.ConditionFalse,
+				gwapiv1.ListenerReasonInvalidCertificateRef, "HTTPS listener requires a certificateRef")
+		}
+		if l.TLS.Mode != nil && *l.TLS.Mode != gwapiv1.TLSModeTerminate {
+			return fail(gwapiv1.ListenerConditionDetached, metav1.ConditionTrue,
+				gwapiv1.ListenerReasonUnsupportedProtocol, "HTTPS listener supports only Terminate mode")
+		}
+		ref := l.TLS.CertificateRef
+		if ref.Kind != "Secret" || (ref.Group != "" && ref.Group != "core") {
+			return fail(gwapiv1.ListenerConditionResolvedRefs, metav1.ConditionFalse,
+				gwapiv1.ListenerReasonInvalidCertificateRef, "certificateRef supports only core Secrets")
+		}
+	case gwapiv1.TLSProtocolType:
+		if l.TLS == nil || l.TLS.Mode == nil || *l.TLS.Mode != gwapiv1.TLSModePassthrough {
+			return fail(gwapiv1.ListenerConditionDetached, metav1.ConditionTrue,
+				gwapiv1.ListenerReasonUnsupportedProtocol, "TLS listener supports only Passthrough mode")
+		}
+	default:
+		return fail(gwapiv1.ListenerConditionDetached, metav1.ConditionTrue,
+			gwapiv1.ListenerReasonUnsupportedProtocol, fmt.Sprintf("Protocol %v is not supported", l.Protocol))
+	}
+
+	if l.Routes.Kind != getRouteKind(l.Protocol) ||
+		(l.Routes.Group != nil && *l.Routes.Group != gatewayAPIGroup) {
+		return fail(gwapiv1.ListenerConditionResolvedRefs, metav1.ConditionFalse, gwapiv1.ListenerReasonInvalidRoutesRef,
+			fmt.Sprintf("%v listener supports only %v", l.Protocol, getRouteKind(l.Protocol)))
+	}
+	if l.Routes.Namespaces != nil && l.Routes.Namespaces.From != nil &&
+		*l.Routes.Namespaces.From != gwapiv1.RouteSelectSame {
+		return fail(gwapiv1.ListenerConditionResolvedRefs, metav1.ConditionFalse, gwapiv1.ListenerReasonInvalidRoutesRef,
+			"Only routes from the namespace of Gateway are supported")
+	}
+	return nil
+}
+
+// setListenerConflicts marks the listeners sharing a port which can not be served by the same virtual
+func setListenerConflicts(lsnrs []*gatewayListener) {
+	conflict := func(l *gatewayListener, reason gwapiv1.ListenerConditionReason, message string) {
+		if l.failed != nil {
+			return
+		}
+		cond := newCondition(string(gwapiv1.ListenerConditionConflicted), metav1.ConditionTrue, string(reason), message)
+		l.failed = &cond
+	}
+	for _, l := range lsnrs[1:] {
+		if l.Protocol != lsnrs[0].Protocol {
+			for _, cl := range lsnrs {
+				conflict(cl, gwapiv1.ListenerReasonProtocolConflict,
+					fmt.Sprintf("Listeners with different protocols use port %v", l.Port))
+			}
+			return
+		}
+	}
+	switch lsnrs[0].Protocol {
+	case gwapiv1.TLSProtocolType, gwapiv1.TCPProtocolType:
+		for _, l := range lsnrs[1:] {
+			conflict(l, gwapiv1.ListenerReasonHostnameConflict,
+				fmt.Sprintf("Only one %v listener is supported on port %v", l.Protocol, l.Port))
+		}
+	default:
+		hosts := make(map[string]bool)
+		for _, l := range lsnrs {
+			host := ""
+			if l.Hostname != nil {
+				host = string(*l.Hostname)
+			}
+			if hosts[host] {
+				conflict(l, gwapiv1.ListenerReasonHostnameConflict,
+					fmt.Sprintf("Hostname %q is used by another listener on port %v", host, l.Port))
+				continue
+			}
+			hosts[host] = true
+		}
+	}
+}
+
+// getListenerStatus returns the status of the listener from the condition observed while processing it
+func getListenerStatus(l *gatewayListener) gwapiv1.ListenerStatus {
+	conds := map[gwapiv1.ListenerConditionType]metav1.Condition{
+		gwapiv1.ListenerConditionDetached: newCondition(string(gwapiv1.ListenerConditionDetached),
+			metav1.ConditionFalse, "Attached", "Listener is attached"),
+		gwapiv1.ListenerConditionConflicted: newCondition(string(gwapiv1.ListenerConditionConflicted),
+			metav1.ConditionFalse, "NoConflicts", "Listener does not conflict"),
+		gwapiv1.ListenerConditionResolvedRefs: newCondition(string(gwapiv1.ListenerConditionResolvedRefs),
+			metav1.ConditionTrue, "ResolvedRefs", "All the references are resolved"),
+		gwapiv1.ListenerConditionReady: newCondition(string(gwapiv1.ListenerConditionReady),
+			metav1.ConditionTrue, "Ready", "Listener is ready"),
+	}
+	if l.failed != nil {
+		conds[gwapiv1.ListenerConditionType(l.failed.Type)] = *l.failed
+		conds[gwapiv1.ListenerConditionReady] = newCondition(string(gwapiv1.ListenerConditionReady),
+			metav1.ConditionFalse, string(gwapiv1.ListenerReasonInvalid), l.failed.Message)
+	}
+	ls := gwapiv1.ListenerStatus{
+		Port:     l.Port,
+		Protocol: l.Protocol,
+		Hostname: l.Hostname,
+	}
+	for _, condType := range []gwapiv1.ListenerConditionType{
+		gwapiv1.ListenerConditionDetached,
+		gwapiv1.ListenerConditionConflicted,
+		gwapiv1.ListenerConditionResolvedRefs,
+		gwapiv1.ListenerConditionReady,
+	} {
+		ls.Conditions = append(ls.Conditions, conds[condType])
+	}
+	return ls
+}
+
+// newGatewayResourceConfig returns the resource config of the virtual for the port of the Gateway
+func (crMgr *CRManager) newGatewayResourceConfig(
+	gw *gwapiv1.Gateway,
+	ip string,
+	port gwapiv1.PortNumber,
+	resourceType string,
+) *ResourceConfig {
+	rsCfg := &ResourceConfig{}
+	rsCfg.Virtual.Partition = crMgr.getTenant(gw.ObjectMeta)
+	rsCfg.MetaData.ResourceType = resourceType
+	// rscName is left empty, as the status of Gateway is not derived from the AS3 response
+	rsCfg.MetaData.namespace = gw.Namespace
+	rsCfg.MetaData.gateway = gw.Namespace + "/" + gw.Name
+	rsCfg.Virtual.Enabled = true
+	rsCfg.Virtual.Name = formatGatewayVirtualName(gw.Namespace, gw.Name, port)
+	rsCfg.Virtual.SetVirtualAddress(ip, int32(port))
+	rsCfg.IntDgMap = make(InternalDataGroupMap)
+	rsCfg.IRulesMap = make(IRulesMap)
+	rsCfg.customProfiles.Profs = make(map[SecretKey]CustomProfile)
+	return rsCfg
+}
+
+// prepareRSConfigFromHTTPListeners converts the HTTPRoutes bound to the HTTP or HTTPS listeners of the port
+// into VirtualServers, which are processed the same way as the VirtualServer custom resources
+func (crMgr *CRManager) prepareRSConfigFromHTTPListeners(
+	gw *gwapiv1.Gateway,
+	ip string,
+	port gwapiv1.PortNumber,
+	lsnrs []*gatewayListener,
+	routeConds map[string]metav1.Condition,
+) *ResourceConfig {
+	rsCfg := crMgr.newGatewayResourceConfig(gw, ip, port, VirtualServer)
+	rsCfg.MetaData.Protocol = "http"
+	if lsnrs[0].Protocol == gwapiv1.HTTPSProtocolType {
+		rsCfg.MetaData.Protocol = "https"
+	}
+
+	valid := false
+	for _, l := range lsnrs {
+		if l.Protocol == gwapiv1.HTTPSProtocolType && l.failed == nil {
+			// Listener with an invalid certificate is skipped, without affecting the other listeners of the port
+			l.failed = crMgr.validateListenerCertificate(gw.Namespace, l)
+			if l.failed != nil {
+				for _, route := range crMgr.getHTTPRoutesForListener(gw, l.Listener) {
+					routeKey := HTTPRoute + "/" + route.Namespace + "/" + route.Name
+					if _, ok := routeConds[routeKey]; !ok {
+						routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted),
+							metav1.ConditionFalse, routeReasonInvalidConfig, l.failed.Message)
+					}
+				}
+			}
+		}
+		if l.failed != nil {
+			continue
+		}
+		valid = true
+		var tls *cisapiv1.TLSProfile
+		if l.Protocol == gwapiv1.HTTPSProtocolType {
+			tls = &cisapiv1.TLSProfile{
+				ObjectMeta: metav1.ObjectMeta{Name: l.TLS.CertificateRef.Name, Namespace: gw.Namespace},
+				Spec: cisapiv1.TLSProfileSpec{
+					TLS: cisapiv1.TLS{
+						Termination: TLSEdge,
+						Reference:   Secret,
+						ClientSSL:   l.TLS.CertificateRef.Name,
+					},
+				},
+			}
+		}
+		for _, route := range crMgr.getHTTPRoutesForListener(gw, l.Listener) {
+			routeKey := HTTPRoute + "/" + route.Namespace + "/" + route.Name
+			hostnames := getRouteHostnames(l.Hostname, route.Spec.Hostnames)
+			if len(hostnames) == 0 {
+				continue
+			}
+			virtuals, err := httpRouteToVirtualServers(route, hostnames)
+			if err != nil {
+				log.Errorf("HTTPRoute %v is not supported: %v", routeKey, err)
+				routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionFalse,
+					routeReasonUnsupported, err.Error())
+				continue
+			}
+			admitted := true
+			for _, vs := range virtuals {
+				if err := crMgr.prepareRSConfigFromVirtualServer(rsCfg, vs); err != nil {
+					routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted),
+						metav1.ConditionFalse, routeReasonInvalidConfig, err.Error())
+					admitted = false
+					break
+				}
+				if tls != nil {
+					vs.Spec.TLSProfileName = tls.Name
+					vs.Spec.VirtualServerHTTPSPort = int32(port)
+					if !crMgr.handleVirtualServerTLS(rsCfg, vs, tls, ip) {
+						routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted),
+							metav1.ConditionFalse, routeReasonInvalidConfig,
+							fmt.Sprintf("Secret %v can not be processed", tls.Name))
+						admitted = false
+						break
+					}
+				}
+				rsCfg.MetaData.hosts = append(rsCfg.MetaData.hosts, vs.Spec.Host)
+			}
+			if admitted {
+				routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionTrue,
+					routeReasonAdmitted, "Route is admitted by Gateway "+gw.Name)
+			}
+		}
+	}
+	if !valid {
+		return nil
+	}
+	return rsCfg
+}
+
+// validateListenerCertificate returns the condition which detaches the HTTPS listener,
+// nil when the Secret of its certificate is valid
+func (crMgr *CRManager) validateListenerCertificate(namespace string, l *gatewayListener) *metav1.Condition {
+	name := l.TLS.CertificateRef.Name
+	secret, err := crMgr.getSecret(namespace, name)
+	if err == nil {
+		for _, key := range []string{"tls.crt", "tls.key"} {
+			if _, ok := secret.Data[key]; !ok {
+				err = fmt.Errorf("'%v' field not specified", key)
+				break
+			}
+		}
+	}
+	if err != nil {
+		cond := newCondition(string(gwapiv1.ListenerConditionResolvedRefs), metav1.ConditionFalse,
+			string(gwapiv1.ListenerReasonInvalidCertificateRef), fmt.Sprintf("Secret %v is not valid: %v", name, err))
+		return &cond
+	}
+	return nil
+}
+
+// prepareRSConfigFromL4Listener converts the TLSRoute or TCPRoute bound to the listener into a TransportServer,
+// which is processed the same way as the TransportServer custom resources
+func (crMgr *CRManager) prepareRSConfigFromL4Listener(
+	gw *gwapiv1.Gateway,
+	ip string,
+	port gwapiv1.PortNumber,
+	l *gatewayListener,
+	routeConds map[string]metav1.Condition,
+) *ResourceConfig {
+	if l.failed != nil {
+		return nil
+	}
+	rsCfg := crMgr.newGatewayResourceConfig(gw, ip, port, TransportServer)
+
+	type l4Route struct {
+		metav1.ObjectMeta
+		forwardTo [][]gwapiv1.RouteForwardTo
+	}
+	var routes []l4Route
+	if l.Protocol == gwapiv1.TLSProtocolType {
+		for _, route := range crMgr.getTLSRoutesForListener(gw, l.Listener) {
+			rt := l4Route{ObjectMeta: route.ObjectMeta}
+			for _, rule := range route.Spec.Rules {
+				rt.forwardTo = append(rt.forwardTo, rule.ForwardTo)
+			}
+			routes = append(routes, rt)
+		}
+	} else {
+		for _, route := range crMgr.getTCPRoutesForListener(gw, l.Listener) {
+			rt := l4Route{ObjectMeta: route.ObjectMeta}
+			for _, rule := range route.Spec.Rules {
+				rt.forwardTo = append(rt.forwardTo, rule.ForwardTo)
+			}
+			routes = append(routes, rt)
+		}
+	}
+	// Oldest route is bound to the listener, so that a new route does not take over the virtual
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].CreationTimestamp.Equal(&routes[j].CreationTimestamp) {
+			return routes[i].Name < routes[j].Name
+		}
+		return routes[i].CreationTimestamp.Before(&routes[j].CreationTimestamp)
+	})
+
+	kind := getRouteKind(l.Protocol)
+	var bound string
+	for _, route := range routes {
+		routeKey := kind + "/" + route.Namespace + "/" + route.Name
+		if bound != "" {
+			routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionFalse,
+				routeReasonRouteConflict, fmt.Sprintf("Listener on port %v is used by %v %v", port, kind, bound))
+			continue
+		}
+		if len(route.forwardTo) != 1 || len(route.forwardTo[0]) != 1 {
+			routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionFalse,
+				routeReasonUnsupported, "Only one rule forwarding to one service is supported")
+			continue
+		}
+		svc, svcPort, err := getForwardToService(route.forwardTo[0][0].ServiceName, route.forwardTo[0][0].Port)
+		if err != nil {
+			routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionFalse,
+				routeReasonUnsupported, err.Error())
+			continue
+		}
+		ts := &cisapiv1.TransportServer{
+			ObjectMeta: metav1.ObjectMeta{Name: route.Name, Namespace: route.Namespace},
+			Spec: cisapiv1.TransportServerSpec{
+				VirtualServerAddress: ip,
+				VirtualServerPort:    int32(port),
+				Mode:                 "standard",
+				Type:                 "tcp",
+				Pool: cisapiv1.Pool{
+					Service:     svc,
+					ServicePort: svcPort,
+				},
+			},
+		}
+		if err := crMgr.prepareRSConfigFromTransportServer(rsCfg, ts); err != nil {
+			routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionFalse,
+				routeReasonInvalidConfig, err.Error())
+			continue
+		}
+		bound = route.Name
+		routeConds[routeKey] = newCondition(string(gwapiv1.ConditionRouteAdmitted), metav1.ConditionTrue,
+			routeReasonAdmitted, "Route is admitted by Gateway "+gw.Name)
+	}
+	if bound == "" {
+		// No pool to forward the connections to
+		return nil
+	}
+	return rsCfg
+}
+
+// getForwardToService returns the service and port of a forwardTo, only services are supported as backends
+func getForwardToService(serviceName *string, port *gwapiv1.PortNumber) (string, int32, error) {
+	if serviceName == nil || *serviceName == "" {
+		return "", 0, fmt.Errorf("forwardTo supports only serviceName")
+	}
+	if port == nil {
+		return "", 0, fmt.Errorf("port of service %v is required", *serviceName)
+	}
+	return *serviceName, int32(*port), nil
+}
+
+// httpRouteToVirtualServers returns a VirtualServer for each hostname of the HTTPRoute,
+// with a pool for each path prefix matched by the rules
+func httpRouteToVirtualServers(route *gwapiv1.HTTPRoute, hostnames []string) ([]*cisapiv1.VirtualServer, error) {
+	var pools []cisapiv1.Pool
+	for _, rule := range route.Spec.Rules {
+		if len(rule.Filters) > 0 {
+			return nil, fmt.Errorf("filters are not supported")
+		}
+		if len(rule.ForwardTo) != 1 {
+			return nil, fmt.Errorf("each rule must forward to exactly one service")
+		}
+		if len(rule.ForwardTo[0].Filters) > 0 {
+			return nil, fmt.Errorf("filters are not supported")
+		}
+		svc, svcPort, err := getForwardToService(rule.ForwardTo[0].ServiceName, rule.ForwardTo[0].Port)
+		if err != nil {
+			return nil, err
+		}
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []gwapiv1.HTTPRouteMatch{{}}
+		}
+		for _, match := range matches {
+			if match.Headers != nil || match.QueryParams != nil || match.ExtensionRef != nil {
+				return nil, fmt.Errorf("only path matches are supported")
+			}
+			path := "/"
+			if match.Path != nil {
+				if match.Path.Type != nil && *match.Path.Type != gwapiv1.PathMatchPrefix {
+					return nil, fmt.Errorf("path match type %v is not supported", *match.Path.Type)
+				}
+				if match.Path.Value != nil && *match.Path.Value != "" {
+					path = *match.Path.Value
+				}
+			}
+			pools = append(pools, cisapiv1.Pool{
+				Path:        path,
+				Service:     svc,
+				ServicePort: svcPort,
+			})
+		}
+	}
+
+	var virtuals []*cisapiv1.VirtualServer
+	for _, host := range hostnames {
+		virtuals = append(virtuals, &cisapiv1.VirtualServer{
+			ObjectMeta: metav1.ObjectMeta{Name: route.Name, Namespace: route.Namespace},
+			Spec: cisapiv1.VirtualServerSpec{
+				Host:  host,
+				Pools: pools,
+			},
+		})
+	}
+	return virtuals, nil
+}
+
+// getRouteHostnames returns the hostnames of the route served by a listener with the given hostname
+// An empty hostname matches any host, no hostnames are returned when the route is not served by the listener
+func getRouteHostnames(listenerHost *gwapiv1.Hostname, routeHosts []gwapiv1.Hostname) []string {
+	lHost := ""
+	if listenerHost != nil {
+		lHost = string(*listenerHost)
+	}
+	if len(routeHosts) == 0 {
+		return []string{lHost}
+	}
+	var hosts []string
+	for _, h := range routeHosts {
+		host := string(h)
+		switch {
+		case lHost == "" || lHost == host:
+			hosts = append(hosts, host)
+		case strings.HasPrefix(lHost, "*.") && !strings.HasPrefix(host, "*.") &&
+			strings.HasSuffix(host, strings.TrimPrefix(lHost, "*")):
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// isRouteBound returns true when the route is selected by the listener and allows the Gateway
+func isRouteBound(gw *gwapiv1.Gateway, l gwapiv1.Listener, route metav1.Object, gateways *gwapiv1.RouteGateways) bool {
+	if route.GetNamespace() != gw.Namespace {
+		return false
+	}
+	if l.Routes.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(l.Routes.Selector)
+		if err != nil || !selector.Matches(labels.Set(route.GetLabels())) {
+			return false
+		}
+	}
+	allow := gwapiv1.GatewayAllowSameNamespace
+	if gateways != nil && gateways.Allow != nil {
+		allow = *gateways.Allow
+	}
+	switch allow {
+	case gwapiv1.GatewayAllowAll:
+		return true
+	case gwapiv1.GatewayAllowFromList:
+		for _, ref := range gateways.GatewayRefs {
+			if ref.Name == gw.Name && ref.Namespace == gw.Namespace {
+				return true
+			}
+		}
+		return false
+	default:
+		return route.GetNamespace() == gw.Namespace
+	}
+}
+
+// getHTTPRoutesForListener returns the HTTPRoutes bound to the listener
+func (crMgr *CRManager) getHTTPRoutesForListener(gw *gwapiv1.Gateway, l gwapiv1.Listener) []*gwapiv1.HTTPRoute {
+	crInf, ok := crMgr.getNamespacedInformer(gw.Namespace)
+	if !ok {
+		return nil
+	}
+	var routes []*gwapiv1.HTTPRoute
+	for _, obj := range listNamespacedObjects(crInf.httpRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.HTTPRoute)
+		if isRouteBound(gw, l, route, route.Spec.Gateways) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// getTLSRoutesForListener returns the TLSRoutes bound to the listener
+func (crMgr *CRManager) getTLSRoutesForListener(gw *gwapiv1.Gateway, l gwapiv1.Listener) []*gwapiv1.TLSRoute {
+	crInf, ok := crMgr.getNamespacedInformer(gw.Namespace)
+	if !ok {
+		return nil
+	}
+	var routes []*gwapiv1.TLSRoute
+	for _, obj := range listNamespacedObjects(crInf.tlsRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.TLSRoute)
+		if isRouteBound(gw, l, route, route.Spec.Gateways) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// getTCPRoutesForListener returns the TCPRoutes bound to the listener
+func (crMgr *CRManager) getTCPRoutesForListener(gw *gwapiv1.Gateway, l gwapiv1.Listener) []*gwapiv1.TCPRoute {
+	crInf, ok := crMgr.getNamespacedInformer(gw.Namespace)
+	if !ok {
+		return nil
+	}
+	var routes []*gwapiv1.TCPRoute
+	for _, obj := range listNamespacedObjects(crInf.tcpRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.TCPRoute)
+		if isRouteBound(gw, l, route, route.Spec.Gateways) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// updateGatewayClassStatus updates the conditions of the GatewayClass
+func (crMgr *CRManager) updateGatewayClassStatus(gwc *gwapiv1.GatewayClass, conditions ...metav1.Condition) {
+	gwcCopy := gwc.DeepCopy()
+	setConditions(&gwcCopy.Status.Conditions, gwc.Generation, conditions)
+	if reflect.DeepEqual(gwc.Status, gwcCopy.Status) {
+		return
+	}
+	_, err := crMgr.gatewayClient.NetworkingV1alpha1().GatewayClasses().UpdateStatus(
+		context.TODO(), gwcCopy, metav1.UpdateOptions{})
+	if err != nil {
+		log.Debugf("Error while updating GatewayClass status:%v", err)
+	}
+}
+
+// updateGatewayStatus updates the status of Gateway with the address, the conditions and the listener statuses
+// Status is updated only when it changes, so that an unchanged status does not trigger processing again
+func (crMgr *CRManager) updateGatewayStatus(
+	gw *gwapiv1.Gateway,
+	ip string,
+	listeners []gwapiv1.ListenerStatus,
+	conditions ...metav1.Condition,
+) {
+	for attempt := 1; ; attempt++ {
+		gwCopy := gw.DeepCopy()
+		gwCopy.Status.Addresses = nil
+		if ip != "" {
+			addrType := gwapiv1.IPAddressType
+			gwCopy.Status.Addresses = []gwapiv1.GatewayAddress{{Type: &addrType, Value: ip}}
+		}
+		setConditions(&gwCopy.Status.Conditions, gw.Generation, conditions)
+		gwCopy.Status.Listeners = nil
+		for _, ls := range listeners {
+			// Retain the LastTransitionTime of the listener conditions which did not change
+			conds := []metav1.Condition{}
+			for _, old := range gw.Status.Listeners {
+				if old.Port == ls.Port && old.Protocol == ls.Protocol && reflect.DeepEqual(old.Hostname, ls.Hostname) {
+					conds = append(conds, old.Conditions...)
+					break
+				}
+			}
+			setConditions(&conds, gw.Generation, ls.Conditions)
+			ls.Conditions = conds
+			gwCopy.Status.Listeners = append(gwCopy.Status.Listeners, ls)
+		}
+		if reflect.DeepEqual(gw.Status, gwCopy.Status) {
+			return
+		}
+
+		log.Debugf("Updating Gateway Status with %v for resource name:%v , namespace: %v",
+			gwCopy.Status, gw.Name, gw.Namespace)
+		_, err := crMgr.gatewayClient.NetworkingV1alpha1().Gateways(gw.Namespace).UpdateStatus(
+			context.TODO(), gwCopy, metav1.UpdateOptions{})
+		if err == nil {
+			return
+		}
+		if !k8serrors.IsConflict(err) || attempt == statusUpdateAttempts {
+			log.Debugf("Error while updating Gateway status:%v", err)
+			return
+		}
+		// Informer cache is stale, retry with the latest Gateway
+		gw, err = crMgr.gatewayClient.NetworkingV1alpha1().Gateways(gw.Namespace).Get(
+			context.TODO(), gw.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("Error while fetching Gateway to update status:%v", err)
+			return
+		}
+	}
+}
+
+// setRouteGatewayStatus sets the condition of the route for the Gateway,
+// the Gateway is removed from the status when cond is nil
+func (crMgr *CRManager) setRouteGatewayStatus(
+	status *gwapiv1.RouteStatus,
+	gw *gwapiv1.Gateway,
+	generation int64,
+	cond *metav1.Condition,
+) {
+	for i, gs := range status.Gateways {
+		if gs.GatewayRef.Name != gw.Name || gs.GatewayRef.Namespace != gw.Namespace {
+			continue
+		}
+		if cond == nil {
+			// Status reported by another controller is retained
+			if gs.GatewayRef.Controller == nil || *gs.GatewayRef.Controller == crMgr.gatewayControllerName {
+				status.Gateways = append(status.Gateways[:i], status.Gateways[i+1:]...)
+			}
+			return
+		}
+		setConditions(&status.Gateways[i].Conditions, generation, []metav1.Condition{*cond})
+		return
+	}
+	if cond == nil {
+		return
+	}
+	controller := crMgr.gatewayControllerName
+	gs := gwapiv1.RouteGatewayStatus{
+		GatewayRef: gwapiv1.RouteStatusGatewayReference{
+			Name:       gw.Name,
+			Namespace:  gw.Namespace,
+			Controller: &controller,
+		},
+	}
+	setConditions(&gs.Conditions, generation, []metav1.Condition{*cond})
+	status.Gateways = append(status.Gateways, gs)
+}
+
+// updateRoutesStatus updates the status of the routes in the namespace of Gateway with the route conditions,
+// the Gateway is removed from the status of the routes which are not bound to it
+func (crMgr *CRManager) updateRoutesStatus(gw *gwapiv1.Gateway, routeConds map[string]metav1.Condition) {
+	crInf, ok := crMgr.getNamespacedInformer(gw.Namespace)
+	if !ok {
+		return
+	}
+	getCond := func(kind string, route metav1.Object) *metav1.Condition {
+		if cond, ok := routeConds[kind+"/"+route.GetNamespace()+"/"+route.GetName()]; ok {
+			return &cond
+		}
+		return nil
+	}
+	routes := crMgr.gatewayClient.NetworkingV1alpha1()
+	logErr := func(kind, name string, err error) {
+		if err != nil {
+			log.Debugf("Error while updating %v %v/%v status:%v", kind, gw.Namespace, name, err)
+		}
+	}
+	for _, obj := range listNamespacedObjects(crInf.httpRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.HTTPRoute)
+		rtCopy := route.DeepCopy()
+		crMgr.setRouteGatewayStatus(&rtCopy.Status.RouteStatus, gw, route.Generation, getCond(HTTPRoute, route))
+		if !reflect.DeepEqual(route.Status, rtCopy.Status) {
+			_, err := routes.HTTPRoutes(route.Namespace).UpdateStatus(context.TODO(), rtCopy, metav1.UpdateOptions{})
+			logErr(HTTPRoute, route.Name, err)
+		}
+	}
+	for _, obj := range listNamespacedObjects(crInf.tlsRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.TLSRoute)
+		rtCopy := route.DeepCopy()
+		crMgr.setRouteGatewayStatus(&rtCopy.Status.RouteStatus, gw, route.Generation, getCond(TLSRoute, route))
+		if !reflect.DeepEqual(route.Status, rtCopy.Status) {
+			_, err := routes.TLSRoutes(route.Namespace).UpdateStatus(context.TODO(), rtCopy, metav1.UpdateOptions{})
+			logErr(TLSRoute, route.Name, err)
+		}
+	}
+	for _, obj := range listNamespacedObjects(crInf.tcpRouteInformer, gw.Namespace) {
+		route := obj.(*gwapiv1.TCPRoute)
+		rtCopy := route.DeepCopy()
+		crMgr.setRouteGatewayStatus(&rtCopy.Status.RouteStatus, gw, route.Generation, getCond(TCPRoute, route))
+		if !reflect.DeepEqual(route.Status, rtCopy.Status) {
+			_, err := routes.TCPRoutes(route.Namespace).UpdateStatus(context.TODO(), rtCopy, metav1.UpdateOptions{})
+			logErr(TCPRoute, route.Name, err)
+		}
+	}
+}
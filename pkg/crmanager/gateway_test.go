@@ -0,0 +1,344 @@
+package crmanager
+
+import (
+	"context"
+
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+	gwfake "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/fake"
+)
+
+var _ = Describe("Gateway API", func() {
+	var mockCRM *mockCRManager
+	var gwc *gwapiv1.GatewayClass
+	var gw *gwapiv1.Gateway
+	var httpRoute *gwapiv1.HTTPRoute
+	namespace := "default"
+	rsName := "gw_default_gw1_80"
+
+	strPtr := func(s string) *string { return &s }
+	portPtr := func(p gwapiv1.PortNumber) *gwapiv1.PortNumber { return &p }
+
+	// setup creates the resources with the fake clients and adds them to the informer caches
+	setup := func(objs ...interface{}) {
+		for _, obj := range objs {
+			var err error
+			switch rsc := obj.(type) {
+			case *gwapiv1.GatewayClass:
+				_, err = mockCRM.gatewayClient.NetworkingV1alpha1().GatewayClasses().Create(
+					context.TODO(), rsc, metav1.CreateOptions{})
+				_ = mockCRM.gwcInformer.gwcInformer.GetIndexer().Add(rsc)
+			case *gwapiv1.Gateway:
+				_, err = mockCRM.gatewayClient.NetworkingV1alpha1().Gateways(namespace).Create(
+					context.TODO(), rsc, metav1.CreateOptions{})
+				_ = mockCRM.crInformers[namespace].gwInformer.GetIndexer().Add(rsc)
+			case *gwapiv1.HTTPRoute:
+				_, err = mockCRM.gatewayClient.NetworkingV1alpha1().HTTPRoutes(namespace).Create(
+					context.TODO(), rsc, metav1.CreateOptions{})
+				_ = mockCRM.crInformers[namespace].httpRouteInformer.GetIndexer().Add(rsc)
+			case *gwapiv1.TCPRoute:
+				_, err = mockCRM.gatewayClient.NetworkingV1alpha1().TCPRoutes(namespace).Create(
+					context.TODO(), rsc, metav1.CreateOptions{})
+				_ = mockCRM.crInformers[namespace].tcpRouteInformer.GetIndexer().Add(rsc)
+			}
+			Expect(err).To(BeNil())
+		}
+	}
+
+	getGateway := func() *gwapiv1.Gateway {
+		obj, err := mockCRM.gatewayClient.NetworkingV1alpha1().Gateways(namespace).Get(
+			context.TODO(), gw.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return obj
+	}
+
+	getHTTPRoute := func(name string) *gwapiv1.HTTPRoute {
+		obj, err := mockCRM.gatewayClient.NetworkingV1alpha1().HTTPRoutes(namespace).Get(
+			context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return obj
+	}
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset(test.NewService("svc1", "1", namespace,
+			v1.ServiceTypeClusterIP, []v1.ServicePort{{Port: 80, Name: "port0"}}))
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset()
+		mockCRM.gatewayClient = gwfake.NewSimpleClientset()
+		mockCRM.gatewayControllerName = DefaultGatewayControllerName
+		mockCRM.gwcInformer = mockCRM.newGatewayClassInformer()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		_ = mockCRM.addNamespacedInformer(namespace)
+		mockCRM.resources = NewResources()
+
+		gwc = &gwapiv1.GatewayClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "f5"},
+			Spec:       gwapiv1.GatewayClassSpec{Controller: DefaultGatewayControllerName},
+		}
+		gw = &gwapiv1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: "gw1", Namespace: namespace},
+			Spec: gwapiv1.GatewaySpec{
+				GatewayClassName: "f5",
+				Listeners: []gwapiv1.Listener{
+					{
+						Port:     80,
+						Protocol: gwapiv1.HTTPProtocolType,
+						Routes:   gwapiv1.RouteBindingSelector{Kind: HTTPRoute},
+					},
+				},
+				Addresses: []gwapiv1.GatewayAddress{{Value: "1.2.3.4"}},
+			},
+		}
+		httpRoute = &gwapiv1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: namespace},
+			Spec: gwapiv1.HTTPRouteSpec{
+				Hostnames: []gwapiv1.Hostname{"foo.com"},
+				Rules: []gwapiv1.HTTPRouteRule{
+					{
+						Matches: []gwapiv1.HTTPRouteMatch{
+							{Path: &gwapiv1.HTTPPathMatch{Value: strPtr("/foo")}},
+						},
+						ForwardTo: []gwapiv1.HTTPRouteForwardTo{
+							{ServiceName: strPtr("svc1"), Port: portPtr(80)},
+						},
+					},
+				},
+			},
+		}
+	})
+
+	It("HTTP listener", func() {
+		setup(gwc, gw, httpRoute)
+		Expect(mockCRM.processGatewayClass(gwc, false)).To(BeNil())
+
+		gwcStatus, _ := mockCRM.gatewayClient.NetworkingV1alpha1().GatewayClasses().Get(
+			context.TODO(), gwc.Name, metav1.GetOptions{})
+		Expect(meta.IsStatusConditionTrue(gwcStatus.Status.Conditions,
+			string(gwapiv1.GatewayClassConditionStatusAdmitted))).To(BeTrue(), "GatewayClass should be admitted")
+
+		rsCfg, ok := mockCRM.resources.rsMap[rsName]
+		Expect(ok).To(BeTrue(), "Virtual should be created for the listener")
+		Expect(rsCfg.MetaData.ResourceType).To(Equal(VirtualServer))
+		Expect(rsCfg.Virtual.Destination).To(Equal("/" + DEFAULT_PARTITION + "/1.2.3.4:80"))
+		Expect(rsCfg.MetaData.hosts).To(Equal([]string{"foo.com"}))
+		Expect(rsCfg.Pools).To(HaveLen(1))
+		Expect(rsCfg.Pools[0].ServiceName).To(Equal("svc1"))
+		policy := rsCfg.FindPolicy(PolicyControlForward)
+		Expect(policy).NotTo(BeNil(), "HTTPRoute should be converted into LTM policy")
+		Expect(policy.Rules).To(HaveLen(1))
+		Expect(policy.Rules[0].FullURI).To(Equal("foo.com/foo"))
+
+		status := getGateway().Status
+		Expect(status.Addresses).To(HaveLen(1))
+		Expect(status.Addresses[0].Value).To(Equal("1.2.3.4"))
+		Expect(meta.IsStatusConditionTrue(status.Conditions, string(gwapiv1.GatewayConditionReady))).To(BeTrue())
+		Expect(status.Listeners).To(HaveLen(1))
+		Expect(meta.IsStatusConditionTrue(status.Listeners[0].Conditions,
+			string(gwapiv1.ListenerConditionReady))).To(BeTrue())
+
+		routeStatus := getHTTPRoute(httpRoute.Name).Status
+		Expect(routeStatus.Gateways).To(HaveLen(1))
+		Expect(routeStatus.Gateways[0].GatewayRef.Name).To(Equal(gw.Name))
+		Expect(*routeStatus.Gateways[0].GatewayRef.Controller).To(Equal(DefaultGatewayControllerName))
+		Expect(meta.IsStatusConditionTrue(routeStatus.Gateways[0].Conditions,
+			string(gwapiv1.ConditionRouteAdmitted))).To(BeTrue())
+
+		Expect(mockCRM.getGatewaysForService(test.NewService("svc1", "1", namespace,
+			v1.ServiceTypeClusterIP, nil))).To(HaveLen(1), "Gateway should be processed on service changes")
+
+		// Listener is moved to another port
+		gw.Spec.Listeners[0].Port = 8080
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).NotTo(HaveKey(rsName), "Virtual of old port should be deleted")
+		Expect(mockCRM.resources.rsMap).To(HaveKey("gw_default_gw1_8080"))
+
+		// informer cache is refreshed with the route status written by the controller
+		_ = mockCRM.crInformers[namespace].httpRouteInformer.GetIndexer().Update(getHTTPRoute(httpRoute.Name))
+		Expect(mockCRM.processGateway(gw, true)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).To(BeEmpty())
+		Expect(getHTTPRoute(httpRoute.Name).Status.Gateways).To(BeEmpty(),
+			"Gateway should be removed from the status of route")
+	})
+
+	It("TCP listener", func() {
+		gw.Spec.Listeners = []gwapiv1.Listener{
+			{
+				Port:     8080,
+				Protocol: gwapiv1.TCPProtocolType,
+				Routes:   gwapiv1.RouteBindingSelector{Kind: TCPRoute},
+			},
+		}
+		tcpRoute := &gwapiv1.TCPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: "tcp1", Namespace: namespace},
+			Spec: gwapiv1.TCPRouteSpec{
+				Rules: []gwapiv1.TCPRouteRule{
+					{ForwardTo: []gwapiv1.RouteForwardTo{{ServiceName: strPtr("svc1"), Port: portPtr(80)}}},
+				},
+			},
+		}
+		conflicting := tcpRoute.DeepCopy()
+		conflicting.Name = "tcp2"
+		setup(gwc, gw, tcpRoute, conflicting)
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+
+		rsCfg, ok := mockCRM.resources.rsMap["gw_default_gw1_8080"]
+		Expect(ok).To(BeTrue())
+		Expect(rsCfg.MetaData.ResourceType).To(Equal(TransportServer))
+		Expect(rsCfg.Virtual.Mode).To(Equal("standard"))
+		Expect(rsCfg.Virtual.PoolName).To(Equal(formatVirtualServerPoolName(namespace, "svc1", 80, "")))
+
+		route, _ := mockCRM.gatewayClient.NetworkingV1alpha1().TCPRoutes(namespace).Get(
+			context.TODO(), "tcp2", metav1.GetOptions{})
+		cond := meta.FindStatusCondition(route.Status.Gateways[0].Conditions, string(gwapiv1.ConditionRouteAdmitted))
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse), "Only one route should be bound to TCP listener")
+		Expect(cond.Reason).To(Equal(routeReasonRouteConflict))
+	})
+
+	It("Unsupported configuration", func() {
+		httpRoute.Spec.Rules[0].Matches[0].Headers = &gwapiv1.HTTPHeaderMatch{Values: map[string]string{"a": "b"}}
+		gw.Spec.Listeners = append(gw.Spec.Listeners, gwapiv1.Listener{
+			Port:     53,
+			Protocol: gwapiv1.UDPProtocolType,
+			Routes:   gwapiv1.RouteBindingSelector{Kind: "UDPRoute"},
+		})
+		setup(gwc, gw, httpRoute)
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+
+		Expect(mockCRM.resources.rsMap).To(HaveKey(rsName))
+		Expect(mockCRM.resources.rsMap[rsName].Policies).To(BeEmpty(), "Unsupported route should not be configured")
+		routeStatus := getHTTPRoute(httpRoute.Name).Status
+		Expect(meta.IsStatusConditionFalse(routeStatus.Gateways[0].Conditions,
+			string(gwapiv1.ConditionRouteAdmitted))).To(BeTrue())
+
+		status := getGateway().Status
+		Expect(meta.FindStatusCondition(status.Conditions, string(gwapiv1.GatewayConditionReady)).Reason).To(
+			Equal(string(gwapiv1.GatewayReasonListenersNotValid)))
+		Expect(meta.IsStatusConditionTrue(status.Listeners[1].Conditions,
+			string(gwapiv1.ListenerConditionDetached))).To(BeTrue(), "UDP listener should be detached")
+
+		gw.Spec.Addresses = nil
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).To(BeEmpty())
+		Expect(meta.FindStatusCondition(getGateway().Status.Conditions,
+			string(gwapiv1.GatewayConditionReady)).Reason).To(Equal(string(gwapiv1.GatewayReasonAddressNotAssigned)))
+
+		gw.Spec.Addresses = []gwapiv1.GatewayAddress{{Value: "1.2.3.4"}}
+		gw.Spec.GatewayClassName = "other"
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).To(BeEmpty(), "Gateway of other controller should not be processed")
+	})
+
+	It("Listener conflicts", func() {
+		gw.Spec.Listeners = append(gw.Spec.Listeners, gwapiv1.Listener{
+			Port:     80,
+			Protocol: gwapiv1.TCPProtocolType,
+			Routes:   gwapiv1.RouteBindingSelector{Kind: TCPRoute},
+		})
+		setup(gwc, gw)
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).To(BeEmpty())
+		for _, ls := range getGateway().Status.Listeners {
+			cond := meta.FindStatusCondition(ls.Conditions, string(gwapiv1.ListenerConditionConflicted))
+			Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+			Expect(cond.Reason).To(Equal(string(gwapiv1.ListenerReasonProtocolConflict)))
+		}
+	})
+
+	It("HTTPS listener with an invalid certificate", func() {
+		mockCRM.SSLContext = make(map[string]*v1.Secret)
+		secret := test.NewSecret("foo-cert", namespace, "cert", "key")
+		_ = mockCRM.crInformers[namespace].secretInformer.GetIndexer().Add(secret)
+		fooHost := gwapiv1.Hostname("foo.com")
+		barHost := gwapiv1.Hostname("bar.com")
+		httpsListener := func(host *gwapiv1.Hostname, certName string) gwapiv1.Listener {
+			return gwapiv1.Listener{
+				Hostname: host,
+				Port:     443,
+				Protocol: gwapiv1.HTTPSProtocolType,
+				TLS: &gwapiv1.GatewayTLSConfig{
+					CertificateRef: &gwapiv1.LocalObjectReference{Kind: "Secret", Name: certName},
+				},
+				Routes: gwapiv1.RouteBindingSelector{Kind: HTTPRoute},
+			}
+		}
+		gw.Spec.Listeners = []gwapiv1.Listener{
+			httpsListener(&fooHost, "foo-cert"),
+			httpsListener(&barHost, "bar-cert"),
+		}
+		barRoute := httpRoute.DeepCopy()
+		barRoute.Name = "route2"
+		barRoute.Spec.Hostnames = []gwapiv1.Hostname{barHost}
+		setup(gwc, gw, httpRoute, barRoute)
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+
+		rsCfg, ok := mockCRM.resources.rsMap["gw_default_gw1_443"]
+		Expect(ok).To(BeTrue(), "Virtual should be created for the valid listener")
+		Expect(rsCfg.MetaData.hosts).To(Equal([]string{"foo.com"}))
+
+		status := getGateway().Status
+		Expect(meta.IsStatusConditionTrue(status.Listeners[0].Conditions,
+			string(gwapiv1.ListenerConditionReady))).To(BeTrue())
+		cond := meta.FindStatusCondition(status.Listeners[1].Conditions, string(gwapiv1.ListenerConditionResolvedRefs))
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(string(gwapiv1.ListenerReasonInvalidCertificateRef)))
+		Expect(meta.IsStatusConditionTrue(getHTTPRoute(httpRoute.Name).Status.Gateways[0].Conditions,
+			string(gwapiv1.ConditionRouteAdmitted))).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(getHTTPRoute(barRoute.Name).Status.Gateways[0].Conditions,
+			string(gwapiv1.ConditionRouteAdmitted))).To(BeTrue())
+	})
+
+	It("Address used by a VirtualServer", func() {
+		setup(gwc, gw, httpRoute)
+		vsCfg := &ResourceConfig{}
+		vsCfg.MetaData.ResourceType = VirtualServer
+		vsCfg.MetaData.namespace = namespace
+		vsCfg.MetaData.rscName = "vs1"
+		vsCfg.Virtual.SetVirtualAddress("1.2.3.4", 80)
+		mockCRM.resources.rsMap["crd_1_2_3_4_80"] = vsCfg
+		Expect(mockCRM.getGatewaysUsingAddress("1.2.3.4", []int32{443, 80})).To(HaveLen(1))
+		Expect(mockCRM.getGatewaysUsingAddress("1.2.3.4", []int32{443})).To(BeEmpty())
+
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).NotTo(HaveKey(rsName), "VirtualServer should keep the address")
+		status := getGateway().Status
+		Expect(meta.FindStatusCondition(status.Conditions, string(gwapiv1.GatewayConditionReady)).Reason).To(
+			Equal(string(gwapiv1.GatewayReasonListenersNotValid)))
+		cond := meta.FindStatusCondition(status.Listeners[0].Conditions, string(gwapiv1.ListenerConditionDetached))
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal(string(gwapiv1.ListenerReasonPortUnavailable)))
+		Expect(cond.Message).To(ContainSubstring("VirtualServer default/vs1"))
+
+		// Gateway takes over the address once the VirtualServer is deleted
+		delete(mockCRM.resources.rsMap, "crd_1_2_3_4_80")
+		Expect(mockCRM.processGateway(gw, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap).To(HaveKey(rsName))
+	})
+
+	It("Route binding", func() {
+		host := gwapiv1.Hostname("*.foo.com")
+		Expect(getRouteHostnames(nil, nil)).To(Equal([]string{""}))
+		Expect(getRouteHostnames(&host, nil)).To(Equal([]string{"*.foo.com"}))
+		Expect(getRouteHostnames(&host, []gwapiv1.Hostname{"a.foo.com", "bar.com"})).To(Equal([]string{"a.foo.com"}))
+
+		Expect(isRouteBound(gw, gw.Spec.Listeners[0], httpRoute, nil)).To(BeTrue())
+		allow := gwapiv1.GatewayAllowFromList
+		gateways := &gwapiv1.RouteGateways{Allow: &allow}
+		Expect(isRouteBound(gw, gw.Spec.Listeners[0], httpRoute, gateways)).To(BeFalse())
+		gateways.GatewayRefs = []gwapiv1.GatewayReference{{Name: gw.Name, Namespace: namespace}}
+		Expect(isRouteBound(gw, gw.Spec.Listeners[0], httpRoute, gateways)).To(BeTrue())
+
+		gw.Spec.Listeners[0].Routes.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}}
+		Expect(isRouteBound(gw, gw.Spec.Listeners[0], httpRoute, nil)).To(BeFalse())
+		httpRoute.Labels = map[string]string{"app": "foo"}
+		Expect(isRouteBound(gw, gw.Spec.Listeners[0], httpRoute, nil)).To(BeTrue())
+	})
+})
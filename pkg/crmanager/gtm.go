@@ -0,0 +1,331 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// gtmPartitionSuffix is appended to the default partition to name the tenant of the GSLB objects,
+// so that they never clash with the LTM tenants when GTM and LTM are provisioned on the same BIG-IP
+const gtmPartitionSuffix = "_gtm"
+
+// as3CommonTenant holds the GSLB servers of the static addresses, as AS3 allows GSLB_Server only in /Common/Shared
+const as3CommonTenant = "Common"
+
+// gslbServerPrefix is the name prefix of the GSLB servers that CIS manages in /Common/Shared
+const gslbServerPrefix = "gslb_server_"
+
+var (
+	// wideIPLBMethods are the load balancing methods of the pools in a WideIP
+	wideIPLBMethods = map[string]bool{
+		"round-robin":         true,
+		"ratio":               true,
+		"topology":            true,
+		"global-availability": true,
+	}
+	// gslbPoolLBMethods are the preferred load balancing methods of the members in a WideIP pool
+	gslbPoolLBMethods = map[string]bool{
+		"round-robin":             true,
+		"ratio":                   true,
+		"topology":                true,
+		"global-availability":     true,
+		"static-persistence":      true,
+		"completion-rate":         true,
+		"fewest-hops":             true,
+		"kilobytes-per-second":    true,
+		"least-connections":       true,
+		"lowest-round-trip-time":  true,
+		"packet-rate":             true,
+		"quality-of-service":      true,
+		"virtual-server-capacity": true,
+		"virtual-server-score":    true,
+		"return-to-dns":           true,
+	}
+	// gslbPoolFallbackLBMethods are the fallback load balancing methods of the members in a WideIP pool
+	gslbPoolFallbackLBMethods = map[string]bool{
+		"round-robin":             true,
+		"ratio":                   true,
+		"topology":                true,
+		"global-availability":     true,
+		"static-persistence":      true,
+		"completion-rate":         true,
+		"fewest-hops":             true,
+		"kilobytes-per-second":    true,
+		"least-connections":       true,
+		"lowest-round-trip-time":  true,
+		"packet-rate":             true,
+		"quality-of-service":      true,
+		"virtual-server-capacity": true,
+		"virtual-server-score":    true,
+		"return-to-dns":           true,
+		"none":                    true,
+	}
+)
+
+// validateExternalDNS validates the load balancing methods and the members of the ExternalDNS
+// dataCenters holds the data center of the static addresses of the other WideIPs
+func validateExternalDNS(edns *cisapiv1.ExternalDNS, dataCenters map[string]string) error {
+	if lbMethod := edns.Spec.LoadBalanceMethod; lbMethod != "" && !wideIPLBMethods[lbMethod] {
+		return fmt.Errorf("unsupported loadBalanceMethod '%v'", lbMethod)
+	}
+	for i, pl := range edns.Spec.Pools {
+		if pl.LoadBalanceMethod != "" && !gslbPoolLBMethods[pl.LoadBalanceMethod] {
+			return fmt.Errorf("unsupported loadBalanceMethod '%v' in pool %v", pl.LoadBalanceMethod, i)
+		}
+		if pl.FallbackMethod != "" && !gslbPoolFallbackLBMethods[pl.FallbackMethod] {
+			return fmt.Errorf("unsupported fallbackMethod '%v' in pool %v", pl.FallbackMethod, i)
+		}
+		for j, member := range pl.Members {
+			switch {
+			case member.Address != "":
+				if net.ParseIP(member.Address) == nil {
+					return fmt.Errorf("invalid address '%v' of member %v in pool %v", member.Address, j, i)
+				}
+				if member.Port <= 0 || member.Port > 65535 || member.DataCenter == "" {
+					return fmt.Errorf("port and dataCenter are required for address of member %v in pool %v", j, i)
+				}
+				if dc, ok := dataCenters[member.Address]; ok && dc != getCommonPath(member.DataCenter) {
+					return fmt.Errorf("address '%v' of member %v in pool %v is already in dataCenter '%v'",
+						member.Address, j, i, dc)
+				}
+				dataCenters[member.Address] = getCommonPath(member.DataCenter)
+			case member.VirtualServerName == "":
+				return fmt.Errorf("either virtualServerName or address is required for member %v in pool %v", j, i)
+			case member.DataServerName == "" && pl.DataServerName == "":
+				return fmt.Errorf("dataServerName is required for member %v in pool %v", j, i)
+			}
+		}
+	}
+	return nil
+}
+
+// getGTMPartition returns the tenant holding the GSLB objects of the ExternalDNS resources
+func getGTMPartition() string {
+	return DEFAULT_PARTITION + gtmPartitionSuffix
+}
+
+// getCommonPath returns the path of a BIG-IP object given by name or by path, defaulting to the Common partition
+func getCommonPath(name string) string {
+	if name != "" && !strings.HasPrefix(name, "/") {
+		return "/Common/" + name
+	}
+	return name
+}
+
+// getStaticAddressDataCenters returns the data center of each static address of the WideIPs except the given one
+// A static address is a single generic host GSLB server, which belongs to one data center
+func getStaticAddressDataCenters(dnsConfig DNSConfig, skipDomain string) map[string]string {
+	dataCenters := make(map[string]string)
+	for domain, wip := range dnsConfig {
+		if domain == skipDomain {
+			continue
+		}
+		for _, pl := range wip.Pools {
+			for _, member := range pl.Members {
+				if member.Address != "" {
+					dataCenters[member.Address] = getCommonPath(member.DataCenter)
+				}
+			}
+		}
+	}
+	return dataCenters
+}
+
+// getGSLBPoolMemberIndex returns the index of the member for the same virtual server, or -1 when not found
+func getGSLBPoolMemberIndex(members []GSLBPoolMember, member GSLBPoolMember) int {
+	for i, m := range members {
+		if member.Address != "" {
+			if m.Address == member.Address && m.Port == member.Port {
+				return i
+			}
+			continue
+		}
+		if m.Address == "" && getCommonPath(m.Server) == getCommonPath(member.Server) &&
+			m.VirtualServer == member.VirtualServer {
+			return i
+		}
+	}
+	return -1
+}
+
+// createGTMDeclaration creates the AS3 declaration of the GSLB objects for the ExternalDNS resources
+// GSLB servers of the static addresses are declared in /Common/Shared. Once none is left,
+// /Common/Shared is declared empty as long as the active declaration has the servers, so that they are removed.
+func createGTMDeclaration(config ResourceConfigWrapper, userAgentInfo string, activeDecl as3Declaration) as3Declaration {
+	var as3Config map[string]interface{}
+	_ = json.Unmarshal([]byte(baseAS3Config), &as3Config)
+
+	adc := as3Config["declaration"].(map[string]interface{})
+	tenant, servers := createGTMTenant(config.dnsConfig)
+	adc[getGTMPartition()] = tenant
+	if len(servers) > 0 || hasGSLBServers(activeDecl) {
+		sharedApp := as3Application{}
+		sharedApp["class"] = "Application"
+		sharedApp["template"] = "shared"
+		for name, server := range servers {
+			sharedApp[name] = server
+		}
+		adc[as3CommonTenant] = as3Tenant{
+			"class":              "Tenant",
+			as3SharedApplication: sharedApp,
+		}
+	}
+
+	controlObj := make(map[string]interface{})
+	controlObj["class"] = "Controls"
+	controlObj["userAgent"] = userAgentInfo
+	adc["controls"] = controlObj
+
+	decl, err := json.Marshal(as3Config)
+	if err != nil {
+		log.Debugf("[GTM] Unified declaration: %v\n", err)
+	}
+	return as3Declaration(decl)
+}
+
+// hasGSLBServers returns true when the declaration has GSLB servers in /Common/Shared
+func hasGSLBServers(decl as3Declaration) bool {
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(decl), &as3Config); err != nil {
+		return false
+	}
+	adc, _ := as3Config["declaration"].(map[string]interface{})
+	tenant, _ := adc[as3CommonTenant].(map[string]interface{})
+	app, _ := tenant[as3SharedApplication].(map[string]interface{})
+	for _, obj := range app {
+		if _, ok := obj.(map[string]interface{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// createGTMTenant creates the tenant with GSLB_Domain, GSLB_Pool and GSLB_Monitor of each WideIP,
+// and returns it along with a GSLB_Server for each static address of the pool members
+func createGTMTenant(dnsConfig DNSConfig) (as3Tenant, map[string]*as3GSLBServer) {
+	sharedApp := as3Application{}
+	sharedApp["class"] = "Application"
+	sharedApp["template"] = "shared"
+
+	servers := make(map[string]*as3GSLBServer)
+	for _, wip := range dnsConfig {
+		domain := &as3GSLBDomain{
+			Class:              "GSLB_Domain",
+			DomainName:         wip.DomainName,
+			ResourceRecordType: wip.RecordType,
+			PoolLbMode:         wip.LBMethod,
+		}
+		for _, pl := range wip.Pools {
+			poolName := AS3NameFormatter(pl.Name)
+			pool := &as3GSLBPool{
+				Class:              "GSLB_Pool",
+				ResourceRecordType: pl.RecordType,
+				LBModePreferred:    pl.LBMethod,
+				LBModeFallback:     pl.FallbackLBMethod,
+			}
+			for _, member := range pl.Members {
+				if member.Address != "" {
+					pool.Members = append(pool.Members, getStaticGSLBPoolMember(member, servers))
+					continue
+				}
+				pool.Members = append(pool.Members, getGSLBPoolMember(member))
+			}
+			if pl.Monitor != nil {
+				monitorName := AS3NameFormatter(pl.Monitor.Name)
+				sharedApp[monitorName] = &as3GSLBMonitor{
+					Class:       "GSLB_Monitor",
+					MonitorType: pl.Monitor.Type,
+					Interval:    pl.Monitor.Interval,
+					Timeout:     pl.Monitor.Timeout,
+					Send:        pl.Monitor.Send,
+					Receive:     pl.Monitor.Recv,
+				}
+				pool.Monitors = append(pool.Monitors, as3ResourcePointer{Use: monitorName})
+			}
+			sharedApp[poolName] = pool
+			domain.Pools = append(domain.Pools, as3GSLBDomainPool{Use: poolName, Ratio: pl.Ratio})
+		}
+		sharedApp[AS3NameFormatter(wip.DomainName)] = domain
+	}
+	for _, server := range servers {
+		// Keep the order of virtual servers stable across the updates
+		sort.Slice(server.VirtualServers, func(i, j int) bool {
+			return server.VirtualServers[i].Name < server.VirtualServers[j].Name
+		})
+	}
+
+	return as3Tenant{
+		"class":              "Tenant",
+		as3SharedApplication: sharedApp,
+	}, servers
+}
+
+// getGSLBPoolMember returns the GSLB pool member for the virtual server on the GSLB server
+func getGSLBPoolMember(member GSLBPoolMember) as3GSLBPoolMember {
+	return as3GSLBPoolMember{
+		Enabled:       true,
+		Server:        as3ResourcePointer{BigIP: getCommonPath(member.Server)},
+		VirtualServer: member.VirtualServer,
+		Ratio:         member.Ratio,
+	}
+}
+
+// getStaticGSLBPoolMember returns the GSLB pool member for the static address, which is declared
+// as a virtual server of the generic host GSLB server of the address in /Common/Shared
+func getStaticGSLBPoolMember(member GSLBPoolMember, servers map[string]*as3GSLBServer) as3GSLBPoolMember {
+	serverName := AS3NameFormatter(gslbServerPrefix + member.Address)
+	server, ok := servers[serverName]
+	if !ok {
+		server = &as3GSLBServer{
+			Class:      "GSLB_Server",
+			DataCenter: as3ResourcePointer{BigIP: getCommonPath(member.DataCenter)},
+			ServerType: "generic-host",
+			Devices:    []as3GSLBServerDevice{{Address: member.Address}},
+		}
+		servers[serverName] = server
+	}
+	vsName := AS3NameFormatter(fmt.Sprintf("vs_%v_%v", member.Address, member.Port))
+	found := false
+	for _, vs := range server.VirtualServers {
+		if vs.Name == vsName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		server.VirtualServers = append(server.VirtualServers, as3GSLBServerVirtualServer{
+			Name:    vsName,
+			Address: member.Address,
+			Port:    member.Port,
+		})
+	}
+	serverPath := fmt.Sprintf("/%v/%v/%v", as3CommonTenant, as3SharedApplication, serverName)
+	return as3GSLBPoolMember{
+		Enabled:       true,
+		Server:        as3ResourcePointer{Use: serverPath},
+		VirtualServer: vsName,
+		Ratio:         member.Ratio,
+	}
+}
@@ -0,0 +1,133 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/health"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// Time allowed for each liveness and readiness check
+	healthCheckTimeout = 5 * time.Second
+	// Time after which a worker busy with the same item is considered stalled
+	workerStallTimeout = 5 * time.Minute
+)
+
+// startHTTPServer serves /metrics, /health, /livez and /readyz on the http-listen-address
+func (crMgr *CRManager) startHTTPServer() {
+	hc := crMgr.newHealthChecker()
+	// Expose Prometheus metrics
+	http.Handle("/metrics", promhttp.Handler())
+	// Add health check to track whether Python process still alive
+	http.Handle("/health", hc.HealthCheckHandler())
+	http.Handle("/livez", hc.LivenessHandler())
+	http.Handle("/readyz", hc.ReadinessHandler())
+	bigIPPrometheus.RegisterMetrics()
+	log.Fatal(http.ListenAndServe(crMgr.Agent.HttpAddress, nil).Error())
+}
+
+func (crMgr *CRManager) newHealthChecker() *health.HealthChecker {
+	hc := &health.HealthChecker{
+		SubPID:  crMgr.Agent.PythonDriverPID,
+		Timeout: healthCheckTimeout,
+		LivenessChecks: []health.Check{
+			{Name: "resource-worker", Func: func() error {
+				return crMgr.workerProgress.Check(workerStallTimeout)
+			}},
+			{Name: "config-worker", Func: func() error {
+				return crMgr.Agent.configProgress.Check(workerStallTimeout)
+			}},
+		},
+		ReadinessChecks: []health.Check{
+			{Name: "informers", Func: crMgr.checkInformersSynced},
+			{Name: "kubernetes-api", Func: crMgr.checkKubernetesAPI},
+			{Name: "bigip", Func: crMgr.checkBigIP},
+		},
+	}
+	// No Python driver runs in IPv6 mode
+	if crMgr.Agent.PythonDriverPID != 0 {
+		hc.LivenessChecks = append(hc.LivenessChecks, health.Check{
+			Name: "python-driver",
+			Func: func() error { return health.CheckProcess(crMgr.Agent.PythonDriverPID) },
+		})
+	}
+	return hc
+}
+
+// checkInformersSynced returns an error when any of the informer caches is not synced yet
+func (crMgr *CRManager) checkInformersSynced() error {
+	if crMgr.nsInformer != nil && !crMgr.nsInformer.nsInformer.HasSynced() {
+		return fmt.Errorf("namespace informer is not synced")
+	}
+	if crMgr.gwcInformer != nil && !crMgr.gwcInformer.gwcInformer.HasSynced() {
+		return fmt.Errorf("GatewayClass informer is not synced")
+	}
+	if crMgr.baselinePlcInformer != nil && !crMgr.baselinePlcInformer.plcInformer.HasSynced() {
+		return fmt.Errorf("baseline Policy informer is not synced")
+	}
+	for ns, crInf := range crMgr.getCRInformers() {
+		for _, inf := range []cache.SharedIndexInformer{
+			crInf.vsInformer,
+			crInf.tlsInformer,
+			crInf.tsInformer,
+			crInf.ilInformer,
+			crInf.ednsInformer,
+			crInf.svcInformer,
+			crInf.epsInformer,
+			crInf.epSliceInformer,
+			crInf.plcInformer,
+			crInf.secretInformer,
+			crInf.gwInformer,
+			crInf.httpRouteInformer,
+			crInf.tlsRouteInformer,
+			crInf.tcpRouteInformer,
+		} {
+			if inf != nil && !inf.HasSynced() {
+				if ns == "" {
+					return fmt.Errorf("informers of all namespaces are not synced")
+				}
+				return fmt.Errorf("informers of namespace %v are not synced", ns)
+			}
+		}
+	}
+	return nil
+}
+
+// checkKubernetesAPI returns an error when the Kubernetes API server is not reachable
+func (crMgr *CRManager) checkKubernetesAPI() error {
+	if _, err := crMgr.kubeClient.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("kubernetes API is not reachable: %v", err)
+	}
+	return nil
+}
+
+// checkBigIP returns an error when BIG-IP does not serve AS3 within healthCheckTimeout
+func (crMgr *CRManager) checkBigIP() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	_, err := crMgr.Agent.getBigipAS3Version(ctx)
+	return err
+}
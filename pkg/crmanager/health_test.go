@@ -0,0 +1,74 @@
+package crmanager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Health Checks", func() {
+	var mockCRM *mockCRManager
+	var mockPM *mockPostManager
+	namespace := "default"
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		mockPM = newMockPostManger()
+		mockPM.BIGIPURL = "bigip.com"
+		mockCRM.Agent = &Agent{PostManager: mockPM.PostManager}
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		mockCRM.crInformers[namespace] = mockCRM.newNamespacedInformer(namespace)
+	})
+
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	It("Readiness", func() {
+		mockPM.setResponses([]int{http.StatusOK}, `{"version":"v1", "release":"r1"}`, http.MethodGet)
+		w := serve(mockCRM.newHealthChecker().ReadinessHandler())
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable), "Informers are not synced before start")
+		Expect(w.Body.String()).To(ContainSubstring("[-]informers failed"))
+		Expect(w.Body.String()).To(ContainSubstring("[+]kubernetes-api ok"))
+		Expect(w.Body.String()).To(ContainSubstring("[+]bigip ok"))
+
+		mockPM.setResponses([]int{http.StatusNotFound}, `{"code":404}`, http.MethodGet)
+		Expect(mockCRM.checkBigIP()).NotTo(BeNil())
+	})
+
+	It("Readiness while namespaces are added and removed", func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 50; i++ {
+				_ = mockCRM.addNamespacedInformer("test")
+				mockCRM.removeNamespacedInformer("test")
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			Expect(mockCRM.checkInformersSynced()).NotTo(BeNil())
+		}
+		<-done
+		Expect(mockCRM.getCRInformers()).To(HaveLen(1))
+	})
+
+	It("Liveness", func() {
+		hc := mockCRM.newHealthChecker()
+		Expect(hc.LivenessChecks).To(HaveLen(2), "Python driver should not be checked without its PID")
+		Expect(serve(hc.LivenessHandler()).Code).To(Equal(http.StatusOK))
+
+		mockCRM.workerProgress.Busy()
+		Expect(mockCRM.workerProgress.Check(time.Minute)).To(BeNil())
+		Expect(mockCRM.workerProgress.Check(0)).NotTo(BeNil())
+		mockCRM.workerProgress.Idle()
+	})
+})
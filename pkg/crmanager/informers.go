@@ -27,11 +27,19 @@ import (
 	cisinfv1 "github.com/F5Networks/k8s-bigip-ctlr/config/client/informers/externalversions/cis/v1"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
+	gwinfv1 "sigs.k8s.io/gateway-api/pkg/client/informers/externalversions/apis/v1alpha1"
 )
 
+// endpointSliceServiceIndex indexes the EndpointSlices by their Service
+const endpointSliceServiceIndex = "service"
+
+// policyIndex indexes the VirtualServers and TransportServers by their Policy
+const policyIndex = "policy"
+
 var K8SCoreServices = map[string]bool{
 	"kube-dns":                      true,
 	"kube-scheduler":                true,
@@ -90,10 +98,30 @@ func (crInfr *CRInformer) start() {
 		go crInfr.epsInformer.Run(crInfr.stopCh)
 		cacheSyncs = append(cacheSyncs, crInfr.epsInformer.HasSynced)
 	}
+	if crInfr.epSliceInformer != nil {
+		go crInfr.epSliceInformer.Run(crInfr.stopCh)
+		cacheSyncs = append(cacheSyncs, crInfr.epSliceInformer.HasSynced)
+	}
 	if crInfr.plcInformer != nil {
 		go crInfr.plcInformer.Run(crInfr.stopCh)
 		cacheSyncs = append(cacheSyncs, crInfr.plcInformer.HasSynced)
 	}
+	if crInfr.secretInformer != nil {
+		go crInfr.secretInformer.Run(crInfr.stopCh)
+		cacheSyncs = append(cacheSyncs, crInfr.secretInformer.HasSynced)
+	}
+	if crInfr.gwInformer != nil {
+		log.Infof("Starting Gateway API Informers")
+		for _, inf := range []cache.SharedIndexInformer{
+			crInfr.gwInformer,
+			crInfr.httpRouteInformer,
+			crInfr.tlsRouteInformer,
+			crInfr.tcpRouteInformer,
+		} {
+			go inf.Run(crInfr.stopCh)
+			cacheSyncs = append(cacheSyncs, inf.HasSynced)
+		}
+	}
 
 	cache.WaitForNamedCacheSync(
 		"F5 CIS CRD Controller",
@@ -107,6 +135,8 @@ func (crInfr *CRInformer) stop() {
 }
 
 func (crMgr *CRManager) watchingAllNamespaces() bool {
+	crMgr.crInformersMutex.RLock()
+	defer crMgr.crInformersMutex.RUnlock()
 	if 0 == len(crMgr.crInformers) {
 		// Not watching any namespaces.
 		return false
@@ -118,13 +148,37 @@ func (crMgr *CRManager) watchingAllNamespaces() bool {
 func (crMgr *CRManager) getNamespacedInformer(
 	namespace string,
 ) (*CRInformer, bool) {
-	if crMgr.watchingAllNamespaces() {
+	crMgr.crInformersMutex.RLock()
+	defer crMgr.crInformersMutex.RUnlock()
+	if _, watchingAll := crMgr.crInformers[""]; watchingAll {
 		namespace = ""
 	}
 	crInf, found := crMgr.crInformers[namespace]
 	return crInf, found
 }
 
+// getCRInformers returns a snapshot of the informers of the watched namespaces. The informers are read
+// by the health and webhook servers, while the worker adds and removes the namespaces
+func (crMgr *CRManager) getCRInformers() map[string]*CRInformer {
+	crMgr.crInformersMutex.RLock()
+	defer crMgr.crInformersMutex.RUnlock()
+	crInformers := make(map[string]*CRInformer, len(crMgr.crInformers))
+	for ns, crInf := range crMgr.crInformers {
+		crInformers[ns] = crInf
+	}
+	return crInformers
+}
+
+// removeNamespacedInformer stops the informers of the namespace and removes them
+func (crMgr *CRManager) removeNamespacedInformer(namespace string) {
+	crMgr.crInformersMutex.Lock()
+	defer crMgr.crInformersMutex.Unlock()
+	if crInf, found := crMgr.crInformers[namespace]; found {
+		crInf.stop()
+		delete(crMgr.crInformers, namespace)
+	}
+}
+
 func (crMgr *CRManager) getWatchingNamespaces() []string {
 	var namespaces []string
 	if crMgr.watchingAllNamespaces() {
@@ -147,7 +201,9 @@ func (crMgr *CRManager) getWatchingNamespaces() []string {
 func (crMgr *CRManager) addNamespacedInformer(
 	namespace string,
 ) error {
-	if crMgr.watchingAllNamespaces() {
+	crMgr.crInformersMutex.Lock()
+	defer crMgr.crInformersMutex.Unlock()
+	if _, watchingAll := crMgr.crInformers[""]; watchingAll {
 		return fmt.Errorf(
 			"Cannot add additional namespaces when already watching all.")
 	}
@@ -193,7 +249,36 @@ func (crMgr *CRManager) newNamespacedInformer(
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 		),
-		epsInformer: cache.NewSharedIndexInformer(
+		secretInformer: cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(
+				restClientv1,
+				"secrets",
+				namespace,
+				everything,
+			),
+			&corev1.Secret{},
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		),
+	}
+
+	if crMgr.useEndpointSlices {
+		crInf.epSliceInformer = cache.NewSharedIndexInformer(
+			cache.NewFilteredListWatchFromClient(
+				crMgr.kubeClient.DiscoveryV1().RESTClient(),
+				"endpointslices",
+				namespace,
+				everything,
+			),
+			&discoveryv1.EndpointSlice{},
+			resyncPeriod,
+			cache.Indexers{
+				cache.NamespaceIndex:      cache.MetaNamespaceIndexFunc,
+				endpointSliceServiceIndex: endpointSliceServiceIndexFunc,
+			},
+		)
+	} else {
+		crInf.epsInformer = cache.NewSharedIndexInformer(
 			cache.NewFilteredListWatchFromClient(
 				restClientv1,
 				"endpoints",
@@ -203,7 +288,7 @@ func (crMgr *CRManager) newNamespacedInformer(
 			&corev1.Endpoints{},
 			resyncPeriod,
 			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
-		),
+		)
 	}
 
 	crInf.ilInformer = cisinfv1.NewFilteredIngressLinkInformer(
@@ -218,7 +303,10 @@ func (crMgr *CRManager) newNamespacedInformer(
 		crMgr.kubeCRClient,
 		namespace,
 		resyncPeriod,
-		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			policyIndex:          policyIndexFunc,
+		},
 		crOptions,
 	)
 	crInf.tlsInformer = cisinfv1.NewFilteredTLSProfileInformer(
@@ -232,7 +320,10 @@ func (crMgr *CRManager) newNamespacedInformer(
 		crMgr.kubeCRClient,
 		namespace,
 		resyncPeriod,
-		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			policyIndex:          policyIndexFunc,
+		},
 		crOptions,
 	)
 	crInf.ednsInformer = cisinfv1.NewFilteredExternalDNSInformer(
@@ -251,6 +342,34 @@ func (crMgr *CRManager) newNamespacedInformer(
 		crOptions,
 	)
 
+	// Gateway API resources are not labeled as F5 Custom Resources, GatewayClass selects the Gateways
+	if crMgr.gatewayClient != nil {
+		crInf.gwInformer = gwinfv1.NewGatewayInformer(
+			crMgr.gatewayClient,
+			namespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+		crInf.httpRouteInformer = gwinfv1.NewHTTPRouteInformer(
+			crMgr.gatewayClient,
+			namespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+		crInf.tlsRouteInformer = gwinfv1.NewTLSRouteInformer(
+			crMgr.gatewayClient,
+			namespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+		crInf.tcpRouteInformer = gwinfv1.NewTCPRouteInformer(
+			crMgr.gatewayClient,
+			namespace,
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+	}
+
 	return crInf
 }
 
@@ -324,12 +443,56 @@ func (crMgr *CRManager) addEventHandlers(crInf *CRInformer) {
 		)
 	}
 
+	if crInf.epSliceInformer != nil {
+		crInf.epSliceInformer.AddEventHandler(
+			&cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { crMgr.enqueueEndpointSlice(obj) },
+				UpdateFunc: func(obj, cur interface{}) { crMgr.enqueueEndpointSlice(cur) },
+				DeleteFunc: func(obj interface{}) { crMgr.enqueueEndpointSlice(obj) },
+			},
+		)
+	}
+
 	if crInf.plcInformer != nil {
+		// Baseline Policy is handled by its own informer
 		crInf.plcInformer.AddEventHandler(
+			&cache.FilteringResourceEventHandler{
+				FilterFunc: func(obj interface{}) bool { return !crMgr.isBaselinePolicy(obj) },
+				Handler: &cache.ResourceEventHandlerFuncs{
+					AddFunc:    func(obj interface{}) { crMgr.enqueuePolicy(obj) },
+					UpdateFunc: func(obj, cur interface{}) { crMgr.enqueueUpdatedPolicy(obj, cur) },
+					DeleteFunc: func(obj interface{}) { crMgr.enqueueDeletedPolicy(obj) },
+				},
+			},
+		)
+	}
+
+	if crInf.secretInformer != nil {
+		crInf.secretInformer.AddEventHandler(
+			&cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { crMgr.enqueueSecret(obj, false) },
+				UpdateFunc: func(old, cur interface{}) { crMgr.enqueueUpdatedSecret(old, cur) },
+				DeleteFunc: func(obj interface{}) { crMgr.enqueueSecret(obj, true) },
+			},
+		)
+	}
+
+	gwInformers := map[string]cache.SharedIndexInformer{
+		Gateway:   crInf.gwInformer,
+		HTTPRoute: crInf.httpRouteInformer,
+		TLSRoute:  crInf.tlsRouteInformer,
+		TCPRoute:  crInf.tcpRouteInformer,
+	}
+	for kind, inf := range gwInformers {
+		if inf == nil {
+			continue
+		}
+		kind := kind
+		inf.AddEventHandler(
 			&cache.ResourceEventHandlerFuncs{
-				AddFunc:    func(obj interface{}) { crMgr.enqueuePolicy(obj) },
-				UpdateFunc: func(obj, cur interface{}) { crMgr.enqueuePolicy(cur) },
-				DeleteFunc: func(obj interface{}) { crMgr.enqueueDeletedPolicy(obj) },
+				AddFunc:    func(obj interface{}) { crMgr.enqueueGatewayResource(obj, kind, false) },
+				UpdateFunc: func(old, cur interface{}) { crMgr.enqueueUpdatedGatewayResource(old, cur, kind) },
+				DeleteFunc: func(obj interface{}) { crMgr.enqueueGatewayResource(obj, kind, true) },
 			},
 		)
 	}
@@ -420,6 +583,12 @@ func (crMgr *CRManager) enqueueUpdatedVirtualServer(oldObj, newObj interface{})
 	oldVS := oldObj.(*cisapiv1.VirtualServer)
 	newVS := newObj.(*cisapiv1.VirtualServer)
 
+	// Skip the status updates, as they do not change the configuration
+	if oldVS.Generation == newVS.Generation && reflect.DeepEqual(oldVS.Labels, newVS.Labels) &&
+		!reflect.DeepEqual(oldVS.Status, newVS.Status) {
+		return
+	}
+
 	if oldVS.Spec.VirtualServerAddress != newVS.Spec.VirtualServerAddress ||
 		oldVS.Spec.VirtualServerHTTPPort != newVS.Spec.VirtualServerHTTPPort ||
 		oldVS.Spec.VirtualServerHTTPSPort != newVS.Spec.VirtualServerHTTPSPort ||
@@ -493,6 +662,12 @@ func (crMgr *CRManager) enqueueUpdatedTransportServer(oldObj, newObj interface{}
 	oldVS := oldObj.(*cisapiv1.TransportServer)
 	newVS := newObj.(*cisapiv1.TransportServer)
 
+	// Skip the status updates, as they do not change the configuration
+	if oldVS.Generation == newVS.Generation && reflect.DeepEqual(oldVS.Labels, newVS.Labels) &&
+		!reflect.DeepEqual(oldVS.Status, newVS.Status) {
+		return
+	}
+
 	if oldVS.Spec.VirtualServerAddress != newVS.Spec.VirtualServerAddress ||
 		oldVS.Spec.VirtualServerPort != newVS.Spec.VirtualServerPort ||
 		oldVS.Spec.VirtualServerName != newVS.Spec.VirtualServerName ||
@@ -546,6 +721,22 @@ func (crMgr *CRManager) enqueuePolicy(obj interface{}) {
 	crMgr.rscQueue.Add(key)
 }
 
+func (crMgr *CRManager) enqueueUpdatedPolicy(oldObj, newObj interface{}) {
+	oldPlc := oldObj.(*cisapiv1.Policy)
+	newPlc := newObj.(*cisapiv1.Policy)
+
+	// Skip the status updates, as they do not change the configuration
+	if oldPlc.Generation == newPlc.Generation && reflect.DeepEqual(oldPlc.Labels, newPlc.Labels) &&
+		!reflect.DeepEqual(oldPlc.Status, newPlc.Status) {
+		return
+	}
+	// Virtuals of the namespace no longer use the Policy as default
+	if isNamespaceDefaultPolicy(oldPlc) && !isNamespaceDefaultPolicy(newPlc) {
+		crMgr.enqueuePolicy(oldObj)
+	}
+	crMgr.enqueuePolicy(newObj)
+}
+
 func (crMgr *CRManager) enqueueDeletedPolicy(obj interface{}) {
 	pol := obj.(*cisapiv1.Policy)
 	log.Infof("Enqueueing Policy: %v", pol)
@@ -669,6 +860,35 @@ func (crMgr *CRManager) enqueueDeletedExternalDNS(obj interface{}) {
 	crMgr.rscQueue.Add(key)
 }
 
+// enqueueGatewayResource enqueues the Gateway API resource of the given kind
+func (crMgr *CRManager) enqueueGatewayResource(obj interface{}, kind string, isDelete bool) {
+	rsc, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	log.Debugf("Enqueueing %v: %v/%v", kind, rsc.GetNamespace(), rsc.GetName())
+	key := &rqKey{
+		namespace: rsc.GetNamespace(),
+		kind:      kind,
+		rscName:   rsc.GetName(),
+		rsc:       obj,
+		rscDelete: isDelete,
+	}
+
+	crMgr.rscQueue.Add(key)
+}
+
+func (crMgr *CRManager) enqueueUpdatedGatewayResource(oldObj, newObj interface{}, kind string) {
+	oldRsc := oldObj.(metav1.Object)
+	newRsc := newObj.(metav1.Object)
+
+	// Skip the status updates, as they do not change the configuration
+	if oldRsc.GetGeneration() == newRsc.GetGeneration() && reflect.DeepEqual(oldRsc.GetLabels(), newRsc.GetLabels()) {
+		return
+	}
+	crMgr.enqueueGatewayResource(newObj, kind, false)
+}
+
 func (crMgr *CRManager) enqueueService(obj interface{}) {
 	svc := obj.(*corev1.Service)
 	// Ignore K8S Core Services
@@ -751,6 +971,84 @@ func (crMgr *CRManager) enqueueEndpoints(obj interface{}) {
 	crMgr.rscQueue.Add(key)
 }
 
+// enqueueEndpointSlice enqueues the EndpointSlice with the name of the Service it belongs to
+func (crMgr *CRManager) enqueueEndpointSlice(obj interface{}) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	svcName, ok := slice.Labels[discoveryv1.LabelServiceName]
+	// Ignore K8S Core Services
+	if _, isCore := K8SCoreServices[svcName]; !ok || isCore {
+		return
+	}
+	log.Debugf("Enqueueing EndpointSlice: %v/%v", slice.Namespace, slice.Name)
+	key := &rqKey{
+		namespace: slice.ObjectMeta.Namespace,
+		kind:      EndpointSlice,
+		rscName:   svcName,
+		rsc:       obj,
+	}
+
+	crMgr.rscQueue.Add(key)
+}
+
+// endpointSliceServiceIndexFunc indexes the EndpointSlices by the namespace/name of their Service
+func endpointSliceServiceIndexFunc(obj interface{}) ([]string, error) {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil, nil
+	}
+	if svcName, ok := slice.Labels[discoveryv1.LabelServiceName]; ok {
+		return []string{slice.Namespace + "/" + svcName}, nil
+	}
+	return nil, nil
+}
+
+// policyIndexFunc indexes the VirtualServers and TransportServers by the namespace/name of the Policy referred
+// with policyName. The resources using the baseline and namespace default Policies are not indexed, as they
+// use them without referring to them
+func policyIndexFunc(obj interface{}) ([]string, error) {
+	var namespace, plcName string
+	switch rsc := obj.(type) {
+	case *cisapiv1.VirtualServer:
+		namespace, plcName = rsc.Namespace, rsc.Spec.PolicyName
+	case *cisapiv1.TransportServer:
+		namespace, plcName = rsc.Namespace, rsc.Spec.PolicyName
+	}
+	if plcName == "" {
+		return nil, nil
+	}
+	return []string{namespace + "/" + plcName}, nil
+}
+
+func (crMgr *CRManager) enqueueSecret(obj interface{}, isDelete bool) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+	// Secret data is not logged
+	log.Debugf("Enqueueing Secret: %v/%v", secret.Namespace, secret.Name)
+	key := &rqKey{
+		namespace: secret.ObjectMeta.Namespace,
+		kind:      K8sSecret,
+		rscName:   secret.ObjectMeta.Name,
+		rsc:       obj,
+		rscDelete: isDelete,
+	}
+	crMgr.rscQueue.Add(key)
+}
+
+func (crMgr *CRManager) enqueueUpdatedSecret(oldObj, newObj interface{}) {
+	oldSecret := oldObj.(*corev1.Secret)
+	newSecret := newObj.(*corev1.Secret)
+	// Only a change in certificate or key updates the profiles
+	if reflect.DeepEqual(oldSecret.Data, newSecret.Data) {
+		return
+	}
+	crMgr.enqueueSecret(newObj, false)
+}
+
 func (nsInfr *NSInformer) start() {
 	if nsInfr.nsInformer != nil {
 		log.Infof("Starting Namespace Informer")
@@ -762,6 +1060,20 @@ func (nsInfr *NSInformer) stop() {
 	close(nsInfr.stopCh)
 }
 
+func (gwcInfr *GWCInformer) start() {
+	log.Infof("Starting GatewayClass Informer")
+	go gwcInfr.gwcInformer.Run(gwcInfr.stopCh)
+	cache.WaitForNamedCacheSync(
+		"F5 CIS GatewayClass Controller",
+		gwcInfr.stopCh,
+		gwcInfr.gwcInformer.HasSynced,
+	)
+}
+
+func (gwcInfr *GWCInformer) stop() {
+	close(gwcInfr.stopCh)
+}
+
 func (crMgr *CRManager) createNamespaceLabeledInformer(selector labels.Selector) error {
 	namespaceOptions := func(options *metav1.ListOptions) {
 		options.LabelSelector = selector.String()
@@ -770,7 +1082,7 @@ func (crMgr *CRManager) createNamespaceLabeledInformer(selector labels.Selector)
 	if nil != crMgr.nsInformer && nil != crMgr.nsInformer.nsInformer {
 		return fmt.Errorf("Already have a namespace label informer added.")
 	}
-	if 0 != len(crMgr.crInformers) {
+	if 0 != len(crMgr.getCRInformers()) {
 		return fmt.Errorf("Cannot set a namespace label informer when informers " +
 			"have been setup for one or more namespaces.")
 	}
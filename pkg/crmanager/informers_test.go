@@ -280,6 +280,30 @@ var _ = Describe("Informers Tests", func() {
 			Expect(quit).To(BeFalse(), "Enqueue New Endpoints  Failed")
 		})
 
+		It("Secret", func() {
+			secret := test.NewSecret("SampleSecret", namespace, "cert", "key")
+			mockCRM.enqueueSecret(secret, false)
+			key, quit := mockCRM.rscQueue.Get()
+			Expect(key).ToNot(BeNil(), "Enqueue New Secret Failed")
+			Expect(quit).To(BeFalse(), "Enqueue New Secret Failed")
+			mockCRM.rscQueue.Done(key)
+
+			mockCRM.enqueueUpdatedSecret(secret, secret.DeepCopy())
+			Expect(mockCRM.rscQueue.Len()).To(Equal(0), "Secret without data change should not be enqueued")
+
+			renewed := test.NewSecret("SampleSecret", namespace, "renewed cert", "key")
+			mockCRM.enqueueUpdatedSecret(secret, renewed)
+			key, quit = mockCRM.rscQueue.Get()
+			Expect(key).ToNot(BeNil(), "Enqueue Updated Secret Failed")
+			Expect(quit).To(BeFalse(), "Enqueue Updated Secret Failed")
+			mockCRM.rscQueue.Done(key)
+
+			mockCRM.enqueueSecret(renewed, true)
+			key, quit = mockCRM.rscQueue.Get()
+			Expect(key.(*rqKey).rscDelete).To(BeTrue(), "Enqueue Deleted Secret Failed")
+			Expect(quit).To(BeFalse(), "Enqueue Deleted Secret Failed")
+		})
+
 		It("Namespace", func() {
 			labels := make(map[string]string)
 			labels["app"] = "test"
@@ -0,0 +1,412 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+)
+
+const (
+	// Reason of the Event recorded on a resource when the IPAM range of its label has no free address
+	IPAMExhaustedReason = "IPAMExhausted"
+	// Reason of the Event recorded on a resource whose virtualServerAddress is allocated by IPAM to another resource
+	IPAMAddressConflictReason = "IPAMAddressConflict"
+
+	// ipamAllocationsSuffix names the ConfigMap persisting the addresses allocated by the builtin IPAM
+	ipamAllocationsSuffix = "-allocations"
+	ipamAllocationsKey    = "allocations"
+)
+
+// IPAMProvider allocates virtual addresses to the resources with an ipamLabel
+type IPAMProvider interface {
+	// RequestIP returns the address allocated to the host or key from the range of the label,
+	// along with the status of the request
+	RequestIP(ipamLabel, host, key string) (string, int)
+	// ReleaseIP releases the address allocated to the host or key and returns it
+	ReleaseIP(ipamLabel, host, key string) string
+	// GetAllocation returns the host or key the address is allocated to
+	GetAllocation(ip string) (string, bool)
+}
+
+// ipamAllocation is an address allocated to the host of a VirtualServer or to the key of another resource
+type ipamAllocation struct {
+	IPAMLabel string `json:"ipamLabel"`
+	Host      string `json:"host,omitempty"`
+	Key       string `json:"key,omitempty"`
+	IP        string `json:"ip"`
+}
+
+// ipRange is an inclusive range of addresses of the same family
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+// builtinIPAM allocates addresses from the ranges of each label defined in a ConfigMap
+// Allocations are persisted in another ConfigMap, so that addresses are retained across restarts
+type builtinIPAM struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+	// staticAddresses returns the virtualServerAddress specified on the resources
+	staticAddresses func() map[string]string
+}
+
+// newBuiltinIPAM returns the builtin IPAM with the ranges of the ConfigMap given as namespace/name
+func (crMgr *CRManager) newBuiltinIPAM(cfgMap string) (*builtinIPAM, error) {
+	cm := strings.Split(cfgMap, "/")
+	if len(cm) != 2 || cm[0] == "" || cm[1] == "" {
+		return nil, fmt.Errorf("invalid IPAM ConfigMap %v, expected <namespace>/<name>", cfgMap)
+	}
+	return &builtinIPAM{
+		kubeClient:      crMgr.kubeClient,
+		namespace:       cm[0],
+		name:            cm[1],
+		staticAddresses: crMgr.getStaticVirtualAddresses,
+	}, nil
+}
+
+func (ipam *builtinIPAM) RequestIP(ipamLabel, host, key string) (string, int) {
+	if ipamLabel == "" || (host == "" && key == "") {
+		return "", InvalidInput
+	}
+	cfgMap, err := ipam.kubeClient.CoreV1().ConfigMaps(ipam.namespace).Get(
+		context.TODO(), ipam.name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("[IPAM] Unable to get IPAM ConfigMap %v/%v: %v", ipam.namespace, ipam.name, err)
+		return "", NotRequested
+	}
+	value, ok := cfgMap.Data[ipamLabel]
+	if !ok {
+		return "", InvalidInput
+	}
+	ranges, err := parseIPRanges(value)
+	if err != nil {
+		log.Errorf("[IPAM] Invalid range for IPAM label %v: %v", ipamLabel, err)
+		return "", InvalidInput
+	}
+
+	allocCfgMap, allocations, err := ipam.getAllocations()
+	if err != nil {
+		log.Errorf("[IPAM] Unable to get IPAM allocations: %v", err)
+		return "", NotRequested
+	}
+	used := make(map[string]bool)
+	for ip := range ipam.staticAddresses() {
+		used[ip] = true
+	}
+	var updated []ipamAllocation
+	for _, alloc := range allocations {
+		if alloc.Host == host && alloc.Key == key {
+			if alloc.IPAMLabel == ipamLabel && inIPRanges(ranges, alloc.IP) {
+				return alloc.IP, Allocated
+			}
+			// The label or its range is updated, allocate a new address
+			log.Debugf("[IPAM] Releasing %v allocated with IPAM label %v", alloc.IP, alloc.IPAMLabel)
+			continue
+		}
+		used[alloc.IP] = true
+		updated = append(updated, alloc)
+	}
+
+	ip := allocateIP(ranges, used)
+	if ip == "" {
+		log.Warningf("[IPAM] No free address available with IPAM label %v", ipamLabel)
+		return "", Exhausted
+	}
+	updated = append(updated, ipamAllocation{IPAMLabel: ipamLabel, Host: host, Key: key, IP: ip})
+	if err = ipam.saveAllocations(allocCfgMap, updated); err != nil {
+		log.Errorf("[IPAM] Unable to save IPAM allocations: %v", err)
+		return "", NotRequested
+	}
+	log.Debugf("[IPAM] Allocated %v with IPAM label %v", ip, ipamLabel)
+	return ip, Allocated
+}
+
+func (ipam *builtinIPAM) ReleaseIP(ipamLabel, host, key string) string {
+	if ipamLabel == "" || (host == "" && key == "") {
+		return ""
+	}
+	allocCfgMap, allocations, err := ipam.getAllocations()
+	if err != nil {
+		log.Errorf("[IPAM] Unable to get IPAM allocations: %v", err)
+		return ""
+	}
+	var ip string
+	var updated []ipamAllocation
+	for _, alloc := range allocations {
+		if alloc.IPAMLabel == ipamLabel && alloc.Host == host && alloc.Key == key {
+			ip = alloc.IP
+			continue
+		}
+		updated = append(updated, alloc)
+	}
+	if ip == "" {
+		return ""
+	}
+	if err = ipam.saveAllocations(allocCfgMap, updated); err != nil {
+		log.Errorf("[IPAM] Unable to save IPAM allocations: %v", err)
+		return ""
+	}
+	log.Debugf("[IPAM] Released %v allocated with IPAM label %v", ip, ipamLabel)
+	return ip
+}
+
+func (ipam *builtinIPAM) GetAllocation(ip string) (string, bool) {
+	_, allocations, err := ipam.getAllocations()
+	if err != nil {
+		return "", false
+	}
+	for _, alloc := range allocations {
+		if alloc.IP == ip {
+			if alloc.Host != "" {
+				return alloc.Host, true
+			}
+			return alloc.Key, true
+		}
+	}
+	return "", false
+}
+
+// getAllocations returns the ConfigMap persisting the allocations, created when not available
+func (ipam *builtinIPAM) getAllocations() (*v1.ConfigMap, []ipamAllocation, error) {
+	cmClient := ipam.kubeClient.CoreV1().ConfigMaps(ipam.namespace)
+	cfgMap, err := cmClient.Get(context.TODO(), ipam.name+ipamAllocationsSuffix, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		cfgMap, err = cmClient.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ipam.name + ipamAllocationsSuffix,
+				Namespace: ipam.namespace,
+			},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var allocations []ipamAllocation
+	if data, ok := cfgMap.Data[ipamAllocationsKey]; ok {
+		if err = json.Unmarshal([]byte(data), &allocations); err != nil {
+			return nil, nil, err
+		}
+	}
+	return cfgMap, allocations, nil
+}
+
+// saveAllocations updates the ConfigMap, which fails on conflicts with the allocations of another replica
+func (ipam *builtinIPAM) saveAllocations(cfgMap *v1.ConfigMap, allocations []ipamAllocation) error {
+	data, err := json.Marshal(allocations)
+	if err != nil {
+		return err
+	}
+	cfgMap = cfgMap.DeepCopy()
+	if cfgMap.Data == nil {
+		cfgMap.Data = make(map[string]string)
+	}
+	cfgMap.Data[ipamAllocationsKey] = string(data)
+	_, err = ipam.kubeClient.CoreV1().ConfigMaps(ipam.namespace).Update(context.TODO(), cfgMap, metav1.UpdateOptions{})
+	return err
+}
+
+// parseIPRanges parses the comma separated CIDRs, ranges given as <start>-<end> and addresses
+// The network and broadcast addresses of an IPv4 CIDR are excluded
+func parseIPRanges(value string) ([]ipRange, error) {
+	var ranges []ipRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var rng ipRange
+		if strings.Contains(part, "/") {
+			_, ipNet, err := net.ParseCIDR(part)
+			if err != nil {
+				return nil, err
+			}
+			rng.start = normalizeIP(ipNet.IP)
+			rng.end = make(net.IP, len(rng.start))
+			for i := range rng.start {
+				rng.end[i] = rng.start[i] | ^ipNet.Mask[i]
+			}
+			if ones, bits := ipNet.Mask.Size(); bits == net.IPv4len*8 && ones < 31 {
+				rng.start = nextIP(rng.start)
+				rng.end = prevIP(rng.end)
+			}
+		} else {
+			bounds := strings.SplitN(part, "-", 2)
+			rng.start = normalizeIP(net.ParseIP(strings.TrimSpace(bounds[0])))
+			rng.end = rng.start
+			if len(bounds) == 2 {
+				rng.end = normalizeIP(net.ParseIP(strings.TrimSpace(bounds[1])))
+			}
+			if rng.start == nil || rng.end == nil || len(rng.start) != len(rng.end) ||
+				bytes.Compare(rng.start, rng.end) > 0 {
+				return nil, fmt.Errorf("invalid address range %v", part)
+			}
+		}
+		ranges = append(ranges, rng)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no address range found")
+	}
+	return ranges, nil
+}
+
+// allocateIP returns the first address of the ranges which is not used
+func allocateIP(ranges []ipRange, used map[string]bool) string {
+	for _, rng := range ranges {
+		for ip := rng.start; ; ip = nextIP(ip) {
+			if !used[ip.String()] {
+				return ip.String()
+			}
+			if ip.Equal(rng.end) {
+				break
+			}
+		}
+	}
+	return ""
+}
+
+func inIPRanges(ranges []ipRange, address string) bool {
+	ip := normalizeIP(net.ParseIP(address))
+	for _, rng := range ranges {
+		if len(ip) == len(rng.start) && bytes.Compare(ip, rng.start) >= 0 && bytes.Compare(ip, rng.end) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+func prevIP(ip net.IP) net.IP {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
+// getStaticVirtualAddresses returns the virtualServerAddress specified on the resources
+// mapped to the namespace/name of the resource
+func (crMgr *CRManager) getStaticVirtualAddresses() map[string]string {
+	addresses := make(map[string]string)
+	for _, crInf := range crMgr.getCRInformers() {
+		if crInf.vsInformer != nil {
+			for _, obj := range crInf.vsInformer.GetIndexer().List() {
+				vs := obj.(*cisapiv1.VirtualServer)
+				if vs.Spec.VirtualServerAddress != "" {
+					addresses[vs.Spec.VirtualServerAddress] = vs.Namespace + "/" + vs.Name
+				}
+			}
+		}
+		if crInf.tsInformer != nil {
+			for _, obj := range crInf.tsInformer.GetIndexer().List() {
+				ts := obj.(*cisapiv1.TransportServer)
+				if ts.Spec.VirtualServerAddress != "" {
+					addresses[ts.Spec.VirtualServerAddress] = ts.Namespace + "/" + ts.Name
+				}
+			}
+		}
+		if crInf.ilInformer != nil {
+			for _, obj := range crInf.ilInformer.GetIndexer().List() {
+				il := obj.(*cisapiv1.IngressLink)
+				if il.Spec.VirtualServerAddress != "" {
+					addresses[il.Spec.VirtualServerAddress] = il.Namespace + "/" + il.Name
+				}
+			}
+		}
+		if crInf.gwInformer != nil {
+			for _, obj := range crInf.gwInformer.GetIndexer().List() {
+				gw := obj.(*gwapiv1.Gateway)
+				if ip := getGatewayAddress(gw); ip != "" {
+					addresses[ip] = gw.Namespace + "/" + gw.Name
+				}
+			}
+		}
+	}
+	return addresses
+}
+
+// isIPAMEnabled returns true when virtual addresses are allocated by f5-ipam-controller or the builtin IPAM
+func (crMgr *CRManager) isIPAMEnabled() bool {
+	return crMgr.ipamCli != nil || crMgr.ipamProvider != nil
+}
+
+// checkIPAMConflict records an Event on the resource when its virtualServerAddress is allocated
+// by IPAM to another resource
+func (crMgr *CRManager) checkIPAMConflict(obj runtime.Object, ip string) {
+	if crMgr.ipamProvider == nil {
+		return
+	}
+	if owner, ok := crMgr.ipamProvider.GetAllocation(ip); ok {
+		message := fmt.Sprintf("virtualServerAddress %v is allocated by IPAM to %v", ip, owner)
+		crMgr.recordIPAMEvent(obj, IPAMAddressConflictReason, message)
+	}
+}
+
+// recordIPAMExhausted records an Event on the resource when no address is free with its IPAM label
+func (crMgr *CRManager) recordIPAMExhausted(obj runtime.Object, ipamLabel string) {
+	crMgr.recordIPAMEvent(obj, IPAMExhaustedReason,
+		fmt.Sprintf("No free address available with IPAM label %v", ipamLabel))
+}
+
+func (crMgr *CRManager) recordIPAMEvent(obj runtime.Object, reason, message string) {
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	log.Warningf("[IPAM] %v/%v: %v", objMeta.GetNamespace(), objMeta.GetName(), message)
+	evNotifier := crMgr.eventNotifier.CreateNotifierForNamespace(
+		objMeta.GetNamespace(), crMgr.kubeClient.CoreV1())
+	evNotifier.RecordEvent(obj, v1.EventTypeWarning, reason, message)
+}
@@ -0,0 +1,117 @@
+package crmanager
+
+import (
+	"net"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Builtin IPAM", func() {
+	var mockCRM *mockCRManager
+	namespace := "default"
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset(test.NewConfigMap("cis-ipam", "1", "kube-system",
+			map[string]string{
+				"Dev":  "10.1.1.1-10.1.1.2",
+				"Prod": "10.2.2.0/30",
+			}))
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		_ = mockCRM.addNamespacedInformer(namespace)
+		provider, err := mockCRM.newBuiltinIPAM("kube-system/cis-ipam")
+		Expect(err).To(BeNil())
+		mockCRM.ipamProvider = provider
+	})
+
+	It("Parse address ranges", func() {
+		ranges, err := parseIPRanges("10.2.2.0/30, 10.3.3.3, 10.4.4.4-10.4.4.8,2001:db8::/127")
+		Expect(err).To(BeNil())
+		Expect(ranges).To(Equal([]ipRange{
+			{start: net.ParseIP("10.2.2.1").To4(), end: net.ParseIP("10.2.2.2").To4()},
+			{start: net.ParseIP("10.3.3.3").To4(), end: net.ParseIP("10.3.3.3").To4()},
+			{start: net.ParseIP("10.4.4.4").To4(), end: net.ParseIP("10.4.4.8").To4()},
+			{start: net.ParseIP("2001:db8::"), end: net.ParseIP("2001:db8::1")},
+		}))
+		_, err = parseIPRanges("10.4.4.8-10.4.4.4")
+		Expect(err).NotTo(BeNil(), "Range should start with the lower address")
+		_, err = parseIPRanges("10.4.4.4-2001:db8::1")
+		Expect(err).NotTo(BeNil(), "Range should not mix address families")
+		_, err = parseIPRanges("")
+		Expect(err).NotTo(BeNil())
+		_, err = mockCRM.newBuiltinIPAM("cis-ipam")
+		Expect(err).NotTo(BeNil(), "ConfigMap should be given as namespace/name")
+	})
+
+	It("Allocate and release addresses", func() {
+		ip, status := mockCRM.requestIP("Dev", "foo.com", "")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.1.1.1"))
+		ip, status = mockCRM.requestIP("Dev", "foo.com", "")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.1.1.1"), "Allocated address should be retained")
+		ip, status = mockCRM.requestIP("Dev", "", "default/ts_ts")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.1.1.2"))
+
+		_, status = mockCRM.requestIP("Dev", "bar.com", "")
+		Expect(status).To(Equal(Exhausted))
+		Expect(getIPAMCondition(status, "Dev", "").Reason).To(Equal(cisapiv1.ReasonIPAMExhausted))
+		_, status = mockCRM.requestIP("QA", "bar.com", "")
+		Expect(status).To(Equal(InvalidInput))
+		_, status = mockCRM.requestIP("", "bar.com", "")
+		Expect(status).To(Equal(InvalidInput))
+
+		// Allocations are persisted across restarts
+		provider, _ := mockCRM.newBuiltinIPAM("kube-system/cis-ipam")
+		mockCRM.ipamProvider = provider
+		owner, ok := mockCRM.ipamProvider.GetAllocation("10.1.1.2")
+		Expect(ok).To(BeTrue())
+		Expect(owner).To(Equal("default/ts_ts"))
+
+		Expect(mockCRM.releaseIP("Dev", "foo.com", "")).To(Equal("10.1.1.1"))
+		Expect(mockCRM.releaseIP("Dev", "foo.com", "")).To(Equal(""))
+		ip, status = mockCRM.requestIP("Dev", "bar.com", "")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.1.1.1"), "Released address should be allocated again")
+	})
+
+	It("Reallocate when the label is updated", func() {
+		ip, _ := mockCRM.requestIP("Dev", "foo.com", "")
+		Expect(ip).To(Equal("10.1.1.1"))
+		ip, status := mockCRM.requestIP("Prod", "foo.com", "")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.2.2.1"))
+		_, ok := mockCRM.ipamProvider.GetAllocation("10.1.1.1")
+		Expect(ok).To(BeFalse(), "Address of the previous label should be released")
+	})
+
+	It("Skip static virtual addresses", func() {
+		vs := test.NewVirtualServer("vs1", namespace, cisapiv1.VirtualServerSpec{
+			Host:                 "static.com",
+			VirtualServerAddress: "10.1.1.1",
+		})
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		Expect(mockCRM.getStaticVirtualAddresses()).To(Equal(map[string]string{"10.1.1.1": "default/vs1"}))
+
+		ip, status := mockCRM.requestIP("Dev", "foo.com", "")
+		Expect(status).To(Equal(Allocated))
+		Expect(ip).To(Equal("10.1.1.2"), "Static virtual address should not be allocated")
+		_, status = mockCRM.requestIP("Dev", "bar.com", "")
+		Expect(status).To(Equal(Exhausted))
+	})
+
+	It("Enable IPAM with builtin provider", func() {
+		Expect(mockCRM.isIPAMEnabled()).To(BeTrue())
+		mockCRM.ipamProvider = nil
+		Expect(mockCRM.isIPAMEnabled()).To(BeFalse())
+	})
+})
@@ -0,0 +1,101 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// DefaultLeaseName is the name of the Lease used for leader election
+	DefaultLeaseName = "k8s-bigip-ctlr"
+)
+
+// newLeaderElector creates a Lease based leader elector, that promotes the Agent
+// to post the configuration to BIG-IP only while holding the Lease
+func (crMgr *CRManager) newLeaderElector(params LeaderElectionParams) (*leaderelection.LeaderElector, error) {
+	if params.LeaseName == "" {
+		params.LeaseName = DefaultLeaseName
+	}
+	if params.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname for leader election identity: %v", err)
+		}
+		params.Identity = hostname
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metaV1.ObjectMeta{
+			Name:      params.LeaseName,
+			Namespace: params.LeaseNamespace,
+		},
+		Client: crMgr.kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: params.Identity,
+		},
+	}
+
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: params.LeaseDuration,
+		RenewDeadline: params.RenewDeadline,
+		RetryPeriod:   params.RetryPeriod,
+		// Release the Lease on shutdown, so that a standby takes over without waiting for the Lease to expire
+		ReleaseOnCancel: true,
+		Name:            params.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("[LeaderElection] %v acquired Lease %v/%v",
+					params.Identity, params.LeaseNamespace, params.LeaseName)
+				crMgr.Agent.OnStartedLeading()
+			},
+			OnStoppedLeading: func() {
+				log.Infof("[LeaderElection] %v released Lease %v/%v",
+					params.Identity, params.LeaseNamespace, params.LeaseName)
+				crMgr.Agent.OnStoppedLeading()
+			},
+			OnNewLeader: func(identity string) {
+				if identity != params.Identity {
+					log.Infof("[LeaderElection] Current leader is %v", identity)
+				}
+			},
+		},
+	})
+}
+
+// runLeaderElection keeps contending for the Lease until the CRManager is stopped
+// Informers and Resources are kept up to date irrespective of leadership
+func (crMgr *CRManager) runLeaderElection(ctx context.Context, elector *leaderelection.LeaderElector) {
+	defer close(crMgr.leaderStopped)
+	for {
+		elector.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			log.Debugf("[LeaderElection] Contending for the Lease again")
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	cisinfv1 "github.com/F5Networks/k8s-bigip-ctlr/config/client/informers/externalversions/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// setupBaselinePolicy creates the informer of the cluster-wide baseline Policy, given as namespace/name.
+// The baseline Policy is watched on its own, as its namespace need not be watched by CIS
+func (crMgr *CRManager) setupBaselinePolicy(baselinePolicy string) error {
+	parts := strings.Split(baselinePolicy, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid baseline Policy %v, expected namespace/name", baselinePolicy)
+	}
+	crMgr.baselinePolicy = baselinePolicy
+	crMgr.baselinePlcInformer = &BaselinePolicyInformer{
+		stopCh: make(chan struct{}),
+		plcInformer: cisinfv1.NewFilteredPolicyInformer(
+			crMgr.kubeCRClient,
+			parts[0],
+			0,
+			cache.Indexers{},
+			func(options *metav1.ListOptions) {
+				options.LabelSelector = crMgr.resourceSelector.String()
+				options.FieldSelector = "metadata.name=" + parts[1]
+			},
+		),
+	}
+	crMgr.baselinePlcInformer.plcInformer.AddEventHandler(
+		&cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { crMgr.enqueuePolicy(obj) },
+			UpdateFunc: func(obj, cur interface{}) { crMgr.enqueueUpdatedPolicy(obj, cur) },
+			DeleteFunc: func(obj interface{}) { crMgr.enqueueDeletedPolicy(obj) },
+		},
+	)
+	return nil
+}
+
+func (plcInfr *BaselinePolicyInformer) start() {
+	log.Infof("Starting Baseline Policy Informer")
+	go plcInfr.plcInformer.Run(plcInfr.stopCh)
+	cache.WaitForNamedCacheSync(
+		"F5 CIS Baseline Policy Controller",
+		plcInfr.stopCh,
+		plcInfr.plcInformer.HasSynced,
+	)
+}
+
+func (plcInfr *BaselinePolicyInformer) stop() {
+	close(plcInfr.stopCh)
+}
+
+// isBaselinePolicy returns true for the cluster-wide baseline Policy
+func (crMgr *CRManager) isBaselinePolicy(obj interface{}) bool {
+	plc, ok := obj.(*cisapiv1.Policy)
+	return ok && crMgr.baselinePolicy != "" && crMgr.baselinePolicy == plc.Namespace+"/"+plc.Name
+}
+
+// isNamespaceDefaultPolicy returns true for a Policy applied to all the resources of its namespace
+func isNamespaceDefaultPolicy(plc *cisapiv1.Policy) bool {
+	return plc.Labels[DefaultPolicyLabel] == "true"
+}
+
+// isAppliedNamespaceDefaultPolicy returns true for a namespace default Policy applied to the resources
+// of its namespace, i.e. the first default Policy of the namespace by name. The Policy need not be in the
+// informer, so that the scope of a deleted Policy is found too
+func (crMgr *CRManager) isAppliedNamespaceDefaultPolicy(plc *cisapiv1.Policy) bool {
+	if !isNamespaceDefaultPolicy(plc) {
+		return false
+	}
+	applied := crMgr.getNamespaceDefaultPolicy(plc.Namespace)
+	return applied == nil || plc.Name <= applied.Name
+}
+
+// getPolicy returns the Policy with the given namespace/name, nil if it is not found
+func (crMgr *CRManager) getPolicy(plcKey string) *cisapiv1.Policy {
+	if plcKey == "" {
+		return nil
+	}
+	var indexer cache.Indexer
+	if plcKey == crMgr.baselinePolicy && crMgr.baselinePlcInformer != nil {
+		indexer = crMgr.baselinePlcInformer.plcInformer.GetIndexer()
+	} else {
+		crInf, ok := crMgr.getNamespacedInformer(strings.Split(plcKey, "/")[0])
+		if !ok {
+			return nil
+		}
+		indexer = crInf.plcInformer.GetIndexer()
+	}
+	obj, exist, err := indexer.GetByKey(plcKey)
+	if err != nil || !exist {
+		return nil
+	}
+	return obj.(*cisapiv1.Policy)
+}
+
+// getNamespaceDefaultPolicy returns the default Policy of the namespace, nil if there is none
+func (crMgr *CRManager) getNamespaceDefaultPolicy(namespace string) *cisapiv1.Policy {
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
+	if !ok {
+		return nil
+	}
+	var defaults []*cisapiv1.Policy
+	for _, obj := range listNamespacedObjects(crInf.plcInformer, namespace) {
+		plc := obj.(*cisapiv1.Policy)
+		if isNamespaceDefaultPolicy(plc) && plc.Namespace == namespace {
+			defaults = append(defaults, plc)
+		}
+	}
+	if len(defaults) == 0 {
+		return nil
+	}
+	sort.Slice(defaults, func(i, j int) bool {
+		return defaults[i].Name < defaults[j].Name
+	})
+	if len(defaults) > 1 {
+		log.Warningf("Multiple default Policies found in namespace %v, using Policy %v",
+			namespace, defaults[0].Name)
+	}
+	return defaults[0]
+}
+
+// getPolicyHierarchy returns the Policies applied to the resources of the namespace from the least
+// specific one: the cluster-wide baseline Policy, the default Policy of the namespace and the Policy
+// referred by the resources
+func (crMgr *CRManager) getPolicyHierarchy(namespace string, plc *cisapiv1.Policy) []*cisapiv1.Policy {
+	var policies []*cisapiv1.Policy
+	applied := make(map[string]bool)
+	candidates := []*cisapiv1.Policy{crMgr.getPolicy(crMgr.baselinePolicy), crMgr.getNamespaceDefaultPolicy(namespace), plc}
+	for _, candidate := range candidates {
+		if candidate == nil || applied[candidate.Namespace+"/"+candidate.Name] {
+			continue
+		}
+		applied[candidate.Namespace+"/"+candidate.Name] = true
+		policies = append(policies, candidate)
+	}
+	return policies
+}
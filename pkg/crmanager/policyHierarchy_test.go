@@ -0,0 +1,113 @@
+package crmanager
+
+import (
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Policy Hierarchy", func() {
+	var mockCRM *mockCRManager
+	var baseline, nsDefault, plc *cisapiv1.Policy
+	namespace := "default"
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		baseline = &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: "kube-system"},
+			Spec: cisapiv1.PolicySpec{
+				L7Policies: cisapiv1.L7PolicySpec{WAF: "/Common/baseline_waf"},
+				L3Policies: cisapiv1.L3PolicySpec{FirewallPolicy: "/Common/baseline_fw"},
+				IRules:     cisapiv1.LtmIRulesSpec{InSecure: "/Common/baseline_irule"},
+				Profiles: cisapiv1.ProfileSpec{
+					TCP:         "/Common/baseline_tcp",
+					LogProfiles: []string{"/Common/local-dos"},
+				},
+			},
+		}
+		nsDefault = &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ns-default",
+				Namespace: namespace,
+				Labels:    map[string]string{DefaultPolicyLabel: "true"},
+			},
+			Spec: cisapiv1.PolicySpec{
+				IRules: cisapiv1.LtmIRulesSpec{InSecure: "/Common/default_irule", Priority: "high"},
+				Profiles: cisapiv1.ProfileSpec{
+					HTTP:        "/Common/default_http",
+					LogProfiles: []string{"/Common/local-dos", "/Common/default_log"},
+				},
+			},
+		}
+		plc = &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace},
+			Spec: cisapiv1.PolicySpec{
+				L7Policies: cisapiv1.L7PolicySpec{WAF: "/Common/plc_waf"},
+				IRules:     cisapiv1.LtmIRulesSpec{InSecure: "/Common/plc_irule"},
+				Profiles:   cisapiv1.ProfileSpec{TCP: "/Common/plc_tcp"},
+			},
+		}
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset()
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		mockCRM.crInformers[namespace] = mockCRM.newNamespacedInformer(namespace)
+		Expect(mockCRM.setupBaselinePolicy("kube-system/baseline")).To(BeNil())
+		_ = mockCRM.baselinePlcInformer.plcInformer.GetIndexer().Add(baseline)
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(nsDefault)
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(plc)
+	})
+
+	It("Validate baseline Policy", func() {
+		Expect(mockCRM.setupBaselinePolicy("baseline")).NotTo(BeNil())
+		Expect(mockCRM.setupBaselinePolicy("/baseline")).NotTo(BeNil())
+		Expect(mockCRM.isBaselinePolicy(baseline)).To(BeTrue())
+		Expect(mockCRM.isBaselinePolicy(plc)).To(BeFalse())
+	})
+
+	It("Policies from the least specific one", func() {
+		Expect(mockCRM.getPolicyHierarchy(namespace, plc)).To(Equal([]*cisapiv1.Policy{baseline, nsDefault, plc}))
+		Expect(mockCRM.getPolicyHierarchy(namespace, nil)).To(Equal([]*cisapiv1.Policy{baseline, nsDefault}))
+		Expect(mockCRM.getPolicyHierarchy(namespace, nsDefault)).To(Equal([]*cisapiv1.Policy{baseline, nsDefault}),
+			"Policy should be applied once")
+
+		// First default Policy by name is used
+		another := nsDefault.DeepCopy()
+		another.Name = "another-default"
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(another)
+		Expect(mockCRM.getNamespaceDefaultPolicy(namespace)).To(Equal(another))
+		Expect(mockCRM.getNamespaceDefaultPolicy("test")).To(BeNil())
+	})
+
+	It("Merge the Policies of the hierarchy", func() {
+		rsCfg := &ResourceConfig{}
+		rsCfg.MetaData.Protocol = "http"
+		rsCfg.Virtual.IRules = []string{"/Common/vs_irule"}
+		for _, p := range mockCRM.getPolicyHierarchy(namespace, plc) {
+			Expect(mockCRM.handleVSResourceConfigForPolicy(rsCfg, p)).To(BeNil())
+		}
+		Expect(rsCfg.MetaData.policies).To(Equal([]string{"kube-system/baseline", "default/ns-default", "default/plc"}))
+		Expect(rsCfg.Virtual.WAF).To(Equal("/Common/plc_waf"), "Most specific Policy should override WAF")
+		Expect(rsCfg.Virtual.Firewall).To(Equal("/Common/baseline_fw"), "Baseline firewall policy should be retained")
+		Expect(rsCfg.Virtual.LogProfiles).To(Equal([]string{"/Common/local-dos", "/Common/default_log"}))
+		Expect(rsCfg.Virtual.IRules).To(Equal([]string{
+			"/Common/default_irule", "/Common/vs_irule", "/Common/baseline_irule", "/Common/plc_irule"}))
+		Expect(rsCfg.Virtual.Profiles).To(Equal(ProfileRefs{
+			{Name: "/Common/plc_tcp", Context: "tcp"},
+			{Name: "/Common/default_http", Context: "http"},
+		}))
+
+		// iRule with override priority replaces the iRules of the Policies applied before
+		plc.Spec.IRules.Priority = "override"
+		tsCfg := &ResourceConfig{}
+		for _, p := range mockCRM.getPolicyHierarchy(namespace, plc) {
+			Expect(mockCRM.handleTSResourceConfigForPolicy(tsCfg, p)).To(BeNil())
+		}
+		Expect(tsCfg.Virtual.IRules).To(Equal([]string{"/Common/plc_irule"}))
+		Expect(tsCfg.Virtual.Profiles).To(Equal(ProfileRefs{{Name: "/Common/plc_tcp", Context: "tcp"}}))
+	})
+})
@@ -0,0 +1,295 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// PolicyInUseReason is the reason of the events of a Policy deleted while it is in use
+	PolicyInUseReason = "PolicyInUse"
+
+	// Number of attempts to update the finalizers of a Policy on conflicts
+	finalizerUpdateAttempts = 3
+
+	// Interval of checking whether this replica acquired leadership, to re-sync the usage of the Policies
+	policyUsageLeaderCheckInterval = 5 * time.Second
+
+	// Delay of the usage updates of a Policy, so that the changes within it are written at once
+	policyUsageUpdateDelay = 2 * time.Second
+
+	// Maximum number of VirtualServers and of TransportServers listed in the status of the baseline
+	// and namespace default Policies, which are used by all the resources in their scope
+	maxListedPolicyUsers = 20
+)
+
+// updatePolicyRefs records the Policy referred by the VirtualServer or TransportServer and queues the update
+// of the usage of the Policy, as well as of the Policy referred before when the reference changes.
+// As the baseline and namespace default Policies are used by all the resources in their scope, their
+// usage is updated when a resource is added or deleted
+func (crMgr *CRManager) updatePolicyRefs(kind, namespace, name, plcName string, rscDelete bool) {
+	if crMgr.policyRefs == nil {
+		crMgr.policyRefs = make(map[string]string)
+	}
+	rscKey := kind + "/" + namespace + "/" + name
+	oldPlcName, known := crMgr.policyRefs[rscKey]
+	if rscDelete {
+		delete(crMgr.policyRefs, rscKey)
+	} else {
+		crMgr.policyRefs[rscKey] = plcName
+	}
+
+	if oldPlcName != "" && oldPlcName != plcName {
+		crMgr.enqueuePolicyUsage(namespace, oldPlcName)
+	}
+	if plcName != "" {
+		crMgr.enqueuePolicyUsage(namespace, plcName)
+	}
+	// resource is added or deleted
+	if known == rscDelete {
+		for _, plc := range crMgr.getPolicyHierarchy(namespace, nil) {
+			crMgr.enqueuePolicyUsage(plc.Namespace, plc.Name)
+		}
+	}
+}
+
+// enqueuePolicyUsage queues the update of the usage of the Policy. Updates queued for a Policy within
+// policyUsageUpdateDelay are written once, as adding or deleting a resource updates the baseline Policy
+func (crMgr *CRManager) enqueuePolicyUsage(namespace, plcName string) {
+	crMgr.policyUsageQueue.AddAfter(namespace+"/"+plcName, crMgr.policyUsageDelay)
+}
+
+// policyUsageWorker updates the usage of the Policies queued until the queue is shut down
+func (crMgr *CRManager) policyUsageWorker() {
+	for crMgr.processPolicyUsage() {
+	}
+}
+
+func (crMgr *CRManager) processPolicyUsage() bool {
+	key, quit := crMgr.policyUsageQueue.Get()
+	if quit {
+		return false
+	}
+	defer crMgr.policyUsageQueue.Done(key)
+	plcKey := strings.SplitN(key.(string), "/", 2)
+	crMgr.updatePolicyUsage(plcKey[0], plcKey[1])
+	return true
+}
+
+// getPolicyUserName returns the name of a resource using the Policy, prefixed with the namespace of the
+// resource when it differs from the one of the Policy, as for the baseline Policy
+func getPolicyUserName(plc *cisapiv1.Policy, namespace, name string) string {
+	if namespace == plc.Namespace {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// getPolicyUsage returns the sorted names of the VirtualServers and TransportServers using the Policy
+func (crMgr *CRManager) getPolicyUsage(plc *cisapiv1.Policy) ([]string, []string) {
+	var vsNames, tsNames []string
+	for _, vs := range crMgr.getVirtualsForCustomPolicy(plc) {
+		vsNames = append(vsNames, getPolicyUserName(plc, vs.Namespace, vs.Name))
+	}
+	for _, ts := range crMgr.getTransportServersForCustomPolicy(plc) {
+		tsNames = append(tsNames, getPolicyUserName(plc, ts.Namespace, ts.Name))
+	}
+	sort.Strings(vsNames)
+	sort.Strings(tsNames)
+	return vsNames, tsNames
+}
+
+// updatePolicyUsage reports the VirtualServers and TransportServers using the Policy in its status,
+// and protects the Policy from deletion while it is in use. Baseline and namespace default Policies
+// list only the first of their users by name, along with the number of users as any other Policy
+func (crMgr *CRManager) updatePolicyUsage(namespace, plcName string) {
+	// Only the leader writes the usage, a standby re-syncs it on acquiring leadership
+	if !crMgr.Agent.IsLeader() {
+		return
+	}
+	// Baseline Policy is found with its own informer, as its namespace need not be watched
+	plc := crMgr.getPolicy(namespace + "/" + plcName)
+	if plc == nil {
+		return
+	}
+	vsNames, tsNames := crMgr.getPolicyUsage(plc)
+	vsCount, tsCount := len(vsNames), len(tsNames)
+	if crMgr.isBaselinePolicy(plc) || crMgr.isAppliedNamespaceDefaultPolicy(plc) {
+		if vsCount > maxListedPolicyUsers {
+			vsNames = vsNames[:maxListedPolicyUsers]
+		}
+		if tsCount > maxListedPolicyUsers {
+			tsNames = tsNames[:maxListedPolicyUsers]
+		}
+	}
+	crMgr.updatePolicyStatus(plc, func(plc *cisapiv1.Policy) {
+		plc.Status.VirtualServers = vsNames
+		plc.Status.TransportServers = tsNames
+		plc.Status.VirtualServerCount = vsCount
+		plc.Status.TransportServerCount = tsCount
+	})
+	crMgr.updatePolicyFinalizer(plc, vsCount+tsCount > 0)
+}
+
+// policyUsageLeaderWorker re-syncs the usage of all the Policies whenever this replica acquires leadership,
+// as the usage is not updated while it is a standby
+func (crMgr *CRManager) policyUsageLeaderWorker() {
+	ticker := time.NewTicker(policyUsageLeaderCheckInterval)
+	defer ticker.Stop()
+	synced := false
+	for {
+		if !crMgr.Agent.IsLeader() {
+			synced = false
+			<-crMgr.Agent.leaderSignal()
+		}
+		if !synced {
+			crMgr.resyncPolicyUsage()
+			synced = true
+		}
+		<-ticker.C
+	}
+}
+
+// resyncPolicyUsage queues the update of the usage of the baseline Policy and of the Policies in the monitored namespaces
+func (crMgr *CRManager) resyncPolicyUsage() {
+	var policies []*cisapiv1.Policy
+	if baseline := crMgr.getPolicy(crMgr.baselinePolicy); baseline != nil {
+		policies = append(policies, baseline)
+	}
+	for _, crInf := range crMgr.getCRInformers() {
+		if crInf.plcInformer == nil {
+			continue
+		}
+		for _, obj := range crInf.plcInformer.GetIndexer().List() {
+			policies = append(policies, obj.(*cisapiv1.Policy))
+		}
+	}
+	log.Debugf("Re-syncing the usage of %v Policies on acquiring leadership", len(policies))
+	for _, plc := range policies {
+		crMgr.enqueuePolicyUsage(plc.Namespace, plc.Name)
+	}
+}
+
+func hasPolicyFinalizer(plc *cisapiv1.Policy) bool {
+	for _, finalizer := range plc.Finalizers {
+		if finalizer == cisapiv1.PolicyFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePolicyFinalizer adds the finalizer to the Policy while it is in use and removes it afterwards,
+// so that a Policy deleted while in use is removed once no virtual server uses it anymore
+func (crMgr *CRManager) updatePolicyFinalizer(plc *cisapiv1.Policy, inUse bool) {
+	if !crMgr.Agent.IsLeader() {
+		return
+	}
+	protect := crMgr.policyFinalizer && inUse
+	for attempt := 1; ; attempt++ {
+		if hasPolicyFinalizer(plc) == protect {
+			return
+		}
+		// Finalizers can not be added to a Policy being deleted
+		if protect && plc.DeletionTimestamp != nil {
+			return
+		}
+
+		plcCopy := plc.DeepCopy()
+		if protect {
+			plcCopy.Finalizers = append(plcCopy.Finalizers, cisapiv1.PolicyFinalizer)
+		} else {
+			plcCopy.Finalizers = nil
+			for _, finalizer := range plc.Finalizers {
+				if finalizer != cisapiv1.PolicyFinalizer {
+					plcCopy.Finalizers = append(plcCopy.Finalizers, finalizer)
+				}
+			}
+		}
+		log.Debugf("Updating finalizers of Policy %v/%v to %v", plc.Namespace, plc.Name, plcCopy.Finalizers)
+		_, err := crMgr.kubeCRClient.CisV1().Policies(plc.Namespace).Update(
+			context.TODO(), plcCopy, metav1.UpdateOptions{})
+		if err == nil {
+			return
+		}
+		if !k8serrors.IsConflict(err) || attempt == finalizerUpdateAttempts {
+			log.Errorf("Error while updating finalizers of Policy %v/%v: %v", plc.Namespace, plc.Name, err)
+			return
+		}
+		// Informer cache is stale, retry with the latest Policy
+		plc, err = crMgr.kubeCRClient.CisV1().Policies(plc.Namespace).Get(
+			context.TODO(), plc.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Errorf("Error while fetching Policy %v/%v to update finalizers: %v", plc.Namespace, plc.Name, err)
+			return
+		}
+	}
+}
+
+// recordPolicyInUseEvents warns on the Policy and on the VirtualServers and TransportServers using it,
+// that the Policy is deleted while it is in use
+func (crMgr *CRManager) recordPolicyInUseEvents(
+	plc *cisapiv1.Policy,
+	virtuals []*cisapiv1.VirtualServer,
+	tsVirtuals []*cisapiv1.TransportServer,
+	deleted bool,
+) {
+	if len(virtuals) == 0 && len(tsVirtuals) == 0 {
+		return
+	}
+	var users []string
+	var objs []runtime.Object
+	var namespaces []string
+	for _, vs := range virtuals {
+		users = append(users, "VirtualServer "+getPolicyUserName(plc, vs.Namespace, vs.Name))
+		objs = append(objs, vs)
+		namespaces = append(namespaces, vs.Namespace)
+	}
+	for _, ts := range tsVirtuals {
+		users = append(users, "TransportServer "+getPolicyUserName(plc, ts.Namespace, ts.Name))
+		objs = append(objs, ts)
+		namespaces = append(namespaces, ts.Namespace)
+	}
+
+	message := fmt.Sprintf("Policy %v is deleted while used by %v", plc.Name, strings.Join(users, ", "))
+	switch {
+	case deleted:
+		message += ", the configuration of the Policy is removed from their virtual servers"
+	case hasPolicyFinalizer(plc):
+		message += ", deletion is blocked until it is no longer used"
+	}
+	log.Warningf("%v in namespace %v", message, plc.Namespace)
+	evNotifier := crMgr.eventNotifier.CreateNotifierForNamespace(plc.Namespace, crMgr.kubeClient.CoreV1())
+	evNotifier.RecordEvent(plc, v1.EventTypeWarning, PolicyInUseReason, message)
+	for i, obj := range objs {
+		// Users of the baseline Policy are in other namespaces
+		evNotifier = crMgr.eventNotifier.CreateNotifierForNamespace(namespaces[i], crMgr.kubeClient.CoreV1())
+		evNotifier.RecordEvent(obj, v1.EventTypeWarning, PolicyInUseReason, message)
+	}
+}
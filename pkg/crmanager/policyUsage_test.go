@@ -0,0 +1,245 @@
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	apm "github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var _ = Describe("Policy Usage", func() {
+	var mockCRM *mockCRManager
+	var vs *cisapiv1.VirtualServer
+	var ts *cisapiv1.TransportServer
+	var plc *cisapiv1.Policy
+	namespace := "default"
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		mockCRM.Agent = &Agent{PostManager: &PostManager{}}
+		mockCRM.Agent.SetLeader(true)
+		mockCRM.policyUsageQueue = workqueue.NewNamedDelayingQueue("policy-usage")
+		vs = test.NewVirtualServer(
+			"SampleVS",
+			namespace,
+			cisapiv1.VirtualServerSpec{
+				Host:       "test.com",
+				PolicyName: "plc",
+			})
+		ts = test.NewTransportServer(
+			"SampleTS",
+			namespace,
+			cisapiv1.TransportServerSpec{
+				VirtualServerPort: 8080,
+				PolicyName:        "plc",
+			})
+		plc = &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace},
+		}
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset(vs, ts, plc)
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		mockCRM.crInformers[namespace] = mockCRM.newNamespacedInformer(namespace)
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		_ = mockCRM.crInformers[namespace].tsInformer.GetIndexer().Add(ts)
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(plc)
+	})
+
+	AfterEach(func() {
+		mockCRM.policyUsageQueue.ShutDown()
+	})
+
+	// processQueued updates the usage of the queued Policies
+	processQueued := func() {
+		for mockCRM.policyUsageQueue.Len() > 0 {
+			mockCRM.processPolicyUsage()
+		}
+	}
+
+	getPolicy := func(name string) *cisapiv1.Policy {
+		latest, err := mockCRM.kubeCRClient.CisV1().Policies(namespace).Get(
+			context.TODO(), name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return latest
+	}
+
+	It("Report VirtualServers and TransportServers using the Policy", func() {
+		Expect(mockCRM.getVirtualsForCustomPolicy(plc)).To(Equal([]*cisapiv1.VirtualServer{vs}))
+		Expect(mockCRM.getTransportServersForCustomPolicy(plc)).To(Equal([]*cisapiv1.TransportServer{ts}))
+
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs.Name, vs.Spec.PolicyName, false)
+		processQueued()
+		status := getPolicy("plc").Status
+		Expect(status.VirtualServers).To(Equal([]string{"SampleVS"}))
+		Expect(status.TransportServers).To(Equal([]string{"SampleTS"}))
+		Expect(getPolicy("plc").Finalizers).To(BeEmpty(), "Finalizer should be added only when enabled")
+
+		// VirtualServer refers to another Policy
+		plc2 := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "plc2", Namespace: namespace},
+		}
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(namespace).Create(context.TODO(), plc2, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(plc2)
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Update(getPolicy("plc"))
+		vs2 := vs.DeepCopy()
+		vs2.Spec.PolicyName = "plc2"
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Update(vs2)
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs.Name, vs2.Spec.PolicyName, false)
+		processQueued()
+		Expect(getPolicy("plc").Status.VirtualServers).To(BeEmpty(),
+			"Policy referred before should no longer report the VirtualServer")
+		Expect(getPolicy("plc").Status.TransportServers).To(Equal([]string{"SampleTS"}))
+		Expect(getPolicy("plc2").Status.VirtualServers).To(Equal([]string{"SampleVS"}))
+
+		// VirtualServer is deleted
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Update(getPolicy("plc2"))
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Delete(vs2)
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs.Name, vs2.Spec.PolicyName, true)
+		processQueued()
+		Expect(getPolicy("plc2").Status.VirtualServers).To(BeEmpty())
+		Expect(mockCRM.policyRefs).To(BeEmpty())
+	})
+
+	It("Protect Policy in use from deletion", func() {
+		mockCRM.policyFinalizer = true
+		mockCRM.eventNotifier = apm.NewEventNotifier(nil)
+		mockCRM.updatePolicyUsage(namespace, plc.Name)
+		Expect(getPolicy("plc").Finalizers).To(Equal([]string{cisapiv1.PolicyFinalizer}))
+
+		// Policy is deleted while in use
+		deleting := getPolicy("plc")
+		deleting.DeletionTimestamp = &metav1.Time{}
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Update(deleting)
+		mockCRM.recordPolicyInUseEvents(deleting, []*cisapiv1.VirtualServer{vs},
+			[]*cisapiv1.TransportServer{ts}, false)
+		mockCRM.updatePolicyUsage(namespace, plc.Name)
+		Expect(getPolicy("plc").Finalizers).To(Equal([]string{cisapiv1.PolicyFinalizer}),
+			"Finalizer should be retained while the Policy is in use")
+
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Delete(vs)
+		_ = mockCRM.crInformers[namespace].tsInformer.GetIndexer().Delete(ts)
+		mockCRM.updatePolicyUsage(namespace, plc.Name)
+		Expect(getPolicy("plc").Finalizers).To(BeEmpty(),
+			"Finalizer should be removed once the Policy is no longer used")
+	})
+
+	It("Report the usage of baseline and namespace default Policies", func() {
+		baseline := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: "kube-system"},
+		}
+		nsDefault := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ns-default",
+				Namespace: namespace,
+				Labels:    map[string]string{DefaultPolicyLabel: "true"},
+			},
+		}
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(baseline.Namespace).Create(
+			context.TODO(), baseline, metav1.CreateOptions{})
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(namespace).Create(context.TODO(), nsDefault, metav1.CreateOptions{})
+		Expect(mockCRM.setupBaselinePolicy("kube-system/baseline")).To(BeNil())
+		_ = mockCRM.baselinePlcInformer.plcInformer.GetIndexer().Add(baseline)
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(nsDefault)
+
+		// VirtualServer without a Policy is added
+		vs2 := test.NewVirtualServer("NoPolicyVS", namespace, cisapiv1.VirtualServerSpec{Host: "test2.com"})
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs2)
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs2.Name, vs2.Spec.PolicyName, false)
+		processQueued()
+		latest, err := mockCRM.kubeCRClient.CisV1().Policies(baseline.Namespace).Get(
+			context.TODO(), baseline.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(latest.Status.VirtualServers).To(Equal([]string{"default/NoPolicyVS", "default/SampleVS"}),
+			"Users of the baseline Policy should be prefixed with their namespace")
+		Expect(latest.Status.TransportServers).To(Equal([]string{"default/SampleTS"}))
+		Expect(getPolicy("ns-default").Status.VirtualServers).To(Equal([]string{"NoPolicyVS", "SampleVS"}))
+
+		mockCRM.policyFinalizer = true
+		mockCRM.updatePolicyUsage(baseline.Namespace, baseline.Name)
+		latest, err = mockCRM.kubeCRClient.CisV1().Policies(baseline.Namespace).Get(
+			context.TODO(), baseline.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(latest.Finalizers).To(Equal([]string{cisapiv1.PolicyFinalizer}),
+			"Baseline Policy in use should be protected")
+		mockCRM.policyFinalizer = false
+
+		// Only the first default Policy of the namespace by name is applied
+		another := nsDefault.DeepCopy()
+		another.Name = "other-default"
+		Expect(mockCRM.getVirtualsForCustomPolicy(another)).To(BeEmpty())
+		Expect(mockCRM.getVirtualsForCustomPolicy(nsDefault)).To(HaveLen(2))
+
+		// VirtualServer is deleted
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Update(getPolicy("ns-default"))
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Delete(vs2)
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs2.Name, vs2.Spec.PolicyName, true)
+		processQueued()
+		Expect(getPolicy("ns-default").Status.VirtualServers).To(Equal([]string{"SampleVS"}))
+	})
+
+	It("Update the usage only as the leader", func() {
+		mockCRM.policyFinalizer = true
+		mockCRM.Agent.SetLeader(false)
+		mockCRM.updatePolicyRefs(VirtualServer, namespace, vs.Name, vs.Spec.PolicyName, false)
+		processQueued()
+		Expect(getPolicy("plc").Status.VirtualServers).To(BeEmpty(), "Standby should not update the status")
+		Expect(getPolicy("plc").Finalizers).To(BeEmpty(), "Standby should not update the finalizers")
+
+		go mockCRM.policyUsageWorker()
+		go mockCRM.policyUsageLeaderWorker()
+		Consistently(func() []string { return getPolicy("plc").Finalizers }, "200ms").Should(BeEmpty())
+		mockCRM.Agent.SetLeader(true)
+		Eventually(func() []string { return getPolicy("plc").Finalizers }).Should(
+			Equal([]string{cisapiv1.PolicyFinalizer}), "Usage should be re-synced on acquiring leadership")
+	})
+
+	It("Coalesce the usage updates of the baseline Policy", func() {
+		baseline := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: "kube-system"},
+		}
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(baseline.Namespace).Create(
+			context.TODO(), baseline, metav1.CreateOptions{})
+		Expect(mockCRM.setupBaselinePolicy("kube-system/baseline")).To(BeNil())
+		_ = mockCRM.baselinePlcInformer.plcInformer.GetIndexer().Add(baseline)
+		fakeClient := mockCRM.kubeCRClient.(*crdfake.Clientset)
+		fakeClient.ClearActions()
+
+		mockCRM.policyUsageDelay = 100 * time.Millisecond
+		for i := 0; i < maxListedPolicyUsers+5; i++ {
+			added := test.NewVirtualServer(fmt.Sprintf("vs%02d", i), namespace, cisapiv1.VirtualServerSpec{})
+			_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(added)
+			mockCRM.updatePolicyRefs(VirtualServer, namespace, added.Name, "", false)
+		}
+		Eventually(mockCRM.policyUsageQueue.Len).Should(Equal(1), "Updates of the Policy should be coalesced")
+		processQueued()
+
+		var statusUpdates int
+		for _, action := range fakeClient.Actions() {
+			if update, ok := action.(k8stesting.UpdateAction); ok && update.GetSubresource() == "status" {
+				statusUpdates++
+			}
+		}
+		Expect(statusUpdates).To(Equal(1), "Status of the Policy should be updated once")
+		latest, err := mockCRM.kubeCRClient.CisV1().Policies(baseline.Namespace).Get(
+			context.TODO(), baseline.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(latest.Status.VirtualServers).To(HaveLen(maxListedPolicyUsers),
+			"Users of the baseline Policy should be capped")
+		Expect(latest.Status.VirtualServers[0]).To(Equal("default/SampleVS"))
+		Expect(latest.Status.VirtualServerCount).To(Equal(maxListedPolicyUsers + 6))
+		Expect(latest.Status.TransportServers).To(Equal([]string{"default/SampleTS"}))
+		Expect(latest.Status.TransportServerCount).To(Equal(1))
+	})
+})
@@ -18,15 +18,23 @@ package crmanager
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/health"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tokenmanager"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 )
 
@@ -34,12 +42,37 @@ const (
 	timeoutSmall  = 3 * time.Second
 	timeoutMedium = 30 * time.Second
 	timeoutLarge  = 60 * time.Second
+	// timeoutDial bounds the connection to BIG-IP, which otherwise waits for the TCP timeout of the OS
+	timeoutDial = 10 * time.Second
 )
 
 type PostManager struct {
-	postChan   chan agentConfig
-	respChan   chan int
-	httpClient *http.Client
+	postChan chan agentConfig
+	respChan chan agentResponse
+	// pendingResps holds the latest response of each tenant yet to be sent on respChan
+	pendingResps map[string]agentResponse
+	// forwardingResps is true while a go routine sends the pending responses on respChan
+	forwardingResps bool
+	respMutex       sync.Mutex
+	// tenantChans holds the latest declaration of each tenant to be posted by its tenantConfigWorker
+	tenantChans map[string]chan agentConfig
+	// postedDecls holds the latest declaration of each tenant posted to BIG-IP
+	postedDecls map[string]agentConfig
+	tenantMutex sync.Mutex
+	// driftChan receives the tenants found drifted on BIG-IP
+	driftChan chan string
+	// leader is true when this replica is allowed to post declarations to BIG-IP
+	leader      bool
+	leaderChan  chan struct{}
+	leaderMutex sync.Mutex
+	httpClient  *http.Client
+	// configProgress tracks the declaration being split into tenants by configWorker
+	configProgress health.Progress
+	// activeURL is the BIG-IP of the HA group which the declarations are posted to
+	activeURL string
+	// activeURLHandler is called whenever another BIG-IP becomes active
+	activeURLHandler func()
+	urlMutex         sync.RWMutex
 	PostParams
 }
 
@@ -52,6 +85,24 @@ type PostParams struct {
 	AS3PostDelay  int
 	//Log the AS3 response body in Controller logs
 	LogResponse bool
+	// Start as a standby replica and post only after acquiring the leader Lease
+	LeaderElection bool
+	// Interval (in seconds) to check the tenants on BIG-IP for configuration drift, 0 disables the check
+	DriftCheckInterval int
+	// Re-post the declaration of a tenant when configuration drift is detected
+	DriftRepost bool
+	// Login provider used to request authentication tokens from BIG-IP
+	LoginProvider string
+	// TokenManager authenticates the requests to BIG-IP, created from the credentials when nil
+	TokenManager *tokenmanager.TokenManager
+	// Management URLs of the BIG-IPs of an HA group, declarations are posted to the active one
+	BIGIPURLs []string
+	// Interval (in seconds) to check the failover status of the BIG-IPs in BIGIPURLs
+	FailoverCheckInterval int
+	// Re-post the declarations to the new active BIG-IP only when its device group is not in sync
+	ConfigSyncAware bool
+	// Label of the tenants declared by this controller, used to find the tenants to be removed after a restart
+	TenantLabel string
 }
 
 type GTMParams struct {
@@ -64,18 +115,52 @@ type agentConfig struct {
 	data      string
 	as3APIURL string
 	id        int
+	tenant    string
+	// errMessage holds the error reported by BIG-IP for the last post of the declaration
+	errMessage string
+}
+
+// agentResponse is sent on respChan once a tenant declaration is posted to BIG-IP
+type agentResponse struct {
+	id     int
+	tenant string
+	// programmed is false when BIG-IP rejected the declaration of the tenant
+	programmed bool
+	message    string
+}
+
+// response returns the agentResponse reporting the result of posting the declaration
+func (cfg agentConfig) response() agentResponse {
+	return agentResponse{
+		id:         cfg.id,
+		tenant:     cfg.tenant,
+		programmed: cfg.errMessage == "",
+		message:    cfg.errMessage,
+	}
 }
 
 func NewPostManager(params PostParams) *PostManager {
 	pm := &PostManager{
-		postChan:   make(chan agentConfig, 1),
-		PostParams: params,
+		postChan:    make(chan agentConfig, 1),
+		tenantChans: make(map[string]chan agentConfig),
+		postedDecls: make(map[string]agentConfig),
+		leaderChan:  make(chan struct{}),
+		PostParams:  params,
 	}
+	pm.SetLeader(!params.LeaderElection)
 	pm.setupBIGIPRESTClient()
 
 	// configWorker runs as a separate go routine
 	// blocks on postChan to get new/updated configuration to be posted to BIG-IP
 	go pm.configWorker()
+	if params.DriftCheckInterval > 0 {
+		// driftWorker periodically compares the tenants on BIG-IP with the posted declarations
+		go pm.driftWorker()
+	}
+	if len(params.BIGIPURLs) > 1 {
+		// failoverWorker periodically finds the active BIG-IP of the HA group
+		go pm.failoverWorker()
+	}
 	return pm
 }
 
@@ -94,20 +179,26 @@ func (postMgr *PostManager) setupBIGIPRESTClient() {
 	}
 
 	tr := &http.Transport{
+		DialContext: (&net.Dialer{Timeout: timeoutDial}).DialContext,
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: postMgr.SSLInsecure,
 			RootCAs:            rootCAs,
 		},
 	}
 
+	if postMgr.TokenManager == nil {
+		postMgr.TokenManager = tokenmanager.NewTokenManager(postMgr.BIGIPURL, postMgr.BIGIPUsername,
+			postMgr.BIGIPPassword, postMgr.LoginProvider)
+	}
+
 	postMgr.httpClient = &http.Client{
-		Transport: tr,
+		Transport: postMgr.TokenManager.Transport(tr),
 		Timeout:   timeoutLarge,
 	}
 }
 
 func (postMgr *PostManager) getAS3APIURL(tenants []string) string {
-	apiURL := postMgr.BIGIPURL + "/mgmt/shared/appsvcs/declare/" + strings.Join(tenants, ",")
+	apiURL := postMgr.getBIGIPURL() + "/mgmt/shared/appsvcs/declare/" + strings.Join(tenants, ",")
 	return apiURL
 }
 
@@ -130,12 +221,174 @@ func (postMgr *PostManager) Write(
 	return
 }
 
+// IsLeader returns true when this replica is allowed to post declarations to BIG-IP
+func (postMgr *PostManager) IsLeader() bool {
+	postMgr.leaderMutex.Lock()
+	defer postMgr.leaderMutex.Unlock()
+	return postMgr.leader
+}
+
+// SetLeader promotes or demotes this replica
+// On promotion tenant workers get unblocked to post the declarations they are holding
+func (postMgr *PostManager) SetLeader(leader bool) {
+	postMgr.leaderMutex.Lock()
+	defer postMgr.leaderMutex.Unlock()
+	if postMgr.leader == leader {
+		return
+	}
+	postMgr.leader = leader
+	if leader {
+		if postMgr.leaderChan != nil {
+			close(postMgr.leaderChan)
+		}
+		return
+	}
+	postMgr.leaderChan = make(chan struct{})
+}
+
+func (postMgr *PostManager) leaderSignal() chan struct{} {
+	postMgr.leaderMutex.Lock()
+	defer postMgr.leaderMutex.Unlock()
+	return postMgr.leaderChan
+}
+
 // configWorker blocks on postChan
-// whenever gets unblocked posts active configuration to BIG-IP
+// whenever gets unblocked splits active configuration into tenant declarations
+// and hands them over to the respective tenant workers
 func (postMgr *PostManager) configWorker() {
+	// Tenants declared on BIG-IP before the restart of controller, until they are removed
+	var labeledTenants []string
+	labeledTenantsFound := postMgr.TenantLabel == ""
+	for cfg := range postMgr.postChan {
+		postMgr.configProgress.Busy()
+		if !labeledTenantsFound {
+			var err error
+			labeledTenants, err = postMgr.getLabeledTenants()
+			if err != nil {
+				log.Warningf("[AS3] Unable to find the tenants declared on BIG-IP, will retry on next update: %v", err)
+			}
+			labeledTenantsFound = err == nil
+		}
+		postMgr.tenantMutex.Lock()
+		staleTenants := labeledTenants
+		labeledTenants = nil
+		for tenant := range postMgr.tenantChans {
+			staleTenants = append(staleTenants, tenant)
+		}
+		postMgr.tenantMutex.Unlock()
+
+		for tenant, data := range getTenantDeclarations(cfg.data, staleTenants, postMgr.TenantLabel) {
+			postMgr.writeTenant(agentConfig{
+				data:      data,
+				as3APIURL: postMgr.getAS3APIURL(getDeclarationTenants(data, tenant)),
+				id:        cfg.id,
+				tenant:    tenant,
+			})
+		}
+		postMgr.configProgress.Idle()
+	}
+}
+
+// writeTenant pushes the latest declaration of a tenant to its worker
+// and starts the worker when a tenant is seen for the first time
+func (postMgr *PostManager) writeTenant(cfg agentConfig) {
+	// Declaration is written holding the lock, so that the worker of a removed tenant does not miss it
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	tenantChan, ok := postMgr.tenantChans[cfg.tenant]
+	if !ok {
+		tenantChan = make(chan agentConfig, 1)
+		postMgr.tenantChans[cfg.tenant] = tenantChan
+		go postMgr.tenantConfigWorker(tenantChan)
+	}
+
+	for {
+		select {
+		case tenantChan <- cfg:
+			return
+		default:
+		}
+		// Replace the declaration which is not yet picked up by the worker
+		select {
+		case <-tenantChan:
+		default:
+		}
+	}
+}
+
+// removeTenant forgets the tenant removed from BIG-IP, so that it is no longer declared empty
+// Returns false when a newer declaration is available for the tenant
+func (postMgr *PostManager) removeTenant(tenantChan chan agentConfig, tenant string) bool {
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	if postMgr.tenantChans[tenant] != tenantChan || len(tenantChan) != 0 {
+		return false
+	}
+	delete(postMgr.tenantChans, tenant)
+	delete(postMgr.postedDecls, tenant)
+	return true
+}
+
+// getLabeledTenants returns the tenants on BIG-IP which are labeled as declared by this controller
+func (postMgr *PostManager) getLabeledTenants() ([]string, error) {
+	responseMap, err := postMgr.getDeclaration(postMgr.getAS3APIURL(nil))
+	if err != nil {
+		return nil, err
+	}
+	var tenants []string
+	for name, obj := range responseMap {
+		if tenant, ok := obj.(map[string]interface{}); ok &&
+			tenant["class"] == "Tenant" && tenant["label"] == postMgr.TenantLabel {
+			tenants = append(tenants, name)
+		}
+	}
+	return tenants, nil
+}
+
+func (postMgr *PostManager) getTenantChan(tenant string) chan agentConfig {
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	return postMgr.tenantChans[tenant]
+}
+
+func (postMgr *PostManager) getPostedDecl(tenant string) (agentConfig, bool) {
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	cfg, ok := postMgr.postedDecls[tenant]
+	return cfg, ok
+}
+
+func (postMgr *PostManager) setPostedDecl(cfg agentConfig) {
+	postMgr.tenantMutex.Lock()
+	defer postMgr.tenantMutex.Unlock()
+	postMgr.postedDecls[cfg.tenant] = cfg
+}
+
+// tenantConfigWorker blocks on tenantChan
+// whenever gets unblocked posts the tenant declaration to BIG-IP
+// Failures are retried within the tenant without blocking the other tenants
+func (postMgr *PostManager) tenantConfigWorker(tenantChan chan agentConfig) {
 	// For the very first post after starting controller, need not wait to post
 	firstPost := true
-	for cfg := range postMgr.postChan {
+	for cfg := range tenantChan {
+		if !postMgr.IsLeader() {
+			cfg = postMgr.waitForLeadership(tenantChan, cfg)
+			// Previous leader might have already posted the same declaration
+			if postMgr.isDeclarationInSync(&cfg) {
+				log.Infof("[AS3] Declaration of tenant %v on BIG-IP is up to date, skipping the post after acquiring leadership",
+					cfg.tenant)
+				postMgr.setPostedDecl(cfg)
+			}
+		}
+
+		// Last declaration of the tenant available on BIG-IP
+		if postedDecl, ok := postMgr.getPostedDecl(cfg.tenant); ok && cfg.data == postedDecl.data {
+			log.Debugf("[AS3] No Change in the Configuration of tenant %v", cfg.tenant)
+			cfg.errMessage = postedDecl.errMessage
+			postMgr.sendResponse(cfg.response())
+			continue
+		}
+
 		if !firstPost && postMgr.AS3PostDelay != 0 {
 			// Time (in seconds) that CIS waits to post the AS3 declaration to BIG-IP.
 			log.Debugf("[AS3] Delaying post to BIG-IP for %v seconds", postMgr.AS3PostDelay)
@@ -144,29 +397,280 @@ func (postMgr *PostManager) configWorker() {
 
 		// After postDelay expires pick up latest declaration, if available
 		select {
-		case cfg = <-postMgr.postChan:
+		case cfg = <-tenantChan:
 		case <-time.After(1 * time.Microsecond):
 		}
 
 		respCfg, posted := postMgr.postConfig(&cfg)
 		// To handle general errors
-		for !posted {
+		for !posted && postMgr.IsLeader() {
 			respCfg, posted = postMgr.postOnEventOrTimeout(timeoutMedium, &cfg)
 		}
 
-		select {
-		case postMgr.respChan <- respCfg.id:
-		case <-postMgr.respChan:
-			postMgr.respChan <- respCfg.id
+		if !posted {
+			// Lost leadership while retrying, hold the declaration unless a newer one is available
+			log.Debugf("[AS3] Lost leadership, holding the declaration of tenant %v", cfg.tenant)
+			select {
+			case tenantChan <- *respCfg:
+			default:
+			}
+			continue
 		}
 
+		postMgr.setPostedDecl(*respCfg)
+		postMgr.sendResponse(respCfg.response())
 		firstPost = false
+		if respCfg.errMessage == "" && isEmptyTenantDeclaration(*respCfg) &&
+			postMgr.removeTenant(tenantChan, respCfg.tenant) {
+			log.Debugf("[AS3] Tenant %v removed from BIG-IP", respCfg.tenant)
+			return
+		}
+	}
+}
+
+// waitForLeadership holds the latest declaration while this replica is a standby
+// and returns it once this replica becomes the leader
+func (postMgr *PostManager) waitForLeadership(tenantChan chan agentConfig, cfg agentConfig) agentConfig {
+	log.Debugf("[AS3] Standby replica, holding the declaration of tenant %v until leadership is acquired", cfg.tenant)
+	for !postMgr.IsLeader() {
+		select {
+		case cfg = <-tenantChan:
+		case <-postMgr.leaderSignal():
+		}
+	}
+	return cfg
+}
+
+// sendResponse queues the response to be sent on respChan, without blocking the tenant worker
+// Only the latest response of each tenant is kept, as it supersedes the older ones
+func (postMgr *PostManager) sendResponse(resp agentResponse) {
+	if postMgr.respChan == nil {
+		return
+	}
+	postMgr.respMutex.Lock()
+	defer postMgr.respMutex.Unlock()
+	if postMgr.pendingResps == nil {
+		postMgr.pendingResps = make(map[string]agentResponse)
+	}
+	postMgr.pendingResps[resp.tenant] = resp
+	if !postMgr.forwardingResps {
+		postMgr.forwardingResps = true
+		go postMgr.forwardResponses()
+	}
+}
+
+// forwardResponses sends the pending responses on respChan until none is left
+func (postMgr *PostManager) forwardResponses() {
+	for {
+		postMgr.respMutex.Lock()
+		var resp agentResponse
+		pending := false
+		for tenant := range postMgr.pendingResps {
+			resp = postMgr.pendingResps[tenant]
+			delete(postMgr.pendingResps, tenant)
+			pending = true
+			break
+		}
+		if !pending {
+			postMgr.forwardingResps = false
+			postMgr.respMutex.Unlock()
+			return
+		}
+		postMgr.respMutex.Unlock()
+		postMgr.respChan <- resp
+	}
+}
+
+// getDeclarationTenants returns the tenants to post the declaration of the tenant to,
+// which includes Common when it is declared along with the tenant
+func getDeclarationTenants(data, tenant string) []string {
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &as3Config); err == nil {
+		adc, _ := as3Config["declaration"].(map[string]interface{})
+		if _, ok := adc[as3CommonTenant]; ok && tenant != as3CommonTenant {
+			return []string{as3CommonTenant, tenant}
+		}
+	}
+	return []string{tenant}
+}
+
+// preserveCommonSharedObjects returns the declaration along with the objects of /Common/Shared on BIG-IP
+// which are not managed by CIS, as AS3 removes the objects left out of a declared application
+func (postMgr *PostManager) preserveCommonSharedObjects(data string) (string, error) {
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &as3Config); err != nil {
+		return data, nil
+	}
+	adc, _ := as3Config["declaration"].(map[string]interface{})
+	if _, ok := adc[as3CommonTenant]; !ok {
+		return data, nil
+	}
+
+	responseMap, err := postMgr.getDeclaration(postMgr.getAS3APIURL([]string{as3CommonTenant}))
+	if err != nil {
+		return "", err
+	}
+	if !mergeCommonSharedObjects(adc, responseMap) {
+		return data, nil
+	}
+	decl, err := json.Marshal(as3Config)
+	if err != nil {
+		return "", err
+	}
+	return string(decl), nil
+}
+
+// mergeCommonSharedObjects adds the objects of /Common/Shared in the current declaration to the ADC,
+// except the GSLB servers managed by CIS, and returns true when any object is added
+func mergeCommonSharedObjects(adc, current map[string]interface{}) bool {
+	tenant, _ := adc[as3CommonTenant].(map[string]interface{})
+	app, _ := tenant[as3SharedApplication].(map[string]interface{})
+	currentTenant, _ := current[as3CommonTenant].(map[string]interface{})
+	currentApp, _ := currentTenant[as3SharedApplication].(map[string]interface{})
+	if app == nil {
+		return false
+	}
+
+	merged := false
+	for name, obj := range currentApp {
+		if _, ok := obj.(map[string]interface{}); !ok || strings.HasPrefix(name, gslbServerPrefix) {
+			continue
+		}
+		if _, ok := app[name]; !ok {
+			app[name] = obj
+			merged = true
+		}
+	}
+	return merged
+}
+
+// getTenantDeclarations splits the AS3 declaration into one declaration per tenant
+// staleTenants which are no longer part of the declaration are declared empty, so that they get removed
+// Each tenant is labeled with the given label, if any
+// Common tenant is not declared on its own, but along with each tenant, as the tenants refer to its objects
+// and AS3 processes it ahead of the other tenants of a declaration
+func getTenantDeclarations(data string, staleTenants []string, label string) map[string]string {
+	tenantDecls := make(map[string]string)
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &as3Config); err != nil {
+		log.Errorf("[AS3] Failed to split the declaration into tenants: %v", err)
+		return tenantDecls
+	}
+	adc, ok := as3Config["declaration"].(map[string]interface{})
+	if !ok {
+		return tenantDecls
 	}
+
+	tenants := make(map[string]interface{})
+	for name, obj := range adc {
+		if tenant, ok := obj.(map[string]interface{}); ok && tenant["class"] == "Tenant" {
+			tenants[name] = tenant
+			delete(adc, name)
+		}
+	}
+	common, hasCommon := tenants[as3CommonTenant]
+	delete(tenants, as3CommonTenant)
+	for _, name := range staleTenants {
+		if _, ok := tenants[name]; !ok {
+			tenants[name] = map[string]interface{}{"class": "Tenant"}
+		}
+	}
+
+	for name, tenant := range tenants {
+		if label != "" {
+			tenant.(map[string]interface{})["label"] = label
+		}
+		adc[name] = tenant
+		if hasCommon {
+			adc[as3CommonTenant] = common
+		}
+		decl, err := json.Marshal(as3Config)
+		delete(adc, name)
+		if err != nil {
+			log.Errorf("[AS3] Failed to create the declaration of tenant %v: %v", name, err)
+			continue
+		}
+		tenantDecls[name] = string(decl)
+	}
+	return tenantDecls
+}
+
+// isDeclarationInSync compares the tenants of the declaration with the ones available on BIG-IP
+func (postMgr *PostManager) isDeclarationInSync(cfg *agentConfig) bool {
+	inSync, err := postMgr.compareDeclaration(cfg)
+	if err != nil {
+		log.Debugf("[AS3] Unable to compare the declaration with BIG-IP: %v", err)
+		return false
+	}
+	return inSync
+}
+
+// compareDeclaration semantically compares the tenants of the declaration with the ones available on BIG-IP
+func (postMgr *PostManager) compareDeclaration(cfg *agentConfig) (bool, error) {
+	var as3Config map[string]interface{}
+	if err := json.Unmarshal([]byte(cfg.data), &as3Config); err != nil {
+		return false, err
+	}
+	adc, ok := as3Config["declaration"].(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("no ADC class declaration found")
+	}
+
+	responseMap, err := postMgr.getDeclaration(cfg.as3APIURL)
+	if err != nil {
+		return false, err
+	}
+
+	mergeCommonSharedObjects(adc, responseMap)
+	tenants := 0
+	for name, obj := range adc {
+		tenant, ok := obj.(map[string]interface{})
+		if !ok || tenant["class"] != "Tenant" {
+			continue
+		}
+		tenants++
+		if !reflect.DeepEqual(tenant, responseMap[name]) {
+			return false, nil
+		}
+	}
+	return tenants > 0, nil
+}
+
+// getDeclaration fetches the declaration available on BIG-IP
+// An empty declaration is returned when BIG-IP has no declaration for the tenants
+func (postMgr *PostManager) getDeclaration(as3APIURL string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", as3APIURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := postMgr.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return map[string]interface{}{}, nil
+	default:
+		return nil, fmt.Errorf("response from BIG-IP with status code %v", httpResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var response map[string]interface{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
 func (postMgr *PostManager) postOnEventOrTimeout(timeout time.Duration, cfg *agentConfig) (*agentConfig, bool) {
 	select {
-	case newCfg := <-postMgr.postChan:
+	case newCfg := <-postMgr.getTenantChan(cfg.tenant):
 		return postMgr.postConfig(&newCfg)
 	case <-time.After(timeout):
 		return postMgr.postConfig(cfg)
@@ -174,19 +678,32 @@ func (postMgr *PostManager) postOnEventOrTimeout(timeout time.Duration, cfg *age
 }
 
 func (postMgr *PostManager) postConfig(cfg *agentConfig) (*agentConfig, bool) {
-	httpReqBody := bytes.NewBuffer([]byte(cfg.data))
+	if cfg.tenant != "" {
+		// Active BIG-IP might have changed since the declaration was received
+		cfg.as3APIURL = postMgr.getAS3APIURL(getDeclarationTenants(cfg.data, cfg.tenant))
+	}
+	data, err := postMgr.preserveCommonSharedObjects(cfg.data)
+	if err != nil {
+		log.Errorf("[AS3] Unable to fetch /%v/%v from BIG-IP, not posting to avoid removing its objects: %v",
+			as3CommonTenant, as3SharedApplication, err)
+		return cfg, false
+	}
+	httpReqBody := bytes.NewBuffer([]byte(data))
 	req, err := http.NewRequest("POST", cfg.as3APIURL, httpReqBody)
 	if err != nil {
 		log.Errorf("[AS3] Creating new HTTP request error: %v ", err)
 		return cfg, false
 	}
 	log.Debugf("[AS3] posting request to %v", cfg.as3APIURL)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
+	bigIPPrometheus.AS3DeclarationSize.WithLabelValues(cfg.tenant).Observe(float64(len(cfg.data)))
+	start := time.Now()
 	httpResp, responseMap := postMgr.httpPOST(req)
+	bigIPPrometheus.AS3PostDuration.WithLabelValues(cfg.tenant).Observe(time.Since(start).Seconds())
 	if httpResp == nil || responseMap == nil {
+		bigIPPrometheus.AS3PostCount.WithLabelValues(cfg.tenant, "error").Inc()
 		return cfg, false
 	}
+	bigIPPrometheus.AS3PostCount.WithLabelValues(cfg.tenant, strconv.Itoa(httpResp.StatusCode)).Inc()
 
 	switch httpResp.StatusCode {
 	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
@@ -234,6 +751,10 @@ func (postMgr *PostManager) handleResponseStatusOK(responseMap map[string]interf
 		log.Debugf("[AS3] Response from BIG-IP: code: %v --- tenant:%v --- message: %v", v["code"], v["tenant"], v["message"])
 	}
 
+	cfg.errMessage = getErrorMessage(responseMap, cfg.tenant)
+	if cfg.errMessage == "" {
+		bigIPPrometheus.SetLastSuccessfulPost()
+	}
 	return cfg, true
 }
 
@@ -253,6 +774,10 @@ func (postMgr *PostManager) handleResponseStatusNotFound(responseMap map[string]
 	if postMgr.LogResponse {
 		log.Errorf("[AS3] Raw response from Big-IP: %v ", responseMap)
 	}
+	cfg.errMessage = getErrorMessage(responseMap, cfg.tenant)
+	if cfg.errMessage == "" {
+		cfg.errMessage = fmt.Sprintf("Big-IP responded with code: %v", http.StatusNotFound)
+	}
 	return cfg, true
 }
 
@@ -272,24 +797,78 @@ func (postMgr *PostManager) handleResponseOthers(responseMap map[string]interfac
 	if postMgr.LogResponse {
 		log.Errorf("[AS3] Raw response from Big-IP: %v ", responseMap)
 	}
+	// Report the failure right away, as the declaration is retried until BIG-IP accepts it
+	cfg.errMessage = getErrorMessage(responseMap, cfg.tenant)
+	if cfg.errMessage == "" {
+		cfg.errMessage = fmt.Sprintf("Big-IP responded with code: %v", responseMap["code"])
+	}
+	postMgr.sendResponse(cfg.response())
 	return postMgr.postOnEventOrTimeout(timeoutMedium, cfg)
 }
 
+// getErrorMessage returns the error reported by BIG-IP for the tenant in the AS3 response
+// An empty message is returned when BIG-IP accepted the declaration of the tenant
+func getErrorMessage(responseMap map[string]interface{}, tenant string) string {
+	if results, ok := (responseMap["results"]).([]interface{}); ok {
+		for _, value := range results {
+			v, ok := value.(map[string]interface{})
+			if !ok || v["tenant"] != tenant {
+				continue
+			}
+			if code, ok := v["code"].(float64); ok && int(code) == http.StatusOK {
+				return ""
+			}
+			return formatErrorMessage(v)
+		}
+		if code, ok := responseMap["code"].(float64); !ok || int(code) == http.StatusOK {
+			return ""
+		}
+	}
+	if err, ok := (responseMap["error"]).(map[string]interface{}); ok {
+		return formatErrorMessage(err)
+	}
+	if responseMap["message"] == nil && responseMap["errors"] == nil {
+		return ""
+	}
+	return formatErrorMessage(responseMap)
+}
+
+func formatErrorMessage(v map[string]interface{}) string {
+	message := fmt.Sprintf("code: %v, message: %v", v["code"], v["message"])
+	if errs, ok := v["errors"].([]interface{}); ok && len(errs) > 0 {
+		var errMsgs []string
+		for _, err := range errs {
+			errMsgs = append(errMsgs, fmt.Sprintf("%v", err))
+		}
+		message += ", errors: " + strings.Join(errMsgs, "; ")
+	} else if response, ok := v["response"]; ok {
+		message += fmt.Sprintf(", response: %v", response)
+	}
+	return message
+}
+
 // GetBigipAS3Version ...
 func (postMgr *PostManager) GetBigipAS3Version() error {
-	url := postMgr.getAS3VersionURL()
-	req, err := http.NewRequest("GET", url, nil)
+	log.Infof("Posting GET BIGIP AS3 Version request on %v", postMgr.getAS3VersionURL())
+	version, err := postMgr.getBigipAS3Version(context.Background())
 	if err != nil {
-		log.Errorf("Creating new HTTP request error: %v ", err)
 		return err
 	}
+	log.Infof("BIGIP is serving with AS3 version : %v ", version)
+	return nil
+}
 
-	log.Infof("Posting GET BIGIP AS3 Version request on %v", url)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
+// getBigipAS3Version fetches the AS3 version served by BIG-IP, the request is cancelled along with ctx
+func (postMgr *PostManager) getBigipAS3Version(ctx context.Context) (string, error) {
+	url := postMgr.getAS3VersionURL()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		log.Errorf("Creating new HTTP request error: %v ", err)
+		return "", err
+	}
 	httpResp, responseMap := postMgr.httpReq(req)
 	if httpResp == nil || responseMap == nil {
-		return fmt.Errorf("Internal Error")
+		return "", fmt.Errorf("Internal Error")
 	}
 
 	switch httpResp.StatusCode {
@@ -297,16 +876,15 @@ func (postMgr *PostManager) GetBigipAS3Version() error {
 		if responseMap["version"] != nil {
 			as3VersionStr := responseMap["version"].(string)
 			as3versionreleaseStr := responseMap["release"].(string)
-			log.Infof("BIGIP is serving with AS3 version : %v ", as3VersionStr+"-"+as3versionreleaseStr)
-			return nil
+			return as3VersionStr + "-" + as3versionreleaseStr, nil
 		}
 	case http.StatusNotFound:
 		if int(responseMap["code"].(float64)) == http.StatusNotFound {
-			return fmt.Errorf("AS3 RPM is not installed on BIGIP,"+
+			return "", fmt.Errorf("AS3 RPM is not installed on BIGIP,"+
 				" Error response from BIGIP with status code %v", httpResp.StatusCode)
 		}
 	}
-	return fmt.Errorf("Error response from BIGIP with status code %v", httpResp.StatusCode)
+	return "", fmt.Errorf("Error response from BIGIP with status code %v", httpResp.StatusCode)
 }
 
 // GetBigipRegKey ...
@@ -319,8 +897,6 @@ func (postMgr *PostManager) GetBigipRegKey() (string, error) {
 	}
 
 	log.Debugf("Posting GET BIGIP Reg Key request on %v", url)
-	req.SetBasicAuth(postMgr.BIGIPUsername, postMgr.BIGIPPassword)
-
 	httpResp, responseMap := postMgr.httpReq(req)
 	if httpResp == nil || responseMap == nil {
 		return "", fmt.Errorf("Internal Error")
@@ -341,6 +917,59 @@ func (postMgr *PostManager) GetBigipRegKey() (string, error) {
 	return "", fmt.Errorf("Error response from BIGIP with status code %v", httpResp.StatusCode)
 }
 
+// poolMemberStats maps to the statistics of the members of a BIG-IP pool
+type poolMemberStats struct {
+	Entries map[string]struct {
+		NestedStats struct {
+			Entries map[string]struct {
+				Value       int64  `json:"value"`
+				Description string `json:"description"`
+			} `json:"entries"`
+		} `json:"nestedStats"`
+	} `json:"entries"`
+}
+
+// GetPoolMemberConnections returns the current server side connections of the members of the pool,
+// by address and port of the member
+func (postMgr *PostManager) GetPoolMemberConnections(partition, application, pool string) (map[string]int64, error) {
+	url := postMgr.getPoolMemberStatsURL(partition, application, pool)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		log.Errorf("Creating new HTTP request error: %v ", err)
+		return nil, err
+	}
+
+	log.Debugf("Posting GET BIGIP Pool Member Stats request on %v", url)
+	httpResp, err := postMgr.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error response from BIGIP with status code %v", httpResp.StatusCode)
+	}
+	var stats poolMemberStats
+	if err = json.NewDecoder(httpResp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("Response body unmarshal failed: %v", err)
+	}
+
+	conns := make(map[string]int64)
+	for _, entry := range stats.Entries {
+		memberStats := entry.NestedStats.Entries
+		// Address of the member is reported with its route domain
+		addr := strings.Split(memberStats["addr"].Description, "%")[0]
+		key := fmt.Sprintf("%s:%d", addr, memberStats["port"].Value)
+		conns[key] = memberStats["serverside.curConns"].Value
+	}
+	return conns, nil
+}
+
+func (postMgr *PostManager) getPoolMemberStatsURL(partition, application, pool string) string {
+	apiURL := fmt.Sprintf("%s/mgmt/tm/ltm/pool/~%s~%s~%s/members/stats",
+		postMgr.getBIGIPURL(), partition, application, pool)
+	return apiURL
+}
+
 func (postMgr *PostManager) httpReq(request *http.Request) (*http.Response, map[string]interface{}) {
 	httpResp, err := postMgr.httpClient.Do(request)
 	if err != nil {
@@ -367,13 +996,13 @@ func (postMgr *PostManager) httpReq(request *http.Request) (*http.Response, map[
 }
 
 func (postMgr *PostManager) getAS3VersionURL() string {
-	apiURL := postMgr.BIGIPURL + "/mgmt/shared/appsvcs/info"
+	apiURL := postMgr.getBIGIPURL() + "/mgmt/shared/appsvcs/info"
 	return apiURL
 
 }
 
 func (postMgr *PostManager) getBigipRegKeyURL() string {
-	apiURL := postMgr.BIGIPURL + "/mgmt/tm/shared/licensing/registration"
+	apiURL := postMgr.getBIGIPURL() + "/mgmt/tm/shared/licensing/registration"
 	return apiURL
 
 }
@@ -1,8 +1,11 @@
 package crmanager
 
 import (
+	"fmt"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
 )
 
@@ -64,6 +67,91 @@ var _ = Describe("PostManager Tests", func() {
 			_, ok := mockPM.postOnEventOrTimeout(0, &agentConfig{})
 			Expect(ok).To(BeTrue(), "Posting Failed")
 		})
+
+		It("Report results of the tenant", func() {
+			mockPM.respChan = make(chan agentResponse, 1)
+			mockPM.setResponses([]int{http.StatusOK}, "", http.MethodPost)
+			cfg, ok := mockPM.postOnEventOrTimeout(0, &agentConfig{tenant: "none", id: 1})
+			Expect(ok).To(BeTrue(), "Posting Failed")
+			Expect(cfg.response().programmed).To(BeTrue(), "Tenant should be programmed")
+
+			mockPM.setResponses([]int{http.StatusNotFound}, "", http.MethodPost)
+			cfg, _ = mockPM.postOnEventOrTimeout(0, &agentConfig{tenant: "none", id: 2})
+			Expect(cfg.response().programmed).To(BeFalse(), "Tenant should not be programmed")
+
+			// Rejected declaration is retried with the latest declaration of the tenant
+			mockPM.tenantChans["none"] = make(chan agentConfig, 1)
+			mockPM.tenantChans["none"] <- agentConfig{tenant: "none", id: 4}
+			mockPM.setResponses([]int{http.StatusUnprocessableEntity, http.StatusOK}, "", http.MethodPost)
+			cfg, ok = mockPM.postConfig(&agentConfig{tenant: "none", id: 3})
+			Expect(ok).To(BeTrue(), "Posting Failed")
+			Expect(cfg.id).To(Equal(4))
+			resp := <-mockPM.respChan
+			Expect(resp.programmed).To(BeFalse(), "Rejected declaration should be reported before retrying")
+			Expect(resp.id).To(Equal(3))
+		})
+		It("Report metrics of the post", func() {
+			// metricValue returns the value of the counter or gauge, or the sample count of the histogram,
+			// gathered from the collector with the given labels
+			metricValue := func(c prometheus.Collector, labels map[string]string) float64 {
+				registry := prometheus.NewRegistry()
+				Expect(registry.Register(c)).To(BeNil())
+				families, err := registry.Gather()
+				Expect(err).To(BeNil())
+				for _, family := range families {
+					for _, m := range family.GetMetric() {
+						matched := true
+						for _, label := range m.GetLabel() {
+							matched = matched && labels[label.GetName()] == label.GetValue()
+						}
+						switch {
+						case !matched:
+						case m.Counter != nil:
+							return m.GetCounter().GetValue()
+						case m.Gauge != nil:
+							return m.GetGauge().GetValue()
+						case m.Histogram != nil:
+							return float64(m.GetHistogram().GetSampleCount())
+						}
+					}
+				}
+				Fail(fmt.Sprintf("No metric found with labels %v", labels))
+				return 0
+			}
+			mockPM.setResponses([]int{http.StatusOK}, "", http.MethodPost)
+			_, ok := mockPM.postConfig(&agentConfig{tenant: "none", data: "{}"})
+			Expect(ok).To(BeTrue())
+			Expect(metricValue(bigIPPrometheus.AS3PostCount, map[string]string{"tenant": "none", "status": "200"})).
+				To(BeNumerically(">=", 1))
+			Expect(metricValue(bigIPPrometheus.LastSuccessfulPost, nil)).To(BeNumerically("<", 5))
+			Expect(metricValue(bigIPPrometheus.AS3DeclarationSize, map[string]string{"tenant": "none"})).
+				To(BeNumerically(">=", 1))
+
+			mockPM.setResponses([]int{http.StatusNotFound}, "", http.MethodPost)
+			_, _ = mockPM.postConfig(&agentConfig{tenant: "metrics"})
+			Expect(metricValue(bigIPPrometheus.AS3PostCount, map[string]string{"tenant": "metrics", "status": "404"})).
+				To(BeEquivalentTo(1))
+		})
+	})
+
+	It("Error message of the tenant", func() {
+		response := map[string]interface{}{
+			"results": []interface{}{
+				map[string]interface{}{"code": float64(200), "tenant": "test", "message": "success"},
+				map[string]interface{}{"code": float64(422), "tenant": "test2", "message": "declaration failed",
+					"response": "invalid pool"},
+			},
+		}
+		Expect(getErrorMessage(response, "test")).To(BeEmpty())
+		Expect(getErrorMessage(response, "test2")).To(ContainSubstring("invalid pool"))
+
+		response = map[string]interface{}{
+			"code":    float64(422),
+			"message": "declaration is invalid",
+			"errors":  []interface{}{"/test/app: should have required property 'class'"},
+		}
+		Expect(getErrorMessage(response, "test")).To(
+			Equal("code: 422, message: declaration is invalid, errors: /test/app: should have required property 'class'"))
 	})
 
 	Describe("BIGIP AS3 Version", func() {
@@ -97,4 +185,255 @@ var _ = Describe("PostManager Tests", func() {
 			Expect(err).NotTo(BeNil(), "Failed Validation while get BIG-IP AS3 Version")
 		})
 	})
+
+	It("Split Declaration into Tenants", func() {
+		decl := `{"class":"AS3","declaration":{"class":"ADC","controls":{"class":"Controls"},` +
+			`"team1":{"class":"Tenant"},"team2":{"class":"Tenant","Shared":{"class":"Application"}}}}`
+		tenantDecls := getTenantDeclarations(decl, []string{"team2", "team3"}, "")
+		Expect(tenantDecls).To(HaveLen(3), "Failed to split the declaration")
+		Expect(tenantDecls["team1"]).To(Equal(
+			`{"class":"AS3","declaration":{"class":"ADC","controls":{"class":"Controls"},"team1":{"class":"Tenant"}}}`))
+		Expect(tenantDecls["team2"]).To(ContainSubstring(`"Shared"`))
+		Expect(tenantDecls["team3"]).To(Equal(
+			`{"class":"AS3","declaration":{"class":"ADC","controls":{"class":"Controls"},"team3":{"class":"Tenant"}}}`),
+			"Stale tenant should be declared empty")
+	})
+
+	It("Declare Common tenant along with each tenant", func() {
+		decl := `{"class":"AS3","declaration":{"class":"ADC","test_gtm":{"class":"Tenant"},` +
+			`"Common":{"class":"Tenant","Shared":{"class":"Application"}}}}`
+		tenantDecls := getTenantDeclarations(decl, nil, "CIS:test_gtm")
+		Expect(tenantDecls).To(HaveLen(1), "Common tenant should not be declared on its own")
+		Expect(tenantDecls["test_gtm"]).To(Equal(`{"class":"AS3","declaration":{` +
+			`"Common":{"Shared":{"class":"Application"},"class":"Tenant"},"class":"ADC",` +
+			`"test_gtm":{"class":"Tenant","label":"CIS:test_gtm"}}}`))
+		Expect(getDeclarationTenants(tenantDecls["test_gtm"], "test_gtm")).To(Equal([]string{"Common", "test_gtm"}))
+		Expect(getDeclarationTenants(decl, "Common")).To(Equal([]string{"Common"}))
+		Expect(getDeclarationTenants(`{"class":"AS3"}`, "team1")).To(Equal([]string{"team1"}))
+	})
+
+	It("Preserve the objects of /Common/Shared not managed by CIS", func() {
+		mockPM.BIGIPURL = "bigip.com"
+		decl := `{"class":"AS3","declaration":{"class":"ADC","test_gtm":{"class":"Tenant"},` +
+			`"Common":{"class":"Tenant","Shared":{"class":"Application","template":"shared",` +
+			`"gslb_server_10_1_1_1":{"class":"GSLB_Server"}}}}}`
+		mockPM.setResponses([]int{http.StatusOK}, `{"class":"ADC","Common":{"class":"Tenant",`+
+			`"Shared":{"class":"Application","template":"shared","gslb_server_10_2_2_2":{"class":"GSLB_Server"},`+
+			`"dc_monitor":{"class":"GSLB_Monitor"}}}}`, http.MethodGet)
+		data, err := mockPM.preserveCommonSharedObjects(decl)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(`{"class":"AS3","declaration":{"Common":{"Shared":{"class":"Application",`+
+			`"dc_monitor":{"class":"GSLB_Monitor"},"gslb_server_10_1_1_1":{"class":"GSLB_Server"},`+
+			`"template":"shared"},"class":"Tenant"},"class":"ADC","test_gtm":{"class":"Tenant"}}}`),
+			"Unmanaged objects should be preserved and the removed GSLB servers left out")
+
+		mockPM.setResponses([]int{http.StatusOK}, `{"class":"ADC","Common":{"class":"Tenant",`+
+			`"Shared":{"class":"Application","template":"shared"}}}`, http.MethodGet)
+		data, err = mockPM.preserveCommonSharedObjects(decl)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(decl), "Declaration should be unchanged without unmanaged objects")
+
+		noCommon := `{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant"}}}`
+		mockPM.setResponses([]int{http.StatusServiceUnavailable}, `{"code":503}`, http.MethodGet)
+		data, err = mockPM.preserveCommonSharedObjects(noCommon)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(Equal(noCommon), "Declaration without Common should not be fetched")
+		_, err = mockPM.preserveCommonSharedObjects(decl)
+		Expect(err).To(HaveOccurred(), "Declaration should not be posted when /Common/Shared is unknown")
+	})
+
+	It("Send responses without blocking the tenant workers", func() {
+		mockPM.respChan = make(chan agentResponse)
+		mockPM.sendResponse(agentResponse{id: 1, tenant: "team1", message: "failed"})
+		mockPM.sendResponse(agentResponse{id: 1, tenant: "team2", programmed: true})
+		mockPM.sendResponse(agentResponse{id: 2, tenant: "team1", programmed: true})
+
+		latest := make(map[string]agentResponse)
+		for len(latest) < 2 || latest["team1"].id != 2 {
+			var resp agentResponse
+			Eventually(mockPM.respChan).Should(Receive(&resp))
+			latest[resp.tenant] = resp
+		}
+		Expect(latest["team1"]).To(Equal(agentResponse{id: 2, tenant: "team1", programmed: true}),
+			"Latest response of the tenant should be sent")
+		Expect(latest["team2"].programmed).To(BeTrue())
+		Consistently(mockPM.respChan, "100ms").ShouldNot(Receive())
+	})
+
+	It("Label the tenants", func() {
+		decl := `{"class":"AS3","declaration":{"class":"ADC","team1":{"class":"Tenant"}}}`
+		tenantDecls := getTenantDeclarations(decl, []string{"team2"}, "CIS:test")
+		Expect(tenantDecls["team1"]).To(Equal(
+			`{"class":"AS3","declaration":{"class":"ADC","team1":{"class":"Tenant","label":"CIS:test"}}}`))
+		Expect(tenantDecls["team2"]).To(Equal(
+			`{"class":"AS3","declaration":{"class":"ADC","team2":{"class":"Tenant","label":"CIS:test"}}}`))
+	})
+
+	Describe("Tenant Removal", func() {
+		BeforeEach(func() {
+			mockPM.BIGIPURL = "bigip.com"
+			mockPM.leader = true
+			mockPM.TenantLabel = "CIS:test"
+		})
+
+		It("Find the tenants declared before restart", func() {
+			mockPM.setResponses([]int{http.StatusOK}, `{"class":"ADC","team1":{"class":"Tenant","label":"CIS:test"},`+
+				`"team2":{"class":"Tenant","label":"CIS:other"},"team3":{"class":"Tenant"}}`, http.MethodGet)
+			tenants, err := mockPM.getLabeledTenants()
+			Expect(err).To(BeNil())
+			Expect(tenants).To(Equal([]string{"team1"}), "Only the tenants labeled by this controller should be found")
+
+			mockPM.setResponses([]int{http.StatusServiceUnavailable}, `{"code":503}`, http.MethodGet)
+			_, err = mockPM.getLabeledTenants()
+			Expect(err).NotTo(BeNil())
+		})
+
+		It("Forget the tenant removed from BIG-IP", func() {
+			mockPM.respChan = make(chan agentResponse, 1)
+			mockPM.setResponses([]int{http.StatusOK}, "", http.MethodPost)
+			tenantChan := make(chan agentConfig, 1)
+			mockPM.tenantChans["test"] = tenantChan
+			done := make(chan struct{})
+			go func() {
+				mockPM.tenantConfigWorker(tenantChan)
+				close(done)
+			}()
+			tenantChan <- agentConfig{
+				data:      `{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant","label":"CIS:test"}}}`,
+				as3APIURL: mockPM.getAS3APIURL([]string{"test"}),
+				id:        1,
+				tenant:    "test",
+			}
+			Eventually(mockPM.respChan).Should(Receive())
+			Eventually(done).Should(BeClosed(), "Worker of the removed tenant should exit")
+			Expect(mockPM.getTenantChan("test")).To(BeNil())
+			_, posted := mockPM.getPostedDecl("test")
+			Expect(posted).To(BeFalse())
+		})
+
+		It("Keep the tenant declared again", func() {
+			tenantChan := make(chan agentConfig, 1)
+			mockPM.tenantChans["test"] = tenantChan
+			tenantChan <- agentConfig{tenant: "test"}
+			Expect(mockPM.removeTenant(tenantChan, "test")).To(BeFalse(), "Tenant with a newer declaration should be kept")
+			<-tenantChan
+			Expect(mockPM.removeTenant(make(chan agentConfig, 1), "test")).To(BeFalse())
+			Expect(mockPM.removeTenant(tenantChan, "test")).To(BeTrue())
+		})
+	})
+
+	Describe("Leader Election", func() {
+		var agentCfg agentConfig
+		BeforeEach(func() {
+			mockPM.BIGIPURL = "bigip.com"
+			mockPM.BIGIPUsername = "user"
+			mockPM.BIGIPPassword = "pswd"
+			agentCfg = agentConfig{
+				data:      `{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant","Shared":{"class":"Application"}}}}`,
+				as3APIURL: mockPM.getAS3APIURL([]string{"test"}),
+				id:        1,
+			}
+		})
+
+		It("Promote and Demote", func() {
+			Expect(mockPM.IsLeader()).To(BeFalse(), "Replica should start as standby")
+			mockPM.SetLeader(true)
+			Expect(mockPM.IsLeader()).To(BeTrue(), "Replica should be promoted")
+			mockPM.SetLeader(false)
+			Expect(mockPM.IsLeader()).To(BeFalse(), "Replica should be demoted")
+		})
+
+		It("Post the held declaration on acquiring leadership", func() {
+			mockPM.leaderChan = make(chan struct{})
+			mockPM.respChan = make(chan agentResponse, 1)
+			mockPM.setResponses([]int{http.StatusOK}, "", http.MethodPost)
+			agent := &Agent{PostManager: mockPM.PostManager}
+			agentCfg.tenant = "test"
+			tenantChan := make(chan agentConfig, 1)
+			defer close(tenantChan)
+			go mockPM.tenantConfigWorker(tenantChan)
+			tenantChan <- agentCfg
+			Consistently(mockPM.respChan, "200ms").ShouldNot(Receive(), "Standby should hold the declaration")
+
+			agent.OnStartedLeading()
+			var resp agentResponse
+			Eventually(mockPM.respChan).Should(Receive(&resp), "Leader should post the held declaration")
+			Expect(resp).To(Equal(agentResponse{id: 1, tenant: "test", programmed: true}))
+			_, posted := mockPM.getPostedDecl("test")
+			Expect(posted).To(BeTrue())
+		})
+
+		It("Declaration in sync with BIG-IP", func() {
+			mockPM.setResponses([]int{http.StatusOK},
+				`{"class":"ADC","id":"x","test":{"class":"Tenant","Shared":{"class":"Application"}}}`, http.MethodGet)
+			Expect(mockPM.isDeclarationInSync(&agentCfg)).To(BeTrue(), "Declaration should be in sync")
+		})
+
+		It("Declaration out of sync with BIG-IP", func() {
+			mockPM.setResponses([]int{http.StatusOK},
+				`{"class":"ADC","test":{"class":"Tenant"}}`, http.MethodGet)
+			Expect(mockPM.isDeclarationInSync(&agentCfg)).To(BeFalse(), "Declaration should not be in sync")
+
+			mockPM.setResponses([]int{http.StatusNotFound}, `{"code":404}`, http.MethodGet)
+			Expect(mockPM.isDeclarationInSync(&agentCfg)).To(BeFalse(), "Declaration should not be in sync")
+		})
+	})
+
+	Describe("Configuration Drift", func() {
+		var agentCfg agentConfig
+		BeforeEach(func() {
+			mockPM.BIGIPURL = "bigip.com"
+			mockPM.leader = true
+			mockPM.DriftRepost = false
+			agentCfg = agentConfig{
+				data:      `{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant","Shared":{"class":"Application"}}}}`,
+				as3APIURL: mockPM.getAS3APIURL([]string{"test"}),
+				id:        1,
+				tenant:    "test",
+			}
+			mockPM.setPostedDecl(agentCfg)
+		})
+
+		It("Tenant in sync with BIG-IP", func() {
+			mockPM.setResponses([]int{http.StatusOK},
+				`{"class":"ADC","test":{"class":"Tenant","Shared":{"class":"Application"}}}`, http.MethodGet)
+			Expect(mockPM.checkDrift(agentCfg, false)).To(BeFalse(), "Tenant should be in sync")
+		})
+
+		It("Tenant deleted on BIG-IP", func() {
+			mockPM.driftChan = make(chan string, 1)
+			mockPM.setResponses([]int{http.StatusNoContent}, " ", http.MethodGet)
+			Expect(mockPM.checkDrift(agentCfg, false)).To(BeTrue(), "Tenant should have drifted")
+			Expect(<-mockPM.driftChan).To(Equal("test"), "Drifted tenant should be reported")
+		})
+
+		It("Drift reported only once", func() {
+			mockPM.driftChan = make(chan string, 1)
+			mockPM.setResponses([]int{http.StatusOK}, `{"class":"ADC","test":{"class":"Tenant"}}`, http.MethodGet)
+			Expect(mockPM.checkDrift(agentCfg, true)).To(BeTrue(), "Tenant should have drifted")
+			Expect(mockPM.driftChan).To(BeEmpty(), "Drift should be reported only once")
+		})
+
+		It("BIG-IP unavailable", func() {
+			mockPM.setResponses([]int{http.StatusServiceUnavailable}, `{"code":503}`, http.MethodGet)
+			Expect(mockPM.checkDrift(agentCfg, false)).To(BeFalse(), "Drift should not be decided without a valid response")
+		})
+
+		It("Re-post drifted tenant", func() {
+			mockPM.DriftRepost = true
+			mockPM.postChan = make(chan agentConfig, 1)
+			mockPM.tenantChans["test"] = mockPM.postChan
+			mockPM.setResponses([]int{http.StatusOK}, `{"class":"ADC","test":{"class":"Tenant"}}`, http.MethodGet)
+			Expect(mockPM.checkDrift(agentCfg, true)).To(BeTrue(), "Tenant should have drifted")
+			_, posted := mockPM.getPostedDecl("test")
+			Expect(posted).To(BeFalse(), "Posted declaration should be cleared to re-post")
+			Expect(<-mockPM.postChan).To(Equal(agentCfg), "Declaration should be re-posted")
+		})
+
+		It("Skip empty tenants", func() {
+			Expect(isEmptyTenantDeclaration(agentCfg)).To(BeFalse())
+			agentCfg.data = `{"class":"AS3","declaration":{"class":"ADC","test":{"class":"Tenant"}}}`
+			Expect(isEmptyTenantDeclaration(agentCfg)).To(BeTrue())
+		})
+	})
 })
@@ -1,8 +1,13 @@
 package crmanager
 
 import (
+	"context"
 	"fmt"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // Creates a new ClientSSL profile from a Secret
@@ -142,3 +147,50 @@ func (crMgr *CRManager) createSecretServerSSLProfile(
 	rsCfg.Virtual.AddOrUpdateProfile(profRef)
 	return nil, false
 }
+
+// Returns the key of a Secret in SSLContext
+func getSSLContextKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Returns the Secret from SSLContext, or fetches it from the Secret informer and saves it in SSLContext.
+// Secret is fetched from API server when its namespace is not watched.
+func (crMgr *CRManager) getSecret(namespace, name string) (*v1.Secret, error) {
+	key := getSSLContextKey(namespace, name)
+	if secret, ok := crMgr.SSLContext[key]; ok {
+		log.Debugf("Secret %s is already available with CIS in SSLContext", key)
+		return secret, nil
+	}
+	var secret *v1.Secret
+	if crInf, ok := crMgr.getNamespacedInformer(namespace); ok && crInf.secretInformer != nil {
+		obj, found, err := crInf.secretInformer.GetIndexer().GetByKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, errors.NewNotFound(v1.Resource("secrets"), name)
+		}
+		secret = obj.(*v1.Secret)
+	} else {
+		var err error
+		secret, err = crMgr.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("Saving Secret %s into SSLContext", key)
+	crMgr.SSLContext[key] = secret
+	return secret, nil
+}
+
+// Updates SSLContext with the changed Secret, so that the profiles are created with the latest certificate
+func (crMgr *CRManager) updateSSLContext(secret *v1.Secret, isDelete bool) {
+	key := getSSLContextKey(secret.Namespace, secret.Name)
+	if isDelete {
+		delete(crMgr.SSLContext, key)
+		return
+	}
+	if _, ok := crMgr.SSLContext[key]; ok {
+		crMgr.SSLContext[key] = secret
+	}
+}
@@ -1,10 +1,12 @@
 package crmanager
 
 import (
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
 var _ = Describe("Profile", func() {
@@ -121,4 +123,38 @@ var _ = Describe("Profile", func() {
 
 	})
 
+	It("SSL Context", func() {
+		mockCRM.SSLContext = make(map[string]*v1.Secret)
+		mockCRM.namespaces = map[string]bool{"default": true, "test": true}
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		_ = mockCRM.addNamespacedInformer("default")
+		_ = mockCRM.addNamespacedInformer("test")
+
+		secret := test.NewSecret("SampleSecret", "default", "cert1", "key1")
+		otherSecret := test.NewSecret("SampleSecret", "test", "cert2", "key2")
+		_ = mockCRM.crInformers["default"].secretInformer.GetIndexer().Add(secret)
+		_ = mockCRM.crInformers["test"].secretInformer.GetIndexer().Add(otherSecret)
+
+		res, err := mockCRM.getSecret("default", "SampleSecret")
+		Expect(err).To(BeNil(), "Failed to get Secret")
+		Expect(res).To(Equal(secret))
+		res, err = mockCRM.getSecret("test", "SampleSecret")
+		Expect(err).To(BeNil(), "Failed to get Secret")
+		Expect(res).To(Equal(otherSecret), "Secrets with same name should not collide")
+		Expect(mockCRM.SSLContext).To(HaveLen(2))
+
+		_, err = mockCRM.getSecret("default", "Unknown")
+		Expect(err).NotTo(BeNil(), "Secret should not be found")
+
+		renewed := test.NewSecret("SampleSecret", "default", "cert3", "key3")
+		mockCRM.updateSSLContext(renewed, false)
+		res, _ = mockCRM.getSecret("default", "SampleSecret")
+		Expect(res).To(Equal(renewed), "SSLContext should be updated with renewed Secret")
+
+		mockCRM.updateSSLContext(renewed, true)
+		Expect(mockCRM.SSLContext).NotTo(HaveKey("default/SampleSecret"))
+	})
+
 })
@@ -19,16 +19,12 @@ package crmanager
 import (
 	"bufio"
 	"fmt"
-	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"net/http"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/F5Networks/k8s-bigip-ctlr/pkg/health"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
@@ -93,8 +89,11 @@ func createDriverCmd(
 	return cmd
 }
 
-func runBigIPDriver(pid chan<- int, cmd *exec.Cmd) {
+// runBigIPDriver runs the python driver until it exits, which is fatal unless stopCh is closed
+// exitCh is closed once the python driver exits
+func runBigIPDriver(pid chan<- int, cmd *exec.Cmd, stopCh <-chan struct{}, exitCh chan<- struct{}) {
 	defer close(pid)
+	defer close(exitCh)
 
 	// the config driver python logging goes to stderr by default
 	cmdOut, err := cmd.StderrPipe()
@@ -128,6 +127,12 @@ func runBigIPDriver(pid chan<- int, cmd *exec.Cmd) {
 	pid <- cmd.Process.Pid
 
 	err = cmd.Wait()
+	select {
+	case <-stopCh:
+		log.Infof("Stopped config driver sub-process at pid: %d", cmd.Process.Pid)
+		return
+	default:
+	}
 	var waitStatus syscall.WaitStatus
 	if exitError, ok := err.(*exec.ExitError); ok {
 		waitStatus = exitError.Sys().(syscall.WaitStatus)
@@ -171,18 +176,43 @@ func (agent *Agent) startPythonDriver(
 		agent.ConfigWriter.GetOutputFilename(),
 		pyCmd,
 	)
-	go runBigIPDriver(subPidCh, cmd)
+	agent.pythonDriver.global = global
+	agent.pythonDriver.bigIP = bigIP
+	agent.pythonDriver.pythonBaseDir = pythonBaseDir
+	agent.pythonDriver.stopCh = make(chan struct{})
+	agent.pythonDriver.exitCh = make(chan struct{})
+	go runBigIPDriver(subPidCh, cmd, agent.pythonDriver.stopCh, agent.pythonDriver.exitCh)
 
 	subPid := <-subPidCh
 	agent.PythonDriverPID = subPid
-	//Enable "/health" and "/metrics" endpoint with crmanager
-	go agent.healthCheckPythonDriver()
 
 	return
 }
 
+// restartPythonDriver restarts the python driver with the active BIG-IP, unless it is already configuring it,
+// as the python driver connects to BIG-IP only on start
+func (agent *Agent) restartPythonDriver() {
+	agent.pythonDriver.mutex.Lock()
+	defer agent.pythonDriver.mutex.Unlock()
+	bigIPURL := agent.getBIGIPURL()
+	if agent.PythonDriverPID == 0 || agent.pythonDriver.bigIP.BigIPURL == bigIPURL {
+		return
+	}
+	log.Infof("Restarting config driver to configure BIG-IP %v", bigIPURL)
+	agent.stopPythonDriver()
+	select {
+	case <-agent.pythonDriver.exitCh:
+	case <-time.After(timeoutMedium):
+		log.Warningf("Config driver did not exit in %v, starting a new one", timeoutMedium)
+	}
+	bigIP := agent.pythonDriver.bigIP
+	bigIP.BigIPURL = bigIPURL
+	agent.startPythonDriver(agent.pythonDriver.global, bigIP, gtmBigIPSection{}, agent.pythonDriver.pythonBaseDir)
+}
+
 func (agent *Agent) stopPythonDriver() {
 	if 0 != agent.PythonDriverPID {
+		close(agent.pythonDriver.stopCh)
 		var proc *os.Process
 		proc, err := os.FindProcess(agent.PythonDriverPID)
 		if nil != err {
@@ -192,17 +222,6 @@ func (agent *Agent) stopPythonDriver() {
 		if nil != err {
 			log.Warningf("Could not stop sub-process on exit: %d - %v", agent.PythonDriverPID, err)
 		}
+		agent.PythonDriverPID = 0
 	}
 }
-
-func (agent *Agent) healthCheckPythonDriver() {
-	// Expose Prometheus metrics
-	http.Handle("/metrics", promhttp.Handler())
-	// Add health check to track whether Python process still alive
-	hc := &health.HealthChecker{
-		SubPID: agent.PythonDriverPID,
-	}
-	http.Handle("/health", hc.HealthCheckHandler())
-	bigIPPrometheus.RegisterMetrics()
-	log.Fatal(http.ListenAndServe(agent.HttpAddress, nil).Error())
-}
@@ -1,10 +1,13 @@
 package crmanager
 
 import (
+	"os"
+	"os/exec"
+	"sync"
+
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
-	"sync"
 )
 
 var _ = Describe("Python Driver Tests", func() {
@@ -63,6 +66,20 @@ var _ = Describe("Python Driver Tests", func() {
 
 	})
 
+	It("Stop", func() {
+		pid := make(chan int)
+		stopCh := make(chan struct{})
+		exitCh := make(chan struct{})
+		go runBigIPDriver(pid, exec.Command("sleep", "10"), stopCh, exitCh)
+		proc, err := os.FindProcess(<-pid)
+		Expect(err).To(BeNil())
+
+		// Exit of the driver stopped by CIS is not fatal
+		close(stopCh)
+		Expect(proc.Signal(os.Interrupt)).To(BeNil())
+		Eventually(exitCh).Should(BeClosed())
+	})
+
 	It("Command", func() {
 		cmd := createDriverCmd("python", "bigipconfigdriver.py")
 		Expect(cmd).NotTo(BeNil(), "Failed to create Command")
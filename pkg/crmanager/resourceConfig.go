@@ -17,7 +17,6 @@
 package crmanager
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -26,8 +25,6 @@ import (
 	"strings"
 	"sync"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
 	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	v1 "k8s.io/api/core/v1"
@@ -118,6 +115,8 @@ const (
 	// Internal data group for https redirect
 	HttpsRedirectDgName = "https_redirect_dg"
 	TLSIRuleName        = "tls_irule"
+	// iRule selecting the weighted pools of ab deployment paths
+	AbDeploymentPathIRuleName = "ab_deployment_path_irule"
 )
 
 // constants for TLS references
@@ -169,6 +168,25 @@ func NewCustomProfiles() *CustomProfileStore {
 	return &cps
 }
 
+// getProfilesForResources returns the custom profiles referred by given resource configs
+func (cps *CustomProfileStore) getProfilesForResources(rsCfgs ResourceConfigs) *CustomProfileStore {
+	profiles := NewCustomProfiles()
+	if cps == nil {
+		return profiles
+	}
+	virtuals := make(map[string]bool)
+	for _, cfg := range rsCfgs {
+		virtuals[cfg.Virtual.Name] = true
+	}
+	for key, prof := range cps.Profs {
+		// Profiles with no resource name are shared (CA certificates)
+		if key.ResourceName == "" || virtuals[key.ResourceName] {
+			profiles.Profs[key] = prof
+		}
+	}
+	return profiles
+}
+
 func NewIRule(name, partition, code string) *IRule {
 	return &IRule{
 		Name:      name,
@@ -324,6 +342,72 @@ func formatMonitorName(namespace, svc string, monitorType string, port int32) st
 	return AS3NameFormatter(monitorName)
 }
 
+// Returns the port probed by the monitor, which is the container port of the pool unless given,
+// as the pool member port is the node port in nodeport mode
+func getMonitorTargetPort(mon cisapiv1.Monitor, servicePort int32) int32 {
+	if mon.TargetPort != 0 {
+		return mon.TargetPort
+	}
+	return servicePort
+}
+
+// Adds the monitors of the pool spec to the pool, referring to the existing BIG-IP monitors by path
+// and creating the others in the partition of the pool
+func (crMgr *CRManager) addPoolMonitors(
+	pool *Pool,
+	namespace string,
+	monitors []cisapiv1.Monitor,
+) []Monitor {
+	var poolMonitors []Monitor
+	for i, mon := range monitors {
+		if mon.Reference != "" {
+			pool.MonitorRefs = append(pool.MonitorRefs, mon.Reference)
+			continue
+		}
+		if mon.Type == "" {
+			log.Errorf("Either type or reference is required for monitor %v of pool %v", i, pool.Name)
+			continue
+		}
+		name := formatMonitorName(namespace, pool.ServiceName, mon.Type, pool.ServicePort)
+		// Monitors of the same type are told apart by their position
+		for _, monitorName := range pool.MonitorNames {
+			if monitorName == JoinBigipPath(pool.Partition, name) {
+				name = AS3NameFormatter(fmt.Sprintf("%s_%d", name, i))
+				break
+			}
+		}
+		monitor := Monitor{
+			Name:       name,
+			Partition:  pool.Partition,
+			Type:       mon.Type,
+			Interval:   mon.Interval,
+			Send:       mon.Send,
+			Recv:       mon.Recv,
+			Timeout:    mon.Timeout,
+			TargetPort: getMonitorTargetPort(mon, pool.ServicePort),
+			QueryName:  mon.QueryName,
+			QueryType:  mon.QueryType,
+			Base:       mon.Base,
+			Filter:     mon.Filter,
+			Pathname:   mon.Pathname,
+			Arguments:  mon.Arguments,
+		}
+		if mon.ClientCertificate != "" {
+			secret, err := crMgr.getSecret(namespace, mon.ClientCertificate)
+			if err != nil {
+				log.Errorf("Unable to get client certificate Secret %v of monitor %v: %v",
+					mon.ClientCertificate, name, err)
+			} else {
+				monitor.ClientCert = string(secret.Data["tls.crt"])
+				monitor.ClientKey = string(secret.Data["tls.key"])
+			}
+		}
+		pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(pool.Partition, name))
+		poolMonitors = append(poolMonitors, monitor)
+	}
+	return poolMonitors
+}
+
 // format the policy name for VirtualServer
 func formatPolicyName(hostname, hostGroup, name string) string {
 	host := hostname
@@ -353,44 +437,57 @@ func (crMgr *CRManager) prepareRSConfigFromVirtualServer(
 	var poolExist bool
 	var monitors []Monitor
 	for _, pl := range vs.Spec.Pools {
-		pool := Pool{
-			Name: formatVirtualServerPoolName(
-				vs.ObjectMeta.Namespace,
-				pl.Service,
-				pl.ServicePort,
-				pl.NodeMemberLabel,
-			),
-			Partition:       rsCfg.Virtual.Partition,
-			ServiceName:     pl.Service,
-			ServicePort:     pl.ServicePort,
-			NodeMemberLabel: pl.NodeMemberLabel,
-		}
-		for _, p := range pools {
-			if pool.Name == p.Name {
-				poolExist = true
-				break
+		// Alternate backends share the node member label and monitor of the pool
+		for _, backend := range getPoolBackends(pl) {
+			pool := Pool{
+				Name: formatVirtualServerPoolName(
+					vs.ObjectMeta.Namespace,
+					backend.service,
+					backend.servicePort,
+					pl.NodeMemberLabel,
+				),
+				Partition:       rsCfg.Virtual.Partition,
+				ServiceName:     backend.service,
+				ServicePort:     backend.servicePort,
+				NodeMemberLabel: pl.NodeMemberLabel,
+				DrainTimeout:    pl.DrainTimeout,
+				Balance:         pl.Balance,
+				SlowRampTime:    pl.SlowRampTime,
+				MinimumMonitors: pl.MinimumMonitors,
+				ReselectTries:   pl.ReselectTries,
+				ConnectionLimit: pl.ConnectionLimit,
+				RateLimit:       pl.RateLimit,
+				Ratio:           pl.Ratio,
+			}
+			for _, p := range pools {
+				if pool.Name == p.Name {
+					poolExist = true
+					break
+				}
+			}
+			if poolExist {
+				poolExist = false
+				continue
 			}
-		}
-		if poolExist {
-			poolExist = false
-			continue
-		}
 
-		if pl.Monitor.Send != "" && pl.Monitor.Type != "" {
-			pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(DEFAULT_PARTITION,
-				formatMonitorName(vs.ObjectMeta.Namespace, pl.Service, pl.Monitor.Type, pl.ServicePort)))
-			monitor := Monitor{
-				Name:      formatMonitorName(vs.ObjectMeta.Namespace, pl.Service, pl.Monitor.Type, pl.ServicePort),
-				Partition: rsCfg.Virtual.Partition,
-				Type:      pl.Monitor.Type,
-				Interval:  pl.Monitor.Interval,
-				Send:      pl.Monitor.Send,
-				Recv:      pl.Monitor.Recv,
-				Timeout:   pl.Monitor.Timeout,
+			if pl.Monitor.Send != "" && pl.Monitor.Type != "" {
+				pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(rsCfg.Virtual.Partition,
+					formatMonitorName(vs.ObjectMeta.Namespace, backend.service, pl.Monitor.Type, backend.servicePort)))
+				monitor := Monitor{
+					Name:       formatMonitorName(vs.ObjectMeta.Namespace, backend.service, pl.Monitor.Type, backend.servicePort),
+					Partition:  rsCfg.Virtual.Partition,
+					Type:       pl.Monitor.Type,
+					Interval:   pl.Monitor.Interval,
+					Send:       pl.Monitor.Send,
+					Recv:       pl.Monitor.Recv,
+					Timeout:    pl.Monitor.Timeout,
+					TargetPort: getMonitorTargetPort(pl.Monitor, backend.servicePort),
+				}
+				monitors = append(monitors, monitor)
 			}
-			monitors = append(monitors, monitor)
+			monitors = append(monitors, crMgr.addPoolMonitors(&pool, vs.ObjectMeta.Namespace, pl.Monitors)...)
+			pools = append(pools, pool)
 		}
-		pools = append(pools, pool)
 	}
 	rsCfg.Pools = append(rsCfg.Pools, pools...)
 	rsCfg.Monitors = append(rsCfg.Monitors, monitors...)
@@ -418,6 +515,12 @@ func (crMgr *CRManager) prepareRSConfigFromVirtualServer(
 	//Attach allowVlans.
 	rsCfg.Virtual.AllowVLANs = vs.Spec.AllowVLANs
 
+	// Persistence of the VirtualServer overrides the one of the Policy
+	if vs.Spec.PersistenceProfile != nil {
+		persistence := Persistence(*vs.Spec.PersistenceProfile)
+		rsCfg.Virtual.Persistence = &persistence
+	}
+
 	// Do not Create Virtual Server L7 Forwarding policies if HTTPTraffic is set to None or Redirect
 	if len(vs.Spec.TLSProfileName) > 0 &&
 		rsCfg.Virtual.VirtualAddress.Port == httpPort &&
@@ -430,6 +533,10 @@ func (crMgr *CRManager) prepareRSConfigFromVirtualServer(
 		return fmt.Errorf("failed to create LTM Rules")
 	}
 
+	if isVirtualServerABDeployment(vs) {
+		crMgr.handleVirtualServerABDeployment(rsCfg, vs)
+	}
+
 	// Update the existing policy with rules
 	// Otherwise create new policy and set
 	if policy := rsCfg.FindPolicy(PolicyControlForward); policy != nil {
@@ -502,82 +609,49 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 			// Process referenced BIG-IP clientSSL
 			if clientSSL != "" {
 				clientProfRef := ConvertStringToProfileRef(
-					clientSSL, CustomProfileClient, vsNamespace)
+					clientSSL, CustomProfileClient, vsNamespace, rsCfg.Virtual.tenant())
 				rsCfg.Virtual.AddOrUpdateProfile(clientProfRef)
 			}
 			// Process referenced BIG-IP serverSSL
 			if serverSSL != "" {
 				serverProfRef := ConvertStringToProfileRef(
-					serverSSL, CustomProfileServer, vsNamespace)
+					serverSSL, CustomProfileServer, vsNamespace, rsCfg.Virtual.tenant())
 				rsCfg.Virtual.AddOrUpdateProfile(serverProfRef)
 			}
 			log.Debugf("Updated BIGIP referenced profiles for Virtual '%s' using TLSProfile '%s'",
 				vsName, tlsName)
 		case Secret:
 			// Prepare SSL Transient Context
-			// Check if TLS Secret already exists
 			// Process ClientSSL stored as kubernetes secret
 			clientSSL := tls.Spec.TLS.ClientSSL
 			if clientSSL != "" {
-				if secret, ok := crMgr.SSLContext[clientSSL]; ok {
-					log.Debugf("clientSSL secret %s for TLSProfile '%s' is already available with CIS in "+
-						"SSLContext as clientSSL", secret.ObjectMeta.Name, tlsName)
-					err, _ := crMgr.createSecretClientSSLProfile(rsCfg, secret, CustomProfileClient)
-					if err != nil {
-						log.Debugf("error %v encountered for '%s' using TLSProfile '%s'",
-							err, vsName, tlsName)
-						return false
-					}
-				} else {
-					// Check if profile is contained in a Secret
-					// Update the SSL Context if secret found, This is used to avoid api calls
-					log.Debugf("saving clientSSL secret for TLSProfile '%s' into SSLContext", tlsName)
-					secret, err := crMgr.kubeClient.CoreV1().Secrets(vsNamespace).
-						Get(context.TODO(), clientSSL, metav1.GetOptions{})
-					if err != nil {
-						log.Errorf("secret %s not found for Virtual '%s' using TLSProfile '%s'",
-							clientSSL, vsName, tlsName)
-						return false
-					}
-					crMgr.SSLContext[clientSSL] = secret
-					err, _ = crMgr.createSecretClientSSLProfile(rsCfg, secret, CustomProfileClient)
-					if err != nil {
-						log.Errorf("error %v encountered for '%s' using TLSProfile '%s'",
-							err, vsName, tlsName)
-						return false
-					}
+				secret, err := crMgr.getSecret(vsNamespace, clientSSL)
+				if err != nil {
+					log.Errorf("secret %s not found for Virtual '%s' using TLSProfile '%s'",
+						clientSSL, vsName, tlsName)
+					return false
+				}
+				err, _ = crMgr.createSecretClientSSLProfile(rsCfg, secret, CustomProfileClient)
+				if err != nil {
+					log.Errorf("error %v encountered for '%s' using TLSProfile '%s'",
+						err, vsName, tlsName)
+					return false
 				}
 			}
 			// Process ServerSSL stored as kubernetes secret
 			serverSSL := tls.Spec.TLS.ServerSSL
 			if serverSSL != "" {
-				if secret, ok := crMgr.SSLContext[serverSSL]; ok {
-					log.Debugf("serverSSL secret %s for TLSProfile '%s' is already available with CIS in"+
-						"SSLContext", secret.ObjectMeta.Name, tlsName)
-					err, _ := crMgr.createSecretServerSSLProfile(rsCfg, secret, CustomProfileServer)
-					if err != nil {
-						log.Debugf("error %v encountered for '%s' using TLSProfile '%s'",
-							err, vsName, tlsName)
-						return false
-					}
-				} else {
-					// Check if profile is contained in a Secret
-					// Update the SSL Context if secret found, This is used to avoid api calls
-					log.Debugf("saving serverSSL secret for TLSProfile '%s' into SSLContext", tlsName)
-					secret, err := crMgr.kubeClient.CoreV1().Secrets(vsNamespace).
-						Get(context.TODO(), serverSSL, metav1.GetOptions{})
-					if err != nil {
-						log.Errorf("secret %s not found for Virtual '%s' using TLSProfile '%s'",
-							serverSSL, vsName, tlsName)
-						return false
-					}
-					crMgr.SSLContext[serverSSL] = secret
-					err, _ = crMgr.createSecretServerSSLProfile(rsCfg, secret, CustomProfileServer)
-					if err != nil {
-						log.Errorf("error %v encountered for '%s' using TLSProfile '%s'",
-							err, vsName, tlsName)
-						return false
-					}
+				secret, err := crMgr.getSecret(vsNamespace, serverSSL)
+				if err != nil {
+					log.Errorf("secret %s not found for Virtual '%s' using TLSProfile '%s'",
+						serverSSL, vsName, tlsName)
+					return false
+				}
+				err, _ = crMgr.createSecretServerSSLProfile(rsCfg, secret, CustomProfileServer)
+				if err != nil {
+					log.Errorf("error %v encountered for '%s' using TLSProfile '%s'",
+						err, vsName, tlsName)
+					return false
 				}
 			}
 		default:
@@ -596,7 +670,7 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 					sslPath := hostName + path
 					sslPath = strings.TrimSuffix(sslPath, "/")
 					updateDataGroup(rsCfg.IntDgMap, getRSCfgResName(rsCfg.Virtual.Name, EdgeServerSslDgName),
-						DEFAULT_PARTITION, vs.ObjectMeta.Namespace, sslPath, serverSsl)
+						rsCfg.Virtual.Partition, vs.ObjectMeta.Namespace, sslPath, serverSsl)
 
 				case TLSReencrypt:
 					hostName := vs.Spec.Host
@@ -606,7 +680,7 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 					serverSsl := AS3NameFormatter("crd_" + ip + "_tls_client")
 					if "" != tls.Spec.TLS.ServerSSL {
 						updateDataGroup(rsCfg.IntDgMap, getRSCfgResName(rsCfg.Virtual.Name, ReencryptServerSslDgName),
-							DEFAULT_PARTITION, vs.ObjectMeta.Namespace, sslPath, serverSsl)
+							rsCfg.Virtual.Partition, vs.ObjectMeta.Namespace, sslPath, serverSsl)
 					}
 				}
 			}
@@ -624,6 +698,7 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 					rsCfg.IntDgMap,
 					vs,
 					rsCfg.Virtual.Name,
+					rsCfg.Virtual.Partition,
 					ReencryptHostsDgName,
 				)
 			case TLSEdge:
@@ -631,6 +706,7 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 					rsCfg.IntDgMap,
 					vs,
 					rsCfg.Virtual.Name,
+					rsCfg.Virtual.Partition,
 					EdgeHostsDgName,
 				)
 			}
@@ -663,17 +739,18 @@ func (crMgr *CRManager) handleVirtualServerTLS(
 			var ruleName string
 			if vs.Spec.Host == "" {
 				ruleName = fmt.Sprintf("%s_%d", getRSCfgResName(rsCfg.Virtual.Name, HttpRedirectNoHostIRuleName), httpsPort)
-				rsCfg.addIRule(ruleName, DEFAULT_PARTITION, httpRedirectIRuleNoHost(httpsPort))
+				rsCfg.addIRule(ruleName, rsCfg.Virtual.Partition, httpRedirectIRuleNoHost(httpsPort))
 			} else {
 				ruleName = fmt.Sprintf("%s_%d", getRSCfgResName(rsCfg.Virtual.Name, HttpRedirectIRuleName), httpsPort)
-				rsCfg.addIRule(ruleName, DEFAULT_PARTITION, httpRedirectIRule(httpsPort, rsCfg.Virtual.Name, DEFAULT_PARTITION))
+				rsCfg.addIRule(ruleName, rsCfg.Virtual.Partition, httpRedirectIRule(httpsPort, rsCfg.Virtual.Name, rsCfg.Virtual.Partition))
 			}
-			ruleName = JoinBigipPath(DEFAULT_PARTITION, ruleName)
+			ruleName = JoinBigipPath(rsCfg.Virtual.Partition, ruleName)
 			rsCfg.Virtual.AddIRule(ruleName)
 			updateDataGroupOfDgName(
 				rsCfg.IntDgMap,
 				vs,
 				rsCfg.Virtual.Name,
+				rsCfg.Virtual.Partition,
 				HttpsRedirectDgName,
 			)
 		case TLSAllowInsecure:
@@ -725,7 +802,8 @@ func validateTLSProfile(tls *cisapiv1.TLSProfile) bool {
 }
 
 // ConvertStringToProfileRef converts strings to profile references
-func ConvertStringToProfileRef(profileName, context, ns string) ProfileRef {
+// Profile name without a partition refers to the given partition
+func ConvertStringToProfileRef(profileName, context, ns, partition string) ProfileRef {
 	profName := strings.TrimSpace(strings.TrimPrefix(profileName, "/"))
 	parts := strings.Split(profName, "/")
 	profRef := ProfileRef{Context: context, Namespace: ns}
@@ -734,9 +812,9 @@ func ConvertStringToProfileRef(profileName, context, ns string) ProfileRef {
 		profRef.Partition = parts[0]
 		profRef.Name = parts[1]
 	case 1:
-		log.Debugf("[RESOURCE] Partition not provided in profile '%s', using default partition '%s'",
-			profileName, DEFAULT_PARTITION)
-		profRef.Partition = DEFAULT_PARTITION
+		log.Debugf("[RESOURCE] Partition not provided in profile '%s', using partition '%s'",
+			profileName, partition)
+		profRef.Partition = partition
 		profRef.Name = profileName
 	default:
 		// This is almost certainly an error, but again issue a warning for
@@ -976,6 +1054,24 @@ func (rcs ResourceConfigs) GetAllPoolMembers() []PoolMember {
 	return allPoolMembers
 }
 
+// groupByTenant returns resource configs grouped by their AS3 tenant
+func (rcs ResourceConfigs) groupByTenant() map[string]ResourceConfigs {
+	tenantRsCfgs := make(map[string]ResourceConfigs)
+	for _, cfg := range rcs {
+		tenant := cfg.Virtual.tenant()
+		tenantRsCfgs[tenant] = append(tenantRsCfgs[tenant], cfg)
+	}
+	return tenantRsCfgs
+}
+
+// tenant returns the AS3 tenant of the virtual, defaults to DEFAULT_PARTITION
+func (v *Virtual) tenant() string {
+	if v.Partition == "" {
+		return DEFAULT_PARTITION
+	}
+	return v.Partition
+}
+
 func (rs *Resources) updateOldConfig() {
 	rs.oldRsMap = make(ResourceConfigMap)
 	for k, v := range rs.rsMap {
@@ -1012,6 +1108,9 @@ const EdgeServerSslDgName = "ssl_edge_serverssl_dg"
 // Internal data group for ab deployment routes.
 const AbDeploymentDgName = "ab_deployment_dg"
 
+// Weight of a pool or alternate backend when not specified
+const DefaultABWeight = 100
+
 func (slice InternalDataGroupRecords) Less(i, j int) bool {
 	return slice[i].Name < slice[j].Name
 }
@@ -1092,19 +1191,19 @@ func (crMgr *CRManager) handleDataGroupIRules(
 	// For https
 	if nil != tls {
 		termination := tls.Spec.TLS.Termination
-		tlsIRuleName := JoinBigipPath(DEFAULT_PARTITION,
+		tlsIRuleName := JoinBigipPath(rsCfg.Virtual.Partition,
 			getRSCfgResName(rsCfg.Virtual.Name, TLSIRuleName))
 		switch termination {
 		case TLSEdge:
 			rsCfg.addIRule(
-				getRSCfgResName(rsCfg.Virtual.Name, TLSIRuleName), DEFAULT_PARTITION, crMgr.getTLSIRule(rsCfg.Virtual.Name))
-			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, EdgeHostsDgName), DEFAULT_PARTITION)
-			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, EdgeServerSslDgName), DEFAULT_PARTITION)
+				getRSCfgResName(rsCfg.Virtual.Name, TLSIRuleName), rsCfg.Virtual.Partition, crMgr.getTLSIRule(rsCfg.Virtual.Name, rsCfg.Virtual.Partition))
+			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, EdgeHostsDgName), rsCfg.Virtual.Partition)
+			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, EdgeServerSslDgName), rsCfg.Virtual.Partition)
 		case TLSReencrypt:
 			rsCfg.addIRule(
-				getRSCfgResName(rsCfg.Virtual.Name, TLSIRuleName), DEFAULT_PARTITION, crMgr.getTLSIRule(rsCfg.Virtual.Name))
-			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, ReencryptHostsDgName), DEFAULT_PARTITION)
-			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, ReencryptServerSslDgName), DEFAULT_PARTITION)
+				getRSCfgResName(rsCfg.Virtual.Name, TLSIRuleName), rsCfg.Virtual.Partition, crMgr.getTLSIRule(rsCfg.Virtual.Name, rsCfg.Virtual.Partition))
+			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, ReencryptHostsDgName), rsCfg.Virtual.Partition)
+			rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, ReencryptServerSslDgName), rsCfg.Virtual.Partition)
 		}
 		if vsHost != "" {
 			rsCfg.Virtual.AddIRule(tlsIRuleName)
@@ -1112,6 +1211,28 @@ func (crMgr *CRManager) handleDataGroupIRules(
 	}
 }
 
+// handleVirtualServerABDeployment configures the data group and iRule which split
+// the traffic of A/B deployment paths among the weighted pools
+func (crMgr *CRManager) handleVirtualServerABDeployment(
+	rsCfg *ResourceConfig,
+	vs *cisapiv1.VirtualServer,
+) {
+	rsCfg.addInternalDataGroup(getRSCfgResName(rsCfg.Virtual.Name, AbDeploymentDgName), rsCfg.Virtual.Partition)
+	updateDataGroupForABVirtualServer(rsCfg.IntDgMap, vs, rsCfg.Virtual.Name, rsCfg.Virtual.Partition)
+
+	// Pools of TLS passthrough are selected by the TLS iRule using the same data group
+	if vs.Spec.TLSProfileName != "" {
+		tls := crMgr.getTLSProfileForVirtualServer(vs, vs.Namespace)
+		if tls != nil && tls.Spec.TLS.Termination == TLSPassthrough {
+			return
+		}
+	}
+	iRuleName := getRSCfgResName(rsCfg.Virtual.Name, AbDeploymentPathIRuleName)
+	rsCfg.addIRule(iRuleName, rsCfg.Virtual.Partition,
+		crMgr.abDeploymentPathIRule(rsCfg.Virtual.Name, rsCfg.Virtual.Partition))
+	rsCfg.Virtual.AddIRule(JoinBigipPath(rsCfg.Virtual.Partition, iRuleName))
+}
+
 func (crMgr *CRManager) deleteVirtualServer(rsName string) {
 	crMgr.resources.deleteVirtualServer(rsName)
 }
@@ -1137,22 +1258,32 @@ func (crMgr *CRManager) prepareRSConfigFromTransportServer(
 		ServiceName:     vs.Spec.Pool.Service,
 		ServicePort:     vs.Spec.Pool.ServicePort,
 		NodeMemberLabel: vs.Spec.Pool.NodeMemberLabel,
+		DrainTimeout:    vs.Spec.Pool.DrainTimeout,
+		Balance:         vs.Spec.Pool.Balance,
+		SlowRampTime:    vs.Spec.Pool.SlowRampTime,
+		MinimumMonitors: vs.Spec.Pool.MinimumMonitors,
+		ReselectTries:   vs.Spec.Pool.ReselectTries,
+		ConnectionLimit: vs.Spec.Pool.ConnectionLimit,
+		RateLimit:       vs.Spec.Pool.RateLimit,
+		Ratio:           vs.Spec.Pool.Ratio,
 	}
 
 	if vs.Spec.Pool.Monitor.Type != "" {
-		pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(DEFAULT_PARTITION,
+		pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(rsCfg.Virtual.Partition,
 			formatMonitorName(vs.ObjectMeta.Namespace, vs.Spec.Pool.Service, vs.Spec.Pool.Monitor.Type, vs.Spec.Pool.ServicePort)))
 		monitor := Monitor{
-			Name:      formatMonitorName(vs.ObjectMeta.Namespace, vs.Spec.Pool.Service, vs.Spec.Pool.Monitor.Type, vs.Spec.Pool.ServicePort),
-			Partition: rsCfg.Virtual.Partition,
-			Type:      vs.Spec.Pool.Monitor.Type,
-			Interval:  vs.Spec.Pool.Monitor.Interval,
-			Send:      "",
-			Recv:      "",
-			Timeout:   vs.Spec.Pool.Monitor.Timeout,
+			Name:       formatMonitorName(vs.ObjectMeta.Namespace, vs.Spec.Pool.Service, vs.Spec.Pool.Monitor.Type, vs.Spec.Pool.ServicePort),
+			Partition:  rsCfg.Virtual.Partition,
+			Type:       vs.Spec.Pool.Monitor.Type,
+			Interval:   vs.Spec.Pool.Monitor.Interval,
+			Send:       "",
+			Recv:       "",
+			Timeout:    vs.Spec.Pool.Monitor.Timeout,
+			TargetPort: getMonitorTargetPort(vs.Spec.Pool.Monitor, vs.Spec.Pool.ServicePort),
 		}
 		monitors = append(monitors, monitor)
 	}
+	monitors = append(monitors, crMgr.addPoolMonitors(&pool, vs.ObjectMeta.Namespace, vs.Spec.Pool.Monitors)...)
 	pools = append(pools, pool)
 	rsCfg.Virtual.Mode = vs.Spec.Mode
 	rsCfg.Virtual.IpProtocol = vs.Spec.Type
@@ -1175,6 +1306,12 @@ func (crMgr *CRManager) prepareRSConfigFromTransportServer(
 	//set allowed VLAN's per TS config
 	rsCfg.Virtual.AllowVLANs = vs.Spec.AllowVLANs
 
+	// Persistence of the TransportServer overrides the one of the Policy
+	if vs.Spec.PersistenceProfile != nil {
+		persistence := Persistence(*vs.Spec.PersistenceProfile)
+		rsCfg.Virtual.Persistence = &persistence
+	}
+
 	// Attach user specified iRules
 	if len(vs.Spec.IRules) > 0 {
 		rsCfg.Virtual.IRules = append(rsCfg.Virtual.IRules, vs.Spec.IRules...)
@@ -1214,16 +1351,17 @@ func (crMgr *CRManager) prepareRSConfigFromLBService(
 				"Unable to parse health monitor JSON array '%v': %v", hmStr, err)
 			log.Errorf("[CORE] %s", msg)
 		}
-		pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(DEFAULT_PARTITION,
+		pool.MonitorNames = append(pool.MonitorNames, JoinBigipPath(rsCfg.Virtual.Partition,
 			formatMonitorName(svc.Namespace, svc.Name, monitorType, svcPort.TargetPort.IntVal)))
 		monitor = Monitor{
-			Name:      formatMonitorName(svc.Namespace, svc.Name, monitorType, svcPort.TargetPort.IntVal),
-			Partition: rsCfg.Virtual.Partition,
-			Type:      monitorType,
-			Interval:  mon.Interval,
-			Send:      "",
-			Recv:      "",
-			Timeout:   mon.Timeout,
+			Name:       formatMonitorName(svc.Namespace, svc.Name, monitorType, svcPort.TargetPort.IntVal),
+			Partition:  rsCfg.Virtual.Partition,
+			Type:       monitorType,
+			Interval:   mon.Interval,
+			Send:       "",
+			Recv:       "",
+			Timeout:    mon.Timeout,
+			TargetPort: svcPort.TargetPort.IntVal,
 		}
 		rsCfg.Monitors = append(rsCfg.Monitors, monitor)
 	}
@@ -1248,50 +1386,30 @@ func (crMgr *CRManager) handleVSResourceConfigForPolicy(
 	rsCfg *ResourceConfig,
 	plc *cisapiv1.Policy,
 ) error {
-	rsCfg.Virtual.WAF = plc.Spec.L7Policies.WAF
-	rsCfg.Virtual.Firewall = plc.Spec.L3Policies.FirewallPolicy
-
-	if len(plc.Spec.Profiles.LogProfiles) > 0 {
-		rsCfg.Virtual.LogProfiles = append(rsCfg.Virtual.LogProfiles, plc.Spec.Profiles.LogProfiles...)
+	if err := handleCommonResourceConfigForPolicy(rsCfg, plc); err != nil {
+		return err
 	}
 	var iRule string
 	// Profiles common for both HTTP and HTTPS
 	// service_HTTP supports profileTCP and profileHTTP
 	// service_HTTPS supports profileTCP, profileHTTP and profileHTTP2
-	if len(plc.Spec.Profiles.HTTP) > 0 {
-		rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
-			Name:    plc.Spec.Profiles.HTTP,
-			Context: "http",
-		})
-	}
-	if len(plc.Spec.Profiles.TCP) > 0 {
-		rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
-			Name:    plc.Spec.Profiles.TCP,
-			Context: "tcp",
-		})
-	}
+	setPolicyProfile(rsCfg, plc.Spec.Profiles.HTTP, "http")
+	setPolicyProfile(rsCfg, plc.Spec.Profiles.TCP, "tcp")
+	setPolicyProfile(rsCfg, plc.Spec.Profiles.RewriteProfile, "rewrite")
 	switch rsCfg.MetaData.Protocol {
 	case "https":
 		iRule = plc.Spec.IRules.Secure
-		if len(plc.Spec.Profiles.HTTP2) > 0 {
-			rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
-				Name:    plc.Spec.Profiles.HTTP2,
-				Context: "http2",
-			})
+		if len(plc.Spec.LtmPolicies.Secure) > 0 {
+			rsCfg.Virtual.LTMPolicy = plc.Spec.LtmPolicies.Secure
 		}
+		setPolicyProfile(rsCfg, plc.Spec.Profiles.HTTP2, "http2")
 	case "http":
 		iRule = plc.Spec.IRules.InSecure
-	}
-	if len(iRule) > 0 {
-		switch plc.Spec.IRules.Priority {
-		case "override":
-			rsCfg.Virtual.IRules = []string{iRule}
-		case "high":
-			rsCfg.Virtual.IRules = append([]string{iRule}, rsCfg.Virtual.IRules...)
-		default:
-			rsCfg.Virtual.IRules = append(rsCfg.Virtual.IRules, iRule)
+		if len(plc.Spec.LtmPolicies.InSecure) > 0 {
+			rsCfg.Virtual.LTMPolicy = plc.Spec.LtmPolicies.InSecure
 		}
 	}
+	setPolicyIRule(rsCfg, iRule, plc.Spec.IRules.Priority)
 	return nil
 }
 
@@ -1299,39 +1417,87 @@ func (crMgr *CRManager) handleTSResourceConfigForPolicy(
 	rsCfg *ResourceConfig,
 	plc *cisapiv1.Policy,
 ) error {
-	rsCfg.Virtual.WAF = plc.Spec.L7Policies.WAF
-	rsCfg.Virtual.Firewall = plc.Spec.L3Policies.FirewallPolicy
-
-	if len(plc.Spec.Profiles.LogProfiles) > 0 {
-		rsCfg.Virtual.LogProfiles = append(rsCfg.Virtual.LogProfiles, plc.Spec.Profiles.LogProfiles...)
+	if err := handleCommonResourceConfigForPolicy(rsCfg, plc); err != nil {
+		return err
 	}
-	if len(plc.Spec.Profiles.UDP) > 0 {
-		rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
-			Name:    plc.Spec.Profiles.UDP,
-			Context: "udp",
-		})
+	setPolicyProfile(rsCfg, plc.Spec.Profiles.UDP, "udp")
+	setPolicyProfile(rsCfg, plc.Spec.Profiles.TCP, "tcp")
+	if len(plc.Spec.LtmPolicies.InSecure) > 0 {
+		rsCfg.Virtual.LTMPolicy = plc.Spec.LtmPolicies.InSecure
 	}
-	if len(plc.Spec.Profiles.TCP) > 0 {
-		rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
-			Name:    plc.Spec.Profiles.TCP,
-			Context: "tcp",
-		})
+	setPolicyIRule(rsCfg, plc.Spec.IRules.InSecure, plc.Spec.IRules.Priority)
+	return nil
+}
+
+// handleCommonResourceConfigForPolicy applies the policies and profiles of the Policy common to
+// VirtualServers and TransportServers. Policies are applied from the least specific one, so that
+// the values set by a Policy override the ones of the Policies applied before
+func handleCommonResourceConfigForPolicy(rsCfg *ResourceConfig, plc *cisapiv1.Policy) error {
+	rsCfg.MetaData.policies = append(rsCfg.MetaData.policies, plc.Namespace+"/"+plc.Name)
+	if len(plc.Spec.L7Policies.WAF) > 0 {
+		rsCfg.Virtual.WAF = plc.Spec.L7Policies.WAF
+	}
+	if len(plc.Spec.L3Policies.FirewallPolicy) > 0 {
+		rsCfg.Virtual.Firewall = plc.Spec.L3Policies.FirewallPolicy
+	}
+	if len(plc.Spec.L3Policies.DOS) > 0 {
+		rsCfg.Virtual.ProfileDOS = plc.Spec.L3Policies.DOS
+	}
+	// Log profiles of all the Policies are attached
+	for _, lp := range plc.Spec.Profiles.LogProfiles {
+		found := false
+		for _, attached := range rsCfg.Virtual.LogProfiles {
+			if attached == lp {
+				found = true
+				break
+			}
+		}
+		if !found {
+			rsCfg.Virtual.LogProfiles = append(rsCfg.Virtual.LogProfiles, lp)
+		}
 	}
-	var iRule string
-	iRule = plc.Spec.IRules.InSecure
-	if len(iRule) > 0 {
-		switch plc.Spec.IRules.Priority {
-		case "override":
-			rsCfg.Virtual.IRules = []string{iRule}
-		case "high":
-			rsCfg.Virtual.IRules = append([]string{iRule}, rsCfg.Virtual.IRules...)
-		default:
-			rsCfg.Virtual.IRules = append(rsCfg.Virtual.IRules, iRule)
+	if plc.Spec.Profiles.PersistenceProfile != nil {
+		if err := validatePersistenceProfile(plc.Spec.Profiles.PersistenceProfile); err != nil {
+			return fmt.Errorf("invalid persistenceProfile of Policy %v: %v", plc.Name, err)
 		}
+		persistence := Persistence(*plc.Spec.Profiles.PersistenceProfile)
+		rsCfg.Virtual.Persistence = &persistence
 	}
 	return nil
 }
 
+// setPolicyProfile sets the profile of the context, replacing the one set by a less specific Policy
+func setPolicyProfile(rsCfg *ResourceConfig, name, context string) {
+	if len(name) == 0 {
+		return
+	}
+	for i, prof := range rsCfg.Virtual.Profiles {
+		if prof.Context == context {
+			rsCfg.Virtual.Profiles[i].Name = name
+			return
+		}
+	}
+	rsCfg.Virtual.Profiles = append(rsCfg.Virtual.Profiles, ProfileRef{
+		Name:    name,
+		Context: context,
+	})
+}
+
+// setPolicyIRule attaches the iRule of the Policy with its priority over the iRules attached before
+func setPolicyIRule(rsCfg *ResourceConfig, iRule, priority string) {
+	if len(iRule) == 0 {
+		return
+	}
+	switch priority {
+	case "override":
+		rsCfg.Virtual.IRules = []string{iRule}
+	case "high":
+		rsCfg.Virtual.IRules = append([]string{iRule}, rsCfg.Virtual.IRules...)
+	default:
+		rsCfg.Virtual.IRules = append(rsCfg.Virtual.IRules, iRule)
+	}
+}
+
 func getRSCfgResName(rsVSName, resName string) string {
 	return fmt.Sprintf("%s_%s", rsVSName, resName)
 }
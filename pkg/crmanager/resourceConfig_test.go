@@ -9,6 +9,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 )
 
@@ -150,6 +152,17 @@ var _ = Describe("Resource Config Tests", func() {
 			Expect(len(rsCfg.IntDgMap)).To(Equal(1), "Failed to Add Internal DataGroup Map")
 		})
 
+		It("Handle DataGroup in the partition of the Virtual", func() {
+			vs := test.NewVirtualServer("SampleVS", namespace, cisapiv1.VirtualServerSpec{
+				Host:  "test.com",
+				Pools: []cisapiv1.Pool{{Path: "/foo", Service: "svc1", ServicePort: 80}},
+			})
+			updateDataGroupOfDgName(rsCfg.IntDgMap, vs, rsCfg.Virtual.Name, "team1", EdgeHostsDgName)
+			dgName := getRSCfgResName(rsCfg.Virtual.Name, EdgeHostsDgName)
+			Expect(rsCfg.IntDgMap).To(HaveKey(NameRef{Name: dgName, Partition: "team1"}))
+			Expect(rsCfg.IntDgMap).NotTo(HaveKey(NameRef{Name: dgName, Partition: DEFAULT_PARTITION}))
+		})
+
 		It("Handle DataGroupIRules", func() {
 			mockCRM := newMockCRManager()
 			tls := test.NewTLSProfile(
@@ -248,6 +261,133 @@ var _ = Describe("Resource Config Tests", func() {
 			Expect(err).To(BeNil(), "Failed to Prepare Resource Config from VirtualServer")
 		})
 
+		It("Prepare Resource Config from a VirtualServer with weighted pools", func() {
+			rsCfg.MetaData.ResourceType = VirtualServer
+			rsCfg.Virtual.Enabled = true
+			rsCfg.Virtual.Name = formatCustomVirtualServerName("My_VS", 80)
+			rsCfg.IntDgMap = make(InternalDataGroupMap)
+			rsCfg.IRulesMap = make(IRulesMap)
+
+			weight := func(w int32) *int32 { return &w }
+			vs := test.NewVirtualServer(
+				"SampleVS",
+				namespace,
+				cisapiv1.VirtualServerSpec{
+					Host: "Test.com",
+					Pools: []cisapiv1.Pool{
+						{
+							Path:        "/foo",
+							Service:     "svc1",
+							ServicePort: 80,
+							Weight:      weight(80),
+						},
+						{
+							Path:        "/foo",
+							Service:     "svc2",
+							ServicePort: 80,
+							Weight:      weight(20),
+						},
+						{
+							Path:        "/",
+							Service:     "svc3",
+							ServicePort: 80,
+							Weight:      weight(0),
+							AlternateBackends: []cisapiv1.AlternateBackend{
+								{Service: "svc4", Weight: weight(0)},
+							},
+						},
+						{
+							Path:        "/bar",
+							Service:     "svc5",
+							ServicePort: 80,
+						},
+					},
+				},
+			)
+			err := mockCRM.prepareRSConfigFromVirtualServer(rsCfg, vs)
+			Expect(err).To(BeNil(), "Failed to Prepare Resource Config from VirtualServer")
+			Expect(rsCfg.Pools).To(HaveLen(5), "Pools of alternate backends should be created")
+			Expect(rsCfg.Pools[3].ServiceName).To(Equal("svc4"))
+			Expect(rsCfg.Pools[3].ServicePort).To(Equal(int32(80)))
+
+			policy := rsCfg.FindPolicy(PolicyControlForward)
+			Expect(policy).NotTo(BeNil())
+			Expect(policy.Rules).To(HaveLen(3), "Requests of a path should be forwarded to the first pool")
+
+			dgName := getRSCfgResName(rsCfg.Virtual.Name, AbDeploymentDgName)
+			dg := rsCfg.IntDgMap[NameRef{Name: dgName, Partition: rsCfg.Virtual.Partition}][namespace]
+			Expect(dg).NotTo(BeNil(), "A/B deployment data group not created")
+			Expect(dg.Records).To(ContainElements(
+				InternalDataGroupRecord{Name: "test.com", Data: ""},
+				InternalDataGroupRecord{
+					Name: "test.com/foo",
+					Data: formatVirtualServerPoolName(namespace, "svc1", 80, "") + ",0.800;" +
+						formatVirtualServerPoolName(namespace, "svc2", 80, "") + ",1.000",
+				},
+				InternalDataGroupRecord{
+					Name: "test.com/bar",
+					Data: formatVirtualServerPoolName(namespace, "svc5", 80, "") + ",1.000",
+				},
+			), "Path under a weighted path should be routed to its own pool")
+			Expect(dg.Records).To(HaveLen(3))
+
+			iRuleName := getRSCfgResName(rsCfg.Virtual.Name, AbDeploymentPathIRuleName)
+			Expect(rsCfg.IRulesMap).To(HaveKey(NameRef{Name: iRuleName, Partition: rsCfg.Virtual.Partition}))
+			Expect(rsCfg.Virtual.IRules).To(ContainElement(JoinBigipPath(rsCfg.Virtual.Partition, iRuleName)))
+		})
+
+		It("Prepare Resource Config from a VirtualServer with header actions", func() {
+			rsCfg.MetaData.ResourceType = VirtualServer
+			rsCfg.Virtual.Enabled = true
+			rsCfg.Virtual.Name = formatCustomVirtualServerName("My_VS", 80)
+			rsCfg.IntDgMap = make(InternalDataGroupMap)
+			rsCfg.IRulesMap = make(IRulesMap)
+
+			vs := test.NewVirtualServer(
+				"SampleVS",
+				namespace,
+				cisapiv1.VirtualServerSpec{
+					Host: "test.com",
+					Pools: []cisapiv1.Pool{
+						{
+							Path:        "/foo",
+							Service:     "svc1",
+							ServicePort: 80,
+							Rewrite:     "/bar",
+							HostRewrite: "internal.test.com",
+							RequestHeaders: &cisapiv1.HeaderActions{
+								Insert: []cisapiv1.HTTPHeader{{Name: "X-Forwarded-Proto", Value: "https"}},
+								Remove: []string{"X-Debug"},
+							},
+							ResponseHeaders: &cisapiv1.HeaderActions{
+								Replace: []cisapiv1.HTTPHeader{{Name: "Server", Value: "test"}},
+							},
+						},
+					},
+				},
+			)
+			err := mockCRM.prepareRSConfigFromVirtualServer(rsCfg, vs)
+			Expect(err).To(BeNil(), "Failed to Prepare Resource Config from VirtualServer")
+
+			policy := rsCfg.FindPolicy(PolicyControlForward)
+			Expect(policy).NotTo(BeNil())
+			Expect(policy.Rules).To(HaveLen(1))
+			actions := policy.Rules[0].Actions
+			Expect(actions).To(HaveLen(6))
+			Expect(actions[1].HTTPURI).To(BeTrue(), "Path rewrite should precede the header actions")
+			Expect(*actions[2]).To(Equal(action{
+				Name: "2", HTTPHost: true, Replace: true, Request: true, Value: "internal.test.com"}))
+			Expect(*actions[3]).To(Equal(action{
+				Name: "3", HTTPHeader: true, Insert: true, Request: true, TmName: "X-Forwarded-Proto", Value: "https"}))
+			Expect(*actions[4]).To(Equal(action{
+				Name: "4", HTTPHeader: true, Remove: true, Request: true, TmName: "X-Debug"}))
+			Expect(*actions[5]).To(Equal(action{
+				Name: "5", HTTPHeader: true, Replace: true, Response: true, TmName: "Server", Value: "test"}))
+
+			vs.Spec.Pools[0].RequestHeaders.Insert[0].Name = "X Forwarded Proto"
+			Expect(mockCRM.validateVirtualServerSpec(vs)).NotTo(BeNil(), "Invalid header name should be rejected")
+		})
+
 		It("Prepare Resource Config from a TransportServer", func() {
 			ts := test.NewTransportServer(
 				"SampleTS",
@@ -268,6 +408,150 @@ var _ = Describe("Resource Config Tests", func() {
 			Expect(err).To(BeNil(), "Failed to Prepare Resource Config from TransportServer")
 		})
 
+		It("Persistence of Policy and TransportServer", func() {
+			plc := &cisapiv1.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace},
+				Spec: cisapiv1.PolicySpec{
+					Profiles: cisapiv1.ProfileSpec{
+						PersistenceProfile: &cisapiv1.PersistenceProfile{Method: "universal"},
+					},
+				},
+			}
+			Expect(mockCRM.handleTSResourceConfigForPolicy(rsCfg, plc)).NotTo(BeNil(),
+				"Universal persistence without rule should be invalid")
+			plc.Spec.Profiles.PersistenceProfile.Rule = "/Common/persist_rule"
+			Expect(mockCRM.handleTSResourceConfigForPolicy(rsCfg, plc)).To(BeNil())
+			Expect(rsCfg.Virtual.Persistence).To(Equal(&Persistence{Method: "universal", Rule: "/Common/persist_rule"}))
+
+			ts := test.NewTransportServer(
+				"SampleTS",
+				namespace,
+				cisapiv1.TransportServerSpec{
+					Pool: cisapiv1.Pool{
+						Service:     "svc1",
+						ServicePort: 80,
+					},
+					PersistenceProfile: &cisapiv1.PersistenceProfile{Reference: "/Common/source_addr"},
+				},
+			)
+			Expect(mockCRM.prepareRSConfigFromTransportServer(rsCfg, ts)).To(BeNil())
+			Expect(rsCfg.Virtual.Persistence).To(Equal(&Persistence{Reference: "/Common/source_addr"}),
+				"Persistence of TransportServer should override the one of Policy")
+		})
+
+		It("DoS profile, LTM policies and rewrite profile of Policy", func() {
+			plc := &cisapiv1.Policy{
+				ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace},
+				Spec: cisapiv1.PolicySpec{
+					L3Policies:  cisapiv1.L3PolicySpec{DOS: "/Common/dos"},
+					LtmPolicies: cisapiv1.LtmIRulesSpec{Secure: "/Common/secure", InSecure: "/Common/insecure"},
+					Profiles:    cisapiv1.ProfileSpec{RewriteProfile: "/Common/rewrite"},
+				},
+			}
+			rsCfg.MetaData.Protocol = "https"
+			Expect(mockCRM.handleVSResourceConfigForPolicy(rsCfg, plc)).To(BeNil())
+			Expect(rsCfg.MetaData.policies).To(Equal([]string{"default/plc"}))
+			Expect(rsCfg.Virtual.ProfileDOS).To(Equal("/Common/dos"))
+			Expect(rsCfg.Virtual.LTMPolicy).To(Equal("/Common/secure"))
+			Expect(rsCfg.Virtual.Profiles).To(ContainElement(ProfileRef{Name: "/Common/rewrite", Context: "rewrite"}))
+
+			tsCfg := &ResourceConfig{}
+			Expect(mockCRM.handleTSResourceConfigForPolicy(tsCfg, plc)).To(BeNil())
+			Expect(tsCfg.Virtual.ProfileDOS).To(Equal("/Common/dos"))
+			Expect(tsCfg.Virtual.LTMPolicy).To(Equal("/Common/insecure"))
+			Expect(tsCfg.Virtual.Profiles).To(BeEmpty())
+		})
+
+		It("Prepare Resource Config from a TransportServer with monitors", func() {
+			rsCfg.Virtual.Partition = "test"
+			mockCRM.SSLContext = make(map[string]*v1.Secret)
+			_ = mockCRM.crInformers[namespace].secretInformer.GetIndexer().Add(
+				test.NewSecret("monitorcert", namespace, "cert", "key"))
+			ts := test.NewTransportServer(
+				"SampleTS",
+				namespace,
+				cisapiv1.TransportServerSpec{
+					Pool: cisapiv1.Pool{
+						Service:         "svc1",
+						ServicePort:     80,
+						MinimumMonitors: 2,
+						Monitor: cisapiv1.Monitor{
+							Type:     "tcp",
+							Timeout:  10,
+							Interval: 10,
+						},
+						Monitors: []cisapiv1.Monitor{
+							{Type: "tcp", Interval: 5, TargetPort: 8080},
+							{Type: "https", Send: "GET /health", ClientCertificate: "monitorcert"},
+							{Type: "dns", QueryName: "test.com", QueryType: "a"},
+							{Reference: "/Common/gateway_icmp"},
+							{Interval: 5},
+						},
+					},
+				},
+			)
+			err := mockCRM.prepareRSConfigFromTransportServer(rsCfg, ts)
+			Expect(err).To(BeNil(), "Failed to Prepare Resource Config from TransportServer")
+			Expect(rsCfg.Pools[0].MonitorNames).To(Equal([]string{
+				"/test/svc1_default_tcp_80",
+				"/test/svc1_default_tcp_80_0",
+				"/test/svc1_default_https_80",
+				"/test/svc1_default_dns_80",
+			}), "Monitors of the same type should have unique names")
+			Expect(rsCfg.Pools[0].MonitorRefs).To(Equal([]string{"/Common/gateway_icmp"}))
+			Expect(rsCfg.Monitors).To(HaveLen(4), "Monitor without type or reference should be skipped")
+			Expect(rsCfg.Monitors[1].TargetPort).To(BeEquivalentTo(8080))
+			Expect(rsCfg.Monitors[2].ClientCert).To(Equal("cert"))
+			Expect(rsCfg.Monitors[2].ClientKey).To(Equal("key"))
+			Expect(rsCfg.Monitors[3].QueryName).To(Equal("test.com"))
+		})
+
+		It("Monitors probe the container port in nodeport mode", func() {
+			mockCRM.ControllerMode = NodePortMode
+			mockCRM.resources = NewResources()
+			mockCRM.oldNodes = []Node{{Name: "node1", Addr: "10.10.10.1"}}
+			mockCRM.resources.poolMemCache["default/svc1"] = poolMembersInfo{
+				svcType: v1.ServiceTypeNodePort,
+				portSpec: []v1.ServicePort{
+					{Port: 80, TargetPort: intstr.FromInt(8080), NodePort: 30080},
+				},
+			}
+			rsCfg.Virtual.Name = "crd_vs_1.2.3.4"
+			rsCfg.Virtual.Partition = "test"
+			ts := test.NewTransportServer(
+				"SampleTS",
+				namespace,
+				cisapiv1.TransportServerSpec{
+					Pool: cisapiv1.Pool{
+						Service:     "svc1",
+						ServicePort: 8080,
+						Monitors: []cisapiv1.Monitor{
+							{Type: "http", Send: "GET /health"},
+							{Type: "tcp", TargetPort: 9090},
+							{Type: "gateway-icmp", Send: "ignored"},
+						},
+					},
+				},
+			)
+			Expect(mockCRM.prepareRSConfigFromTransportServer(rsCfg, ts)).To(BeNil())
+			mockCRM.updatePoolMembersForNodePort(rsCfg, namespace)
+			Expect(rsCfg.Pools[0].Members).To(Equal([]PoolMember{
+				{Address: "10.10.10.1", Port: 30080, Session: "user-enabled"},
+			}))
+
+			sharedApp := as3Application{}
+			createMonitorDecl(rsCfg, sharedApp)
+			http := sharedApp["svc1_default_http_8080"].(*as3Monitor)
+			Expect(*http.TargetPort).To(BeEquivalentTo(8080), "Monitor should default to the container port")
+			tcp := sharedApp["svc1_default_tcp_8080"].(*as3Monitor)
+			Expect(*tcp.TargetPort).To(BeEquivalentTo(9090))
+			icmp := sharedApp["svc1_default_gateway_icmp_8080"].(*as3Monitor)
+			Expect(icmp.TargetPort).To(BeNil(), "ICMP monitor should have no port")
+			Expect(icmp.TargetAddress).To(BeNil())
+			Expect(icmp.Send).To(BeNil())
+			Expect(icmp.Receive).To(BeNil())
+		})
+
 		It("Prepare Resource Config from a Service", func() {
 			svcPort := v1.ServicePort{
 				Name:     "port1",
@@ -356,10 +640,11 @@ var _ = Describe("Resource Config Tests", func() {
 				"sample",
 				ctx,
 				namespace,
+				"test",
 			)
 			Expect(profRef).To(Equal(ProfileRef{
 				"sample",
-				DEFAULT_PARTITION,
+				"test",
 				ctx,
 				namespace},
 			), "Invalid Profile Reference")
@@ -368,6 +653,7 @@ var _ = Describe("Resource Config Tests", func() {
 				"/Common/sample",
 				ctx,
 				namespace,
+				"test",
 			)
 			Expect(profRef).To(Equal(ProfileRef{
 				"sample",
@@ -380,6 +666,7 @@ var _ = Describe("Resource Config Tests", func() {
 				"/too/large/path",
 				ctx,
 				namespace,
+				"test",
 			)
 			Expect(profRef).To(Equal(ProfileRef{
 				"",
@@ -2,82 +2,124 @@ package crmanager
 
 import (
 	"container/list"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type requestQueueData struct {
 	sync.Mutex
 	*list.List
+	// lastID is the id of the last enqueued request
+	lastID int
+	// policyResults holds the latest response of each virtual using a Policy, by Policy and virtual
+	policyResults map[string]map[string]agentResponse
 }
 
 type requestMeta struct {
-	meta []metaData
-	id   int
+	// meta holds the resources of the request grouped by tenant
+	meta map[string][]metaData
+	// pendingTenants holds the tenants of the request yet to respond
+	pendingTenants map[string]struct{}
+	id             int
 }
 
-func (crMgr *CRManager) enqueueReq(config ResourceConfigWrapper) {
+// enqueueReq records the resources of the request and returns the request id
+func (crMgr *CRManager) enqueueReq(config ResourceConfigWrapper) int {
 	rm := requestMeta{
-		meta: make([]metaData, len(config.rsCfgs)),
+		meta:           make(map[string][]metaData),
+		pendingTenants: make(map[string]struct{}),
 	}
-	if crMgr.requestQueue.Len() == 0 {
-		rm.id = 1
-	} else {
-		rm.id = crMgr.requestQueue.Back().Value.(requestMeta).id + 1
-	}
-
-	isEmptyMetadata := true
+	// users holds the virtuals using each Policy in the request
+	users := make(map[string]map[string]struct{})
 	for _, cfg := range config.rsCfgs {
 		if cfg.MetaData.rscName != "" && cfg.MetaData.namespace != "" {
-			rm.meta = append(rm.meta, cfg.MetaData)
-			isEmptyMetadata = false
+			tenant := cfg.Virtual.tenant()
+			rm.meta[tenant] = append(rm.meta[tenant], cfg.MetaData)
+			rm.pendingTenants[tenant] = struct{}{}
+			for _, plcKey := range cfg.MetaData.policies {
+				if _, ok := users[plcKey]; !ok {
+					users[plcKey] = make(map[string]struct{})
+				}
+				users[plcKey][cfg.MetaData.virtualKey()] = struct{}{}
+			}
+		}
+	}
+
+	crMgr.requestQueue.Lock()
+	defer crMgr.requestQueue.Unlock()
+	// forget the responses of the virtuals no longer using the Policies
+	for plcKey, results := range crMgr.requestQueue.policyResults {
+		for vKey := range results {
+			if _, ok := users[plcKey][vKey]; !ok {
+				delete(results, vKey)
+			}
+		}
+		if len(results) == 0 {
+			delete(crMgr.requestQueue.policyResults, plcKey)
 		}
 	}
-	if !isEmptyMetadata {
-		crMgr.requestQueue.Lock()
-		crMgr.requestQueue.PushBack(rm)
-		crMgr.requestQueue.Unlock()
+	crMgr.requestQueue.lastID++
+	rm.id = crMgr.requestQueue.lastID
+	crMgr.requestQueue.PushBack(rm)
+	return rm.id
+}
+
+// dequeueReq removes the request from the queue, as no tenant responds to it
+func (crMgr *CRManager) dequeueReq(id int) {
+	crMgr.requestQueue.Lock()
+	defer crMgr.requestQueue.Unlock()
+	for e := crMgr.requestQueue.Back(); e != nil; e = e.Prev() {
+		if e.Value.(requestMeta).id == id {
+			crMgr.requestQueue.Remove(e)
+			return
+		}
 	}
 }
 
-func (crMgr *CRManager) responseHandler(respChan chan int) {
-	crMgr.requestQueue = &requestQueueData{sync.Mutex{}, list.New()}
-
-	for id := range respChan {
-		var rm requestMeta
-		for crMgr.requestQueue.Len() > 0 {
-			crMgr.requestQueue.Lock()
-			rm = crMgr.requestQueue.Remove(crMgr.requestQueue.Front()).(requestMeta)
-			crMgr.requestQueue.Unlock()
-			if id == rm.id {
-				break
-			}
+// releaseReq marks the tenant of the response as completed and returns the resources of the tenant
+// in the request. As each tenant always posts its latest declaration, the response completes the tenant
+// in the older requests too. A request is removed from the queue once all its tenants have responded.
+func (crMgr *CRManager) releaseReq(resp agentResponse) []metaData {
+	var items []metaData
+	crMgr.requestQueue.Lock()
+	defer crMgr.requestQueue.Unlock()
+	for e := crMgr.requestQueue.Front(); e != nil; {
+		next := e.Next()
+		rm := e.Value.(requestMeta)
+		if rm.id > resp.id {
+			break
+		}
+		if rm.id == resp.id {
+			items = rm.meta[resp.tenant]
 		}
-		for _, item := range rm.meta {
+		delete(rm.pendingTenants, resp.tenant)
+		if len(rm.pendingTenants) == 0 {
+			crMgr.requestQueue.Remove(e)
+		}
+		e = next
+	}
+	return items
+}
+
+func (crMgr *CRManager) responseHandler(respChan chan agentResponse) {
+	for resp := range respChan {
+		for _, item := range crMgr.releaseReq(resp) {
 			switch item.ResourceType {
 			case VirtualServer:
-				// update status
-				vsKey := item.namespace + "/" + item.rscName
-				crInf, ok := crMgr.getNamespacedInformer(item.namespace)
-				if !ok {
-					log.Errorf("Informer not found for namespace: %v, failed to update VS status", item.namespace)
-					break
-				}
-				obj, exist, err := crInf.vsInformer.GetIndexer().GetByKey(vsKey)
-				if err != nil {
-					log.Errorf("Error while fetching VirtualServer: %v: %v, failed to update VS status",
-						vsKey, err)
-					break
+				// update status of all the VirtualServers merged into the virtual
+				virtuals := item.virtuals
+				if len(virtuals) == 0 {
+					virtuals = []string{item.rscName}
 				}
-				if !exist {
-					log.Errorf("VirtualServer Not Found: %v, failed to update VS status", vsKey)
-					break
-				}
-				virtual := obj.(*cisapiv1.VirtualServer)
-				if virtual.Name == item.rscName && virtual.Namespace == item.namespace {
-					crMgr.updateVirtualServerStatus(virtual, virtual.Status.VSAddress, "Ok")
+				for _, name := range virtuals {
+					crMgr.updateVirtualServerProgrammedStatus(item.namespace, name, resp)
 				}
 			case TransportServer:
 				// update status
@@ -99,10 +141,98 @@ func (crMgr *CRManager) responseHandler(respChan chan int) {
 				}
 				virtual := obj.(*cisapiv1.TransportServer)
 				if virtual.Name == item.rscName && virtual.Namespace == item.namespace {
-					crMgr.updateTransportServerStatus(virtual, virtual.Status.VSAddress, "Ok")
+					crMgr.updateTransportServerStatus(virtual, "", getProgrammedCondition(resp))
 				}
 
 			}
+			for _, plcKey := range item.policies {
+				crMgr.updatePolicyProgrammedStatus(plcKey, crMgr.getPolicyProgrammedCondition(plcKey, item, resp))
+			}
+		}
+	}
+}
+
+// updateVirtualServerProgrammedStatus reports the AS3 response of the tenant on the VirtualServer
+func (crMgr *CRManager) updateVirtualServerProgrammedStatus(namespace, name string, resp agentResponse) {
+	vsKey := namespace + "/" + name
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v, failed to update VS status", namespace)
+		return
+	}
+	obj, exist, err := crInf.vsInformer.GetIndexer().GetByKey(vsKey)
+	if err != nil {
+		log.Errorf("Error while fetching VirtualServer: %v: %v, failed to update VS status",
+			vsKey, err)
+		return
+	}
+	if !exist {
+		log.Errorf("VirtualServer Not Found: %v, failed to update VS status", vsKey)
+		return
+	}
+	crMgr.updateVirtualServerStatus(obj.(*cisapiv1.VirtualServer), "", getProgrammedCondition(resp))
+}
+
+// virtualKey identifies the resource the config is derived from in the status of a Policy
+func (md metaData) virtualKey() string {
+	return md.ResourceType + " " + md.namespace + "/" + md.rscName
+}
+
+// getPolicyProgrammedCondition records the response of the virtual using the Policy and returns the
+// Programmed condition of the Policy across all its virtuals. The condition is False if BIG-IP rejected
+// the configuration of any of the virtuals.
+func (crMgr *CRManager) getPolicyProgrammedCondition(plcKey string, item metaData, resp agentResponse) metav1.Condition {
+	crMgr.requestQueue.Lock()
+	defer crMgr.requestQueue.Unlock()
+	if crMgr.requestQueue.policyResults == nil {
+		crMgr.requestQueue.policyResults = make(map[string]map[string]agentResponse)
+	}
+	results, ok := crMgr.requestQueue.policyResults[plcKey]
+	if !ok {
+		results = make(map[string]agentResponse)
+		crMgr.requestQueue.policyResults[plcKey] = results
+	}
+	results[item.virtualKey()] = resp
+
+	var failed []string
+	for vKey, result := range results {
+		if !result.programmed {
+			failed = append(failed, fmt.Sprintf("%v (tenant %v: %v)", vKey, result.tenant, result.message))
+		}
+	}
+	if len(failed) == 0 {
+		return newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionTrue, cisapiv1.ReasonProgrammed,
+			"Configuration of all the virtuals using the Policy is posted to BIG-IP")
+	}
+	sort.Strings(failed)
+	return newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionFalse, cisapiv1.ReasonRejected,
+		fmt.Sprintf("BIG-IP rejected the configuration of %v of %v virtuals using the Policy: %v",
+			len(failed), len(results), strings.Join(failed, "; ")))
+}
+
+// updatePolicyProgrammedStatus reports the Programmed condition on a Policy applied to the resources,
+// as the objects referred by the Policy, such as LTM policies and profiles, may be missing on BIG-IP
+func (crMgr *CRManager) updatePolicyProgrammedStatus(plcKey string, cond metav1.Condition) {
+	plc := crMgr.getPolicy(plcKey)
+	if plc == nil {
+		log.Errorf("Policy Not Found: %v, failed to update Policy status", plcKey)
+		return
+	}
+	crMgr.updatePolicyStatus(plc, func(plc *cisapiv1.Policy) {
+		setConditions(&plc.Status.Conditions, plc.Generation, []metav1.Condition{cond})
+	})
+}
+
+// gtmResponseHandler reports the result of posting the GSLB declaration to the GTM BIG-IP
+func (crMgr *CRManager) gtmResponseHandler(respChan chan agentResponse) {
+	for resp := range respChan {
+		if resp.programmed {
+			log.Debugf("[GTM] Posted the declaration of tenant %v to GTM BIG-IP", resp.tenant)
+			bigIPPrometheus.GTMWriteCount.WithLabelValues("success").Inc()
+			continue
 		}
+		log.Errorf("[GTM] GTM BIG-IP rejected the ExternalDNS declaration of tenant %v: %v",
+			resp.tenant, resp.message)
+		bigIPPrometheus.GTMWriteCount.WithLabelValues("failure").Inc()
 	}
 }
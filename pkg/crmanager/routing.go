@@ -51,11 +51,20 @@ func (crMgr *CRManager) prepareVirtualServerRules(
 
 	}
 
+	abPaths := make(map[string]struct{})
 	for _, pl := range vs.Spec.Pools {
 		// Service cannot be empty
 		if pl.Service == "" {
 			continue
 		}
+		// Requests of an A/B deployment path are forwarded to the first pool
+		// and the ab deployment iRule selects the pool by weight
+		if isABDeploymentPath(vs, pl.Path) {
+			if _, ok := abPaths[pl.Path]; ok {
+				continue
+			}
+			abPaths[pl.Path] = struct{}{}
+		}
 
 		uri := vs.Spec.Host + pl.Path
 
@@ -105,6 +114,15 @@ func (crMgr *CRManager) prepareVirtualServerRules(
 			}
 			rl.Actions = append(rl.Actions, rewriteActions...)
 		}
+		if pl.HostRewrite != "" || pl.RequestHeaders != nil || pl.ResponseHeaders != nil {
+			// HTTP headers are not available to the rules of TLS passthrough
+			if event == HTTPRequest {
+				rl.Actions = append(rl.Actions, getHeaderActions(pl, len(rl.Actions))...)
+			} else {
+				log.Warningf("Ignoring hostRewrite, requestHeaders and responseHeaders of path %v "+
+					"in VirtualServer %v with TLS passthrough", pl.Path, vs.Name)
+			}
+		}
 
 		if pl.Path == "/" {
 			redirects = append(redirects, rl)
@@ -328,6 +346,58 @@ func getRewriteActions(path, rwPath string, actionNameIndex int) ([]*action, err
 	return actions, nil
 }
 
+// getHeaderActions returns the actions rewriting the Host header of the requests forwarded to the pool,
+// and inserting, replacing and removing the HTTP headers of the requests and of their responses
+func getHeaderActions(pl cisapiv1.Pool, actionNameIndex int) []*action {
+	var actions []*action
+	if pl.HostRewrite != "" {
+		actions = append(actions, &action{
+			Name:     fmt.Sprintf("%d", actionNameIndex),
+			HTTPHost: true,
+			Replace:  true,
+			Request:  true,
+			Value:    pl.HostRewrite,
+		})
+	}
+	actions = append(actions, getHTTPHeaderActions(pl.RequestHeaders, true, actionNameIndex+len(actions))...)
+	actions = append(actions, getHTTPHeaderActions(pl.ResponseHeaders, false, actionNameIndex+len(actions))...)
+	return actions
+}
+
+// getHTTPHeaderActions returns the actions inserting, replacing and removing the HTTP headers
+// of the requests or of the responses
+func getHTTPHeaderActions(headers *cisapiv1.HeaderActions, request bool, actionNameIndex int) []*action {
+	if headers == nil {
+		return nil
+	}
+	var actions []*action
+	newAction := func(name string) *action {
+		a := &action{
+			Name:       fmt.Sprintf("%d", actionNameIndex+len(actions)),
+			HTTPHeader: true,
+			Request:    request,
+			Response:   !request,
+			TmName:     name,
+		}
+		actions = append(actions, a)
+		return a
+	}
+	for _, hdr := range headers.Insert {
+		a := newAction(hdr.Name)
+		a.Insert = true
+		a.Value = hdr.Value
+	}
+	for _, hdr := range headers.Replace {
+		a := newAction(hdr.Name)
+		a.Replace = true
+		a.Value = hdr.Value
+	}
+	for _, name := range headers.Remove {
+		newAction(name).Remove = true
+	}
+	return actions
+}
+
 func createRedirectRule(source, target, ruleName string) (*Rule, error) {
 	_u := "scheme://" + source
 	_u = strings.TrimSuffix(_u, "/")
@@ -550,8 +620,8 @@ func httpRedirectIRule(port int32, rsVSName string, partition string) string {
 	return iRuleCode
 }
 
-func (crMgr *CRManager) getTLSIRule(rsVSName string) string {
-	dgPath := crMgr.dgPath
+func (crMgr *CRManager) getTLSIRule(rsVSName string, partition string) string {
+	dgPath := strings.Join([]string{partition, as3SharedApplication}, "/")
 
 	iRule := fmt.Sprintf(`
 		when CLIENT_ACCEPTED {
@@ -837,13 +907,13 @@ func (crMgr *CRManager) getTLSIRule(rsVSName string) string {
 			}
         }`, dgPath, rsVSName)
 
-	iRuleCode := fmt.Sprintf("%s\n\n%s", crMgr.selectPoolIRuleFunc(rsVSName), iRule)
+	iRuleCode := fmt.Sprintf("%s\n\n%s", crMgr.selectPoolIRuleFunc(rsVSName, partition), iRule)
 
 	return iRuleCode
 }
 
-func (crMgr *CRManager) selectPoolIRuleFunc(rsVSName string) string {
-	dgPath := crMgr.dgPath
+func (crMgr *CRManager) selectPoolIRuleFunc(rsVSName string, partition string) string {
+	dgPath := strings.Join([]string{partition, as3SharedApplication}, "/")
 
 	iRuleFunc := fmt.Sprintf(`
 		proc select_ab_pool {path default_pool } {
@@ -882,10 +952,164 @@ func (crMgr *CRManager) selectPoolIRuleFunc(rsVSName string) string {
 	return iRuleFunc
 }
 
+// abDeploymentPathIRule selects the pool of the A/B deployment paths of a virtual
+func (crMgr *CRManager) abDeploymentPathIRule(rsVSName string, partition string) string {
+	// The key in the data group is the specific host/path to examine.
+	// The data is a list of pool/weight pairs delimited by ';'. The pair values
+	// are delineated by ','. Finally, the weight value is normalized between
+	// 0.0 and 1.0 and the pairs should be listed in ascending order or weight
+	// values.
+	iRuleCode := fmt.Sprintf("%s\n\n%s", crMgr.selectPoolIRuleFunc(rsVSName, partition), `
+		when HTTP_REQUEST priority 200 {
+			set path [string tolower [HTTP::host]][HTTP::path]
+			set selected_pool [call select_ab_pool $path ""]
+			if {$selected_pool != ""} then {
+				pool $selected_pool
+				event disable
+			}
+		}`)
+
+	return iRuleCode
+}
+
+// poolBackend is a service sharing the traffic of a VirtualServer pool
+type poolBackend struct {
+	service     string
+	servicePort int32
+	weight      int32
+}
+
+// getPoolBackends returns the service of the pool followed by its alternate backends
+func getPoolBackends(pl cisapiv1.Pool) []poolBackend {
+	weightOf := func(weight *int32) int32 {
+		if weight == nil {
+			return DefaultABWeight
+		}
+		return *weight
+	}
+	backends := []poolBackend{{
+		service:     pl.Service,
+		servicePort: pl.ServicePort,
+		weight:      weightOf(pl.Weight),
+	}}
+	for _, ab := range pl.AlternateBackends {
+		port := ab.ServicePort
+		if port == 0 {
+			port = pl.ServicePort
+		}
+		backends = append(backends, poolBackend{
+			service:     ab.Service,
+			servicePort: port,
+			weight:      weightOf(ab.Weight),
+		})
+	}
+	return backends
+}
+
+// isABDeploymentPath returns true if the pools on the path of VirtualServer
+// split the traffic by weight
+func isABDeploymentPath(vs *cisapiv1.VirtualServer, path string) bool {
+	for _, pl := range vs.Spec.Pools {
+		if pl.Path == path && (pl.Weight != nil || len(pl.AlternateBackends) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// isVirtualServerABDeployment returns true if any path of VirtualServer is an A/B deployment
+func isVirtualServerABDeployment(vs *cisapiv1.VirtualServer) bool {
+	for _, pl := range vs.Spec.Pools {
+		if isABDeploymentPath(vs, pl.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Update a data group map based on the weighted pools of VirtualServer.
+// (ignore a service with a 0 weight value)
+// The other paths are recorded with their own pool, as select_ab_pool matches the longest recorded
+// prefix of the request path, so that an A/B deployment path does not capture the paths under it.
+func updateDataGroupForABVirtualServer(
+	intDgMap InternalDataGroupMap,
+	vs *cisapiv1.VirtualServer,
+	rsVSName string,
+	partition string,
+) {
+	var paths []string
+	pathBackends := make(map[string][]poolBackend)
+	for _, pl := range vs.Spec.Pools {
+		_, ok := pathBackends[pl.Path]
+		if !isABDeploymentPath(vs, pl.Path) {
+			// First pool of the path serves the requests, same as the LTM policy
+			if !ok {
+				paths = append(paths, pl.Path)
+				pathBackends[pl.Path] = []poolBackend{{
+					service: formatVirtualServerPoolName(vs.Namespace, pl.Service,
+						pl.ServicePort, pl.NodeMemberLabel),
+					weight: DefaultABWeight,
+				}}
+			}
+			continue
+		}
+		if !ok {
+			paths = append(paths, pl.Path)
+		}
+		for _, backend := range getPoolBackends(pl) {
+			backend.service = formatVirtualServerPoolName(vs.Namespace, backend.service,
+				backend.servicePort, pl.NodeMemberLabel)
+			pathBackends[pl.Path] = append(pathBackends[pl.Path], backend)
+		}
+	}
+
+	for _, path := range paths {
+		key := strings.TrimSuffix(strings.ToLower(vs.Spec.Host)+path, "/")
+		var weightTotal int32
+		for _, backend := range pathBackends[path] {
+			weightTotal = weightTotal + backend.weight
+		}
+		if weightTotal == 0 {
+			// If all services have 0 weight, a 503 is returned
+			updateDataGroup(intDgMap, getRSCfgResName(rsVSName, AbDeploymentDgName),
+				partition, vs.Namespace, key, "")
+			continue
+		}
+		// Place each pool in a segment between 0.0 and 1.0 that corresponds to
+		// it's ratio percentage. The list must be in ascending order.
+		var entries []string
+		var runningWeightTotal int32
+		for _, backend := range pathBackends[path] {
+			if backend.weight == 0 {
+				continue
+			}
+			runningWeightTotal = runningWeightTotal + backend.weight
+			weightedSliceThreshold := float64(runningWeightTotal) / float64(weightTotal)
+			entries = append(entries, fmt.Sprintf("%s,%4.3f", backend.service, weightedSliceThreshold))
+		}
+		updateDataGroup(intDgMap, getRSCfgResName(rsVSName, AbDeploymentDgName),
+			partition, vs.Namespace, key, strings.Join(entries, ";"))
+	}
+}
+
+// updateDataGroupForABVirtuals records the paths of all the VirtualServers merged into the virtual
+// in its A/B deployment data group, if any, as the paths of a VirtualServer may be under the A/B deployment
+// path of another VirtualServer with the same host
+func updateDataGroupForABVirtuals(rsCfg *ResourceConfig, virtuals []*cisapiv1.VirtualServer) {
+	dgName := getRSCfgResName(rsCfg.Virtual.Name, AbDeploymentDgName)
+	if _, ok := rsCfg.IntDgMap[NameRef{Name: dgName, Partition: rsCfg.Virtual.Partition}]; !ok {
+		return
+	}
+	for _, vs := range virtuals {
+		updateDataGroupForABVirtualServer(rsCfg.IntDgMap, vs, rsCfg.Virtual.Name, rsCfg.Virtual.Partition)
+	}
+}
+
 func updateDataGroupOfDgName(
 	intDgMap InternalDataGroupMap,
 	virtual *cisapiv1.VirtualServer,
 	rsVSName string,
+	partition string,
 	dgName string,
 ) {
 	hostName := virtual.Spec.Host
@@ -897,13 +1121,21 @@ func updateDataGroupOfDgName(
 		// Combination of hostName and path are used as key in edge Datagroup.
 		// Servername and path from the ssl::payload of clientssl_data Irule event is
 		// used as value in edge and reencrypt Datagroup.
+		abPaths := make(map[string]struct{})
 		for _, pl := range virtual.Spec.Pools {
 			path := pl.Path
+			// First pool of an A/B deployment path is the default pool
+			if isABDeploymentPath(virtual, path) {
+				if _, ok := abPaths[path]; ok {
+					continue
+				}
+				abPaths[path] = struct{}{}
+			}
 			routePath := hostName + path
 			routePath = strings.TrimSuffix(routePath, "/")
 			poolName := formatVirtualServerPoolName(namespace, pl.Service, pl.ServicePort, pl.NodeMemberLabel)
 			updateDataGroup(intDgMap, rsDGName,
-				DEFAULT_PARTITION, namespace, routePath, poolName)
+				partition, namespace, routePath, poolName)
 		}
 	case HttpsRedirectDgName:
 		for _, pl := range virtual.Spec.Pools {
@@ -913,7 +1145,7 @@ func updateDataGroupOfDgName(
 			}
 			routePath := hostName + path
 			updateDataGroup(intDgMap, rsDGName,
-				DEFAULT_PARTITION, namespace, routePath, path)
+				partition, namespace, routePath, path)
 		}
 	}
 }
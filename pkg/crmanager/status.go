@@ -0,0 +1,233 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Number of attempts to update the status of a resource on conflicts
+	statusUpdateAttempts = 3
+
+	// Legacy status values derived from the Programmed condition
+	statusOk      = "Ok"
+	statusError   = "Error"
+	statusPending = "Pending"
+)
+
+func newCondition(condType string, status metav1.ConditionStatus, reason, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:    condType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+// setConditions updates the conditions observed for the given generation of the resource
+// LastTransitionTime is retained unless the status of a condition changes
+func setConditions(conditions *[]metav1.Condition, generation int64, newConditions []metav1.Condition) {
+	for _, cond := range newConditions {
+		cond.ObservedGeneration = generation
+		meta.SetStatusCondition(conditions, cond)
+	}
+}
+
+// getLegacyStatus returns the value of the status field derived from the Programmed condition
+func getLegacyStatus(conditions []metav1.Condition) string {
+	cond := meta.FindStatusCondition(conditions, cisapiv1.ConditionProgrammed)
+	if cond == nil {
+		return statusPending
+	}
+	switch cond.Status {
+	case metav1.ConditionTrue:
+		return statusOk
+	case metav1.ConditionFalse:
+		return statusError
+	}
+	return statusPending
+}
+
+// getProgrammedCondition returns the Programmed condition reported by the AS3 response of a tenant
+func getProgrammedCondition(resp agentResponse) metav1.Condition {
+	if resp.programmed {
+		return newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionTrue, cisapiv1.ReasonProgrammed,
+			fmt.Sprintf("Configuration is posted to BIG-IP in tenant %v", resp.tenant))
+	}
+	return newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionFalse, cisapiv1.ReasonRejected,
+		fmt.Sprintf("BIG-IP rejected the configuration of tenant %v: %v", resp.tenant, resp.message))
+}
+
+// getIPAMCondition returns the IPAllocated condition for the status of the IPAM request
+func getIPAMCondition(status int, ipamLabel, ip string) metav1.Condition {
+	switch status {
+	case NotEnabled:
+		return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse, cisapiv1.ReasonIPAMUnavailable,
+			"IPAM Custom Resource is not available")
+	case InvalidInput:
+		return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse, cisapiv1.ReasonInvalidIPAMLabel,
+			fmt.Sprintf("Invalid IPAM Label: %v", ipamLabel))
+	case NotRequested:
+		return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse, cisapiv1.ReasonIPAMPending,
+			"Unable to make IPAM request, will be re-requested soon")
+	case Requested:
+		return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse, cisapiv1.ReasonIPAMPending,
+			fmt.Sprintf("IP address requested from IPAM with label %v", ipamLabel))
+	case Exhausted:
+		return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse, cisapiv1.ReasonIPAMExhausted,
+			fmt.Sprintf("No free address available with IPAM label %v", ipamLabel))
+	}
+	return newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionTrue, cisapiv1.ReasonIPAMAllocated, ip)
+}
+
+// getMissingServices returns the services not found in the namespace
+func (crMgr *CRManager) getMissingServices(namespace string, services []string) []string {
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
+	if !ok {
+		return services
+	}
+	var missing []string
+	for _, svc := range services {
+		if _, found, _ := crInf.svcInformer.GetIndexer().GetByKey(namespace + "/" + svc); !found {
+			missing = append(missing, svc)
+		}
+	}
+	return missing
+}
+
+// getServiceRefsCondition returns the ResolvedRefs condition of the services referred as pools
+func (crMgr *CRManager) getServiceRefsCondition(namespace string, services []string) metav1.Condition {
+	if missing := crMgr.getMissingServices(namespace, services); len(missing) > 0 {
+		return newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionFalse, cisapiv1.ReasonServiceNotFound,
+			fmt.Sprintf("Service %v not found in namespace %v", strings.Join(missing, ", "), namespace))
+	}
+	return newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionTrue, cisapiv1.ReasonResolvedRefs,
+		"All the references are resolved")
+}
+
+// updateVirtualServerStatus updates the status of VirtualServer with the virtual address and the conditions
+// Status is updated only when it changes, so that an unchanged status does not trigger processing again
+func (crMgr *CRManager) updateVirtualServerStatus(vs *cisapiv1.VirtualServer, ip string, conditions ...metav1.Condition) {
+	for attempt := 1; ; attempt++ {
+		vsCopy := vs.DeepCopy()
+		if ip != "" {
+			vsCopy.Status.VSAddress = ip
+		}
+		vsCopy.Status.ObservedGeneration = vs.Generation
+		setConditions(&vsCopy.Status.Conditions, vs.Generation, conditions)
+		vsCopy.Status.StatusOk = getLegacyStatus(vsCopy.Status.Conditions)
+		if reflect.DeepEqual(vs.Status, vsCopy.Status) {
+			return
+		}
+
+		log.Debugf("Updating VirtualServer Status with %v for resource name:%v , namespace: %v",
+			vsCopy.Status, vs.Name, vs.Namespace)
+		_, err := crMgr.kubeCRClient.CisV1().VirtualServers(vs.Namespace).UpdateStatus(
+			context.TODO(), vsCopy, metav1.UpdateOptions{})
+		if err == nil {
+			return
+		}
+		if !k8serrors.IsConflict(err) || attempt == statusUpdateAttempts {
+			log.Debugf("Error while updating virtual server status:%v", err)
+			return
+		}
+		// Informer cache is stale, retry with the latest VirtualServer
+		vs, err = crMgr.kubeCRClient.CisV1().VirtualServers(vs.Namespace).Get(
+			context.TODO(), vs.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("Error while fetching virtual server to update status:%v", err)
+			return
+		}
+	}
+}
+
+// updateTransportServerStatus updates the status of TransportServer with the virtual address and the conditions
+// Status is updated only when it changes, so that an unchanged status does not trigger processing again
+func (crMgr *CRManager) updateTransportServerStatus(ts *cisapiv1.TransportServer, ip string, conditions ...metav1.Condition) {
+	for attempt := 1; ; attempt++ {
+		tsCopy := ts.DeepCopy()
+		if ip != "" {
+			tsCopy.Status.VSAddress = ip
+		}
+		tsCopy.Status.ObservedGeneration = ts.Generation
+		setConditions(&tsCopy.Status.Conditions, ts.Generation, conditions)
+		tsCopy.Status.StatusOk = getLegacyStatus(tsCopy.Status.Conditions)
+		if reflect.DeepEqual(ts.Status, tsCopy.Status) {
+			return
+		}
+
+		log.Debugf("Updating TransportServer Status with %v for resource name:%v , namespace: %v",
+			tsCopy.Status, ts.Name, ts.Namespace)
+		_, err := crMgr.kubeCRClient.CisV1().TransportServers(ts.Namespace).UpdateStatus(
+			context.TODO(), tsCopy, metav1.UpdateOptions{})
+		if err == nil {
+			return
+		}
+		if !k8serrors.IsConflict(err) || attempt == statusUpdateAttempts {
+			log.Debugf("Error while updating Transport server status:%v", err)
+			return
+		}
+		// Informer cache is stale, retry with the latest TransportServer
+		ts, err = crMgr.kubeCRClient.CisV1().TransportServers(ts.Namespace).Get(
+			context.TODO(), ts.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("Error while fetching transport server to update status:%v", err)
+			return
+		}
+	}
+}
+
+// updatePolicyStatus updates the status of Policy with the given update
+// Status is updated only when it changes, so that an unchanged status does not trigger processing again
+func (crMgr *CRManager) updatePolicyStatus(plc *cisapiv1.Policy, update func(plc *cisapiv1.Policy)) {
+	for attempt := 1; ; attempt++ {
+		plcCopy := plc.DeepCopy()
+		update(plcCopy)
+		if reflect.DeepEqual(plc.Status, plcCopy.Status) {
+			return
+		}
+
+		log.Debugf("Updating Policy Status with %v for resource name:%v , namespace: %v",
+			plcCopy.Status, plc.Name, plc.Namespace)
+		_, err := crMgr.kubeCRClient.CisV1().Policies(plc.Namespace).UpdateStatus(
+			context.TODO(), plcCopy, metav1.UpdateOptions{})
+		if err == nil {
+			return
+		}
+		if !k8serrors.IsConflict(err) || attempt == statusUpdateAttempts {
+			log.Debugf("Error while updating policy status:%v", err)
+			return
+		}
+		// Informer cache is stale, retry with the latest Policy
+		plc, err = crMgr.kubeCRClient.CisV1().Policies(plc.Namespace).Get(
+			context.TODO(), plc.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Debugf("Error while fetching policy to update status:%v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package crmanager
+
+import (
+	"container/list"
+	"context"
+	"time"
+
+	crdfake "github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned/fake"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/teem"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Resource Status", func() {
+	var mockCRM *mockCRManager
+	var vs *cisapiv1.VirtualServer
+	var ts *cisapiv1.TransportServer
+	namespace := "default"
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		vs = test.NewVirtualServer(
+			"SampleVS",
+			namespace,
+			cisapiv1.VirtualServerSpec{
+				Host:                 "test.com",
+				VirtualServerAddress: "1.2.3.4",
+				Pools: []cisapiv1.Pool{
+					{
+						Path:        "/path",
+						Service:     "svc1",
+						ServicePort: 80,
+					},
+				},
+			})
+		vs.Generation = 2
+		ts = test.NewTransportServer(
+			"SampleTS",
+			namespace,
+			cisapiv1.TransportServerSpec{
+				VirtualServerAddress: "1.2.3.5",
+				VirtualServerPort:    8080,
+				Pool: cisapiv1.Pool{
+					Service:     "svc1",
+					ServicePort: 80,
+				},
+			})
+		mockCRM.kubeCRClient = crdfake.NewSimpleClientset(vs, ts)
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		mockCRM.crInformers[namespace] = mockCRM.newNamespacedInformer(namespace)
+		mockCRM.resources = NewResources()
+		mockCRM.TeemData = &teem.TeemsData{
+			ResourceType: teem.ResourceTypes{
+				VirtualServer:   make(map[string]int),
+				TransportServer: make(map[string]int),
+			},
+		}
+	})
+
+	getVSStatus := func() cisapiv1.VirtualServerStatus {
+		latest, err := mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+			context.TODO(), vs.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return latest.Status
+	}
+
+	It("Update VirtualServer conditions", func() {
+		mockCRM.updateVirtualServerStatus(vs, "",
+			newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionTrue, cisapiv1.ReasonProgrammed, "posted"))
+		status := getVSStatus()
+		Expect(status.ObservedGeneration).To(BeEquivalentTo(2))
+		Expect(status.StatusOk).To(Equal(statusOk))
+		cond := meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionProgrammed)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.ObservedGeneration).To(BeEquivalentTo(2))
+		Expect(cond.LastTransitionTime.IsZero()).To(BeFalse())
+
+		// Transition time is retained for the same status
+		vs, _ = mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+			context.TODO(), vs.Name, metav1.GetOptions{})
+		mockCRM.updateVirtualServerStatus(vs, "",
+			newCondition(cisapiv1.ConditionProgrammed, metav1.ConditionTrue, cisapiv1.ReasonProgrammed, "posted"),
+			newCondition(cisapiv1.ConditionAccepted, metav1.ConditionTrue, cisapiv1.ReasonAccepted, "valid"))
+		status = getVSStatus()
+		Expect(status.Conditions).To(HaveLen(2))
+		Expect(meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionProgrammed).LastTransitionTime).
+			To(Equal(cond.LastTransitionTime))
+
+		mockCRM.updateVirtualServerStatus(vs, "",
+			getProgrammedCondition(agentResponse{tenant: "test", message: "declaration is invalid"}))
+		status = getVSStatus()
+		Expect(status.StatusOk).To(Equal(statusError))
+		cond = meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionProgrammed)
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonRejected))
+		Expect(cond.Message).To(ContainSubstring("declaration is invalid"))
+	})
+
+	It("Report conditions while processing VirtualServer", func() {
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+		status := getVSStatus()
+		Expect(meta.IsStatusConditionTrue(status.Conditions, cisapiv1.ConditionAccepted)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(status.Conditions, cisapiv1.ConditionIPAllocated)).To(BeTrue())
+		cond := meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionResolvedRefs)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonServiceNotFound))
+		Expect(status.StatusOk).To(Equal(statusPending), "Status should be pending until posted to BIG-IP")
+
+		svc := test.NewService("svc1", "1", namespace, v1.ServiceTypeClusterIP,
+			[]v1.ServicePort{{Port: 80, Name: "port0"}})
+		_ = mockCRM.crInformers[namespace].svcInformer.GetIndexer().Add(svc)
+		latest, _ := mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+			context.TODO(), vs.Name, metav1.GetOptions{})
+		Expect(mockCRM.processVirtualServers(latest, false)).To(BeNil())
+		Expect(meta.IsStatusConditionTrue(getVSStatus().Conditions, cisapiv1.ConditionResolvedRefs)).To(BeTrue())
+	})
+
+	It("Report conditions on VirtualServers merged into the virtual", func() {
+		vs2 := test.NewVirtualServer("SampleVS2", namespace, cisapiv1.VirtualServerSpec{
+			Host:                 "test.com",
+			VirtualServerAddress: "1.2.3.4",
+			Pools:                []cisapiv1.Pool{{Path: "/path2", Service: "svc2", ServicePort: 80}},
+		})
+		_, _ = mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Create(context.TODO(), vs2, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs2)
+		svc := test.NewService("svc1", "1", namespace, v1.ServiceTypeClusterIP,
+			[]v1.ServicePort{{Port: 80, Name: "port0"}})
+		_ = mockCRM.crInformers[namespace].svcInformer.GetIndexer().Add(svc)
+		Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+
+		getVS2 := func() *cisapiv1.VirtualServer {
+			latest, err := mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+				context.TODO(), vs2.Name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			return latest
+		}
+		status := getVS2().Status
+		Expect(meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionAccepted)).To(BeNil(),
+			"Accepted should be reported on processing the VirtualServer itself")
+		Expect(meta.IsStatusConditionTrue(status.Conditions, cisapiv1.ConditionIPAllocated)).To(BeTrue())
+		cond := meta.FindStatusCondition(status.Conditions, cisapiv1.ConditionResolvedRefs)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Message).To(ContainSubstring("svc2"), "Services of the VirtualServer itself should be resolved")
+		Expect(meta.IsStatusConditionTrue(getVSStatus().Conditions, cisapiv1.ConditionResolvedRefs)).To(BeTrue())
+
+		// Response of the tenant is reported on all the VirtualServers of the virtual
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Update(getVS2())
+		mockCRM.requestQueue = &requestQueueData{List: list.New()}
+		id := mockCRM.enqueueReq(ResourceConfigWrapper{rsCfgs: mockCRM.resources.GetAllResources()})
+		respChan := make(chan agentResponse, 1)
+		respChan <- agentResponse{id: id, tenant: DEFAULT_PARTITION, programmed: true}
+		close(respChan)
+		mockCRM.responseHandler(respChan)
+		Expect(meta.IsStatusConditionTrue(getVS2().Status.Conditions, cisapiv1.ConditionProgrammed)).To(BeTrue())
+	})
+
+	It("Reject conflicting persistence on a shared address", func() {
+		vs.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+		vs.Spec.PersistenceProfile = &cisapiv1.PersistenceProfile{Method: "cookie"}
+		vs2 := test.NewVirtualServer("SampleVS2", namespace, cisapiv1.VirtualServerSpec{
+			Host:                 "test.com",
+			VirtualServerAddress: "1.2.3.4",
+			PersistenceProfile:   &cisapiv1.PersistenceProfile{Method: "source-address"},
+			Pools:                []cisapiv1.Pool{{Path: "/path2", Service: "svc2", ServicePort: 80}},
+		})
+		vs2.CreationTimestamp = metav1.Now()
+		_, _ = mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Create(context.TODO(), vs2, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs2)
+
+		getVS2 := func() *cisapiv1.VirtualServer {
+			latest, err := mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+				context.TODO(), vs2.Name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			return latest
+		}
+		for _, vrt := range []*cisapiv1.VirtualServer{vs2, vs} {
+			Expect(mockCRM.processVirtualServers(vrt, false)).To(BeNil())
+			rsCfg := mockCRM.resources.rsMap[formatVirtualServerName("1.2.3.4", 80)]
+			Expect(rsCfg).NotTo(BeNil())
+			Expect(rsCfg.MetaData.virtuals).To(Equal([]string{vs.Name}), "Conflicting VirtualServer should not be merged")
+			Expect(*rsCfg.Virtual.Persistence).To(Equal(Persistence{Method: "cookie"}),
+				"Persistence of the oldest VirtualServer should be retained")
+			cond := meta.FindStatusCondition(getVS2().Status.Conditions, cisapiv1.ConditionAccepted)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(cisapiv1.ReasonPersistenceConflict))
+			Expect(cond.Message).To(ContainSubstring(vs.Name))
+		}
+		Expect(meta.IsStatusConditionTrue(getVSStatus().Conditions, cisapiv1.ConditionAccepted)).To(BeTrue())
+
+		// VirtualServer is accepted once the persistence no longer conflicts
+		vs2 = getVS2()
+		vs2.Spec.PersistenceProfile = nil
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Update(vs2)
+		Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap[formatVirtualServerName("1.2.3.4", 80)].MetaData.virtuals).To(HaveLen(2))
+		Expect(meta.IsStatusConditionTrue(getVS2().Status.Conditions, cisapiv1.ConditionAccepted)).To(BeTrue())
+	})
+
+	It("Reject conflicting tenants on a shared address", func() {
+		vs.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+		vs.Labels = map[string]string{TenantLabel: "team1"}
+		vs2 := test.NewVirtualServer("SampleVS2", namespace, cisapiv1.VirtualServerSpec{
+			Host:                 "test.com",
+			VirtualServerAddress: "1.2.3.4",
+			Pools:                []cisapiv1.Pool{{Path: "/path2", Service: "svc2", ServicePort: 80}},
+		})
+		vs2.Labels = map[string]string{TenantLabel: "team2"}
+		vs2.CreationTimestamp = metav1.Now()
+		_, _ = mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Create(context.TODO(), vs2, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs2)
+
+		getVS2 := func() *cisapiv1.VirtualServer {
+			latest, err := mockCRM.kubeCRClient.CisV1().VirtualServers(namespace).Get(
+				context.TODO(), vs2.Name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			return latest
+		}
+		for _, vrt := range []*cisapiv1.VirtualServer{vs2, vs} {
+			Expect(mockCRM.processVirtualServers(vrt, false)).To(BeNil())
+			rsCfg := mockCRM.resources.rsMap[formatVirtualServerName("1.2.3.4", 80)]
+			Expect(rsCfg).NotTo(BeNil())
+			Expect(rsCfg.MetaData.virtuals).To(Equal([]string{vs.Name}), "Conflicting VirtualServer should not be merged")
+			Expect(rsCfg.Virtual.Partition).To(Equal("team1"), "Tenant of the oldest VirtualServer should be used")
+			cond := meta.FindStatusCondition(getVS2().Status.Conditions, cisapiv1.ConditionAccepted)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal(cisapiv1.ReasonTenantConflict))
+			Expect(cond.Message).To(ContainSubstring("team1"))
+		}
+
+		// VirtualServer is accepted once the tenant no longer conflicts
+		vs2 = getVS2()
+		vs2.Labels[TenantLabel] = "team1"
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Update(vs2)
+		Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+		Expect(mockCRM.resources.rsMap[formatVirtualServerName("1.2.3.4", 80)].MetaData.virtuals).To(HaveLen(2))
+		Expect(meta.IsStatusConditionTrue(getVS2().Status.Conditions, cisapiv1.ConditionAccepted)).To(BeTrue())
+	})
+
+	It("Report invalid VirtualServer", func() {
+		vs.Spec.VirtualServerAddress = ""
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+		cond := meta.FindStatusCondition(getVSStatus().Conditions, cisapiv1.ConditionAccepted)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonInvalid))
+		cond = meta.FindStatusCondition(getVSStatus().Conditions, cisapiv1.ConditionResolvedRefs)
+		Expect(cond).NotTo(BeNil(), "ResolvedRefs should be reported when processing stops early")
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonServiceNotFound))
+	})
+
+	It("Report unresolved references of VirtualServer", func() {
+		svc := test.NewService("svc1", "1", namespace, v1.ServiceTypeClusterIP,
+			[]v1.ServicePort{{Port: 80, Name: "port0"}})
+		_ = mockCRM.crInformers[namespace].svcInformer.GetIndexer().Add(svc)
+		getRefsCond := func() *metav1.Condition {
+			_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+			Expect(mockCRM.processVirtualServers(vs, false)).To(BeNil())
+			cond := meta.FindStatusCondition(getVSStatus().Conditions, cisapiv1.ConditionResolvedRefs)
+			Expect(cond).NotTo(BeNil())
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			return cond
+		}
+
+		vs.Spec.TLSProfileName = "missing-tls"
+		Expect(getRefsCond().Reason).To(Equal(cisapiv1.ReasonTLSProfileNotFound))
+
+		vs.Spec.TLSProfileName = ""
+		vs.Spec.PolicyName = "missing-plc"
+		Expect(getRefsCond().Reason).To(Equal(cisapiv1.ReasonInvalidPolicy))
+	})
+
+	It("Report conditions while processing TransportServer", func() {
+		_ = mockCRM.crInformers[namespace].tsInformer.GetIndexer().Add(ts)
+		Expect(mockCRM.processTransportServers(ts, false)).To(BeNil())
+		latest, err := mockCRM.kubeCRClient.CisV1().TransportServers(namespace).Get(
+			context.TODO(), ts.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(meta.IsStatusConditionTrue(latest.Status.Conditions, cisapiv1.ConditionAccepted)).To(BeTrue())
+		cond := meta.FindStatusCondition(latest.Status.Conditions, cisapiv1.ConditionIPAllocated)
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonStaticAddress))
+		Expect(cond.Message).To(Equal("1.2.3.5"))
+	})
+
+	It("Report unresolved references of TransportServer when processing stops early", func() {
+		ts.Spec.VirtualServerAddress = ""
+		_ = mockCRM.crInformers[namespace].tsInformer.GetIndexer().Add(ts)
+		_ = mockCRM.processTransportServers(ts, false)
+		latest, err := mockCRM.kubeCRClient.CisV1().TransportServers(namespace).Get(
+			context.TODO(), ts.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		cond := meta.FindStatusCondition(latest.Status.Conditions, cisapiv1.ConditionResolvedRefs)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(cisapiv1.ReasonServiceNotFound))
+	})
+
+	It("Report AS3 errors on Policy", func() {
+		plc := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace, Generation: 1},
+			Spec: cisapiv1.PolicySpec{
+				LtmPolicies: cisapiv1.LtmIRulesSpec{InSecure: "/Common/missing_policy"},
+			},
+		}
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(namespace).Create(context.TODO(), plc, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(plc)
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs)
+		mockCRM.requestQueue = &requestQueueData{List: list.New()}
+
+		rsCfg := &ResourceConfig{}
+		rsCfg.Virtual.Partition = "test"
+		rsCfg.MetaData.ResourceType = VirtualServer
+		rsCfg.MetaData.rscName = vs.Name
+		rsCfg.MetaData.namespace = namespace
+		rsCfg.MetaData.policies = []string{namespace + "/" + plc.Name}
+		id := mockCRM.enqueueReq(ResourceConfigWrapper{rsCfgs: ResourceConfigs{rsCfg}})
+
+		respChan := make(chan agentResponse, 1)
+		respChan <- agentResponse{id: id, tenant: "test", message: "/Common/missing_policy does not exist"}
+		close(respChan)
+		mockCRM.responseHandler(respChan)
+
+		latest, err := mockCRM.kubeCRClient.CisV1().Policies(namespace).Get(
+			context.TODO(), plc.Name, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		cond := meta.FindStatusCondition(latest.Status.Conditions, cisapiv1.ConditionProgrammed)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.ObservedGeneration).To(BeEquivalentTo(1))
+		Expect(cond.Message).To(ContainSubstring("/Common/missing_policy does not exist"))
+		Expect(meta.IsStatusConditionFalse(getVSStatus().Conditions, cisapiv1.ConditionProgrammed)).To(BeTrue())
+	})
+
+	It("Report AS3 errors on Policy across its virtuals", func() {
+		plc := &cisapiv1.Policy{
+			ObjectMeta: metav1.ObjectMeta{Name: "plc", Namespace: namespace, Generation: 1},
+		}
+		_, _ = mockCRM.kubeCRClient.CisV1().Policies(namespace).Create(context.TODO(), plc, metav1.CreateOptions{})
+		_ = mockCRM.crInformers[namespace].plcInformer.GetIndexer().Add(plc)
+		mockCRM.requestQueue = &requestQueueData{List: list.New()}
+
+		var config ResourceConfigWrapper
+		for _, tenant := range []string{"good", "bad"} {
+			rsCfg := &ResourceConfig{}
+			rsCfg.Virtual.Partition = tenant
+			rsCfg.MetaData.ResourceType = VirtualServer
+			rsCfg.MetaData.rscName = tenant + "_vs"
+			rsCfg.MetaData.namespace = namespace
+			rsCfg.MetaData.policies = []string{namespace + "/" + plc.Name}
+			config.rsCfgs = append(config.rsCfgs, rsCfg)
+		}
+		respond := func(id int, tenant, message string) *metav1.Condition {
+			respChan := make(chan agentResponse, 1)
+			respChan <- agentResponse{id: id, tenant: tenant, programmed: message == "", message: message}
+			close(respChan)
+			mockCRM.responseHandler(respChan)
+			latest, err := mockCRM.kubeCRClient.CisV1().Policies(namespace).Get(
+				context.TODO(), plc.Name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			return meta.FindStatusCondition(latest.Status.Conditions, cisapiv1.ConditionProgrammed)
+		}
+
+		id := mockCRM.enqueueReq(config)
+		Expect(respond(id, "bad", "invalid iRule").Status).To(Equal(metav1.ConditionFalse))
+		// Success of the other virtual should not hide the failure
+		cond := respond(id, "good", "")
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Message).To(ContainSubstring("VirtualServer " + namespace + "/bad_vs (tenant bad: invalid iRule)"))
+		Expect(cond.Message).NotTo(ContainSubstring("good_vs"))
+
+		id = mockCRM.enqueueReq(config)
+		_ = respond(id, "good", "")
+		Expect(respond(id, "bad", "").Status).To(Equal(metav1.ConditionTrue))
+
+		// The failure of a virtual no longer using the Policy is forgotten
+		Expect(respond(mockCRM.enqueueReq(config), "bad", "invalid iRule").Status).To(Equal(metav1.ConditionFalse))
+		config.rsCfgs[1].MetaData.policies = nil
+		Expect(respond(mockCRM.enqueueReq(config), "good", "").Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("Release the request once all its tenants respond", func() {
+		mockCRM.requestQueue = &requestQueueData{List: list.New()}
+		newConfig := func(tenants ...string) ResourceConfigWrapper {
+			var config ResourceConfigWrapper
+			for _, tenant := range tenants {
+				rsCfg := &ResourceConfig{}
+				rsCfg.Virtual.Partition = tenant
+				rsCfg.MetaData.rscName = tenant + "_vs"
+				rsCfg.MetaData.namespace = namespace
+				config.rsCfgs = append(config.rsCfgs, rsCfg)
+			}
+			return config
+		}
+		first := mockCRM.enqueueReq(newConfig("fast", "slow"))
+		second := mockCRM.enqueueReq(newConfig("fast"))
+		Expect(second).To(Equal(first + 1))
+
+		// Response of the fast tenant to the newer request should not discard the slow tenant
+		Expect(mockCRM.releaseReq(agentResponse{id: second, tenant: "fast"})).To(HaveLen(1))
+		Expect(mockCRM.requestQueue.Len()).To(Equal(1))
+		items := mockCRM.releaseReq(agentResponse{id: first, tenant: "slow"})
+		Expect(items).To(HaveLen(1))
+		Expect(items[0].rscName).To(Equal("slow_vs"))
+		Expect(mockCRM.requestQueue.Len()).To(BeZero())
+
+		// Request ids are not reused once the queue is empty
+		third := mockCRM.enqueueReq(newConfig("fast"))
+		Expect(third).To(Equal(second + 1))
+
+		// Request which is not posted is removed right away
+		mockCRM.dequeueReq(third)
+		Expect(mockCRM.requestQueue.Len()).To(BeZero())
+	})
+
+	It("IPAM conditions", func() {
+		Expect(getIPAMCondition(Requested, "test", "").Reason).To(Equal(cisapiv1.ReasonIPAMPending))
+		Expect(getIPAMCondition(InvalidInput, "test", "").Reason).To(Equal(cisapiv1.ReasonInvalidIPAMLabel))
+		cond := getIPAMCondition(Allocated, "test", "10.1.1.1")
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Message).To(Equal("10.1.1.1"))
+	})
+})
@@ -17,13 +17,17 @@
 package crmanager
 
 import (
+	"context"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/teem"
 
 	"github.com/F5Networks/f5-ipam-controller/pkg/ipammachinery"
 	"github.com/F5Networks/k8s-bigip-ctlr/config/client/clientset/versioned"
 	apm "github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/health"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/pollers"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 	v1 "k8s.io/api/core/v1"
@@ -33,6 +37,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	gwclientset "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 )
 
 type (
@@ -43,6 +48,7 @@ type (
 		kubeClient         kubernetes.Interface
 		kubeAPIClient      *extClient.Clientset
 		crInformers        map[string]*CRInformer
+		crInformersMutex   sync.RWMutex
 		nsInformer         *NSInformer
 		eventNotifier      *apm.EventNotifier
 		resourceSelector   labels.Selector
@@ -57,14 +63,38 @@ type (
 		oldNodes           []Node
 		UseNodeInternal    bool
 		initState          bool
-		SSLContext         map[string]*v1.Secret
-		dgPath             string
+		SSLContext         map[string]*v1.Secret // TLS Secrets by namespace/name
+		tenantPerNamespace bool
 		shareNodes         bool
 		ipamCli            *ipammachinery.IPAMClient
 		ipamCR             string
+		ipamProvider       IPAMProvider
+		useEndpointSlices  bool
 		defaultRouteDomain int
 		TeemData           *teem.TeemsData
 		requestQueue       *requestQueueData
+		leaderCancel       context.CancelFunc
+		leaderStopped      chan struct{}
+		webhookParams      WebhookParams
+		webhookServer      *http.Server
+		// workerProgress tracks the resource being processed by customResourceWorker
+		workerProgress health.Progress
+		// Gateway API resources are watched only when gatewayClient is set
+		gatewayClient         gwclientset.Interface
+		gwcInformer           *GWCInformer
+		gatewayControllerName string
+		// drainer keeps the members removed from pools disabled until they are drained
+		drainer poolMemberDrainer
+		// policyRefs holds the Policy referred by each VirtualServer and TransportServer as last processed
+		policyRefs map[string]string
+		// policyUsageQueue holds the Policies whose usage is to be updated, delayed by policyUsageDelay
+		policyUsageQueue workqueue.DelayingInterface
+		policyUsageDelay time.Duration
+		// policyFinalizer protects the Policies in use from deletion with a finalizer
+		policyFinalizer bool
+		// baselinePolicy is the namespace/name of the Policy applied to all the virtuals
+		baselinePolicy      string
+		baselinePlcInformer *BaselinePolicyInformer
 	}
 	// Params defines parameters
 	Params struct {
@@ -81,7 +111,38 @@ type (
 		NodeLabelSelector  string
 		ShareNodes         bool
 		IPAM               bool
+		IPAMConfigMap      string
+		EndpointSlices     bool
 		DefaultRouteDomain int
+		TenantPerNamespace bool
+		PolicyFinalizer    bool
+		BaselinePolicy     string
+		LeaderElection     LeaderElectionParams
+		Webhook            WebhookParams
+		GatewayAPI         GatewayAPIParams
+	}
+	// LeaderElectionParams defines parameters for Lease based leader election
+	LeaderElectionParams struct {
+		Enabled        bool
+		LeaseName      string
+		LeaseNamespace string
+		Identity       string
+		LeaseDuration  time.Duration
+		RenewDeadline  time.Duration
+		RetryPeriod    time.Duration
+	}
+	// WebhookParams defines parameters for the validating admission webhook
+	WebhookParams struct {
+		// Port to serve the webhook on, 0 disables the webhook
+		Port int
+		// TLSSecret is the namespace/name of the kubernetes.io/tls Secret with the serving certificate
+		TLSSecret string
+	}
+	// GatewayAPIParams defines parameters for processing Gateway API resources
+	GatewayAPIParams struct {
+		Enabled bool
+		// ControllerName is matched against the controller of GatewayClasses
+		ControllerName string
 	}
 	// CRInformer defines the structure of Custom Resource Informer
 	CRInformer struct {
@@ -95,12 +156,31 @@ type (
 		ilInformer   cache.SharedIndexInformer
 		ednsInformer cache.SharedIndexInformer
 		plcInformer  cache.SharedIndexInformer
+		// TLS Secrets referred by TLSProfiles and Gateways
+		secretInformer cache.SharedIndexInformer
+		// EndpointSlices are watched instead of Endpoints when useEndpointSlices is set
+		epSliceInformer cache.SharedIndexInformer
+		// Gateway API informers, nil unless Gateway API is enabled
+		gwInformer        cache.SharedIndexInformer
+		httpRouteInformer cache.SharedIndexInformer
+		tlsRouteInformer  cache.SharedIndexInformer
+		tcpRouteInformer  cache.SharedIndexInformer
 	}
 
 	NSInformer struct {
 		stopCh     chan struct{}
 		nsInformer cache.SharedIndexInformer
 	}
+	// GWCInformer watches the cluster scoped GatewayClasses
+	GWCInformer struct {
+		stopCh      chan struct{}
+		gwcInformer cache.SharedIndexInformer
+	}
+	// BaselinePolicyInformer watches the cluster-wide baseline Policy
+	BaselinePolicyInformer struct {
+		stopCh      chan struct{}
+		plcInformer cache.SharedIndexInformer
+	}
 	rqKey struct {
 		namespace string
 		kind      string
@@ -116,6 +196,12 @@ type (
 		namespace    string
 		hosts        []string
 		Protocol     string
+		// gateway is the namespace/name of the Gateway the config is derived from
+		gateway string
+		// policies are the namespace/name of the Policies applied to the config
+		policies []string
+		// virtuals are the names of the VirtualServers merged into the config
+		virtuals []string
 	}
 
 	// Virtual Server Key - unique server is Name + Port
@@ -142,6 +228,8 @@ type (
 		SNAT                   string                `json:"snat,omitempty"`
 		WAF                    string                `json:"waf,omitempty"`
 		Firewall               string                `json:"firewallPolicy,omitempty"`
+		ProfileDOS             string                `json:"profileDOS,omitempty"`
+		LTMPolicy              string                `json:"-"`
 		LogProfiles            []string              `json:"logProfiles,omitempty"`
 		Mode                   string                `json:"mode,omitempty"`
 		TranslateServerAddress bool                  `json:"translateServerAddress"`
@@ -151,10 +239,24 @@ type (
 		PersistenceMethods     []string              `json:"-"`
 		HTTPTraffic            string                `json:"-"`
 		isSecure               bool                  `json:"-"`
+		Persistence            *Persistence          `json:"-"`
 	}
 	// Virtuals is slice of virtuals
 	Virtuals []Virtual
 
+	// Persistence is the session persistence of a virtual server, either
+	// a BIG-IP persistence profile or a persistence method
+	Persistence struct {
+		Reference           string `json:"reference,omitempty"`
+		Method              string `json:"method,omitempty"`
+		CookieMethod        string `json:"cookieMethod,omitempty"`
+		CookieName          string `json:"cookieName,omitempty"`
+		AddressMask         string `json:"addressMask,omitempty"`
+		Timeout             int32  `json:"timeout,omitempty"`
+		Rule                string `json:"rule,omitempty"`
+		FallbackPersistence string `json:"fallbackPersistence,omitempty"`
+	}
+
 	// ServiceAddress Service IP address definition (BIG-IP virtual-address).
 	ServiceAddress struct {
 		ArpEnabled         bool   `json:"arpEnabled,omitempty"`
@@ -199,10 +301,6 @@ type (
 
 	DNSConfig map[string]WideIP
 
-	WideIPs struct {
-		WideIPs []WideIP `json:"wideIPs"`
-	}
-
 	WideIP struct {
 		DomainName string     `json:"name"`
 		RecordType string     `json:"recordType"`
@@ -210,11 +308,25 @@ type (
 		Pools      []GSLBPool `json:"pools"`
 	}
 	GSLBPool struct {
-		Name       string   `json:"name"`
-		RecordType string   `json:"recordType"`
-		LBMethod   string   `json:"LoadBalancingMode"`
-		Members    []string `json:"members"`
-		Monitor    *Monitor `json:"monitor,omitempty"`
+		Name       string           `json:"name"`
+		RecordType string           `json:"recordType"`
+		LBMethod   string           `json:"LoadBalancingMode"`
+		Members    []GSLBPoolMember `json:"members"`
+		Monitor    *Monitor         `json:"monitor,omitempty"`
+		// FallbackLBMethod is used when the preferred LBMethod fails
+		FallbackLBMethod string `json:"fallbackMode,omitempty"`
+		Ratio            int32  `json:"ratio,omitempty"`
+		Order            int32  `json:"order,omitempty"`
+	}
+
+	// GSLBPoolMember is a virtual server on a GSLB server, or a static address in a data center
+	GSLBPoolMember struct {
+		Server        string `json:"server,omitempty"`
+		VirtualServer string `json:"virtualServer,omitempty"`
+		Address       string `json:"address,omitempty"`
+		Port          int32  `json:"port,omitempty"`
+		DataCenter    string `json:"dataCenter,omitempty"`
+		Ratio         int32  `json:"ratio,omitempty"`
 	}
 
 	ResourceConfigWrapper struct {
@@ -235,6 +347,15 @@ type (
 		Members         []PoolMember `json:"members"`
 		NodeMemberLabel string       `json:"-"`
 		MonitorNames    []string     `json:"monitors,omitempty"`
+		DrainTimeout    int32        `json:"-"`
+		Balance         string       `json:"loadBalancingMode,omitempty"`
+		SlowRampTime    *int32       `json:"slowRampTime,omitempty"`
+		MinimumMonitors int32        `json:"minimumMonitors,omitempty"`
+		ReselectTries   int32        `json:"reselectTries,omitempty"`
+		ConnectionLimit int32        `json:"-"`
+		RateLimit       int32        `json:"-"`
+		Ratio           int32        `json:"-"`
+		MonitorRefs     []string     `json:"-"`
 	}
 	// Pools is slice of pool
 	Pools []Pool
@@ -259,6 +380,15 @@ type (
 		Recv       string `json:"recv"`
 		Timeout    int    `json:"timeout,omitempty"`
 		TargetPort int32  `json:"targetPort,omitempty"`
+		// Client certificate and key of the https monitor
+		ClientCert string `json:"-"`
+		ClientKey  string `json:"-"`
+		QueryName  string `json:"queryName,omitempty"`
+		QueryType  string `json:"queryType,omitempty"`
+		Base       string `json:"base,omitempty"`
+		Filter     string `json:"filter,omitempty"`
+		Pathname   string `json:"pathname,omitempty"`
+		Arguments  string `json:"arguments,omitempty"`
 	}
 	// Monitors  is slice of monitor
 	Monitors []Monitor
@@ -281,20 +411,25 @@ type (
 
 	// action config for a Rule
 	action struct {
-		Name      string `json:"name"`
-		Pool      string `json:"pool,omitempty"`
-		HTTPHost  bool   `json:"httpHost,omitempty"`
-		HttpReply bool   `json:"httpReply,omitempty"`
-		HTTPURI   bool   `json:"httpUri,omitempty"`
-		Forward   bool   `json:"forward,omitempty"`
-		Location  string `json:"location,omitempty"`
-		Path      string `json:"path,omitempty"`
-		Redirect  bool   `json:"redirect,omitempty"`
-		Replace   bool   `json:"replace,omitempty"`
-		Request   bool   `json:"request,omitempty"`
-		Reset     bool   `json:"reset,omitempty"`
-		Select    bool   `json:"select,omitempty"`
-		Value     string `json:"value,omitempty"`
+		Name       string `json:"name"`
+		Pool       string `json:"pool,omitempty"`
+		HTTPHost   bool   `json:"httpHost,omitempty"`
+		HTTPHeader bool   `json:"httpHeader,omitempty"`
+		HttpReply  bool   `json:"httpReply,omitempty"`
+		HTTPURI    bool   `json:"httpUri,omitempty"`
+		Forward    bool   `json:"forward,omitempty"`
+		Location   string `json:"location,omitempty"`
+		Path       string `json:"path,omitempty"`
+		Redirect   bool   `json:"redirect,omitempty"`
+		Insert     bool   `json:"insert,omitempty"`
+		Replace    bool   `json:"replace,omitempty"`
+		Remove     bool   `json:"remove,omitempty"`
+		Request    bool   `json:"request,omitempty"`
+		Response   bool   `json:"response,omitempty"`
+		Reset      bool   `json:"reset,omitempty"`
+		Select     bool   `json:"select,omitempty"`
+		TmName     string `json:"tmName,omitempty"`
+		Value      string `json:"value,omitempty"`
 	}
 
 	// condition config for a Rule
@@ -409,10 +544,29 @@ type (
 		ConfigWriter    writer.Writer
 		EventChan       chan interface{}
 		PythonDriverPID int
-		activeDecl      as3Declaration
-		userAgent       string
-		HttpAddress     string
-		EnableIPV6      bool
+		// pythonDriver holds the configuration of the python driver, to restart it on BIG-IP failover
+		pythonDriver pythonDriverConfig
+		activeDecl   as3Declaration
+		userAgent    string
+		HttpAddress  string
+		EnableIPV6   bool
+		// GTMPostManager posts the GSLB declaration of ExternalDNS resources to the GTM BIG-IP
+		GTMPostManager *PostManager
+		activeGTMDecl  as3Declaration
+		// declMutex serializes posting the declarations by the worker with the leader election callbacks
+		declMutex sync.Mutex
+	}
+
+	// pythonDriverConfig is the configuration the python driver is started with
+	pythonDriverConfig struct {
+		global        globalSection
+		bigIP         bigIPSection
+		pythonBaseDir string
+		// stopCh is closed when the python driver is stopped by CIS
+		stopCh chan struct{}
+		// exitCh is closed once the python driver exits
+		exitCh chan struct{}
+		mutex  sync.Mutex
 	}
 
 	AgentParams struct {
@@ -485,7 +639,9 @@ type (
 		Policy   *as3ResourcePointer     `json:"policy,omitempty"`
 		Enabled  *bool                   `json:"enabled,omitempty"`
 		Location string                  `json:"location,omitempty"`
+		Insert   *as3ActionReplaceMap    `json:"insert,omitempty"`
 		Replace  *as3ActionReplaceMap    `json:"replace,omitempty"`
+		Remove   *as3ActionReplaceMap    `json:"remove,omitempty"`
 	}
 
 	as3ActionReplaceMap struct {
@@ -530,6 +686,9 @@ type (
 		LoadBalancingMode string               `json:"loadBalancingMode,omitempty"`
 		Members           []as3PoolMember      `json:"members,omitempty"`
 		Monitors          []as3ResourcePointer `json:"monitors,omitempty"`
+		SlowRampTime      *int32               `json:"slowRampTime,omitempty"`
+		MinimumMonitors   int32                `json:"minimumMonitors,omitempty"`
+		ReselectTries     int32                `json:"reselectTries,omitempty"`
 	}
 
 	// as3PoolMember maps to Pool_Member in AS3 Resources
@@ -538,6 +697,10 @@ type (
 		ServerAddresses  []string `json:"serverAddresses,omitempty"`
 		ServicePort      int32    `json:"servicePort,omitempty"`
 		ShareNodes       bool     `json:"shareNodes,omitempty"`
+		AdminState       string   `json:"adminState,omitempty"`
+		ConnectionLimit  int32    `json:"connectionLimit,omitempty"`
+		RateLimit        int32    `json:"rateLimit,omitempty"`
+		Ratio            int32    `json:"ratio,omitempty"`
 	}
 
 	// as3ResourcePointer maps to following in AS3 Resources
@@ -576,11 +739,27 @@ type (
 		LogProfiles            []as3ResourcePointer `json:"securityLogProfiles,omitempty"`
 		ProfileL4              string               `json:"profileL4,omitempty"`
 		AllowVLANs             []as3ResourcePointer `json:"allowVlans,omitempty"`
-		PersistenceMethods     []string             `json:"persistenceMethods,omitempty"`
+		PersistenceMethods     []as3MultiTypeParam  `json:"persistenceMethods,omitempty"`
 		ProfileTCP             as3MultiTypeParam    `json:"profileTCP,omitempty"`
 		ProfileUDP             as3MultiTypeParam    `json:"profileUDP,omitempty"`
 		ProfileHTTP            as3MultiTypeParam    `json:"profileHTTP,omitempty"`
 		ProfileHTTP2           as3MultiTypeParam    `json:"profileHTTP2,omitempty"`
+		ProfileRewrite         as3MultiTypeParam    `json:"profileRewrite,omitempty"`
+		ProfileDOS             as3MultiTypeParam    `json:"profileDOS,omitempty"`
+		// Persistence method used when the persistence method fails
+		FallbackPersistence string `json:"fallbackPersistenceMethod,omitempty"`
+	}
+
+	// as3Persist maps to Persist in AS3 Resources
+	as3Persist struct {
+		Class             string              `json:"class"`
+		PersistenceMethod string              `json:"persistenceMethod"`
+		CookieMethod      string              `json:"cookieMethod,omitempty"`
+		CookieName        string              `json:"cookieName,omitempty"`
+		TTL               int32               `json:"ttl,omitempty"`
+		AddressMask       string              `json:"addressMask,omitempty"`
+		Duration          int32               `json:"duration,omitempty"`
+		IRule             *as3ResourcePointer `json:"iRule,omitempty"`
 	}
 
 	// as3ServiceAddress maps to VirtualAddress in AS3 Resources
@@ -598,6 +777,9 @@ type (
 	// - Monitor
 	// - Monitor_HTTP
 	// - Monitor_HTTPS
+	// - Monitor_DNS
+	// - Monitor_LDAP
+	// - Monitor_External
 	as3Monitor struct {
 		Class             string  `json:"class,omitempty"`
 		Interval          int     `json:"interval,omitempty"`
@@ -607,11 +789,81 @@ type (
 		TimeUnitilUp      *int    `json:"timeUntilUp,omitempty"`
 		Adaptive          *bool   `json:"adaptive,omitempty"`
 		Dscp              *int    `json:"dscp,omitempty"`
-		Receive           string  `json:"receive"`
-		Send              string  `json:"send"`
+		Receive           *string `json:"receive,omitempty"`
+		Send              *string `json:"send,omitempty"`
 		TargetPort        *int32  `json:"targetPort,omitempty"`
 		ClientCertificate string  `json:"clientCertificate,omitempty"`
 		Ciphers           string  `json:"ciphers,omitempty"`
+		QueryName         string  `json:"queryName,omitempty"`
+		QueryType         string  `json:"queryType,omitempty"`
+		Base              string  `json:"base,omitempty"`
+		Filter            string  `json:"filter,omitempty"`
+		Pathname          string  `json:"pathname,omitempty"`
+		Arguments         string  `json:"arguments,omitempty"`
+	}
+
+	// as3GSLBDomain maps to GSLB_Domain in AS3 Resources
+	as3GSLBDomain struct {
+		Class              string              `json:"class"`
+		DomainName         string              `json:"domainName"`
+		ResourceRecordType string              `json:"resourceRecordType"`
+		PoolLbMode         string              `json:"poolLbMode,omitempty"`
+		Pools              []as3GSLBDomainPool `json:"pools,omitempty"`
+	}
+
+	// as3GSLBDomainPool maps to the pools of GSLB_Domain in AS3 Resources
+	as3GSLBDomainPool struct {
+		Use   string `json:"use"`
+		Ratio int32  `json:"ratio,omitempty"`
+	}
+
+	// as3GSLBPool maps to GSLB_Pool in AS3 Resources
+	as3GSLBPool struct {
+		Class              string               `json:"class"`
+		ResourceRecordType string               `json:"resourceRecordType"`
+		LBModePreferred    string               `json:"lbModePreferred,omitempty"`
+		LBModeFallback     string               `json:"lbModeFallback,omitempty"`
+		Members            []as3GSLBPoolMember  `json:"members,omitempty"`
+		Monitors           []as3ResourcePointer `json:"monitors,omitempty"`
+	}
+
+	// as3GSLBPoolMember maps to the members of GSLB_Pool in AS3 Resources
+	as3GSLBPoolMember struct {
+		Enabled       bool               `json:"enabled"`
+		Server        as3ResourcePointer `json:"server"`
+		VirtualServer string             `json:"virtualServer"`
+		Ratio         int32              `json:"ratio,omitempty"`
+	}
+
+	// as3GSLBServer maps to GSLB_Server in AS3 Resources
+	as3GSLBServer struct {
+		Class          string                       `json:"class"`
+		DataCenter     as3ResourcePointer           `json:"dataCenter"`
+		ServerType     string                       `json:"serverType"`
+		Devices        []as3GSLBServerDevice        `json:"devices"`
+		VirtualServers []as3GSLBServerVirtualServer `json:"virtualServers,omitempty"`
+	}
+
+	// as3GSLBServerDevice maps to the devices of GSLB_Server in AS3 Resources
+	as3GSLBServerDevice struct {
+		Address string `json:"address"`
+	}
+
+	// as3GSLBServerVirtualServer maps to the virtual servers of GSLB_Server in AS3 Resources
+	as3GSLBServerVirtualServer struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+		Port    int32  `json:"port"`
+	}
+
+	// as3GSLBMonitor maps to GSLB_Monitor in AS3 Resources
+	as3GSLBMonitor struct {
+		Class       string `json:"class"`
+		MonitorType string `json:"monitorType"`
+		Interval    int    `json:"interval,omitempty"`
+		Timeout     int    `json:"timeout,omitempty"`
+		Send        string `json:"send,omitempty"`
+		Receive     string `json:"receive,omitempty"`
 	}
 
 	// as3CABundle maps to CA_Bundle in AS3 Resources
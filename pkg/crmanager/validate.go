@@ -18,14 +18,15 @@ package crmanager
 
 import (
 	"fmt"
+	"strings"
 
 	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
-	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 )
 
+// checkValidVirtualServer returns an error describing why the VirtualServer cannot be processed
 func (crMgr *CRManager) checkValidVirtualServer(
 	vsResource *cisapiv1.VirtualServer,
-) bool {
+) error {
 
 	vsNamespace := vsResource.ObjectMeta.Namespace
 	vsName := vsResource.ObjectMeta.Name
@@ -33,38 +34,54 @@ func (crMgr *CRManager) checkValidVirtualServer(
 
 	crInf, ok := crMgr.getNamespacedInformer(vsNamespace)
 	if !ok {
-		log.Errorf("Informer not found for namespace: %v", vsNamespace)
-		return false
+		return fmt.Errorf("Informer not found for namespace: %v", vsNamespace)
 	}
 	// Check if the virtual exists and valid for us.
 	_, virtualFound, _ := crInf.vsInformer.GetIndexer().GetByKey(vkey)
 	if !virtualFound {
-		log.Infof("VirtualServer %s is invalid", vsName)
-		return false
+		return fmt.Errorf("VirtualServer %s is not found", vsName)
 	}
+	return crMgr.validateVirtualServerSpec(vsResource)
+}
+
+// validateVirtualServerSpec validates the spec of VirtualServer irrespective of the other resources
+func (crMgr *CRManager) validateVirtualServerSpec(
+	vsResource *cisapiv1.VirtualServer,
+) error {
+	vsName := vsResource.ObjectMeta.Name
 	bindAddr := vsResource.Spec.VirtualServerAddress
-	if crMgr.ipamCli == nil {
+	if !crMgr.isIPAMEnabled() {
 
 		// This ensures that pool-only mode only logs the message below the first
 		// time we see a config.
 		if bindAddr == "" {
-			log.Infof("No IP was specified for the virtual server %s", vsName)
-			return false
+			return fmt.Errorf("No IP was specified for the virtual server %s", vsName)
 		}
 	} else {
 		ipamLabel := vsResource.Spec.IPAMLabel
 		if ipamLabel == "" && bindAddr == "" {
-			log.Infof("No ipamLabel was specified for the virtual server %s", vsName)
-			return false
+			return fmt.Errorf("No ipamLabel was specified for the virtual server %s", vsName)
+		}
+	}
+	if err := validatePersistenceProfile(vsResource.Spec.PersistenceProfile); err != nil {
+		return fmt.Errorf("Invalid persistenceProfile of the virtual server %s: %v", vsName, err)
+	}
+	for _, pl := range vsResource.Spec.Pools {
+		if err := validateHeaderActions(pl.RequestHeaders); err != nil {
+			return fmt.Errorf("Invalid requestHeaders of path %v of the virtual server %s: %v", pl.Path, vsName, err)
+		}
+		if err := validateHeaderActions(pl.ResponseHeaders); err != nil {
+			return fmt.Errorf("Invalid responseHeaders of path %v of the virtual server %s: %v", pl.Path, vsName, err)
 		}
 	}
 
-	return true
+	return nil
 }
 
+// checkValidTransportServer returns an error describing why the TransportServer cannot be processed
 func (crMgr *CRManager) checkValidTransportServer(
 	tsResource *cisapiv1.TransportServer,
-) bool {
+) error {
 
 	vsNamespace := tsResource.ObjectMeta.Namespace
 	vsName := tsResource.ObjectMeta.Name
@@ -72,46 +89,95 @@ func (crMgr *CRManager) checkValidTransportServer(
 
 	crInf, ok := crMgr.getNamespacedInformer(vsNamespace)
 	if !ok {
-		log.Errorf("Informer not found for namespace: %v", vsNamespace)
-		return false
+		return fmt.Errorf("Informer not found for namespace: %v", vsNamespace)
 	}
 	// Check if the virtual exists and valid for us.
 	_, virtualFound, _ := crInf.tsInformer.GetIndexer().GetByKey(vkey)
 	if !virtualFound {
-		log.Infof("TransportServer %s is invalid", vsName)
-		return false
+		return fmt.Errorf("TransportServer %s is not found", vsName)
 	}
+	return crMgr.validateTransportServerSpec(tsResource)
+}
 
+// validateTransportServerSpec validates the spec of TransportServer irrespective of the other resources
+func (crMgr *CRManager) validateTransportServerSpec(
+	tsResource *cisapiv1.TransportServer,
+) error {
+	vsName := tsResource.ObjectMeta.Name
 	bindAddr := tsResource.Spec.VirtualServerAddress
 
-	if crMgr.ipamCli == nil {
+	if !crMgr.isIPAMEnabled() {
 		// This ensures that pool-only mode only logs the message below the first
 		// time we see a config.
 		if bindAddr == "" {
-			log.Infof("No IP was specified for the transport server %s", vsName)
-			return false
+			return fmt.Errorf("No IP was specified for the transport server %s", vsName)
 		}
 	} else {
 		ipamLabel := tsResource.Spec.IPAMLabel
 		if ipamLabel == "" && bindAddr == "" {
-			log.Infof("No ipamLabel was specified for the transport server %s", vsName)
-			return false
+			return fmt.Errorf("No ipamLabel was specified for the transport server %s", vsName)
 		}
 	}
 
 	if tsResource.Spec.Type == "" {
 		tsResource.Spec.Type = "tcp"
 	} else if !(tsResource.Spec.Type == "udp" || tsResource.Spec.Type == "tcp") {
-		log.Errorf("Invalid type value for transport server %s. Supported values are tcp and udp only", vsName)
-		return false
+		return fmt.Errorf("Invalid type value for transport server %s. Supported values are tcp and udp only", vsName)
+	}
+	if err := validatePersistenceProfile(tsResource.Spec.PersistenceProfile); err != nil {
+		return fmt.Errorf("Invalid persistenceProfile of the transport server %s: %v", vsName, err)
+	}
+
+	return nil
+}
+
+// validatePersistenceProfile validates that the persistence profile refers to a BIG-IP profile
+// or has a persistence method with the options of the method
+func validatePersistenceProfile(prof *cisapiv1.PersistenceProfile) error {
+	if prof == nil {
+		return nil
+	}
+	switch {
+	case prof.Reference != "" && prof.Method != "":
+		return fmt.Errorf("either reference or method is allowed")
+	case prof.Reference != "":
+		return nil
+	case prof.Method == "":
+		return fmt.Errorf("either reference or method is required")
+	case prof.Method == "universal" && prof.Rule == "":
+		return fmt.Errorf("rule is required for universal persistence")
+	case prof.CookieMethod != "" && prof.Method != "cookie":
+		return fmt.Errorf("cookieMethod is allowed only for cookie persistence")
+	case prof.AddressMask != "" && prof.Method != "source-address" && prof.Method != "destination-address":
+		return fmt.Errorf("addressMask is allowed only for source-address and destination-address persistence")
 	}
+	return nil
+}
 
-	return true
+// validateHeaderActions validates the names and values of the HTTP headers inserted, replaced and removed
+func validateHeaderActions(headers *cisapiv1.HeaderActions) error {
+	if headers == nil {
+		return nil
+	}
+	names := append([]string{}, headers.Remove...)
+	for _, hdr := range append(append([]cisapiv1.HTTPHeader{}, headers.Insert...), headers.Replace...) {
+		if strings.ContainsAny(hdr.Value, "\r\n") {
+			return fmt.Errorf("value of header %v contains a line break", hdr.Name)
+		}
+		names = append(names, hdr.Name)
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+			return fmt.Errorf("invalid header name '%v'", name)
+		}
+	}
+	return nil
 }
 
+// checkValidIngressLink returns an error describing why the IngressLink cannot be processed
 func (crMgr *CRManager) checkValidIngressLink(
 	il *cisapiv1.IngressLink,
-) bool {
+) error {
 
 	ilNamespace := il.ObjectMeta.Namespace
 	ilName := il.ObjectMeta.Name
@@ -119,29 +185,108 @@ func (crMgr *CRManager) checkValidIngressLink(
 
 	crInf, ok := crMgr.getNamespacedInformer(ilNamespace)
 	if !ok {
-		log.Errorf("Informer not found for namespace: %v", ilNamespace)
-		return false
+		return fmt.Errorf("Informer not found for namespace: %v", ilNamespace)
 	}
 	// Check if the virtual exists and valid for us.
 	_, virtualFound, _ := crInf.ilInformer.GetIndexer().GetByKey(ilkey)
 	if !virtualFound {
-		log.Infof("IngressLink %s is invalid", ilName)
-		return false
+		return fmt.Errorf("IngressLink %s is not found", ilName)
 	}
+	return crMgr.validateIngressLinkSpec(il)
+}
 
+// validateIngressLinkSpec validates the spec of IngressLink irrespective of the other resources
+func (crMgr *CRManager) validateIngressLinkSpec(
+	il *cisapiv1.IngressLink,
+) error {
+	ilName := il.ObjectMeta.Name
 	bindAddr := il.Spec.VirtualServerAddress
 
-	if crMgr.ipamCli == nil {
+	if !crMgr.isIPAMEnabled() {
 		if bindAddr == "" {
-			log.Infof("No IP was specified for ingresslink %s", ilName)
-			return false
+			return fmt.Errorf("No IP was specified for ingresslink %s", ilName)
 		}
 	} else {
 		ipamLabel := il.Spec.IPAMLabel
 		if ipamLabel == "" && bindAddr == "" {
-			log.Infof("No ipamLabel was specified for the il server %s", ilName)
-			return false
+			return fmt.Errorf("No ipamLabel was specified for the il server %s", ilName)
 		}
 	}
-	return true
+	return nil
+}
+
+// checkVirtualServerConflicts validates the VirtualServer against the resources already available,
+// so that conflicts are rejected by the admission webhook instead of failing while processing
+func (crMgr *CRManager) checkVirtualServerConflicts(vs *cisapiv1.VirtualServer) error {
+	if vs.Spec.VirtualServerAddress != "" && vs.Spec.IPAMLabel != "" {
+		return fmt.Errorf("Both virtualServerAddress and ipamLabel can not be specified")
+	}
+
+	crInf, ok := crMgr.getNamespacedInformer(vs.Namespace)
+	if !ok {
+		return fmt.Errorf("Informer not found for namespace: %v", vs.Namespace)
+	}
+	if vs.Spec.TLSProfileName != "" {
+		key := vs.Namespace + "/" + vs.Spec.TLSProfileName
+		if _, found, _ := crInf.tlsInformer.GetIndexer().GetByKey(key); !found {
+			return fmt.Errorf("TLSProfile %v not found", key)
+		}
+	}
+	if vs.Spec.PolicyName != "" {
+		key := vs.Namespace + "/" + vs.Spec.PolicyName
+		if _, found, _ := crInf.plcInformer.GetIndexer().GetByKey(key); !found {
+			return fmt.Errorf("Policy %v not found", key)
+		}
+	}
+
+	for _, vrt := range crMgr.getAllVSFromMonitoredNamespaces() {
+		if vrt.Namespace == vs.Namespace && vrt.Name == vs.Name {
+			continue
+		}
+		if vs.Spec.HostGroup != "" && vrt.Namespace == vs.Namespace && vrt.Spec.HostGroup == vs.Spec.HostGroup &&
+			vrt.Spec.VirtualServerAddress != vs.Spec.VirtualServerAddress {
+			return fmt.Errorf("virtualServerAddress %v does not match with %v of VirtualServer %v/%v in hostGroup %v",
+				vs.Spec.VirtualServerAddress, vrt.Spec.VirtualServerAddress, vrt.Namespace, vrt.Name, vs.Spec.HostGroup)
+		}
+		if vs.Spec.Host == "" || vrt.Spec.Host != vs.Spec.Host ||
+			vrt.Spec.VirtualServerHTTPPort != vs.Spec.VirtualServerHTTPPort ||
+			vrt.Spec.VirtualServerHTTPSPort != vs.Spec.VirtualServerHTTPSPort {
+			continue
+		}
+		for _, pool := range vs.Spec.Pools {
+			for _, vrtPool := range vrt.Spec.Pools {
+				if pool.Path == vrtPool.Path {
+					return fmt.Errorf("Host %v and path %v are already used by VirtualServer %v/%v",
+						vs.Spec.Host, pool.Path, vrt.Namespace, vrt.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkTransportServerConflicts validates the TransportServer against the resources already available
+func (crMgr *CRManager) checkTransportServerConflicts(ts *cisapiv1.TransportServer) error {
+	if ts.Spec.VirtualServerAddress != "" && ts.Spec.IPAMLabel != "" {
+		return fmt.Errorf("Both virtualServerAddress and ipamLabel can not be specified")
+	}
+	if ts.Spec.PolicyName != "" {
+		crInf, ok := crMgr.getNamespacedInformer(ts.Namespace)
+		if !ok {
+			return fmt.Errorf("Informer not found for namespace: %v", ts.Namespace)
+		}
+		key := ts.Namespace + "/" + ts.Spec.PolicyName
+		if _, found, _ := crInf.plcInformer.GetIndexer().GetByKey(key); !found {
+			return fmt.Errorf("Policy %v not found", key)
+		}
+	}
+	return nil
+}
+
+// checkIngressLinkConflicts validates the IngressLink against the resources already available
+func (crMgr *CRManager) checkIngressLinkConflicts(il *cisapiv1.IngressLink) error {
+	if il.Spec.VirtualServerAddress != "" && il.Spec.IPAMLabel != "" {
+		return fmt.Errorf("Both virtualServerAddress and ipamLabel can not be specified")
+	}
+	return nil
 }
@@ -0,0 +1,197 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package crmanager
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// WebhookValidatePath is the path of the validating admission webhook
+	WebhookValidatePath = "/validate"
+)
+
+// startWebhookServer serves the validating admission webhook for the custom resources over TLS
+func (crMgr *CRManager) startWebhookServer(params WebhookParams) error {
+	cert, err := crMgr.getWebhookCertificate(params.TLSSecret)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebhookValidatePath, crMgr.serveValidate)
+	crMgr.webhookServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", params.Port),
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+	go func() {
+		log.Infof("[Webhook] Serving validating admission webhook on port %v", params.Port)
+		err := crMgr.webhookServer.ListenAndServeTLS("", "")
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[Webhook] Failed to serve validating admission webhook: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (crMgr *CRManager) stopWebhookServer() {
+	if crMgr.webhookServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutSmall)
+	defer cancel()
+	_ = crMgr.webhookServer.Shutdown(ctx)
+}
+
+// getWebhookCertificate loads the serving certificate from the kubernetes.io/tls Secret namespace/name
+func (crMgr *CRManager) getWebhookCertificate(secretKey string) (tls.Certificate, error) {
+	parts := strings.Split(secretKey, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return tls.Certificate{}, fmt.Errorf("invalid webhook TLS Secret %v, expected namespace/name", secretKey)
+	}
+	secret, err := crMgr.kubeClient.CoreV1().Secrets(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to fetch webhook TLS Secret %v: %v", secretKey, err)
+	}
+	cert, err := tls.X509KeyPair(secret.Data[v1.TLSCertKey], secret.Data[v1.TLSPrivateKeyKey])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid certificate in webhook TLS Secret %v: %v", secretKey, err)
+	}
+	return cert, nil
+}
+
+func (crMgr *CRManager) serveValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var review admissionv1.AdmissionReview
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = crMgr.validateAdmission(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	resp, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(resp)
+}
+
+// validateAdmission validates the custom resource of the request
+// Resources which are not processed by CIS are always allowed
+func (crMgr *CRManager) validateAdmission(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+	if req.Operation == admissionv1.Delete {
+		return allowed
+	}
+
+	var objMeta *metav1.ObjectMeta
+	var validate func() error
+	var err error
+	switch req.Kind.Kind {
+	case VirtualServer:
+		vs := &cisapiv1.VirtualServer{}
+		err = json.Unmarshal(req.Object.Raw, vs)
+		objMeta = &vs.ObjectMeta
+		validate = func() error {
+			if err := crMgr.validateVirtualServerSpec(vs); err != nil {
+				return err
+			}
+			return crMgr.checkVirtualServerConflicts(vs)
+		}
+	case TransportServer:
+		ts := &cisapiv1.TransportServer{}
+		err = json.Unmarshal(req.Object.Raw, ts)
+		objMeta = &ts.ObjectMeta
+		validate = func() error {
+			if err := crMgr.validateTransportServerSpec(ts); err != nil {
+				return err
+			}
+			return crMgr.checkTransportServerConflicts(ts)
+		}
+	case IngressLink:
+		il := &cisapiv1.IngressLink{}
+		err = json.Unmarshal(req.Object.Raw, il)
+		objMeta = &il.ObjectMeta
+		validate = func() error {
+			if err := crMgr.validateIngressLinkSpec(il); err != nil {
+				return err
+			}
+			return crMgr.checkIngressLinkConflicts(il)
+		}
+	default:
+		return allowed
+	}
+	if err != nil {
+		return denyAdmission(fmt.Sprintf("unable to decode %v: %v", req.Kind.Kind, err))
+	}
+	if objMeta.Namespace == "" {
+		objMeta.Namespace = req.Namespace
+	}
+	if !crMgr.resourceSelector.Matches(labels.Set(objMeta.Labels)) {
+		return allowed
+	}
+	if _, ok := crMgr.getNamespacedInformer(objMeta.Namespace); !ok {
+		return allowed
+	}
+
+	if err = validate(); err != nil {
+		log.Debugf("[Webhook] Rejected %v %v/%v: %v", req.Kind.Kind, objMeta.Namespace, objMeta.Name, err)
+		return denyAdmission(err.Error())
+	}
+	return allowed
+}
+
+func denyAdmission(message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusUnprocessableEntity,
+			Reason:  metav1.StatusReasonInvalid,
+			Message: message,
+		},
+	}
+}
@@ -0,0 +1,179 @@
+package crmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Validating Admission Webhook", func() {
+	var mockCRM *mockCRManager
+	var vs *cisapiv1.VirtualServer
+	namespace := "default"
+
+	newRequest := func(kind string, obj interface{}) *admissionv1.AdmissionRequest {
+		raw, _ := json.Marshal(obj)
+		return &admissionv1.AdmissionRequest{
+			UID:       types.UID("1"),
+			Kind:      metav1.GroupVersionKind{Group: "cis.f5.com", Version: "v1", Kind: kind},
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+	}
+
+	BeforeEach(func() {
+		mockCRM = newMockCRManager()
+		mockCRM.kubeClient = k8sfake.NewSimpleClientset()
+		mockCRM.namespaces = map[string]bool{namespace: true}
+		mockCRM.crInformers = make(map[string]*CRInformer)
+		mockCRM.resourceSelector, _ = createLabelSelector(DefaultCustomResourceLabel)
+		mockCRM.crInformers[namespace] = mockCRM.newNamespacedInformer(namespace)
+
+		vs = test.NewVirtualServer(
+			"SampleVS",
+			namespace,
+			cisapiv1.VirtualServerSpec{
+				Host:                 "test.com",
+				VirtualServerAddress: "1.2.3.4",
+				Pools: []cisapiv1.Pool{
+					{
+						Path:        "/foo",
+						Service:     "svc1",
+						ServicePort: 80,
+					},
+				},
+			})
+		vs.Labels = map[string]string{"f5cr": "true"}
+	})
+
+	It("Allow valid VirtualServer", func() {
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue())
+	})
+
+	It("Allow resources not processed by CIS", func() {
+		vs.Labels = nil
+		vs.Spec.VirtualServerAddress = ""
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue(),
+			"VirtualServer without f5cr label should be allowed")
+
+		vs.Labels = map[string]string{"f5cr": "true"}
+		vs.Namespace = "other"
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue(),
+			"VirtualServer of namespace not watched should be allowed")
+
+		req := newRequest(VirtualServer, vs)
+		req.Operation = admissionv1.Delete
+		Expect(mockCRM.validateAdmission(req).Allowed).To(BeTrue(), "Delete should be allowed")
+	})
+
+	It("Reject invalid VirtualServer", func() {
+		vs.Spec.VirtualServerAddress = ""
+		resp := mockCRM.validateAdmission(newRequest(VirtualServer, vs))
+		Expect(resp.Allowed).To(BeFalse(), "VirtualServer without address should be rejected")
+		Expect(resp.Result.Message).To(ContainSubstring("No IP was specified"))
+
+		vs.Spec.VirtualServerAddress = "1.2.3.4"
+		vs.Spec.IPAMLabel = "test"
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeFalse(),
+			"VirtualServer with both address and ipamLabel should be rejected")
+
+		vs.Spec.IPAMLabel = ""
+		vs.Spec.PersistenceProfile = &cisapiv1.PersistenceProfile{Method: "universal"}
+		resp = mockCRM.validateAdmission(newRequest(VirtualServer, vs))
+		Expect(resp.Allowed).To(BeFalse(), "Universal persistence without rule should be rejected")
+		Expect(resp.Result.Message).To(ContainSubstring("rule is required"))
+		vs.Spec.PersistenceProfile = &cisapiv1.PersistenceProfile{Method: "source-address", AddressMask: "255.255.255.0"}
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue())
+		vs.Spec.PersistenceProfile = &cisapiv1.PersistenceProfile{Method: "cookie", AddressMask: "255.255.255.0"}
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeFalse(),
+			"addressMask of cookie persistence should be rejected")
+	})
+
+	It("Reject missing references", func() {
+		vs.Spec.TLSProfileName = "tls"
+		resp := mockCRM.validateAdmission(newRequest(VirtualServer, vs))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Message).To(ContainSubstring("TLSProfile default/tls not found"))
+
+		tls := test.NewTLSProfile("tls", namespace, cisapiv1.TLSProfileSpec{})
+		_ = mockCRM.crInformers[namespace].tlsInformer.GetIndexer().Add(tls)
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue())
+
+		vs.Spec.PolicyName = "plc"
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeFalse(),
+			"VirtualServer with missing Policy should be rejected")
+
+		ts := test.NewTransportServer("SampleTS", namespace, cisapiv1.TransportServerSpec{
+			VirtualServerAddress: "1.2.3.5",
+			VirtualServerPort:    8080,
+			PolicyName:           "plc",
+		})
+		ts.Labels = map[string]string{"f5cr": "true"}
+		Expect(mockCRM.validateAdmission(newRequest(TransportServer, ts)).Allowed).To(BeFalse(),
+			"TransportServer with missing Policy should be rejected")
+	})
+
+	It("Reject conflicting VirtualServers", func() {
+		existing := vs.DeepCopy()
+		existing.Name = "ExistingVS"
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(existing)
+
+		// Same VirtualServer is updated
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vs.DeepCopy())
+		resp := mockCRM.validateAdmission(newRequest(VirtualServer, vs))
+		Expect(resp.Allowed).To(BeFalse(), "Duplicate host and path should be rejected")
+		Expect(resp.Result.Message).To(ContainSubstring("default/ExistingVS"))
+
+		vs.Spec.Pools[0].Path = "/bar"
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeTrue(),
+			"Same host with different path should be allowed")
+
+		existing.Spec.HostGroup = "group"
+		_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Update(existing)
+		vs.Spec.HostGroup = "group"
+		vs.Spec.VirtualServerAddress = "1.2.3.5"
+		Expect(mockCRM.validateAdmission(newRequest(VirtualServer, vs)).Allowed).To(BeFalse(),
+			"Different address within hostGroup should be rejected")
+	})
+
+	It("Serve AdmissionReview", func() {
+		vs.Spec.VirtualServerAddress = ""
+		review := admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request:  newRequest(VirtualServer, vs),
+		}
+		body, _ := json.Marshal(review)
+		w := httptest.NewRecorder()
+		mockCRM.serveValidate(w, httptest.NewRequest(http.MethodPost, WebhookValidatePath, bytes.NewReader(body)))
+		Expect(w.Code).To(Equal(http.StatusOK))
+
+		var resp admissionv1.AdmissionReview
+		Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(BeNil())
+		Expect(resp.Kind).To(Equal("AdmissionReview"))
+		Expect(resp.Response.UID).To(Equal(types.UID("1")))
+		Expect(resp.Response.Allowed).To(BeFalse())
+
+		w = httptest.NewRecorder()
+		mockCRM.serveValidate(w, httptest.NewRequest(http.MethodPost, WebhookValidatePath, bytes.NewReader([]byte("{}"))))
+		Expect(w.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Webhook certificate", func() {
+		_, err := mockCRM.getWebhookCertificate("invalid")
+		Expect(err).NotTo(BeNil())
+		_, err = mockCRM.getWebhookCertificate("default/missing")
+		Expect(err).NotTo(BeNil())
+	})
+})
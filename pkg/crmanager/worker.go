@@ -28,10 +28,15 @@ import (
 
 	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
 	cisapiv1 "github.com/F5Networks/k8s-bigip-ctlr/config/apis/cis/v1"
+	bigIPPrometheus "github.com/F5Networks/k8s-bigip-ctlr/pkg/prometheus"
+	rsc "github.com/F5Networks/k8s-bigip-ctlr/pkg/resource"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	gwapiv1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 )
 
 const nginxMonitorPort int32 = 8081
@@ -42,6 +47,7 @@ const (
 	NotRequested
 	Requested
 	Allocated
+	Exhausted
 )
 
 // customResourceWorker starts the Custom Resource Worker.
@@ -85,9 +91,13 @@ func (crMgr *CRManager) processResource() bool {
 	var isError bool
 
 	defer crMgr.rscQueue.Done(key)
+	crMgr.workerProgress.Busy()
+	defer crMgr.workerProgress.Idle()
 	rKey := key.(*rqKey)
 	log.Debugf("Processing Key: %v", rKey)
 
+	bigIPPrometheus.ResourceQueueDepth.Set(float64(crMgr.rscQueue.Len()))
+
 	// During Init time, just accumulate all the poolMembers by processing only services
 	if crMgr.initState && rKey.kind != Namespace {
 		if rKey.kind != Service {
@@ -100,6 +110,11 @@ func (crMgr *CRManager) processResource() bool {
 		}
 	}
 
+	startTime := time.Now()
+	defer func() {
+		bigIPPrometheus.ResourceProcessingDuration.WithLabelValues(rKey.kind).Observe(time.Since(startTime).Seconds())
+	}()
+
 	// Check the type of resource and process accordingly.
 	switch rKey.kind {
 	case VirtualServer:
@@ -110,6 +125,8 @@ func (crMgr *CRManager) processResource() bool {
 			utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
 			isError = true
 		}
+		crMgr.updatePolicyRefs(VirtualServer, virtual.Namespace, virtual.Name, virtual.Spec.PolicyName,
+			rKey.rscDelete)
 	case TLSProfile:
 		tlsProfile := rKey.rsc.(*cisapiv1.TLSProfile)
 		virtuals := crMgr.getVirtualsForTLSProfile(tlsProfile)
@@ -125,6 +142,31 @@ func (crMgr *CRManager) processResource() bool {
 				isError = true
 			}
 		}
+	case K8sSecret:
+		secret := rKey.rsc.(*v1.Secret)
+		crMgr.updateSSLContext(secret, rKey.rscDelete)
+		// Profiles of the Virtuals are updated with the renewed certificate
+		for _, virtual := range crMgr.getVirtualsForSecret(secret) {
+			err := crMgr.processVirtualServers(virtual, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
+		for _, virtual := range crMgr.getTransportServersForSecret(secret) {
+			err := crMgr.processTransportServers(virtual, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
+		for _, gw := range crMgr.getGatewaysForSecret(secret) {
+			err := crMgr.processGateway(gw, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
 	case TransportServer:
 		virtual := rKey.rsc.(*cisapiv1.TransportServer)
 		err := crMgr.processTransportServers(virtual, rKey.rscDelete)
@@ -133,6 +175,8 @@ func (crMgr *CRManager) processResource() bool {
 			utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
 			isError = true
 		}
+		crMgr.updatePolicyRefs(TransportServer, virtual.Namespace, virtual.Name, virtual.Spec.PolicyName,
+			rKey.rscDelete)
 	case IngressLink:
 		ingLink := rKey.rsc.(*cisapiv1.IngressLink)
 		log.Infof("Worker got IngressLink: %v\n", ingLink)
@@ -195,6 +239,10 @@ func (crMgr *CRManager) processResource() bool {
 		cp := rKey.rsc.(*cisapiv1.Policy)
 
 		virtuals := crMgr.getVirtualsForCustomPolicy(cp)
+		tsVirtuals := crMgr.getTransportServersForCustomPolicy(cp)
+		if rKey.rscDelete || cp.DeletionTimestamp != nil {
+			crMgr.recordPolicyInUseEvents(cp, virtuals, tsVirtuals, rKey.rscDelete)
+		}
 		//Sync Custompolicy for Virtual Servers
 		for _, virtual := range virtuals {
 			err := crMgr.processVirtualServers(virtual, false)
@@ -205,7 +253,6 @@ func (crMgr *CRManager) processResource() bool {
 			}
 		}
 		//Sync Custompolicy for Transport Servers
-		tsVirtuals := crMgr.getTransportServersForCustomPolicy(cp)
 		for _, virtual := range tsVirtuals {
 			err := crMgr.processTransportServers(virtual, false)
 			if err != nil {
@@ -214,6 +261,9 @@ func (crMgr *CRManager) processResource() bool {
 				isError = true
 			}
 		}
+		if !rKey.rscDelete {
+			crMgr.enqueuePolicyUsage(cp.Namespace, cp.Name)
+		}
 	case Service:
 		svc := rKey.rsc.(*v1.Service)
 
@@ -268,10 +318,25 @@ func (crMgr *CRManager) processResource() bool {
 				}
 			}
 		}
+		//Sync service for Gateways
+		for _, gw := range crMgr.getGatewaysForService(svc) {
+			err := crMgr.processGateway(gw, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
 
-	case Endpoints:
-		ep := rKey.rsc.(*v1.Endpoints)
-		svc := crMgr.getServiceForEndpoints(ep)
+	case Endpoints, EndpointSlice:
+		var ep *v1.Endpoints
+		var svc *v1.Service
+		if rKey.kind == EndpointSlice {
+			// Members are built from all the EndpointSlices of the service
+			svc = crMgr.getService(rKey.namespace, rKey.rscName)
+		} else {
+			ep = rKey.rsc.(*v1.Endpoints)
+			svc = crMgr.getServiceForEndpoints(ep)
+		}
 		// No Services are effected with the change in service.
 		if nil == svc {
 			break
@@ -322,6 +387,37 @@ func (crMgr *CRManager) processResource() bool {
 				}
 			}
 		}
+		//Sync service for Gateways
+		for _, gw := range crMgr.getGatewaysForService(svc) {
+			err := crMgr.processGateway(gw, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
+	case GatewayClass:
+		gwc := rKey.rsc.(*gwapiv1.GatewayClass)
+		err := crMgr.processGatewayClass(gwc, rKey.rscDelete)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+			isError = true
+		}
+	case Gateway:
+		gw := rKey.rsc.(*gwapiv1.Gateway)
+		err := crMgr.processGateway(gw, rKey.rscDelete)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+			isError = true
+		}
+	case HTTPRoute, TLSRoute, TCPRoute:
+		// Routes are bound to the Gateways of their namespace
+		for _, gw := range crMgr.getAllGateways(rKey.namespace) {
+			err := crMgr.processGateway(gw, false)
+			if err != nil {
+				utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+				isError = true
+			}
+		}
 	case Namespace:
 		ns := rKey.rsc.(*v1.Namespace)
 		nsName := ns.ObjectMeta.Name
@@ -344,8 +440,15 @@ func (crMgr *CRManager) processResource() bool {
 				}
 			}
 
-			crMgr.crInformers[nsName].stop()
-			delete(crMgr.crInformers, nsName)
+			for _, gw := range crMgr.getAllGateways(nsName) {
+				err := crMgr.processGateway(gw, true)
+				if err != nil {
+					utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+					isError = true
+				}
+			}
+
+			crMgr.removeNamespacedInformer(nsName)
 			crMgr.namespacesMutex.Lock()
 			delete(crMgr.namespaces, nsName)
 			crMgr.namespacesMutex.Unlock()
@@ -355,7 +458,9 @@ func (crMgr *CRManager) processResource() bool {
 			crMgr.namespaces[nsName] = true
 			crMgr.namespacesMutex.Unlock()
 			_ = crMgr.addNamespacedInformer(nsName)
-			crMgr.crInformers[nsName].start()
+			if crInf, ok := crMgr.getNamespacedInformer(nsName); ok {
+				crInf.start()
+			}
 			log.Debugf("Added Namespace: '%v' to CIS scope", nsName)
 		}
 	default:
@@ -371,38 +476,49 @@ func (crMgr *CRManager) processResource() bool {
 	if crMgr.rscQueue.Len() == 0 &&
 		(!reflect.DeepEqual(crMgr.resources.rsMap, crMgr.resources.oldRsMap) ||
 			!reflect.DeepEqual(crMgr.resources.dnsConfig, crMgr.resources.oldDNSConfig)) {
-		customProfileStore := NewCustomProfiles()
-		for _, rsCfg := range crMgr.resources.rsMap {
-			for skey, prof := range rsCfg.customProfiles.Profs {
-				customProfileStore.Profs[skey] = prof
-			}
-		}
-		config := ResourceConfigWrapper{
-			rsCfgs:             crMgr.resources.GetAllResources(),
-			customProfiles:     customProfileStore,
-			shareNodes:         crMgr.shareNodes,
-			dnsConfig:          crMgr.resources.dnsConfig,
-			defaultRouteDomain: crMgr.defaultRouteDomain,
-		}
+		crMgr.drainer.forgetRemovedPools(crMgr.resources.rsMap)
+		config := crMgr.getResourceConfigWrapper()
 		go crMgr.TeemData.PostTeemsData()
-		crMgr.enqueueReq(config)
-		crMgr.Agent.PostConfig(config)
+		config.reqId = crMgr.enqueueReq(config)
+		if !crMgr.Agent.PostConfig(config) {
+			// No response is sent for the configuration which is not posted
+			crMgr.dequeueReq(config.reqId)
+		}
 		crMgr.initState = false
 		crMgr.resources.updateOldConfig()
 	}
 	return true
 }
 
+// getResourceConfigWrapper returns the configuration of all the resources to be posted to BIG-IP
+func (crMgr *CRManager) getResourceConfigWrapper() ResourceConfigWrapper {
+	customProfileStore := NewCustomProfiles()
+	for _, rsCfg := range crMgr.resources.rsMap {
+		for skey, prof := range rsCfg.customProfiles.Profs {
+			customProfileStore.Profs[skey] = prof
+		}
+	}
+	return ResourceConfigWrapper{
+		rsCfgs:             crMgr.resources.GetAllResources(),
+		customProfiles:     customProfileStore,
+		shareNodes:         crMgr.shareNodes,
+		dnsConfig:          crMgr.resources.dnsConfig,
+		defaultRouteDomain: crMgr.defaultRouteDomain,
+	}
+}
+
 // getServiceForEndpoints returns the service associated with endpoints.
 func (crMgr *CRManager) getServiceForEndpoints(ep *v1.Endpoints) *v1.Service {
+	return crMgr.getService(ep.ObjectMeta.Namespace, ep.ObjectMeta.Name)
+}
 
-	epName := ep.ObjectMeta.Name
-	epNamespace := ep.ObjectMeta.Namespace
-	svcKey := fmt.Sprintf("%s/%s", epNamespace, epName)
+// getService returns the service from the informer cache
+func (crMgr *CRManager) getService(namespace, name string) *v1.Service {
+	svcKey := fmt.Sprintf("%s/%s", namespace, name)
 
-	crInf, ok := crMgr.getNamespacedInformer(epNamespace)
+	crInf, ok := crMgr.getNamespacedInformer(namespace)
 	if !ok {
-		log.Errorf("Informer not found for namespace: %v", epNamespace)
+		log.Errorf("Informer not found for namespace: %v", namespace)
 		return nil
 	}
 	svc, exists, err := crInf.svcInformer.GetIndexer().GetByKey(svcKey)
@@ -483,21 +599,97 @@ func (crMgr *CRManager) getVirtualsForTLSProfile(tls *cisapiv1.TLSProfile) []*ci
 	return virtualsForTLSProfile
 }
 
+// getVirtualsForSecret returns the VirtualServers using the TLSProfiles which refer the Secret
+func (crMgr *CRManager) getVirtualsForSecret(secret *v1.Secret) []*cisapiv1.VirtualServer {
+	crInf, ok := crMgr.getNamespacedInformer(secret.Namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v", secret.Namespace)
+		return nil
+	}
+	tlsProfiles, err := crInf.tlsInformer.GetIndexer().ByIndex("namespace", secret.Namespace)
+	if err != nil {
+		log.Errorf("Unable to get list of TLSProfiles for namespace '%v': %v", secret.Namespace, err)
+		return nil
+	}
+
+	var virtuals []*cisapiv1.VirtualServer
+	found := make(map[string]struct{})
+	for _, obj := range tlsProfiles {
+		tls := obj.(*cisapiv1.TLSProfile)
+		if tls.Spec.TLS.Reference != Secret ||
+			(tls.Spec.TLS.ClientSSL != secret.Name && tls.Spec.TLS.ServerSSL != secret.Name) {
+			continue
+		}
+		for _, vs := range crMgr.getVirtualsForTLSProfile(tls) {
+			vsKey := vs.Namespace + "/" + vs.Name
+			if _, ok := found[vsKey]; ok {
+				continue
+			}
+			found[vsKey] = struct{}{}
+			virtuals = append(virtuals, vs)
+		}
+	}
+	// Client certificates of the pool monitors
+	for _, vs := range crMgr.getAllVirtualServers(secret.Namespace) {
+		if _, ok := found[vs.Namespace+"/"+vs.Name]; ok {
+			continue
+		}
+		for _, pl := range vs.Spec.Pools {
+			if usesMonitorSecret(pl.Monitors, secret.Name) {
+				virtuals = append(virtuals, vs)
+				break
+			}
+		}
+	}
+	return virtuals
+}
+
+// Returns the TransportServers whose pool monitors present the client certificate of the Secret
+func (crMgr *CRManager) getTransportServersForSecret(secret *v1.Secret) []*cisapiv1.TransportServer {
+	var virtuals []*cisapiv1.TransportServer
+	for _, ts := range crMgr.getAllTransportServers(secret.Namespace) {
+		if usesMonitorSecret(ts.Spec.Pool.Monitors, secret.Name) {
+			virtuals = append(virtuals, ts)
+		}
+	}
+	return virtuals
+}
+
+func usesMonitorSecret(monitors []cisapiv1.Monitor, secretName string) bool {
+	for _, mon := range monitors {
+		if mon.ClientCertificate == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// getVirtualsForCustomPolicy returns the VirtualServers using the Policy. The baseline Policy is used by
+// the VirtualServers of all the monitored namespaces and the namespace default Policy by the ones of its namespace
 func (crMgr *CRManager) getVirtualsForCustomPolicy(plc *cisapiv1.Policy) []*cisapiv1.VirtualServer {
-	nsVirtuals := crMgr.getAllVirtualServers(plc.Namespace)
-	if nil == nsVirtuals {
-		log.Infof("No VirtualServers found in namespace %s",
-			plc.Namespace)
+	if crMgr.isBaselinePolicy(plc) {
+		return crMgr.getAllVSFromMonitoredNamespaces()
+	}
+	if crMgr.isAppliedNamespaceDefaultPolicy(plc) {
+		return crMgr.getAllVirtualServers(plc.Namespace)
+	}
+	crInf, ok := crMgr.getNamespacedInformer(plc.Namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v", plc.Namespace)
+		return nil
+	}
+	objs, err := crInf.vsInformer.GetIndexer().ByIndex(policyIndex, plc.Namespace+"/"+plc.Name)
+	if err != nil {
+		log.Errorf("Unable to get VirtualServers of Policy %v/%v: %v", plc.Namespace, plc.Name, err)
 		return nil
 	}
 
 	var plcVSs []*cisapiv1.VirtualServer
 	var plcVSNames []string
-	for _, vs := range nsVirtuals {
-		if vs.Spec.PolicyName == plc.Name {
-			plcVSs = append(plcVSs, vs)
-			plcVSNames = append(plcVSNames, vs.Name)
-		}
+	for _, obj := range objs {
+		vs := obj.(*cisapiv1.VirtualServer)
+		plcVSs = append(plcVSs, vs)
+		plcVSNames = append(plcVSNames, vs.Name)
 	}
 
 	log.Debugf("VirtualServers %v are affected with Custom Policy %s: ",
@@ -506,24 +698,35 @@ func (crMgr *CRManager) getVirtualsForCustomPolicy(plc *cisapiv1.Policy) []*cisa
 	return plcVSs
 }
 
+// getTransportServersForCustomPolicy returns the TransportServers using the Policy, all the ones in its scope
+// for the baseline and namespace default Policies
 func (crMgr *CRManager) getTransportServersForCustomPolicy(plc *cisapiv1.Policy) []*cisapiv1.TransportServer {
-	nsVirtuals := crMgr.getAllTransportServers(plc.Namespace)
-	if nil == nsVirtuals {
-		log.Infof("No VirtualServers found in namespace %s",
-			plc.Namespace)
+	if crMgr.isBaselinePolicy(plc) {
+		return crMgr.getAllTSFromMonitoredNamespaces()
+	}
+	if crMgr.isAppliedNamespaceDefaultPolicy(plc) {
+		return crMgr.getAllTransportServers(plc.Namespace)
+	}
+	crInf, ok := crMgr.getNamespacedInformer(plc.Namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v", plc.Namespace)
+		return nil
+	}
+	objs, err := crInf.tsInformer.GetIndexer().ByIndex(policyIndex, plc.Namespace+"/"+plc.Name)
+	if err != nil {
+		log.Errorf("Unable to get TransportServers of Policy %v/%v: %v", plc.Namespace, plc.Name, err)
 		return nil
 	}
 
 	var plcVSs []*cisapiv1.TransportServer
 	var plcVSNames []string
-	for _, vs := range nsVirtuals {
-		if vs.Spec.PolicyName == plc.Name {
-			plcVSs = append(plcVSs, vs)
-			plcVSNames = append(plcVSNames, vs.Name)
-		}
+	for _, obj := range objs {
+		vs := obj.(*cisapiv1.TransportServer)
+		plcVSs = append(plcVSs, vs)
+		plcVSNames = append(plcVSNames, vs.Name)
 	}
 
-	log.Debugf("VirtualServers %v are affected with Custom Policy %s: ",
+	log.Debugf("TransportServers %v are affected with Custom Policy %s: ",
 		plcVSNames, plc.Name)
 
 	return plcVSs
@@ -591,9 +794,11 @@ func filterVirtualServersForService(allVirtuals []*cisapiv1.VirtualServer,
 
 		isValidVirtual := false
 		for _, pool := range vs.Spec.Pools {
-			if pool.Service == svcName {
-				isValidVirtual = true
-				break
+			for _, backend := range getPoolBackends(pool) {
+				if backend.service == svcName {
+					isValidVirtual = true
+					break
+				}
 			}
 		}
 		if !isValidVirtual {
@@ -664,7 +869,11 @@ func (crMgr *CRManager) getTLSProfileForVirtualServer(
 	tlsProfile := obj.(*cisapiv1.TLSProfile)
 
 	if tlsProfile.Spec.TLS.Reference == "secret" {
-		clientSecret, _ := crMgr.kubeClient.CoreV1().Secrets(namespace).Get(context.TODO(), tlsProfile.Spec.TLS.ClientSSL, metav1.GetOptions{})
+		clientSecret, err := crMgr.getSecret(namespace, tlsProfile.Spec.TLS.ClientSSL)
+		if err != nil {
+			log.Errorf("secret %s not found for TLSProfile %s: %v", tlsProfile.Spec.TLS.ClientSSL, tlsName, err)
+			return nil
+		}
 		//validate clientSSL certificates and hostname
 		match := checkCertificateHost(clientSecret, vs.Spec.Host)
 		if match == false {
@@ -727,16 +936,34 @@ func (crMgr *CRManager) processVirtualServers(
 			virtual, endTime.Sub(startTime))
 	}()
 
+	// conditions observed while processing are reported on the status of VirtualServer
+	var conditions []metav1.Condition
+	var vsAddress string
+	// virtuals are the VirtualServers merged into the same virtual on BIG-IP
+	var virtuals []*cisapiv1.VirtualServer
+	// refsCond is reported on every return path, so that unresolved references are surfaced
+	// even when processing stops early
+	refsCond := crMgr.getServiceRefsCondition(virtual.Namespace, getVirtualServerServices(virtual))
+	defer func() {
+		conditions = append(conditions, refsCond)
+		if !isVSDeleted {
+			crMgr.updateVirtualServerStatus(virtual, vsAddress, conditions...)
+		}
+		crMgr.updateAssociatedVirtualServersStatus(virtual, virtuals, vsAddress, conditions)
+	}()
 	// Skip validation for a deleted Virtual Server
 	if !isVSDeleted {
 		// check if the virutal server matches all the requirements.
 		vkey := virtual.ObjectMeta.Namespace + "/" + virtual.ObjectMeta.Name
-		valid := crMgr.checkValidVirtualServer(virtual)
-		if false == valid {
-			log.Errorf("VirtualServer %s, is not valid",
-				vkey)
+		if err := crMgr.checkValidVirtualServer(virtual); err != nil {
+			log.Errorf("VirtualServer %s, is not valid: %v",
+				vkey, err)
+			conditions = append(conditions, newCondition(cisapiv1.ConditionAccepted, metav1.ConditionFalse,
+				cisapiv1.ReasonInvalid, err.Error()))
 			return nil
 		}
+		conditions = append(conditions, newCondition(cisapiv1.ConditionAccepted, metav1.ConditionTrue,
+			cisapiv1.ReasonAccepted, "VirtualServer is valid"))
 	}
 
 	allVirtuals := crMgr.getAllVirtualServers(virtual.ObjectMeta.Namespace)
@@ -748,11 +975,13 @@ func (crMgr *CRManager) processVirtualServers(
 	// In the event of deletion, exclude the deleted VirtualServer
 	log.Debugf("Process all the Virtual Servers which share same VirtualServerAddress")
 
-	virtuals := crMgr.getAssociatedVirtualServers(virtual, allVirtuals, isVSDeleted)
+	virtuals = crMgr.getAssociatedVirtualServers(virtual, allVirtuals, isVSDeleted)
+	virtuals = crMgr.rejectTenantConflicts(virtual, virtuals, &conditions)
+	virtuals = crMgr.rejectPersistenceConflicts(virtual, virtuals, &conditions)
 
 	var ip string
 	var status int
-	if crMgr.ipamCli != nil {
+	if crMgr.isIPAMEnabled() {
 		if isVSDeleted && len(virtuals) == 0 && virtual.Spec.VirtualServerAddress == "" {
 			if virtual.Spec.HostGroup != "" {
 				key := virtual.ObjectMeta.Namespace + "/" + virtual.Spec.HostGroup
@@ -763,6 +992,9 @@ func (crMgr *CRManager) processVirtualServers(
 		} else if virtual.Spec.VirtualServerAddress != "" {
 			// Prioritise VirtualServerAddress specified over IPAMLabel
 			ip = virtual.Spec.VirtualServerAddress
+			crMgr.checkIPAMConflict(virtual, ip)
+			conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionTrue,
+				cisapiv1.ReasonStaticAddress, ip))
 		} else {
 			ipamLabel := getIPAMLabel(virtuals)
 			if virtual.Spec.HostGroup != "" {
@@ -772,6 +1004,7 @@ func (crMgr *CRManager) processVirtualServers(
 				ip, status = crMgr.requestIP(ipamLabel, virtual.Spec.Host, "")
 			}
 
+			conditions = append(conditions, getIPAMCondition(status, ipamLabel, ip))
 			switch status {
 			case NotEnabled:
 				log.Debug("IPAM Custom Resource Not Available")
@@ -781,15 +1014,20 @@ func (crMgr *CRManager) processVirtualServers(
 				return nil
 			case NotRequested:
 				return fmt.Errorf("unable make do IPAM Request, will be re-requested soon")
+			case Exhausted:
+				crMgr.recordIPAMExhausted(virtual, ipamLabel)
+				return fmt.Errorf("no free address available with IPAM label %v", ipamLabel)
 			case Requested:
 				log.Debugf("IP address requested for service: %s/%s", virtual.Namespace, virtual.Name)
 				return nil
 			}
-			virtual.Status.VSAddress = ip
+			vsAddress = ip
 		}
 	} else {
 		if virtual.Spec.HostGroup == "" {
 			if virtual.Spec.VirtualServerAddress == "" {
+				conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse,
+					cisapiv1.ReasonNoAddress, "No VirtualServer address or IPAM found"))
 				return fmt.Errorf("No VirtualServer address or IPAM found.")
 			}
 			ip = virtual.Spec.VirtualServerAddress
@@ -798,9 +1036,13 @@ func (crMgr *CRManager) processVirtualServers(
 			ip, err = getVirtualServerAddress(virtuals)
 			if err != nil {
 				log.Errorf("Error in virtualserver address: %s", err.Error())
+				conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse,
+					cisapiv1.ReasonNoAddress, err.Error()))
 				return err
 			}
 		}
+		conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionTrue,
+			cisapiv1.ReasonStaticAddress, ip))
 	}
 	// Depending on the ports defined, TLS type or Unsecured we will populate the resource config.
 	portStructs := crMgr.virtualPorts(virtual)
@@ -832,7 +1074,7 @@ func (crMgr *CRManager) processVirtualServers(
 		}
 
 		rsCfg := &ResourceConfig{}
-		rsCfg.Virtual.Partition = crMgr.Partition
+		rsCfg.Virtual.Partition = crMgr.getTenant(virtuals[0].ObjectMeta)
 		rsCfg.MetaData.ResourceType = VirtualServer
 		rsCfg.Virtual.Enabled = true
 		rsCfg.Virtual.Name = rsName
@@ -840,6 +1082,9 @@ func (crMgr *CRManager) processVirtualServers(
 		rsCfg.MetaData.Protocol = portStruct.protocol
 		rsCfg.MetaData.namespace = virtual.ObjectMeta.Namespace
 		rsCfg.MetaData.rscName = virtual.ObjectMeta.Name
+		for _, vrt := range virtuals {
+			rsCfg.MetaData.virtuals = append(rsCfg.MetaData.virtuals, vrt.ObjectMeta.Name)
+		}
 		rsCfg.Virtual.SetVirtualAddress(
 			ip,
 			portStruct.port,
@@ -848,15 +1093,16 @@ func (crMgr *CRManager) processVirtualServers(
 		rsCfg.IRulesMap = make(IRulesMap)
 		rsCfg.customProfiles.Profs = make(map[SecretKey]CustomProfile)
 
-		plc, err := crMgr.getPolicyFromVirtuals(virtuals)
-		if plc != nil {
-			err := crMgr.handleVSResourceConfigForPolicy(rsCfg, plc)
+		policies, err := crMgr.getPolicyFromVirtuals(virtuals)
+		for _, plc := range policies {
+			err = crMgr.handleVSResourceConfigForPolicy(rsCfg, plc)
 			if err != nil {
-				processingError = true
 				break
 			}
 		}
 		if err != nil {
+			refsCond = newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionFalse,
+				cisapiv1.ReasonInvalidPolicy, err.Error())
 			processingError = true
 			log.Errorf("%v", err)
 			break
@@ -878,6 +1124,9 @@ func (crMgr *CRManager) processVirtualServers(
 				// Handle TLS configuration for VirtualServer Custom Resource
 				tlsProf := crMgr.getTLSProfileForVirtualServer(vrt, vrt.Namespace)
 				if tlsProf == nil {
+					refsCond = newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionFalse,
+						cisapiv1.ReasonTLSProfileNotFound, fmt.Sprintf("TLSProfile %v of VirtualServer %v is not found",
+							vrt.Spec.TLSProfileName, vrt.Name))
 					// Processing failed
 					// Stop processing further virtuals
 					processingError = true
@@ -886,6 +1135,9 @@ func (crMgr *CRManager) processVirtualServers(
 
 				processed := crMgr.handleVirtualServerTLS(rsCfg, vrt, tlsProf, ip)
 				if !processed {
+					refsCond = newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionFalse,
+						cisapiv1.ReasonInvalidTLSProfile, fmt.Sprintf("TLSProfile %v of VirtualServer %v cannot be processed",
+							vrt.Spec.TLSProfileName, vrt.Name))
 					// Processing failed
 					// Stop processing further virtuals
 					processingError = true
@@ -901,6 +1153,7 @@ func (crMgr *CRManager) processVirtualServers(
 			log.Errorf("Cannot Publish VirtualServer %s", virtual.ObjectMeta.Name)
 			break
 		}
+		updateDataGroupForABVirtuals(rsCfg, virtuals)
 
 		// Save ResourceConfig in temporary Map
 		vsMap[rsName] = rsCfg
@@ -928,9 +1181,147 @@ func (crMgr *CRManager) processVirtualServers(
 		}
 	}
 
+	// Gateways on the same address yield to the VirtualServer, and take over the address once it is deleted
+	var ports []int32
+	for _, portStruct := range portStructs {
+		ports = append(ports, portStruct.port)
+	}
+	crMgr.enqueueGatewaysUsingAddress(ip, ports)
+
 	return nil
 }
 
+// getOldestVirtualServer returns the oldest of the VirtualServers, the first by namespace/name on a tie
+func getOldestVirtualServer(virtuals []*cisapiv1.VirtualServer) *cisapiv1.VirtualServer {
+	var oldest *cisapiv1.VirtualServer
+	for _, vrt := range virtuals {
+		if oldest == nil || vrt.CreationTimestamp.Before(&oldest.CreationTimestamp) ||
+			(vrt.CreationTimestamp.Equal(&oldest.CreationTimestamp) &&
+				vrt.Namespace+"/"+vrt.Name < oldest.Namespace+"/"+oldest.Name) {
+			oldest = vrt
+		}
+	}
+	return oldest
+}
+
+// rejectSharedAddressConflicts returns the virtuals without the ones conflicting with the owner of the address.
+// Rejection of the current VirtualServer is added to the conditions, the others are updated right away.
+func (crMgr *CRManager) rejectSharedAddressConflicts(
+	virtual *cisapiv1.VirtualServer,
+	virtuals []*cisapiv1.VirtualServer,
+	conditions *[]metav1.Condition,
+	reason string,
+	msg string,
+	conflicts func(vrt *cisapiv1.VirtualServer) bool,
+) []*cisapiv1.VirtualServer {
+	var accepted []*cisapiv1.VirtualServer
+	for _, vrt := range virtuals {
+		if !conflicts(vrt) {
+			accepted = append(accepted, vrt)
+			continue
+		}
+		log.Errorf("VirtualServer %v/%v is rejected: %v", vrt.Namespace, vrt.Name, msg)
+		cond := newCondition(cisapiv1.ConditionAccepted, metav1.ConditionFalse, reason, msg)
+		if vrt.Namespace == virtual.Namespace && vrt.Name == virtual.Name {
+			*conditions = append(*conditions, cond)
+			continue
+		}
+		crMgr.updateVirtualServerStatus(vrt, "", cond)
+	}
+	return accepted
+}
+
+// rejectTenantConflicts returns the virtuals without the ones whose tenant differs from the one of the
+// oldest VirtualServer, as the VirtualServers sharing an address are declared in a single tenant.
+func (crMgr *CRManager) rejectTenantConflicts(
+	virtual *cisapiv1.VirtualServer,
+	virtuals []*cisapiv1.VirtualServer,
+	conditions *[]metav1.Condition,
+) []*cisapiv1.VirtualServer {
+	owner := getOldestVirtualServer(virtuals)
+	if owner == nil {
+		return virtuals
+	}
+	tenant := crMgr.getTenant(owner.ObjectMeta)
+	msg := fmt.Sprintf("tenant conflicts with the tenant %v of VirtualServer %v/%v sharing the address",
+		tenant, owner.Namespace, owner.Name)
+	return crMgr.rejectSharedAddressConflicts(virtual, virtuals, conditions, cisapiv1.ReasonTenantConflict, msg,
+		func(vrt *cisapiv1.VirtualServer) bool {
+			return crMgr.getTenant(vrt.ObjectMeta) != tenant
+		})
+}
+
+// rejectPersistenceConflicts returns the virtuals without the ones whose persistenceProfile differs from
+// the one of the oldest VirtualServer setting it, as the VirtualServers sharing an address share its persistence.
+func (crMgr *CRManager) rejectPersistenceConflicts(
+	virtual *cisapiv1.VirtualServer,
+	virtuals []*cisapiv1.VirtualServer,
+	conditions *[]metav1.Condition,
+) []*cisapiv1.VirtualServer {
+	var persistent []*cisapiv1.VirtualServer
+	for _, vrt := range virtuals {
+		if vrt.Spec.PersistenceProfile != nil {
+			persistent = append(persistent, vrt)
+		}
+	}
+	owner := getOldestVirtualServer(persistent)
+	if owner == nil {
+		return virtuals
+	}
+	msg := fmt.Sprintf("persistenceProfile conflicts with the one of VirtualServer %v/%v sharing the address",
+		owner.Namespace, owner.Name)
+	return crMgr.rejectSharedAddressConflicts(virtual, virtuals, conditions, cisapiv1.ReasonPersistenceConflict, msg,
+		func(vrt *cisapiv1.VirtualServer) bool {
+			return vrt.Spec.PersistenceProfile != nil &&
+				!reflect.DeepEqual(vrt.Spec.PersistenceProfile, owner.Spec.PersistenceProfile)
+		})
+}
+
+// updateAssociatedVirtualServersStatus reports the outcome of processing the virtual on the other
+// VirtualServers merged into it. Their Accepted condition is reported when they are processed themselves,
+// and their ResolvedRefs condition refers to their own services unless processing the virtual failed.
+func (crMgr *CRManager) updateAssociatedVirtualServersStatus(
+	virtual *cisapiv1.VirtualServer,
+	virtuals []*cisapiv1.VirtualServer,
+	vsAddress string,
+	conditions []metav1.Condition,
+) {
+	for _, vrt := range virtuals {
+		if vrt.Namespace == virtual.Namespace && vrt.Name == virtual.Name {
+			continue
+		}
+		var vrtConditions []metav1.Condition
+		// VirtualServer rejected for its tenant or persistence is accepted once it no longer conflicts
+		accepted := meta.FindStatusCondition(vrt.Status.Conditions, cisapiv1.ConditionAccepted)
+		if accepted != nil && (accepted.Reason == cisapiv1.ReasonTenantConflict ||
+			accepted.Reason == cisapiv1.ReasonPersistenceConflict) {
+			vrtConditions = append(vrtConditions, newCondition(cisapiv1.ConditionAccepted, metav1.ConditionTrue,
+				cisapiv1.ReasonAccepted, "VirtualServer is valid"))
+		}
+		for _, cond := range conditions {
+			switch {
+			case cond.Type == cisapiv1.ConditionAccepted:
+				continue
+			case cond.Type == cisapiv1.ConditionResolvedRefs && cond.Status == metav1.ConditionTrue:
+				cond = crMgr.getServiceRefsCondition(vrt.Namespace, getVirtualServerServices(vrt))
+			}
+			vrtConditions = append(vrtConditions, cond)
+		}
+		crMgr.updateVirtualServerStatus(vrt, vsAddress, vrtConditions...)
+	}
+}
+
+// getVirtualServerServices returns the services of all the pools of VirtualServer
+func getVirtualServerServices(virtual *cisapiv1.VirtualServer) []string {
+	var services []string
+	for _, pool := range virtual.Spec.Pools {
+		for _, backend := range getPoolBackends(pool) {
+			services = append(services, backend.service)
+		}
+	}
+	return services
+}
+
 func (crMgr *CRManager) getAssociatedVirtualServers(
 	currentVS *cisapiv1.VirtualServer,
 	allVirtuals []*cisapiv1.VirtualServer,
@@ -985,7 +1376,7 @@ func (crMgr *CRManager) getAssociatedVirtualServers(
 			}
 		}
 
-		if crMgr.ipamCli != nil {
+		if crMgr.isIPAMEnabled() {
 			if currentVS.Spec.HostGroup == "" && vrt.Spec.IPAMLabel != currentVS.Spec.IPAMLabel {
 				log.Errorf("Same host %v is configured with different IPAM labels: %v, %v. Unable to process %v", vrt.Spec.Host, vrt.Spec.IPAMLabel, currentVS.Spec.IPAMLabel, currentVS.Name)
 				return nil
@@ -1012,7 +1403,15 @@ func (crMgr *CRManager) getAssociatedVirtualServers(
 			uniquePaths = uniqueHostPathMap[vrt.Spec.Host]
 		}
 		isUnique := true
+		abPaths := make(map[string]struct{})
 		for _, pool := range vrt.Spec.Pools {
+			// Pools of an A/B deployment share the path
+			if _, ok := abPaths[pool.Path]; ok {
+				continue
+			}
+			if isABDeploymentPath(vrt, pool.Path) {
+				abPaths[pool.Path] = struct{}{}
+			}
 			if _, ok := uniquePaths[pool.Path]; ok {
 				// path already exists for the same host
 				log.Debugf("Discarding the VirtualServer %v/%v due to duplicate path",
@@ -1029,7 +1428,9 @@ func (crMgr *CRManager) getAssociatedVirtualServers(
 	return virtuals
 }
 
-func (crMgr *CRManager) getPolicyFromVirtuals(virtuals []*cisapiv1.VirtualServer) (*cisapiv1.Policy, error) {
+// getPolicyFromVirtuals returns the Policies applied to the virtuals from the least specific one,
+// the cluster-wide baseline Policy, the default Policy of the namespace and the Policy of the virtuals
+func (crMgr *CRManager) getPolicyFromVirtuals(virtuals []*cisapiv1.VirtualServer) ([]*cisapiv1.Policy, error) {
 
 	if len(virtuals) == 0 {
 		log.Errorf("No virtuals to extract policy from")
@@ -1047,7 +1448,7 @@ func (crMgr *CRManager) getPolicyFromVirtuals(virtuals []*cisapiv1.VirtualServer
 		}
 	}
 	if plcName == "" {
-		return nil, nil
+		return crMgr.getPolicyHierarchy(ns, nil), nil
 	}
 	crInf, ok := crMgr.getNamespacedInformer(ns)
 	if !ok {
@@ -1065,10 +1466,12 @@ func (crMgr *CRManager) getPolicyFromVirtuals(virtuals []*cisapiv1.VirtualServer
 		return nil, fmt.Errorf("Policy Not Found: %v", key)
 	}
 
-	return obj.(*cisapiv1.Policy), nil
+	return crMgr.getPolicyHierarchy(ns, obj.(*cisapiv1.Policy)), nil
 }
 
-func (crMgr *CRManager) getPolicyFromTransportServers(virtuals []*cisapiv1.TransportServer) (*cisapiv1.Policy, error) {
+// getPolicyFromTransportServers returns the Policies applied to the virtuals from the least specific one,
+// the cluster-wide baseline Policy, the default Policy of the namespace and the Policy of the virtuals
+func (crMgr *CRManager) getPolicyFromTransportServers(virtuals []*cisapiv1.TransportServer) ([]*cisapiv1.Policy, error) {
 
 	if len(virtuals) == 0 {
 		log.Errorf("No virtuals to extract policy from")
@@ -1086,7 +1489,7 @@ func (crMgr *CRManager) getPolicyFromTransportServers(virtuals []*cisapiv1.Trans
 		}
 	}
 	if plcName == "" {
-		return nil, nil
+		return crMgr.getPolicyHierarchy(ns, nil), nil
 	}
 	crInf, ok := crMgr.getNamespacedInformer(ns)
 	if !ok {
@@ -1106,7 +1509,7 @@ func (crMgr *CRManager) getPolicyFromTransportServers(virtuals []*cisapiv1.Trans
 		log.Errorf("Policy Not Found: %v", key)
 		return nil, fmt.Errorf("Policy Not Found: %v", key)
 	}
-	return obj.(*cisapiv1.Policy), nil
+	return crMgr.getPolicyHierarchy(ns, obj.(*cisapiv1.Policy)), nil
 }
 
 func getIPAMLabel(virtuals []*cisapiv1.VirtualServer) string {
@@ -1151,6 +1554,9 @@ func (crMgr *CRManager) getIPAMCR() *ficV1.IPAM {
 
 //Request IPAM for virtual IP address
 func (crMgr *CRManager) requestIP(ipamLabel string, host string, key string) (string, int) {
+	if crMgr.ipamProvider != nil {
+		return crMgr.ipamProvider.RequestIP(ipamLabel, host, key)
+	}
 	ipamCR := crMgr.getIPAMCR()
 	var ip string
 	var ipReleased bool
@@ -1259,6 +1665,9 @@ func (crMgr *CRManager) requestIP(ipamLabel string, host string, key string) (st
 }
 
 func (crMgr *CRManager) releaseIP(ipamLabel string, host string, key string) string {
+	if crMgr.ipamProvider != nil {
+		return crMgr.ipamProvider.ReleaseIP(ipamLabel, host, key)
+	}
 	ipamCR := crMgr.getIPAMCR()
 	var ip string
 	if ipamCR == nil || ipamLabel == "" {
@@ -1353,6 +1762,7 @@ func (crMgr *CRManager) updatePoolMembersForNodePort(
 					crMgr.getEndpointsForNodePort(nodePort, pool.NodeMemberLabel)
 			}
 		}
+		crMgr.drainPoolMembers(rsCfg, index, namespace)
 	}
 }
 
@@ -1374,6 +1784,7 @@ func (crMgr *CRManager) updatePoolMembersForCluster(
 			rsCfg.MetaData.Active = true
 			rsCfg.Pools[index].Members = mems
 		}
+		crMgr.drainPoolMembers(rsCfg, index, namespace)
 	}
 }
 
@@ -1425,16 +1836,29 @@ func (crMgr *CRManager) processTransportServers(
 			virtual, endTime.Sub(startTime))
 	}()
 
+	// conditions observed while processing are reported on the status of TransportServer
+	var conditions []metav1.Condition
+	var vsAddress string
+	// refsCond is reported on every return path, so that unresolved references are surfaced
+	// even when processing stops early
+	refsCond := crMgr.getServiceRefsCondition(virtual.Namespace, []string{virtual.Spec.Pool.Service})
 	// Skip validation for a deleted Virtual Server
 	if !isTSDeleted {
+		defer func() {
+			conditions = append(conditions, refsCond)
+			crMgr.updateTransportServerStatus(virtual, vsAddress, conditions...)
+		}()
 		// check if the virutal server matches all the requirements.
 		vkey := virtual.ObjectMeta.Namespace + "/" + virtual.ObjectMeta.Name
-		valid := crMgr.checkValidTransportServer(virtual)
-		if false == valid {
-			log.Errorf("TransportServer %s, is not valid",
-				vkey)
+		if err := crMgr.checkValidTransportServer(virtual); err != nil {
+			log.Errorf("TransportServer %s, is not valid: %v",
+				vkey, err)
+			conditions = append(conditions, newCondition(cisapiv1.ConditionAccepted, metav1.ConditionFalse,
+				cisapiv1.ReasonInvalid, err.Error()))
 			return nil
 		}
+		conditions = append(conditions, newCondition(cisapiv1.ConditionAccepted, metav1.ConditionTrue,
+			cisapiv1.ReasonAccepted, "TransportServer is valid"))
 	}
 	allVirtuals := crMgr.getAllTransportServers(virtual.ObjectMeta.Namespace)
 	crMgr.TeemData.Lock()
@@ -1463,13 +1887,17 @@ func (crMgr *CRManager) processTransportServers(
 	var key string
 	var status int
 	key = virtual.ObjectMeta.Namespace + "/" + virtual.ObjectMeta.Name + "_ts"
-	if crMgr.ipamCli != nil {
+	if crMgr.isIPAMEnabled() {
 		if isTSDeleted && len(virtuals) == 0 && virtual.Spec.VirtualServerAddress == "" {
 			ip = crMgr.releaseIP(virtual.Spec.IPAMLabel, "", key)
 		} else if virtual.Spec.VirtualServerAddress != "" {
 			ip = virtual.Spec.VirtualServerAddress
+			crMgr.checkIPAMConflict(virtual, ip)
+			conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionTrue,
+				cisapiv1.ReasonStaticAddress, ip))
 		} else {
 			ip, status = crMgr.requestIP(virtual.Spec.IPAMLabel, "", key)
+			conditions = append(conditions, getIPAMCondition(status, virtual.Spec.IPAMLabel, ip))
 
 			switch status {
 			case NotEnabled:
@@ -1481,17 +1909,24 @@ func (crMgr *CRManager) processTransportServers(
 				return nil
 			case NotRequested:
 				return fmt.Errorf("unable to make IPAM Request, will be re-requested soon")
+			case Exhausted:
+				crMgr.recordIPAMExhausted(virtual, virtual.Spec.IPAMLabel)
+				return fmt.Errorf("no free address available with IPAM label %v", virtual.Spec.IPAMLabel)
 			case Requested:
 				log.Debugf("IP address requested for Transport Server: %s/%s", virtual.Namespace, virtual.Name)
 				return nil
 			}
-			virtual.Status.VSAddress = ip
+			vsAddress = ip
 		}
 	} else {
 		if virtual.Spec.VirtualServerAddress == "" {
+			conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionFalse,
+				cisapiv1.ReasonNoAddress, "No VirtualServer address in TS or IPAM found"))
 			return fmt.Errorf("No VirtualServer address in TS or IPAM found.")
 		}
 		ip = virtual.Spec.VirtualServerAddress
+		conditions = append(conditions, newCondition(cisapiv1.ConditionIPAllocated, metav1.ConditionTrue,
+			cisapiv1.ReasonStaticAddress, ip))
 	}
 
 	// vsMap holds Resource Configs of current virtuals temporarily
@@ -1515,7 +1950,7 @@ func (crMgr *CRManager) processTransportServers(
 	}
 
 	rsCfg := &ResourceConfig{}
-	rsCfg.Virtual.Partition = crMgr.Partition
+	rsCfg.Virtual.Partition = crMgr.getTenant(virtual.ObjectMeta)
 	rsCfg.MetaData.ResourceType = TransportServer
 	rsCfg.Virtual.Enabled = true
 	rsCfg.Virtual.Name = rsName
@@ -1526,14 +1961,16 @@ func (crMgr *CRManager) processTransportServers(
 		ip,
 		virtual.Spec.VirtualServerPort,
 	)
-	plc, err := crMgr.getPolicyFromTransportServers(virtuals)
-	if plc != nil {
-		err := crMgr.handleTSResourceConfigForPolicy(rsCfg, plc)
+	policies, err := crMgr.getPolicyFromTransportServers(virtuals)
+	for _, plc := range policies {
+		err = crMgr.handleTSResourceConfigForPolicy(rsCfg, plc)
 		if err != nil {
-			processingError = true
+			break
 		}
 	}
 	if err != nil {
+		refsCond = newCondition(cisapiv1.ConditionResolvedRefs, metav1.ConditionFalse,
+			cisapiv1.ReasonInvalidPolicy, err.Error())
 		processingError = true
 		log.Errorf("%v", err)
 	}
@@ -1679,7 +2116,8 @@ func filterTransportServersForService(allVirtuals []*cisapiv1.TransportServer,
 func (crMgr *CRManager) getAllServicesFromMonitoredNamespaces() []*v1.Service {
 	var svcList []*v1.Service
 	if crMgr.watchingAllNamespaces() {
-		objList := crMgr.crInformers[""].svcInformer.GetIndexer().List()
+		crInf, _ := crMgr.getNamespacedInformer("")
+		objList := crInf.svcInformer.GetIndexer().List()
 		for _, obj := range objList {
 			svcList = append(svcList, obj.(*v1.Service))
 		}
@@ -1687,7 +2125,11 @@ func (crMgr *CRManager) getAllServicesFromMonitoredNamespaces() []*v1.Service {
 	}
 
 	for ns := range crMgr.namespaces {
-		objList := crMgr.crInformers[ns].svcInformer.GetIndexer().List()
+		crInf, ok := crMgr.getNamespacedInformer(ns)
+		if !ok {
+			continue
+		}
+		objList := crInf.svcInformer.GetIndexer().List()
 		for _, obj := range objList {
 			svcList = append(svcList, obj.(*v1.Service))
 		}
@@ -1782,7 +2224,7 @@ func (crMgr *CRManager) processLBServices(
 	svc *v1.Service,
 	isSVCDeleted bool,
 ) error {
-	if crMgr.ipamCli == nil {
+	if !crMgr.isIPAMEnabled() {
 		log.Error("IPAM is not enabled, Unable to process Services of Type LoadBalancer")
 		return nil
 	}
@@ -1810,6 +2252,9 @@ func (crMgr *CRManager) processLBServices(
 		return nil
 	case NotRequested:
 		return fmt.Errorf("unable to make IPAM Request, will be re-requested soon")
+	case Exhausted:
+		crMgr.recordIPAMExhausted(svc, ipamLabel)
+		return fmt.Errorf("no free address available with IPAM label %v", ipamLabel)
 	case Requested:
 		log.Debugf("IP address requested for service: %s/%s", svc.Namespace, svc.Name)
 		return nil
@@ -1831,7 +2276,7 @@ func (crMgr *CRManager) processLBServices(
 		}
 
 		rsCfg := &ResourceConfig{}
-		rsCfg.Virtual.Partition = crMgr.Partition
+		rsCfg.Virtual.Partition = crMgr.getTenant(svc.ObjectMeta)
 		rsCfg.MetaData.ResourceType = TransportServer
 		rsCfg.Virtual.Enabled = true
 		rsCfg.Virtual.Name = rsName
@@ -1868,6 +2313,10 @@ func (crMgr *CRManager) processService(
 		return nil
 	}
 
+	if crMgr.useEndpointSlices {
+		return crMgr.processServiceEndpointSlices(svc)
+	}
+
 	if eps == nil {
 		crInf, ok := crMgr.getNamespacedInformer(namespace)
 		if !ok {
@@ -1895,7 +2344,7 @@ func (crMgr *CRManager) processService(
 			var members []PoolMember
 			for _, addr := range subset.Addresses {
 				// Checking for headless services
-				if containsNode(nodes, *addr.NodeName) || svc.Spec.ClusterIP == "None" {
+				if (addr.NodeName != nil && containsNode(nodes, *addr.NodeName)) || svc.Spec.ClusterIP == "None" {
 					member := PoolMember{
 						Address: addr.IP,
 						Port:    p.Port,
@@ -1914,6 +2363,51 @@ func (crMgr *CRManager) processService(
 	return nil
 }
 
+// processServiceEndpointSlices updates the pool members of the service from its EndpointSlices
+func (crMgr *CRManager) processServiceEndpointSlices(svc *v1.Service) error {
+	svcKey := svc.Namespace + "/" + svc.Name
+	crInf, ok := crMgr.getNamespacedInformer(svc.Namespace)
+	if !ok {
+		log.Errorf("Informer not found for namespace: %v", svc.Namespace)
+		return fmt.Errorf("unable to process Service: %v", svcKey)
+	}
+	objs, err := crInf.epSliceInformer.GetIndexer().ByIndex(endpointSliceServiceIndex, svcKey)
+	if err != nil {
+		return err
+	}
+	var slices []*discoveryv1.EndpointSlice
+	for _, obj := range objs {
+		slices = append(slices, obj.(*discoveryv1.EndpointSlice))
+	}
+
+	nodes := crMgr.getNodesFromCache()
+	// Checking for headless services
+	include := func(endpoint discoveryv1.Endpoint) bool {
+		return (endpoint.NodeName != nil && containsNode(nodes, *endpoint.NodeName)) || svc.Spec.ClusterIP == "None"
+	}
+
+	pmi := poolMembersInfo{
+		svcType:   svc.Spec.Type,
+		portSpec:  svc.Spec.Ports,
+		memberMap: make(map[portRef][]PoolMember),
+	}
+	for port, members := range rsc.GetEndpointSliceMembers(svc, slices, include) {
+		var poolMembers []PoolMember
+		for _, member := range members {
+			poolMembers = append(poolMembers, PoolMember{
+				Address: member.Address,
+				Port:    member.Port,
+				Session: member.Session,
+			})
+		}
+		pmi.memberMap[portRef{name: port.Name, port: port.Port}] = poolMembers
+	}
+
+	crMgr.resources.poolMemCache[svcKey] = pmi
+
+	return nil
+}
+
 func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete bool) {
 
 	if isDelete {
@@ -1926,6 +2420,12 @@ func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete
 	crMgr.TeemData.Lock()
 	crMgr.TeemData.ResourceType.ExternalDNS[edns.Namespace] = len(crMgr.getAllExternalDNS(edns.Namespace))
 	crMgr.TeemData.Unlock()
+	dataCenters := getStaticAddressDataCenters(crMgr.resources.dnsConfig, edns.Spec.DomainName)
+	if err := validateExternalDNS(edns, dataCenters); err != nil {
+		log.Errorf("Invalid ExternalDNS %v/%v: %v", edns.Namespace, edns.Name, err)
+		delete(crMgr.resources.dnsConfig, edns.Spec.DomainName)
+		return
+	}
 	wip := WideIP{
 		DomainName: edns.Spec.DomainName,
 		RecordType: edns.Spec.DNSRecordType,
@@ -1940,13 +2440,19 @@ func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete
 
 	log.Debugf("Processing WideIP: %v", edns.Spec.DomainName)
 
-	for _, pl := range edns.Spec.Pools {
+	for i, pl := range edns.Spec.Pools {
 		UniquePoolName := edns.Spec.DomainName + "_" + strings.ReplaceAll(edns.GetCreationTimestamp().Format(time.RFC3339Nano), ":", "-")
+		if i > 0 {
+			UniquePoolName = fmt.Sprintf("%v_%v", UniquePoolName, i)
+		}
 		log.Debugf("Processing WideIP Pool: %v", UniquePoolName)
 		pool := GSLBPool{
-			Name:       UniquePoolName,
-			RecordType: pl.DNSRecordType,
-			LBMethod:   pl.LoadBalanceMethod,
+			Name:             UniquePoolName,
+			RecordType:       pl.DNSRecordType,
+			LBMethod:         pl.LoadBalanceMethod,
+			FallbackLBMethod: pl.FallbackMethod,
+			Ratio:            pl.Ratio,
+			Order:            pl.Order,
 		}
 
 		if pl.DNSRecordType == "" {
@@ -1968,21 +2474,39 @@ func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete
 				if !vs.Virtual.isSecure && vs.Virtual.HTTPTraffic == TLSRedirectInsecure {
 					continue
 				}
-				log.Debugf("Adding WideIP Pool Member: %v", fmt.Sprintf("%v:/%v/Shared/%v",
-					pl.DataServerName, DEFAULT_PARTITION, vsName))
-				pool.Members = append(
-					pool.Members,
-					fmt.Sprintf("%v:/%v/Shared/%v",
-						pl.DataServerName, DEFAULT_PARTITION, vsName),
-				)
+				member := GSLBPoolMember{
+					Server:        pl.DataServerName,
+					VirtualServer: fmt.Sprintf("/%v/%v/%v", vs.Virtual.tenant(), as3SharedApplication, vsName),
+				}
+				log.Debugf("Adding WideIP Pool Member: %v:%v", member.Server, member.VirtualServer)
+				pool.Members = append(pool.Members, member)
+			}
+		}
+		// Members of the other clusters and static addresses
+		for _, mem := range pl.Members {
+			member := GSLBPoolMember{
+				Server:        mem.DataServerName,
+				VirtualServer: mem.VirtualServerName,
+				Address:       mem.Address,
+				Port:          mem.Port,
+				DataCenter:    mem.DataCenter,
+				Ratio:         mem.Ratio,
+			}
+			if member.Address == "" && member.Server == "" {
+				member.Server = pl.DataServerName
+			}
+			// Member given for a virtual server of this cluster replaces the one found by host, retaining its ratio
+			if idx := getGSLBPoolMemberIndex(pool.Members, member); idx >= 0 {
+				pool.Members[idx] = member
+				continue
 			}
+			pool.Members = append(pool.Members, member)
 		}
 		if pl.Monitor.Type != "" {
-			// TODO: Need to change to DEFAULT_PARTITION from Common, once Agent starts to support DEFAULT_PARTITION
 			if pl.Monitor.Type == "http" || pl.Monitor.Type == "https" {
 				pool.Monitor = &Monitor{
 					Name:      UniquePoolName + "_monitor",
-					Partition: "Common",
+					Partition: getGTMPartition(),
 					Type:      pl.Monitor.Type,
 					Interval:  pl.Monitor.Interval,
 					Send:      pl.Monitor.Send,
@@ -1992,7 +2516,7 @@ func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete
 			} else {
 				pool.Monitor = &Monitor{
 					Name:      UniquePoolName + "_monitor",
-					Partition: "Common",
+					Partition: getGTMPartition(),
 					Type:      pl.Monitor.Type,
 					Interval:  pl.Monitor.Interval,
 					Timeout:   pl.Monitor.Timeout,
@@ -2001,6 +2525,10 @@ func (crMgr *CRManager) processExternalDNS(edns *cisapiv1.ExternalDNS, isDelete
 		}
 		wip.Pools = append(wip.Pools, pool)
 	}
+	// Pools of the WideIP are selected in this order by global-availability
+	sort.SliceStable(wip.Pools, func(i, j int) bool {
+		return wip.Pools[i].Order < wip.Pools[j].Order
+	})
 
 	crMgr.resources.dnsConfig[wip.DomainName] = wip
 	return
@@ -2088,10 +2616,9 @@ func (crMgr *CRManager) processIngressLink(
 	if !isILDeleted {
 		// check if the virutal server matches all the requirements.
 		vkey := ingLink.ObjectMeta.Namespace + "/" + ingLink.ObjectMeta.Name
-		valid := crMgr.checkValidIngressLink(ingLink)
-		if false == valid {
-			log.Errorf("ingressLink %s, is not valid",
-				vkey)
+		if err := crMgr.checkValidIngressLink(ingLink); err != nil {
+			log.Errorf("ingressLink %s, is not valid: %v",
+				vkey, err)
 			return nil
 		}
 	}
@@ -2099,11 +2626,12 @@ func (crMgr *CRManager) processIngressLink(
 	var key string
 	var status int
 	key = ingLink.ObjectMeta.Namespace + "/" + ingLink.ObjectMeta.Name + "_il"
-	if crMgr.ipamCli != nil {
+	if crMgr.isIPAMEnabled() {
 		if isILDeleted && ingLink.Spec.VirtualServerAddress == "" {
 			ip = crMgr.releaseIP(ingLink.Spec.IPAMLabel, "", key)
 		} else if ingLink.Spec.VirtualServerAddress != "" {
 			ip = ingLink.Spec.VirtualServerAddress
+			crMgr.checkIPAMConflict(ingLink, ip)
 		} else {
 			ip, status = crMgr.requestIP(ingLink.Spec.IPAMLabel, "", key)
 
@@ -2117,6 +2645,9 @@ func (crMgr *CRManager) processIngressLink(
 				return nil
 			case NotRequested:
 				return fmt.Errorf("unable to make IPAM Request, will be re-requested soon")
+			case Exhausted:
+				crMgr.recordIPAMExhausted(ingLink, ingLink.Spec.IPAMLabel)
+				return fmt.Errorf("no free address available with IPAM label %v", ingLink.Spec.IPAMLabel)
 			case Requested:
 				log.Debugf("IP address requested for IngressLink: %s/%s", ingLink.Namespace, ingLink.Name)
 				return nil
@@ -2182,7 +2713,7 @@ func (crMgr *CRManager) processIngressLink(
 		)
 
 		rsCfg := &ResourceConfig{}
-		rsCfg.Virtual.Partition = crMgr.Partition
+		rsCfg.Virtual.Partition = crMgr.getTenant(ingLink.ObjectMeta)
 		rsCfg.MetaData.ResourceType = "TransportServer"
 		rsCfg.Virtual.Mode = "standard"
 		rsCfg.Virtual.TranslateServerAddress = true
@@ -2497,36 +3028,6 @@ func getNodeport(svc *v1.Service, servicePort int32) int32 {
 	return 0
 }
 
-//Update virtual server status with virtual server address
-func (crMgr *CRManager) updateVirtualServerStatus(vs *cisapiv1.VirtualServer, ip string, statusOk string) {
-	// Set the vs status to include the virtual IP address
-	vsStatus := cisapiv1.VirtualServerStatus{VSAddress: ip, StatusOk: statusOk}
-	log.Debugf("Updating VirtualServer Status with %v for resource name:%v , namespace: %v", vsStatus, vs.Name, vs.Namespace)
-	vs.Status = vsStatus
-	vs.Status.VSAddress = ip
-	vs.Status.StatusOk = statusOk
-	_, updateErr := crMgr.kubeCRClient.CisV1().VirtualServers(vs.ObjectMeta.Namespace).UpdateStatus(context.TODO(), vs, metav1.UpdateOptions{})
-	if nil != updateErr {
-		log.Debugf("Error while updating virtual server status:%v", updateErr)
-		return
-	}
-}
-
-//Update Transport server status with virtual server address
-func (crMgr *CRManager) updateTransportServerStatus(ts *cisapiv1.TransportServer, ip string, statusOk string) {
-	// Set the vs status to include the virtual IP address
-	tsStatus := cisapiv1.TransportServerStatus{VSAddress: ip, StatusOk: statusOk}
-	log.Debugf("Updating VirtualServer Status with %v for resource name:%v , namespace: %v", tsStatus, ts.Name, ts.Namespace)
-	ts.Status = tsStatus
-	ts.Status.VSAddress = ip
-	ts.Status.StatusOk = statusOk
-	_, updateErr := crMgr.kubeCRClient.CisV1().TransportServers(ts.ObjectMeta.Namespace).UpdateStatus(context.TODO(), ts, metav1.UpdateOptions{})
-	if nil != updateErr {
-		log.Debugf("Error while updating Transport server status:%v", updateErr)
-		return
-	}
-}
-
 //Update ingresslink status with virtual server address
 func (crMgr *CRManager) updateIngressLinkStatus(il *cisapiv1.IngressLink, ip string) {
 	// Set the vs status to include the virtual IP address
@@ -4,6 +4,7 @@ import (
 	"context"
 	"reflect"
 	"sort"
+	"strings"
 	"time"
 
 	ficV1 "github.com/F5Networks/f5-ipam-controller/pkg/ipamapis/apis/fic/v1"
@@ -20,6 +21,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -79,7 +81,10 @@ var _ = Describe("Worker Tests", func() {
 			mockCRM.kubeCRClient,
 			namespace,
 			0,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+				policyIndex:          policyIndexFunc,
+			},
 			func(options *metav1.ListOptions) {
 				options.LabelSelector = mockCRM.resourceSelector.String()
 			},
@@ -450,6 +455,39 @@ var _ = Describe("Worker Tests", func() {
 			Expect(res[1]).To(Equal(vrt3), "Wrong list of Virtual Servers")
 		})
 
+		It("Filter VS for Secret", func() {
+			tlsProf := test.NewTLSProfile("sampleTLS", namespace, cisapiv1.TLSProfileSpec{
+				Hosts: []string{"test.com"},
+				TLS: cisapiv1.TLS{
+					Termination: TLSEdge,
+					Reference:   Secret,
+					ClientSSL:   "clientsecret",
+				},
+			})
+			vrt1.Spec.TLSProfileName = "sampleTLS"
+			_ = mockCRM.crInformers[namespace].tlsInformer.GetIndexer().Add(tlsProf)
+			_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vrt1)
+
+			res := mockCRM.getVirtualsForSecret(test.NewSecret("clientsecret", namespace, "cert", "key"))
+			Expect(res).To(Equal([]*cisapiv1.VirtualServer{vrt1}), "Wrong list of Virtual Servers")
+			res = mockCRM.getVirtualsForSecret(test.NewSecret("othersecret", namespace, "cert", "key"))
+			Expect(res).To(BeEmpty(), "Wrong list of Virtual Servers")
+
+			vrt2 := test.NewVirtualServer(
+				"SampleVS2",
+				namespace,
+				cisapiv1.VirtualServerSpec{
+					Host: "test2.com",
+					Pools: []cisapiv1.Pool{{
+						Service:  "svc1",
+						Monitors: []cisapiv1.Monitor{{Type: "https", ClientCertificate: "monitorsecret"}},
+					}},
+				})
+			_ = mockCRM.crInformers[namespace].vsInformer.GetIndexer().Add(vrt2)
+			res = mockCRM.getVirtualsForSecret(test.NewSecret("monitorsecret", namespace, "cert", "key"))
+			Expect(res).To(Equal([]*cisapiv1.VirtualServer{vrt2}), "Wrong list of Virtual Servers")
+		})
+
 		It("VS Handling HTTP", func() {
 			Expect(doesVSHandleHTTP(vrt1)).To(BeTrue(), "HTTP VS in invalid")
 			vrt1.Spec.TLSProfileName = "TLSProf"
@@ -458,6 +496,22 @@ var _ = Describe("Worker Tests", func() {
 			Expect(doesVSHandleHTTP(vrt1)).To(BeTrue(), "HTTPS VS in invalid")
 		})
 
+		It("Validate tenant label", func() {
+			objMeta := metav1.ObjectMeta{Name: "vs", Namespace: namespace}
+			Expect(mockCRM.getTenant(objMeta)).To(Equal(DEFAULT_PARTITION))
+			for tenant, expected := range map[string]string{
+				"team_1.a-b":                  "team_1.a-b",
+				"Common":                      DEFAULT_PARTITION,
+				"1team":                       DEFAULT_PARTITION,
+				"team/a":                      DEFAULT_PARTITION,
+				"team a":                      DEFAULT_PARTITION,
+				"t" + strings.Repeat("a", 64): DEFAULT_PARTITION,
+			} {
+				objMeta.Labels = map[string]string{TenantLabel: tenant}
+				Expect(mockCRM.getTenant(objMeta)).To(Equal(expected), tenant)
+			}
+		})
+
 		Describe("Filter Associated VirtualServers", func() {
 			var vrt2, vrt3, vrt4 *cisapiv1.VirtualServer
 			BeforeEach(func() {
@@ -851,6 +905,140 @@ var _ = Describe("Worker Tests", func() {
 			mockCRM.processExternalDNS(newEDNS, true)
 			Expect(len(mockCRM.resources.dnsConfig)).To(Equal(0))
 		})
+
+		It("Processing External DNS with members of other clusters", func() {
+			mockCRM.resources.Init()
+			mockCRM.TeemData = &teem.TeemsData{
+				ResourceType: teem.ResourceTypes{
+					ExternalDNS: make(map[string]int),
+				},
+			}
+			mockCRM.resources.rsMap["SampleVS"] = &ResourceConfig{
+				MetaData: metaData{
+					hosts: []string{"test.com"},
+				},
+			}
+			mockCRM.resources.rsMap["SampleVS"].Virtual.Partition = "test"
+
+			newEDNS := test.NewExternalDNS(
+				"SampleEDNS",
+				namespace,
+				cisapiv1.ExternalDNSSpec{
+					DomainName:        "test.com",
+					LoadBalanceMethod: "global-availability",
+					Pools: []cisapiv1.DNSPool{
+						{
+							DataServerName: "/Common/DataServer2",
+							Order:          2,
+							Members: []cisapiv1.DNSPoolMember{
+								{Address: "10.1.1.1", Port: 443, DataCenter: "/Common/DC3"},
+							},
+						},
+						{
+							DataServerName:    "/Common/DataServer1",
+							LoadBalanceMethod: "ratio",
+							FallbackMethod:    "return-to-dns",
+							Order:             1,
+							Members: []cisapiv1.DNSPoolMember{
+								{VirtualServerName: "/test/Shared/SampleVS", Ratio: 2},
+								{DataServerName: "/Common/DataServer3", VirtualServerName: "/test/Shared/SampleVS"},
+							},
+						},
+					},
+				})
+
+			mockCRM.processExternalDNS(newEDNS, false)
+			pools := mockCRM.resources.dnsConfig["test.com"].Pools
+			Expect(pools).To(HaveLen(2))
+			Expect(pools[0].Name).NotTo(Equal(pools[1].Name), "Pools should be named uniquely")
+			Expect(pools[0].Order).To(Equal(int32(1)), "Pools should be ordered")
+			Expect(pools[0].FallbackLBMethod).To(Equal("return-to-dns"))
+			Expect(pools[0].Members).To(Equal([]GSLBPoolMember{
+				{Server: "/Common/DataServer1", VirtualServer: "/test/Shared/SampleVS", Ratio: 2},
+				{Server: "/Common/DataServer3", VirtualServer: "/test/Shared/SampleVS"},
+			}), "Member given for the VirtualServer of this cluster should replace the one found by host")
+			Expect(pools[1].Members[1]).To(Equal(GSLBPoolMember{Address: "10.1.1.1", Port: 443, DataCenter: "/Common/DC3"}))
+
+			invalidEDNS := newEDNS.DeepCopy()
+			invalidEDNS.Spec.LoadBalanceMethod = "least-connections"
+			mockCRM.processExternalDNS(invalidEDNS, false)
+			Expect(mockCRM.resources.dnsConfig).To(BeEmpty(), "WideIP with unsupported LB method should be removed")
+
+			invalidEDNS = newEDNS.DeepCopy()
+			invalidEDNS.Spec.Pools[0].Members[0].DataCenter = ""
+			mockCRM.processExternalDNS(invalidEDNS, false)
+			Expect(mockCRM.resources.dnsConfig).To(BeEmpty(), "Static member without data center should be rejected")
+
+			invalidEDNS = newEDNS.DeepCopy()
+			invalidEDNS.Spec.Pools[1].Members = append(invalidEDNS.Spec.Pools[1].Members,
+				cisapiv1.DNSPoolMember{Address: "10.1.1.1", Port: 80, DataCenter: "DC4"})
+			mockCRM.processExternalDNS(invalidEDNS, false)
+			Expect(mockCRM.resources.dnsConfig).To(BeEmpty(), "Static address in another data center should be rejected")
+
+			mockCRM.processExternalDNS(newEDNS, false)
+			otherEDNS := newEDNS.DeepCopy()
+			otherEDNS.Spec.DomainName = "other.com"
+			otherEDNS.Spec.Pools[0].Members[0].DataCenter = "DC4"
+			mockCRM.processExternalDNS(otherEDNS, false)
+			Expect(mockCRM.resources.dnsConfig).NotTo(HaveKey("other.com"),
+				"Static address in the data center of another WideIP should be rejected")
+			otherEDNS.Spec.Pools[0].Members[0].DataCenter = "DC3"
+			mockCRM.processExternalDNS(otherEDNS, false)
+			Expect(mockCRM.resources.dnsConfig).To(HaveKey("other.com"))
+		})
+	})
+
+	It("Pool members from EndpointSlices", func() {
+		ready, notReady := true, false
+		port := int32(8080)
+		portName := "port0"
+		node1, node2 := "node1", "node2"
+		mockCRM.useEndpointSlices = true
+		mockCRM.oldNodes = []Node{{Name: "node1", Addr: "10.10.10.1"}}
+		delete(mockCRM.crInformers, "default")
+		_ = mockCRM.addNamespacedInformer("default")
+		crInf := mockCRM.crInformers["default"]
+		Expect(crInf.epsInformer).To(BeNil())
+		Expect(crInf.epSliceInformer).NotTo(BeNil())
+
+		slice := &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "svc1-abc",
+				Namespace: namespace,
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "svc1"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses:  []string{"10.1.1.1"},
+					Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+					NodeName:   &node1,
+				},
+				{
+					Addresses: []string{"10.1.1.2"},
+					Conditions: discoveryv1.EndpointConditions{
+						Ready: &notReady, Serving: &ready, Terminating: &ready,
+					},
+					NodeName: &node1,
+				},
+				{
+					Addresses:  []string{"10.1.1.3"},
+					Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+					NodeName:   &node2,
+				},
+			},
+		}
+		_ = crInf.epSliceInformer.GetIndexer().Add(slice)
+		_ = crInf.svcInformer.GetIndexer().Add(svc1)
+
+		err := mockCRM.processService(svc1, nil, false)
+		Expect(err).To(BeNil())
+		pmi := mockCRM.resources.poolMemCache["default/svc1"]
+		Expect(pmi.memberMap[portRef{name: "port0", port: 8080}]).To(Equal([]PoolMember{
+			{Address: "10.1.1.1", Port: 8080, Session: "user-enabled"},
+			{Address: "10.1.1.2", Port: 8080, Session: "user-disabled"},
+		}), "Members on unknown nodes should be excluded")
 	})
 
 	It("get node port", func() {
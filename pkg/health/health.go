@@ -1,24 +1,42 @@
 package health
 
 import (
+	"bytes"
+	"fmt"
 	"net/http"
 	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 )
 
+// DefaultCheckTimeout bounds each check when HealthChecker has no Timeout set
+const DefaultCheckTimeout = 5 * time.Second
+
+// Check verifies a single component, Func returns an error when the component is unhealthy
+type Check struct {
+	Name string
+	Func func() error
+}
+
 type HealthChecker struct {
 	SubPID int
+	// Checks served on /livez, a failure means the controller needs a restart
+	LivenessChecks []Check
+	// Checks served on /readyz, a failure means the controller can not program BIG-IP right now
+	ReadinessChecks []Check
+	// Time allowed for each check
+	Timeout time.Duration
 }
 
-//TODO: Add additional health checks
-//TODO: add health check if Kubernetes API is still reachable
 func (hc HealthChecker) HealthCheckHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if hc.SubPID != 0 {
-			_, err := os.FindProcess(hc.SubPID)
+			err := CheckProcess(hc.SubPID)
 			if err == nil {
-				// assume that Python process is still running
+				// Python process is still running
 				w.WriteHeader(http.StatusOK)
 				w.Write([]byte("Ok"))
 				return
@@ -31,3 +49,119 @@ func (hc HealthChecker) HealthCheckHandler() http.Handler {
 		w.Write([]byte("Python process is dead"))
 	})
 }
+
+// LivenessHandler serves the result of LivenessChecks
+func (hc HealthChecker) LivenessHandler() http.Handler {
+	return hc.checksHandler("livez", hc.LivenessChecks)
+}
+
+// ReadinessHandler serves the result of ReadinessChecks
+func (hc HealthChecker) ReadinessHandler() http.Handler {
+	return hc.checksHandler("readyz", hc.ReadinessChecks)
+}
+
+// checksHandler reports every check on its own line and responds with 503 when any of them fails
+func (hc HealthChecker) checksHandler(endpoint string, checks []Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := hc.Timeout
+		if timeout == 0 {
+			timeout = DefaultCheckTimeout
+		}
+		errs := runChecks(checks, timeout)
+
+		var body bytes.Buffer
+		failed := false
+		for i, check := range checks {
+			if errs[i] != nil {
+				failed = true
+				fmt.Fprintf(&body, "[-]%v failed: %v\n", check.Name, errs[i])
+				continue
+			}
+			fmt.Fprintf(&body, "[+]%v ok\n", check.Name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if failed {
+			log.Debugf("[HEALTH] %v check failed:\n%v", endpoint, body.String())
+			fmt.Fprintf(&body, "%v check failed\n", endpoint)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			fmt.Fprintf(&body, "%v check passed\n", endpoint)
+			w.WriteHeader(http.StatusOK)
+		}
+		w.Write(body.Bytes())
+	})
+}
+
+// runChecks runs the checks in parallel, a check which does not return within timeout fails
+func runChecks(checks []Check, timeout time.Duration) []error {
+	errs := make([]error, len(checks))
+	results := make([]chan error, len(checks))
+	for i, check := range checks {
+		// Buffered, so that a check returning after the timeout does not block forever
+		results[i] = make(chan error, 1)
+		go func(check Check, result chan error) {
+			result <- check.Func()
+		}(check, results[i])
+	}
+
+	deadline := time.After(timeout)
+	for i := range checks {
+		select {
+		case errs[i] = <-results[i]:
+		case <-deadline:
+			// Remaining checks get a last chance to report without waiting
+			for ; i < len(checks); i++ {
+				select {
+				case errs[i] = <-results[i]:
+				default:
+					errs[i] = fmt.Errorf("timed out after %v", timeout)
+				}
+			}
+			return errs
+		}
+	}
+	return errs
+}
+
+// CheckProcess verifies that the process with the given PID is still running
+// os.FindProcess always succeeds on Unix, so the process is probed with signal 0
+func CheckProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err = proc.Signal(syscall.Signal(0)); err != nil {
+		return fmt.Errorf("process %v is not running: %v", pid, err)
+	}
+	return nil
+}
+
+// Progress tracks how long a worker loop has been busy with its current item
+// An idle worker waiting for the next item is always considered to make progress
+type Progress struct {
+	// Unix time in nanoseconds when the worker picked the current item, 0 when idle
+	busySince int64
+}
+
+// Busy marks that the worker picked an item
+func (p *Progress) Busy() {
+	atomic.StoreInt64(&p.busySince, time.Now().UnixNano())
+}
+
+// Idle marks that the worker is done with its item
+func (p *Progress) Idle() {
+	atomic.StoreInt64(&p.busySince, 0)
+}
+
+// Check returns an error when the worker has been busy with the same item for longer than stallTimeout
+func (p *Progress) Check(stallTimeout time.Duration) error {
+	busySince := atomic.LoadInt64(&p.busySince)
+	if busySince == 0 {
+		return nil
+	}
+	if busy := time.Since(time.Unix(0, busySince)); busy > stallTimeout {
+		return fmt.Errorf("no progress for %v", busy.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*-
+ * Copyright (c) 2017-2021 F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health Checks", func() {
+	serve := func(handler http.Handler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	It("Report each check", func() {
+		hc := HealthChecker{
+			ReadinessChecks: []Check{
+				{Name: "first", Func: func() error { return nil }},
+				{Name: "second", Func: func() error { return fmt.Errorf("unreachable") }},
+			},
+		}
+		w := serve(hc.ReadinessHandler())
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Body.String()).To(ContainSubstring("[+]first ok"))
+		Expect(w.Body.String()).To(ContainSubstring("[-]second failed: unreachable"))
+
+		hc.ReadinessChecks = hc.ReadinessChecks[:1]
+		w = serve(hc.ReadinessHandler())
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(ContainSubstring("readyz check passed"))
+
+		w = serve(hc.LivenessHandler())
+		Expect(w.Code).To(Equal(http.StatusOK), "No liveness checks should pass")
+	})
+
+	It("Time out slow checks", func() {
+		block := make(chan struct{})
+		defer close(block)
+		hc := HealthChecker{
+			Timeout: 10 * time.Millisecond,
+			LivenessChecks: []Check{
+				{Name: "slow", Func: func() error {
+					<-block
+					return nil
+				}},
+				{Name: "fast", Func: func() error { return nil }},
+			},
+		}
+		w := serve(hc.LivenessHandler())
+		Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(w.Body.String()).To(ContainSubstring("[-]slow failed: timed out"))
+		Expect(w.Body.String()).To(ContainSubstring("[+]fast ok"))
+	})
+
+	It("Check process", func() {
+		Expect(CheckProcess(os.Getpid())).To(BeNil())
+		w := serve(HealthChecker{SubPID: os.Getpid()}.HealthCheckHandler())
+		Expect(w.Code).To(Equal(http.StatusOK))
+		w = serve(HealthChecker{}.HealthCheckHandler())
+		Expect(w.Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("Track worker progress", func() {
+		var p Progress
+		Expect(p.Check(time.Minute)).To(BeNil(), "Idle worker should be healthy")
+		p.Busy()
+		Expect(p.Check(time.Minute)).To(BeNil())
+		p.busySince = time.Now().Add(-2 * time.Minute).UnixNano()
+		Expect(p.Check(time.Minute)).NotTo(BeNil(), "Worker busy beyond the stall timeout should fail")
+		p.Idle()
+		Expect(p.Check(time.Minute)).To(BeNil())
+	})
+})
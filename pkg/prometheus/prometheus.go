@@ -1,6 +1,9 @@
 package prometheus
 
 import (
+	"sync/atomic"
+	"time"
+
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -31,6 +34,113 @@ var CurrentErrors = prometheus.NewGaugeVec(
 	[]string{},
 )
 
+var ConfigurationDrift = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "bigip_configuration_drift",
+		Help: "Set to 1 when the AS3 tenant on BIG-IP differs from the declaration posted by the BigIP k8s CTLR",
+	},
+	[]string{"tenant"},
+)
+
+var ConfigurationDriftCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bigip_configuration_drift_total",
+		Help: "Total count of configuration drifts detected on the AS3 tenants of BIG-IP",
+	},
+	[]string{"tenant"},
+)
+
+var AS3PostDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "bigip_as3_post_duration_seconds",
+		Help:    "Latency of the AS3 declaration posts to BIG-IP",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 30, 45, 60},
+	},
+	[]string{"tenant"},
+)
+
+var AS3DeclarationSize = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "bigip_as3_declaration_size_bytes",
+		Help:    "Size of the AS3 declarations posted to BIG-IP",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8),
+	},
+	[]string{"tenant"},
+)
+
+var AS3PostCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bigip_as3_posts_total",
+		Help: "Total count of the AS3 declaration posts to BIG-IP by HTTP status code",
+	},
+	[]string{"tenant", "status"},
+)
+
+var LastSuccessfulPost = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "bigip_as3_seconds_since_last_successful_post",
+		Help: "Seconds elapsed since BIG-IP last accepted an AS3 declaration, counted from the start of the BigIP k8s CTLR until the first one",
+	},
+	func() float64 {
+		return time.Since(time.Unix(0, atomic.LoadInt64(&lastSuccessfulPost))).Seconds()
+	},
+)
+
+var GTMWriteCount = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bigip_gtm_writes_total",
+		Help: "Total count of the gtm configuration writes by result",
+	},
+	[]string{"result"},
+)
+
+var ResourceQueueDepth = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "bigip_resource_queue_depth",
+		Help: "Count of the resources waiting in the queue of the BigIP k8s CTLR",
+	},
+)
+
+var ResourceProcessingDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "bigip_resource_processing_duration_seconds",
+		Help:    "Time taken to process a resource from the queue of the BigIP k8s CTLR",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"kind"},
+)
+
+var BigIPActiveDevice = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "bigip_active_device",
+		Help: "Set to 1 for the BIG-IP of the HA group which the BigIP k8s CTLR posts to",
+	},
+	[]string{"url"},
+)
+
+var BigIPFailoverCount = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "bigip_failover_total",
+		Help: "Total count of the active BIG-IP changes of the HA group detected by the BigIP k8s CTLR",
+	},
+)
+
+var BigIPConfigSync = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "bigip_config_sync",
+		Help: "Set to 1 when the device group of the active BIG-IP is in sync",
+	},
+	[]string{"url"},
+)
+
+// lastSuccessfulPost holds the time in nanoseconds of the last AS3 declaration accepted by BIG-IP
+var lastSuccessfulPost = time.Now().UnixNano()
+
+// SetLastSuccessfulPost records that BIG-IP accepted an AS3 declaration
+func SetLastSuccessfulPost() {
+	atomic.StoreInt64(&lastSuccessfulPost, time.Now().UnixNano())
+}
+
 // further metrics? todo think about
 // RegisterMetrics registers all Prometheus metrics defined above
 func RegisterMetrics() {
@@ -38,4 +148,16 @@ func RegisterMetrics() {
 	prometheus.MustRegister(MonitoredNodes)
 	prometheus.MustRegister(MonitoredServices)
 	prometheus.MustRegister(CurrentErrors)
+	prometheus.MustRegister(ConfigurationDrift)
+	prometheus.MustRegister(ConfigurationDriftCount)
+	prometheus.MustRegister(AS3PostDuration)
+	prometheus.MustRegister(AS3DeclarationSize)
+	prometheus.MustRegister(AS3PostCount)
+	prometheus.MustRegister(LastSuccessfulPost)
+	prometheus.MustRegister(GTMWriteCount)
+	prometheus.MustRegister(ResourceQueueDepth)
+	prometheus.MustRegister(ResourceProcessingDuration)
+	prometheus.MustRegister(BigIPActiveDevice)
+	prometheus.MustRegister(BigIPFailoverCount)
+	prometheus.MustRegister(BigIPConfigSync)
 }
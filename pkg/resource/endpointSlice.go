@@ -0,0 +1,122 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resource
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+const (
+	// MemberSessionEnabled is the session of the pool members of ready endpoints
+	MemberSessionEnabled = "user-enabled"
+	// MemberSessionDisabled is the session of the pool members of terminating endpoints, drained by BIG-IP
+	MemberSessionDisabled = "user-disabled"
+)
+
+// EndpointPort identifies a port of the endpoints of a Service
+type EndpointPort struct {
+	Name string
+	Port int32
+}
+
+// GetEndpointSliceMembers returns the pool members of each port from the EndpointSlices of the Service
+// Ready endpoints are user-enabled, terminating endpoints which are still serving are user-disabled,
+// so that their connections are drained instead of being reset, other endpoints are excluded.
+// Only the slices of the address families of the Service are considered.
+func GetEndpointSliceMembers(
+	svc *v1.Service,
+	slices []*discoveryv1.EndpointSlice,
+	include func(endpoint discoveryv1.Endpoint) bool,
+) map[EndpointPort][]Member {
+	memberMap := make(map[EndpointPort][]Member)
+	added := make(map[EndpointPort]map[string]bool)
+	for _, slice := range slices {
+		if !isServiceAddressType(svc, slice.AddressType) {
+			continue
+		}
+		for _, p := range slice.Ports {
+			if p.Port == nil {
+				continue
+			}
+			portKey := EndpointPort{Port: *p.Port}
+			if p.Name != nil {
+				portKey.Name = *p.Name
+			}
+			if _, ok := added[portKey]; !ok {
+				added[portKey] = make(map[string]bool)
+				memberMap[portKey] = nil
+			}
+			for _, endpoint := range slice.Endpoints {
+				session, ok := getEndpointSession(endpoint.Conditions)
+				if !ok || (include != nil && !include(endpoint)) {
+					continue
+				}
+				for _, addr := range endpoint.Addresses {
+					// An endpoint might be available in multiple slices while they are updated
+					if added[portKey][addr] {
+						continue
+					}
+					added[portKey][addr] = true
+					memberMap[portKey] = append(memberMap[portKey], Member{
+						Address: addr,
+						Port:    *p.Port,
+						SvcPort: *p.Port,
+						Session: session,
+					})
+				}
+			}
+		}
+	}
+	for _, members := range memberMap {
+		sort.Slice(members, func(i, j int) bool {
+			return members[i].Address < members[j].Address
+		})
+	}
+	return memberMap
+}
+
+// getEndpointSession returns the session of the pool member for the conditions of the endpoint
+// A nil ready condition is interpreted as ready
+func getEndpointSession(conditions discoveryv1.EndpointConditions) (string, bool) {
+	if conditions.Ready == nil || *conditions.Ready {
+		return MemberSessionEnabled, true
+	}
+	if conditions.Serving != nil && *conditions.Serving &&
+		conditions.Terminating != nil && *conditions.Terminating {
+		return MemberSessionDisabled, true
+	}
+	return "", false
+}
+
+// isServiceAddressType returns true for the IPv4 and IPv6 slices of the IP families of the Service
+func isServiceAddressType(svc *v1.Service, addressType discoveryv1.AddressType) bool {
+	if addressType != discoveryv1.AddressTypeIPv4 && addressType != discoveryv1.AddressTypeIPv6 {
+		return false
+	}
+	if len(svc.Spec.IPFamilies) == 0 {
+		return true
+	}
+	for _, family := range svc.Spec.IPFamilies {
+		if string(family) == string(addressType) {
+			return true
+		}
+	}
+	return false
+}
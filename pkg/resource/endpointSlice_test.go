@@ -0,0 +1,124 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resource
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("EndpointSlice Members", func() {
+	var svc *v1.Service
+	boolPtr := func(b bool) *bool { return &b }
+	strPtr := func(s string) *string { return &s }
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	newSlice := func(name string, addrType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "svc1"},
+			},
+			AddressType: addrType,
+			Ports: []discoveryv1.EndpointPort{
+				{Name: strPtr("http"), Port: int32Ptr(8080)},
+			},
+			Endpoints: endpoints,
+		}
+	}
+	newEndpoint := func(addr string, ready, serving, terminating *bool) discoveryv1.Endpoint {
+		return discoveryv1.Endpoint{
+			Addresses: []string{addr},
+			Conditions: discoveryv1.EndpointConditions{
+				Ready:       ready,
+				Serving:     serving,
+				Terminating: terminating,
+			},
+			NodeName: strPtr("node1"),
+		}
+	}
+
+	BeforeEach(func() {
+		svc = &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: "default"},
+		}
+	})
+
+	It("Sets the session of the members from the endpoint conditions", func() {
+		slice := newSlice("svc1-abc", discoveryv1.AddressTypeIPv4,
+			newEndpoint("10.1.1.3", boolPtr(true), boolPtr(true), boolPtr(false)),
+			newEndpoint("10.1.1.1", nil, nil, nil),
+			newEndpoint("10.1.1.2", boolPtr(false), boolPtr(true), boolPtr(true)),
+			newEndpoint("10.1.1.4", boolPtr(false), boolPtr(false), boolPtr(true)),
+			newEndpoint("10.1.1.5", boolPtr(false), boolPtr(false), boolPtr(false)),
+		)
+		members := GetEndpointSliceMembers(svc, []*discoveryv1.EndpointSlice{slice}, nil)
+		Expect(members).To(HaveLen(1))
+		Expect(members[EndpointPort{Name: "http", Port: 8080}]).To(Equal([]Member{
+			{Address: "10.1.1.1", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+			{Address: "10.1.1.2", Port: 8080, SvcPort: 8080, Session: MemberSessionDisabled},
+			{Address: "10.1.1.3", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+		}), "Terminating endpoints which are not serving should be excluded")
+	})
+
+	It("Merges the slices of the service", func() {
+		ep := newEndpoint("10.1.1.1", boolPtr(true), nil, nil)
+		slices := []*discoveryv1.EndpointSlice{
+			newSlice("svc1-abc", discoveryv1.AddressTypeIPv4, ep),
+			newSlice("svc1-def", discoveryv1.AddressTypeIPv4, ep,
+				newEndpoint("10.1.1.2", boolPtr(true), nil, nil)),
+		}
+		members := GetEndpointSliceMembers(svc, slices, nil)
+		Expect(members[EndpointPort{Name: "http", Port: 8080}]).To(HaveLen(2),
+			"Endpoint available in multiple slices should be added once")
+	})
+
+	It("Filters the slices by the IP families of the service", func() {
+		slices := []*discoveryv1.EndpointSlice{
+			newSlice("svc1-v4", discoveryv1.AddressTypeIPv4, newEndpoint("10.1.1.1", nil, nil, nil)),
+			newSlice("svc1-v6", discoveryv1.AddressTypeIPv6, newEndpoint("2001:db8::1", nil, nil, nil)),
+			newSlice("svc1-fqdn", discoveryv1.AddressTypeFQDN, newEndpoint("app.example.com", nil, nil, nil)),
+		}
+		members := GetEndpointSliceMembers(svc, slices, nil)
+		Expect(members[EndpointPort{Name: "http", Port: 8080}]).To(HaveLen(2),
+			"Dual-stack members should be added")
+
+		svc.Spec.IPFamilies = []v1.IPFamily{v1.IPv6Protocol}
+		members = GetEndpointSliceMembers(svc, slices, nil)
+		Expect(members[EndpointPort{Name: "http", Port: 8080}]).To(Equal([]Member{
+			{Address: "2001:db8::1", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+		}))
+	})
+
+	It("Excludes the endpoints rejected by the filter", func() {
+		ep := newEndpoint("10.1.1.2", nil, nil, nil)
+		ep.NodeName = strPtr("node2")
+		slice := newSlice("svc1-abc", discoveryv1.AddressTypeIPv4,
+			newEndpoint("10.1.1.1", nil, nil, nil), ep)
+		members := GetEndpointSliceMembers(svc, []*discoveryv1.EndpointSlice{slice},
+			func(endpoint discoveryv1.Endpoint) bool {
+				return *endpoint.NodeName == "node1"
+			})
+		Expect(members[EndpointPort{Name: "http", Port: 8080}]).To(Equal([]Member{
+			{Address: "10.1.1.1", Port: 8080, SvcPort: 8080, Session: MemberSessionEnabled},
+		}))
+	})
+})
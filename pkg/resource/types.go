@@ -435,6 +435,9 @@ type (
 
 	ResourceResponse struct {
 		IsResponseSuccessful bool
+		// AS3 tenants drifted on BIG-IP, mapped to the AS3 ConfigMaps
+		// (namespace/name) declaring them
+		DriftedTenants map[string][]string
 	}
 
 	MessageRequest struct {
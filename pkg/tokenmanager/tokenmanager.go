@@ -0,0 +1,269 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tokenmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+const (
+	// DefaultLoginProvider is the BIG-IP login provider of local user accounts
+	DefaultLoginProvider = "tmos"
+	// TokenHeader carries the authentication token in iControl REST requests
+	TokenHeader = "X-F5-Auth-Token"
+
+	loginURI = "/mgmt/shared/authn/login"
+	// defaultTokenTimeout is the lifetime of a BIG-IP token when the login response does not provide one
+	defaultTokenTimeout = 1200 * time.Second
+	// refreshWindow renews the token before it expires on BIG-IP
+	refreshWindow = 60 * time.Second
+	// loginTimeout bounds the login, so that an unreachable BIG-IP does not hold up the requests
+	loginTimeout = 30 * time.Second
+)
+
+// TokenManager requests and caches the authentication token of a BIG-IP user account
+// Tokens are cached per BIG-IP, so that the devices of an HA group share the credentials
+type TokenManager struct {
+	sync.Mutex
+	url           string
+	username      string
+	password      string
+	loginProvider string
+	tokens        map[string]token
+	// logins in progress per BIG-IP, shared by the requests waiting for the token
+	logins map[string]*loginCall
+	// generation changes with the credentials, so that logins with the old ones are not cached
+	generation int
+	// now returns the current time, overridden in tests
+	now func() time.Time
+}
+
+type token struct {
+	value  string
+	expiry time.Time
+}
+
+// loginCall is a login in progress, done is closed once value and err are set
+type loginCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+type loginRequest struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	LoginProviderName string `json:"loginProviderName"`
+}
+
+type loginResponse struct {
+	Token struct {
+		Token   string `json:"token"`
+		Timeout int    `json:"timeout"`
+	} `json:"token"`
+}
+
+// NewTokenManager returns a TokenManager authenticating against the BIG-IP at url
+func NewTokenManager(url, username, password, loginProvider string) *TokenManager {
+	if loginProvider == "" {
+		loginProvider = DefaultLoginProvider
+	}
+	return &TokenManager{
+		url:           url,
+		username:      username,
+		password:      password,
+		loginProvider: loginProvider,
+		tokens:        make(map[string]token),
+		logins:        make(map[string]*loginCall),
+		now:           time.Now,
+	}
+}
+
+// UpdateCredentials replaces the user account credentials, the next request logs in again
+func (tm *TokenManager) UpdateCredentials(username, password string) {
+	tm.Lock()
+	defer tm.Unlock()
+	if tm.username == username && tm.password == password {
+		return
+	}
+	log.Infof("[AUTH] BIG-IP credentials updated, requesting a new authentication token")
+	tm.username = username
+	tm.password = password
+	tm.tokens = make(map[string]token)
+	tm.generation++
+}
+
+// Transport returns a RoundTripper adding the authentication token to the requests sent over base
+func (tm *TokenManager) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &tokenTransport{tokenManager: tm, base: base}
+}
+
+// getToken returns the cached token of the BIG-IP at url, logging in when it is missing or about to expire
+// The login runs without holding the lock and only once per BIG-IP, the concurrent requests wait for it
+func (tm *TokenManager) getToken(ctx context.Context, rt http.RoundTripper, url string) (string, error) {
+	tm.Lock()
+	if t, ok := tm.tokens[url]; ok && tm.now().Add(refreshWindow).Before(t.expiry) {
+		tm.Unlock()
+		return t.value, nil
+	}
+	call, ok := tm.logins[url]
+	if !ok {
+		call = &loginCall{done: make(chan struct{})}
+		tm.logins[url] = call
+		go tm.login(rt, url, call, loginRequest{
+			Username:          tm.username,
+			Password:          tm.password,
+			LoginProviderName: tm.loginProvider,
+		}, tm.generation)
+	}
+	tm.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// invalidate drops the token rejected by BIG-IP unless it has already been renewed
+func (tm *TokenManager) invalidate(url, value string) {
+	tm.Lock()
+	defer tm.Unlock()
+	if tm.tokens[url].value == value {
+		delete(tm.tokens, url)
+	}
+}
+
+// login requests a token of the BIG-IP at url and caches it unless the credentials have changed meanwhile
+func (tm *TokenManager) login(rt http.RoundTripper, url string, call *loginCall, login loginRequest, generation int) {
+	value, timeout, err := requestToken(rt, url, login)
+
+	tm.Lock()
+	delete(tm.logins, url)
+	if err != nil {
+		delete(tm.tokens, url)
+	} else if generation == tm.generation {
+		tm.tokens[url] = token{value: value, expiry: tm.now().Add(timeout)}
+		log.Debugf("[AUTH] Received BIG-IP authentication token of %v valid for %v", url, timeout)
+	}
+	call.value, call.err = value, err
+	close(call.done)
+	tm.Unlock()
+}
+
+// requestToken logs in to the BIG-IP at url and returns the token along with its lifetime
+func requestToken(rt http.RoundTripper, url string, login loginRequest) (string, time.Duration, error) {
+	body, err := json.Marshal(login)
+	if err != nil {
+		return "", 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url+loginURI, bytes.NewBuffer(body))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := rt.RoundTrip(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("BIG-IP login failed: %v", err)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("BIG-IP login failed: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("BIG-IP login failed with status code %v", httpResp.StatusCode)
+	}
+
+	var response loginResponse
+	if err = json.Unmarshal(respBody, &response); err != nil {
+		return "", 0, fmt.Errorf("BIG-IP login response unmarshal failed: %v", err)
+	}
+	if response.Token.Token == "" {
+		return "", 0, fmt.Errorf("BIG-IP login response does not contain a token")
+	}
+	timeout := defaultTokenTimeout
+	if response.Token.Timeout > 0 {
+		timeout = time.Duration(response.Token.Timeout) * time.Second
+	}
+	return response.Token.Token, timeout, nil
+}
+
+type tokenTransport struct {
+	tokenManager *TokenManager
+	base         http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests are authenticated with the token of the BIG-IP they are sent to
+	url := t.tokenManager.url
+	if req.URL.Host != "" {
+		url = req.URL.Scheme + "://" + req.URL.Host
+	}
+	token, err := t.tokenManager.getToken(req.Context(), t.base, url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(withToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// The token was revoked or expired on BIG-IP, log in again and retry the request once
+	retry := withToken(req, "")
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	t.tokenManager.invalidate(url, token)
+	if token, err = t.tokenManager.getToken(req.Context(), t.base, url); err != nil {
+		log.Errorf("[AUTH] %v", err)
+		return resp, nil
+	}
+	resp.Body.Close()
+	retry.Header.Set(TokenHeader, token)
+	return t.base.RoundTrip(retry)
+}
+
+// withToken returns a copy of the request carrying the token instead of any basic auth credentials
+func withToken(req *http.Request, token string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Del("Authorization")
+	if token != "" {
+		r.Header.Set(TokenHeader, token)
+	}
+	return r
+}
@@ -0,0 +1,203 @@
+/*-
+ * Copyright (c) 2016-2021, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tokenmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token Manager", func() {
+	var server *httptest.Server
+	var tm *TokenManager
+	var client *http.Client
+	var logins []loginRequest
+	var validToken string
+	var bodies []string
+	var now time.Time
+
+	BeforeEach(func() {
+		logins = nil
+		bodies = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == loginURI {
+				var login loginRequest
+				json.NewDecoder(r.Body).Decode(&login)
+				logins = append(logins, login)
+				if login.Password != "pswd" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				validToken = fmt.Sprintf("token%d", len(logins))
+				fmt.Fprintf(w, `{"token":{"token":"%s","timeout":600}}`, validToken)
+				return
+			}
+			if _, _, ok := r.BasicAuth(); ok || r.Header.Get(TokenHeader) != validToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.WriteHeader(http.StatusOK)
+		}))
+		now = time.Now()
+		tm = NewTokenManager(server.URL, "user", "pswd", "")
+		tm.now = func() time.Time { return now }
+		client = &http.Client{Transport: tm.Transport(nil)}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	post := func(data string) *http.Response {
+		req, err := http.NewRequest("POST", server.URL+"/mgmt/shared/appsvcs/declare", bytes.NewBufferString(data))
+		Expect(err).To(BeNil())
+		req.SetBasicAuth("user", "pswd")
+		resp, err := client.Do(req)
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		return resp
+	}
+
+	It("Authenticate requests with a token", func() {
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(1), "Token should be reused")
+		Expect(logins[0]).To(Equal(loginRequest{Username: "user", Password: "pswd",
+			LoginProviderName: DefaultLoginProvider}))
+	})
+
+	It("Refresh the token before expiry", func() {
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		now = now.Add(590 * time.Second)
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(2))
+	})
+
+	It("Log in again when the token is rejected", func() {
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		// Token revoked on BIG-IP
+		validToken = "revoked"
+		Expect(post("retried").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(2))
+		Expect(bodies).To(Equal([]string{"decl", "retried"}), "Request body should be replayed")
+	})
+
+	It("Use updated credentials", func() {
+		tm.UpdateCredentials("user", "wrong")
+		resp, err := client.Get(server.URL + "/mgmt/shared/appsvcs/info")
+		Expect(err).NotTo(BeNil(), "Login with invalid credentials should fail")
+		Expect(resp).To(BeNil())
+
+		tm.UpdateCredentials("admin", "pswd")
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(2))
+		Expect(logins[1].Username).To(Equal("admin"))
+
+		tm.UpdateCredentials("admin", "pswd")
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(2), "Unchanged credentials should keep the token")
+	})
+
+	It("Log in to each BIG-IP of the HA group", func() {
+		var standbyLogins int
+		standby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == loginURI {
+				standbyLogins++
+				fmt.Fprint(w, `{"token":{"token":"standby","timeout":600}}`)
+				return
+			}
+			if r.Header.Get(TokenHeader) != "standby" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer standby.Close()
+
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		resp, err := client.Get(standby.URL + "/mgmt/tm/cm/failover-status")
+		Expect(err).To(BeNil())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK), "Token of a BIG-IP should not be used on another")
+		Expect(standbyLogins).To(Equal(1))
+
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+		Expect(logins).To(HaveLen(1), "Token of each BIG-IP should be reused")
+	})
+
+	It("Log in once per BIG-IP without blocking the requests to other BIG-IPs", func() {
+		var slowLogins int32
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == loginURI {
+				atomic.AddInt32(&slowLogins, 1)
+				<-release
+				fmt.Fprint(w, `{"token":{"token":"slow","timeout":600}}`)
+				return
+			}
+			if r.Header.Get(TokenHeader) != "slow" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer slow.Close()
+		Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+
+		statuses := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				resp, err := client.Get(slow.URL + "/mgmt/tm/cm/failover-status")
+				if err != nil {
+					statuses <- 0
+					return
+				}
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}()
+		}
+		Eventually(func() int32 { return atomic.LoadInt32(&slowLogins) }).Should(Equal(int32(1)))
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(post("decl").StatusCode).To(Equal(http.StatusOK))
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed(), "Login to a BIG-IP should not block the requests to another")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", slow.URL+"/mgmt/tm/cm/failover-status", nil)
+		_, err := client.Do(req)
+		Expect(err).NotTo(BeNil(), "Request should not wait for the login beyond its deadline")
+
+		close(release)
+		for i := 0; i < 3; i++ {
+			Eventually(statuses).Should(Receive(Equal(http.StatusOK)))
+		}
+		Expect(atomic.LoadInt32(&slowLogins)).To(Equal(int32(1)), "Concurrent requests should share the login")
+	})
+})